@@ -0,0 +1,82 @@
+package cmdbreach
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/askuy/passwordx/backend/cmd"
+	"github.com/gotomicro/ego"
+	"github.com/gotomicro/ego/core/econf"
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/spf13/cobra"
+
+	"github.com/askuy/passwordx/backend/internal/pkg/breach"
+)
+
+var CmdRun = &cobra.Command{
+	Use:   "breach-import <corpus> [index]",
+	Short: "import a breached password corpus",
+	Long: `import a Pwned Passwords style SHA-1 corpus ("HASH:COUNT" per line) into the
+breach index at [breach] indexPath, or at the given index path`,
+	Run:                CmdFunc,
+	DisableFlagParsing: true,
+}
+
+func init() {
+	cmd.RootCommand.AddCommand(CmdRun)
+}
+
+func CmdFunc(cmd *cobra.Command, args []string) {
+	if err := ego.New().
+		Invoker(func() error {
+			return importCorpus(positionalArgs(args))
+		}).
+		Run(); err != nil {
+		elog.Panic("startup failed", elog.FieldErr(err))
+	}
+}
+
+// positionalArgs drops the flags ego parses itself, such as --config
+func positionalArgs(args []string) []string {
+	var positional []string
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			positional = append(positional, arg)
+		}
+	}
+	return positional
+}
+
+func importCorpus(args []string) error {
+	if len(args) == 0 {
+		fmt.Println("Usage: passwordx breach-import --config=config/config.toml <corpus> [index]")
+		os.Exit(1)
+	}
+
+	indexPath := econf.GetString("breach.indexPath")
+	if len(args) > 1 {
+		indexPath = args[1]
+	}
+	if indexPath == "" {
+		return errors.New("no index path: set [breach] indexPath or pass it as the second argument")
+	}
+
+	corpus, err := os.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to open corpus: %w", err)
+	}
+	defer corpus.Close()
+
+	start := time.Now()
+	count, err := breach.Build(indexPath, corpus)
+	if err != nil {
+		return fmt.Errorf("failed to import corpus: %w", err)
+	}
+
+	fmt.Printf("Imported %d hashes into %s in %s\n", count, indexPath, time.Since(start).Round(time.Second))
+	fmt.Println("Restart the server to load the new index.")
+	return nil
+}
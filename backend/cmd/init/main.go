@@ -116,15 +116,20 @@ func initUser() error {
 	}
 
 	// Create super admin user
+	kdf := crypto.DefaultKDFParams()
 	user := &model.User{
-		TenantID:      tenant.ID,
-		Email:         strings.ToLower(email),
-		Name:          name,
-		PasswordHash:  passwordHash,
-		MasterKeySalt: salt,
-		Role:          model.UserRoleSuperAdmin,
-		AccountType:   model.AccountTypeTeam,
-		Status:        model.UserStatusActive,
+		TenantID:       tenant.ID,
+		Email:          strings.ToLower(email),
+		Name:           name,
+		PasswordHash:   passwordHash,
+		MasterKeySalt:  salt,
+		KDFAlgorithm:   kdf.Algorithm,
+		KDFIterations:  kdf.Iterations,
+		KDFMemory:      kdf.Memory,
+		KDFParallelism: kdf.Parallelism,
+		Role:           model.UserRoleSuperAdmin,
+		AccountType:    model.AccountTypeTeam,
+		Status:         model.UserStatusActive,
 	}
 
 	if err := userRepo.Create(stdCtx, user); err != nil {
@@ -4,6 +4,7 @@ import (
 	"github.com/gotomicro/ego"
 	"github.com/gotomicro/ego/core/elog"
 	"github.com/gotomicro/ego/server/egin"
+	"github.com/gotomicro/ego/task/ecron"
 
 	"github.com/askuy/passwordx/backend/internal/handler"
 	"github.com/askuy/passwordx/backend/internal/middleware"
@@ -15,6 +16,7 @@ func Server() {
 	if err := ego.New().
 		Invoker(initDependencies).
 		Serve(newHTTPServer()).
+		Cron(newTrashPurgeCron()).
 		Run(); err != nil {
 		elog.Panic("startup failed", elog.FieldErr(err))
 	}
@@ -25,11 +27,26 @@ var (
 	tenantHandler     *handler.TenantHandler
 	vaultHandler      *handler.VaultHandler
 	credentialHandler *handler.CredentialHandler
+	attachmentHandler *handler.AttachmentHandler
+	revisionHandler   *handler.RevisionHandler
+	trashHandler      *handler.TrashHandler
+	folderHandler     *handler.FolderHandler
+	domainHandler     *handler.DomainHandler
 	userHandler       *handler.UserHandler
+	accountHandler    *handler.AccountHandler
+	recoveryHandler   *handler.RecoveryHandler
+	escrowHandler     *handler.EscrowHandler
+	generatorHandler  *handler.GeneratorHandler
+	itemTypeHandler   *handler.ItemTypeHandler
+	policyHandler     *handler.PasswordPolicyHandler
+	breachHandler     *handler.BreachHandler
+	twoFactorHandler  *handler.TwoFactorHandler
+	webauthnHandler   *handler.WebAuthnHandler
 	settingsHandler   *handler.SettingsHandler
 	authMiddleware    *middleware.AuthMiddleware
 	userRepo          *repository.UserRepository
 	tenantRepo        *repository.TenantRepository
+	trashService      *service.TrashService
 )
 
 func initDependencies() error {
@@ -42,24 +59,73 @@ func initDependencies() error {
 	vaultRepo := repository.NewVaultRepository(db)
 	credentialRepo := repository.NewCredentialRepository(db)
 	vaultMemberRepo := repository.NewVaultMemberRepository(db)
+	challengeRepo := repository.NewAuthChallengeRepository(db)
+	recoveryRepo := repository.NewRecoveryKeyRepository(db)
+	escrowRepo := repository.NewEscrowRepository(db)
+	escrowRequestRepo := repository.NewEscrowRequestRepository(db)
+	twoFactorRepo := repository.NewTwoFactorRepository(db)
+	webauthnRepo := repository.NewWebAuthnRepository(db)
+	attachmentRepo := repository.NewAttachmentRepository(db)
+	revisionRepo := repository.NewCredentialRevisionRepository(db)
+	folderRepo := repository.NewFolderRepository(db)
+	tagRepo := repository.NewTagRepository(db)
+	metadataRepo := repository.NewCredentialMetadataRepository(db)
+	domainRepo := repository.NewEquivalentDomainRepository(db)
 
 	// Initialize services
-	authService := service.NewAuthService(userRepo, tenantRepo)
+	breachService, err := service.NewBreachService()
+	if err != nil {
+		return err
+	}
+	twoFactorService, err := service.NewTwoFactorService(userRepo, tenantRepo, twoFactorRepo, webauthnRepo)
+	if err != nil {
+		return err
+	}
+	authService := service.NewAuthService(userRepo, tenantRepo, challengeRepo, breachService, twoFactorService)
+	webauthnService, err := service.NewWebAuthnService(userRepo, tenantRepo, webauthnRepo, challengeRepo, authService, twoFactorService)
+	if err != nil {
+		return err
+	}
+	attachmentService, err := service.NewAttachmentService(attachmentRepo, credentialRepo, vaultRepo, vaultMemberRepo, tenantRepo)
+	if err != nil {
+		return err
+	}
 	tenantService := service.NewTenantService(tenantRepo, userRepo)
-	vaultService := service.NewVaultService(vaultRepo, vaultMemberRepo)
-	credentialService := service.NewCredentialService(credentialRepo, vaultMemberRepo)
-	userService := service.NewUserService(userRepo, tenantRepo)
+	vaultService := service.NewVaultService(vaultRepo, vaultMemberRepo, userRepo)
+	folderService := service.NewFolderService(folderRepo, tagRepo, credentialRepo, vaultMemberRepo)
+	credentialService := service.NewCredentialService(credentialRepo, vaultRepo, vaultMemberRepo, tenantRepo, revisionRepo, metadataRepo, folderService)
+	domainService := service.NewDomainService(domainRepo)
+	trashService = service.NewTrashService(credentialRepo, vaultRepo, vaultMemberRepo, attachmentService)
+	userService := service.NewUserService(userRepo, tenantRepo, vaultMemberRepo, breachService)
+	accountService := service.NewAccountService(userRepo, vaultMemberRepo, challengeRepo)
+	recoveryService := service.NewRecoveryService(userRepo, tenantRepo, vaultMemberRepo, recoveryRepo, challengeRepo)
+	escrowService := service.NewEscrowService(userRepo, tenantRepo, escrowRepo, escrowRequestRepo)
+	policyService := service.NewPasswordPolicyService(userRepo, tenantRepo)
 
 	// Initialize handlers
 	authHandler = handler.NewAuthHandler(authService)
 	tenantHandler = handler.NewTenantHandler(tenantService)
 	vaultHandler = handler.NewVaultHandler(vaultService)
 	credentialHandler = handler.NewCredentialHandler(credentialService)
+	attachmentHandler = handler.NewAttachmentHandler(attachmentService)
+	revisionHandler = handler.NewRevisionHandler(credentialService)
+	trashHandler = handler.NewTrashHandler(trashService)
+	folderHandler = handler.NewFolderHandler(folderService)
+	domainHandler = handler.NewDomainHandler(domainService)
 	userHandler = handler.NewUserHandler(userService, userRepo, tenantRepo)
+	accountHandler = handler.NewAccountHandler(accountService)
+	recoveryHandler = handler.NewRecoveryHandler(recoveryService)
+	escrowHandler = handler.NewEscrowHandler(escrowService)
+	generatorHandler = handler.NewGeneratorHandler()
+	itemTypeHandler = handler.NewItemTypeHandler()
+	policyHandler = handler.NewPasswordPolicyHandler(policyService)
+	breachHandler = handler.NewBreachHandler(breachService)
+	twoFactorHandler = handler.NewTwoFactorHandler(twoFactorService)
+	webauthnHandler = handler.NewWebAuthnHandler(webauthnService)
 	settingsHandler = handler.NewSettingsHandler()
 
 	// Initialize middleware
-	authMiddleware = middleware.NewAuthMiddleware()
+	authMiddleware = middleware.NewAuthMiddleware(userRepo)
 
 	return nil
 }
@@ -79,7 +145,19 @@ func newHTTPServer() *egin.Component {
 		auth := api.Group("/auth")
 		{
 			auth.POST("/register", authHandler.Register)
+			auth.POST("/prelogin", authHandler.Prelogin)
+			auth.GET("/password-policy", policyHandler.GetDefault)
 			auth.POST("/login", authHandler.Login)
+			auth.POST("/srp/init", authHandler.SRPInit)
+			auth.POST("/srp/verify", authHandler.SRPVerify)
+			auth.POST("/2fa/verify", authHandler.VerifyTwoFactor)
+			auth.POST("/2fa/enroll", authHandler.BeginTwoFactorEnrollment)
+			auth.POST("/2fa/enroll/confirm", authHandler.ConfirmTwoFactorEnrollment)
+			auth.POST("/webauthn/login/begin", webauthnHandler.BeginLogin)
+			auth.POST("/webauthn/login/finish", webauthnHandler.FinishLogin)
+			auth.POST("/recovery/init", recoveryHandler.Init)
+			auth.POST("/recovery/verify", recoveryHandler.Verify)
+			auth.POST("/recovery/reset", recoveryHandler.Reset)
 			auth.GET("/oauth/:provider", authHandler.OAuthLogin)
 			auth.GET("/oauth/:provider/callback", authHandler.OAuthCallback)
 		}
@@ -92,6 +170,33 @@ func newHTTPServer() *egin.Component {
 		// User routes (get current user info)
 		protected.GET("/me", userHandler.GetMe)
 
+		// Account key material
+		protected.GET("/me/keys", accountHandler.GetKeys)
+		protected.PUT("/me/keys", accountHandler.SetKeys)
+		protected.PUT("/me/kdf", accountHandler.UpgradeKDF)
+		protected.POST("/me/password", accountHandler.ChangePassword)
+		protected.GET("/users/:id/public-key", accountHandler.GetPublicKey)
+
+		// Account recovery
+		protected.GET("/me/recovery", recoveryHandler.GetStatus)
+		protected.PUT("/me/recovery", recoveryHandler.SetRecoveryKey)
+		protected.GET("/me/emergency-kit", recoveryHandler.EmergencyKit)
+		protected.GET("/me/escrow", escrowHandler.GetPolicy)
+		protected.PUT("/me/escrow", escrowHandler.Enroll)
+
+		// Two-factor authentication
+		protected.GET("/me/2fa", twoFactorHandler.GetStatus)
+		protected.POST("/me/2fa/enroll", twoFactorHandler.Enroll)
+		protected.POST("/me/2fa/confirm", twoFactorHandler.Confirm)
+		protected.POST("/me/2fa/recovery-codes", twoFactorHandler.RegenerateRecoveryCodes)
+		protected.POST("/me/2fa/disable", twoFactorHandler.Disable)
+
+		// Security keys
+		protected.POST("/auth/webauthn/register/begin", webauthnHandler.BeginRegistration)
+		protected.POST("/auth/webauthn/register/finish", webauthnHandler.FinishRegistration)
+		protected.GET("/me/webauthn", webauthnHandler.List)
+		protected.DELETE("/me/webauthn/:id", webauthnHandler.Delete)
+
 		// Tenant routes
 		tenants := protected.Group("/tenants")
 		{
@@ -110,6 +215,8 @@ func newHTTPServer() *egin.Component {
 			vaults.GET("/:id", vaultHandler.Get)
 			vaults.PUT("/:id", vaultHandler.Update)
 			vaults.DELETE("/:id", vaultHandler.Delete)
+			vaults.GET("/:id/key", vaultHandler.GetKey)
+			vaults.POST("/:id/rotate", vaultHandler.RotateKey)
 			vaults.POST("/:id/members", vaultHandler.AddMember)
 			vaults.DELETE("/:id/members/:userId", vaultHandler.RemoveMember)
 
@@ -119,7 +226,80 @@ func newHTTPServer() *egin.Component {
 			vaults.GET("/:id/credentials/:credId", credentialHandler.Get)
 			vaults.PUT("/:id/credentials/:credId", credentialHandler.Update)
 			vaults.DELETE("/:id/credentials/:credId", credentialHandler.Delete)
+
+			// Where the current user files a credential
+			vaults.PUT("/:id/credentials/:credId/folder", folderHandler.SetCredentialFolder)
+			vaults.PUT("/:id/credentials/:credId/tags", folderHandler.SetCredentialTags)
+
+			// The current user's favorites and usage
+			vaults.PUT("/:id/credentials/:credId/favorite", credentialHandler.SetFavorite)
+			vaults.POST("/:id/credentials/:credId/usage", credentialHandler.ReportUsage)
+
+			// Attachment routes (nested under credentials)
+			vaults.POST("/:id/credentials/:credId/attachments", attachmentHandler.Upload)
+			vaults.GET("/:id/credentials/:credId/attachments", attachmentHandler.List)
+			vaults.GET("/:id/credentials/:credId/attachments/:attachmentId", attachmentHandler.Download)
+			vaults.DELETE("/:id/credentials/:credId/attachments/:attachmentId", attachmentHandler.Delete)
+
+			// Revision history routes (nested under credentials)
+			vaults.GET("/:id/credentials/:credId/revisions", revisionHandler.List)
+			vaults.GET("/:id/credentials/:credId/revisions/:revision", revisionHandler.Get)
+			vaults.POST("/:id/credentials/:credId/revisions/:revision/restore", revisionHandler.Restore)
+
+			// Trash of deleted credentials
+			vaults.GET("/:id/trash", trashHandler.ListCredentials)
+			vaults.POST("/:id/trash/:credId/restore", trashHandler.RestoreCredential)
+			vaults.DELETE("/:id/trash/:credId", trashHandler.DeleteCredential)
+		}
+
+		// Trash of deleted vaults
+		trash := protected.Group("/trash")
+		{
+			trash.GET("/vaults", trashHandler.ListVaults)
+			trash.POST("/vaults/:id/restore", trashHandler.RestoreVault)
+			trash.DELETE("/vaults/:id", trashHandler.DeleteVault)
+		}
+
+		// The current user's folders and tags
+		folders := protected.Group("/folders")
+		{
+			folders.GET("", folderHandler.ListFolders)
+			folders.POST("", folderHandler.CreateFolder)
+			folders.PUT("/:id", folderHandler.UpdateFolder)
+			folders.DELETE("/:id", folderHandler.DeleteFolder)
 		}
+		tags := protected.Group("/tags")
+		{
+			tags.GET("", folderHandler.ListTags)
+			tags.POST("", folderHandler.CreateTag)
+			tags.PUT("/:id", folderHandler.UpdateTag)
+			tags.DELETE("/:id", folderHandler.DeleteTag)
+		}
+
+		// Equivalent domains and match modes for autofill
+		domains := protected.Group("/domains")
+		{
+			domains.GET("/match-modes", domainHandler.MatchModes)
+			domains.GET("/equivalents", domainHandler.List)
+			domains.POST("/equivalents", domainHandler.Create)
+			domains.PUT("/equivalents/:id", domainHandler.Update)
+			domains.DELETE("/equivalents/:id", domainHandler.Delete)
+		}
+
+		// Password and passphrase generator
+		protected.POST("/generator", generatorHandler.Generate)
+		protected.GET("/generator/wordlist", generatorHandler.Wordlist)
+
+		// Item type schemas
+		protected.GET("/item-types", itemTypeHandler.List)
+		protected.GET("/item-types/:type", itemTypeHandler.Get)
+
+		// Password strength and policy
+		protected.POST("/password-strength", policyHandler.Evaluate)
+		protected.GET("/password-policy", policyHandler.Get)
+
+		// Breached password k-anonymity lookups
+		protected.GET("/breach/range/:prefix", breachHandler.Range)
 
 		// Search credentials across all vaults
 		protected.GET("/credentials/search", credentialHandler.Search)
@@ -137,9 +317,48 @@ func newHTTPServer() *egin.Component {
 				users.PUT("/:id", userHandler.Update)
 				users.DELETE("/:id", userHandler.Delete)
 				users.POST("/:id/reset-password", userHandler.ResetPassword)
+				users.POST("/:id/reset-2fa", twoFactorHandler.Reset)
+			}
+
+			admin.GET("/two-factor-policy", twoFactorHandler.GetPolicy)
+			admin.PUT("/two-factor-policy", twoFactorHandler.SetPolicy)
+			admin.PUT("/password-policy", policyHandler.Set)
+			admin.DELETE("/password-policy", policyHandler.Reset)
+			admin.GET("/attachment-quota", attachmentHandler.GetQuota)
+			admin.PUT("/attachment-quota", attachmentHandler.SetQuota)
+			admin.DELETE("/attachment-quota", attachmentHandler.ResetQuota)
+			admin.GET("/revision-policy", revisionHandler.GetPolicy)
+			admin.PUT("/revision-policy", revisionHandler.SetPolicy)
+			admin.DELETE("/revision-policy", revisionHandler.ResetPolicy)
+			admin.GET("/equivalent-domains", domainHandler.ListTenant)
+			admin.POST("/equivalent-domains", domainHandler.CreateTenant)
+			admin.PUT("/equivalent-domains/:id", domainHandler.UpdateTenant)
+			admin.DELETE("/equivalent-domains/:id", domainHandler.DeleteTenant)
+
+			// Organization escrow recovery
+			escrow := admin.Group("/escrow")
+			{
+				escrow.GET("", escrowHandler.GetConfig)
+				escrow.PUT("", escrowHandler.Configure)
+				escrow.DELETE("", escrowHandler.Disable)
+				escrow.POST("/changes/:id/approve", escrowHandler.ApproveChange)
+				escrow.POST("/changes/:id/cancel", escrowHandler.CancelChange)
+				escrow.GET("/share", escrowHandler.GetShare)
+				escrow.GET("/requests", escrowHandler.ListRequests)
+				escrow.POST("/requests", escrowHandler.CreateRequest)
+				escrow.GET("/requests/:id", escrowHandler.GetRequest)
+				escrow.POST("/requests/:id/approve", escrowHandler.Approve)
+				escrow.POST("/requests/:id/complete", escrowHandler.Complete)
+				escrow.POST("/requests/:id/cancel", escrowHandler.Cancel)
 			}
 		}
 	}
 
 	return server
 }
+
+// newTrashPurgeCron permanently deletes what has been in the trash for
+// longer than [trash] retentionDays
+func newTrashPurgeCron() *ecron.Component {
+	return ecron.Load("cron.trashPurge").Build(ecron.WithJob(trashService.Purge))
+}
@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/askuy/passwordx/backend/internal/middleware"
+	"github.com/askuy/passwordx/backend/internal/pkg/crypto"
+	"github.com/askuy/passwordx/backend/internal/service"
+)
+
+type AccountHandler struct {
+	accountService *service.AccountService
+}
+
+func NewAccountHandler(accountService *service.AccountService) *AccountHandler {
+	return &AccountHandler{
+		accountService: accountService,
+	}
+}
+
+// GetKeys returns the current user's key material
+func (h *AccountHandler) GetKeys(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	keys, err := h.accountService.GetKeys(c.Request.Context(), userID)
+	if err != nil {
+		if err == service.ErrUserNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// SetKeys uploads the current user's keypair
+func (h *AccountHandler) SetKeys(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	var req service.SetKeysRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.accountService.SetKeys(c.Request.Context(), userID, &req); err != nil {
+		switch err {
+		case crypto.ErrInvalidPublicKey:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid public key"})
+		case service.ErrKeysAlreadySet:
+			c.JSON(http.StatusConflict, gin.H{"error": "encryption keypair already set"})
+		case service.ErrUserNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "keys saved"})
+}
+
+// GetPublicKey returns another user's public key
+func (h *AccountHandler) GetPublicKey(c *gin.Context) {
+	tenantID := middleware.GetTenantID(c)
+
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	key, err := h.accountService.GetPublicKey(c.Request.Context(), tenantID, userID)
+	if err != nil {
+		switch err {
+		case service.ErrUserNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		case service.ErrMemberKeyMissing:
+			c.JSON(http.StatusNotFound, gin.H{"error": "user has not set up an encryption keypair"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, key)
+}
+
+// UpgradeKDF upgrades the current user's key derivation parameters
+func (h *AccountHandler) UpgradeKDF(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	var req service.UpgradeKDFRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.accountService.UpgradeKDF(c.Request.Context(), userID, &req); err != nil {
+		switch err {
+		case service.ErrInvalidCredentials:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "current password is incorrect"})
+		case service.ErrInvalidKDFSettings, service.ErrKDFDowngrade, service.ErrKeysRequired, service.ErrInvalidVerifier:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case service.ErrLegacyVaults:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case service.ErrUserNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		case service.ErrServerBusy:
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "KDF parameters upgraded"})
+}
+
+// ChangePassword changes the current user's master password
+func (h *AccountHandler) ChangePassword(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	var req service.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.accountService.ChangePassword(c.Request.Context(), userID, &req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCiphertext) || errors.Is(err, service.ErrInvalidItem) || errors.Is(err, service.ErrInvalidCustomFields) || errors.Is(err, service.ErrInvalidAttachments) || errors.Is(err, service.ErrInvalidRevisions) || errors.Is(err, service.ErrInvalidSearchToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		switch err {
+		case service.ErrInvalidCredentials:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "current password is incorrect"})
+		case service.ErrInvalidSalt, service.ErrInvalidVerifier, service.ErrInvalidKDFSettings, service.ErrKDFDowngrade,
+			service.ErrKeysRequired, service.ErrItemIDRequired, service.ErrItemIDImmutable:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case service.ErrIncompleteBatch:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case service.ErrUserNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		case service.ErrServerBusy:
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/askuy/passwordx/backend/internal/middleware"
+	"github.com/askuy/passwordx/backend/internal/service"
+)
+
+// maxUploadOverhead is what an upload may carry besides the blob: the
+// multipart framing and the metadata fields
+const maxUploadOverhead = 64 << 10
+
+type AttachmentHandler struct {
+	attachmentService *service.AttachmentService
+}
+
+func NewAttachmentHandler(attachmentService *service.AttachmentService) *AttachmentHandler {
+	return &AttachmentHandler{
+		attachmentService: attachmentService,
+	}
+}
+
+// attachmentParams parses the vault, credential and attachment IDs of a
+// request; the attachment ID only when the route has one
+func attachmentParams(c *gin.Context) (vaultID, credID, attachmentID int64, ok bool) {
+	vaultID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid vault ID"})
+		return 0, 0, 0, false
+	}
+	credID, err = strconv.ParseInt(c.Param("credId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid credential ID"})
+		return 0, 0, 0, false
+	}
+	if c.Param("attachmentId") != "" {
+		attachmentID, err = strconv.ParseInt(c.Param("attachmentId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid attachment ID"})
+			return 0, 0, 0, false
+		}
+	}
+	return vaultID, credID, attachmentID, true
+}
+
+// Upload attaches an encrypted file to a credential. The request is
+// multipart/form-data with the fields of service.UploadAttachmentRequest and
+// the encrypted blob in the "file" part.
+func (h *AttachmentHandler) Upload(c *gin.Context) {
+	vaultID, credID, _, ok := attachmentParams(c)
+	if !ok {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.attachmentService.MaxFileSize()+maxUploadOverhead)
+
+	var req service.UploadAttachmentRequest
+	if err := c.ShouldBind(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": service.ErrAttachmentTooLarge.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	attachment, err := h.attachmentService.Upload(c.Request.Context(), vaultID, credID, middleware.GetUserID(c), &req, file, header.Size)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, attachment)
+}
+
+// List returns the attachments of a credential
+func (h *AttachmentHandler) List(c *gin.Context) {
+	vaultID, credID, _, ok := attachmentParams(c)
+	if !ok {
+		return
+	}
+
+	attachments, err := h.attachmentService.List(c.Request.Context(), vaultID, credID, middleware.GetUserID(c))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"attachments": attachments})
+}
+
+// Download streams the encrypted blob of an attachment
+func (h *AttachmentHandler) Download(c *gin.Context) {
+	vaultID, credID, attachmentID, ok := attachmentParams(c)
+	if !ok {
+		return
+	}
+
+	attachment, blob, err := h.attachmentService.Download(c.Request.Context(), vaultID, credID, attachmentID, middleware.GetUserID(c))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	defer blob.Close()
+
+	c.DataFromReader(http.StatusOK, attachment.Size, "application/octet-stream", blob, map[string]string{
+		"Content-Disposition": `attachment; filename="` + attachment.AttachmentID + `"`,
+		"Cache-Control":       "no-store",
+	})
+}
+
+// Delete removes an attachment
+func (h *AttachmentHandler) Delete(c *gin.Context) {
+	vaultID, credID, attachmentID, ok := attachmentParams(c)
+	if !ok {
+		return
+	}
+
+	if err := h.attachmentService.Delete(c.Request.Context(), vaultID, credID, attachmentID, middleware.GetUserID(c)); err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// GetQuota returns the tenant's attachment storage quota and usage (admin only)
+func (h *AttachmentHandler) GetQuota(c *gin.Context) {
+	quota, err := h.attachmentService.GetQuota(c.Request.Context(), middleware.GetUser(c))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, quota)
+}
+
+// SetQuota sets the tenant's attachment storage quota (admin only)
+func (h *AttachmentHandler) SetQuota(c *gin.Context) {
+	var req service.SetAttachmentQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	quota, err := h.attachmentService.SetQuota(c.Request.Context(), middleware.GetUser(c), &req)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, quota)
+}
+
+// ResetQuota restores the default attachment storage quota (admin only)
+func (h *AttachmentHandler) ResetQuota(c *gin.Context) {
+	quota, err := h.attachmentService.ResetQuota(c.Request.Context(), middleware.GetUser(c))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, quota)
+}
+
+// respondError maps attachment errors to HTTP responses
+func (h *AttachmentHandler) respondError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrCredentialAccessDenied):
+		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+	case errors.Is(err, service.ErrCredentialNotFound), errors.Is(err, service.ErrAttachmentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrStaleKeyGeneration), errors.Is(err, service.ErrAttachmentExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrAttachmentTooLarge), errors.Is(err, service.ErrAttachmentQuotaExceeded):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidCiphertext), errors.Is(err, service.ErrItemIDRequired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
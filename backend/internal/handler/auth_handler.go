@@ -3,8 +3,11 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gotomicro/ego/core/econf"
@@ -12,6 +15,7 @@ import (
 	"golang.org/x/oauth2/github"
 	"golang.org/x/oauth2/google"
 
+	"github.com/askuy/passwordx/backend/internal/pkg/srp"
 	"github.com/askuy/passwordx/backend/internal/service"
 )
 
@@ -64,12 +68,20 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	}
 
 	resp, err := h.authService.Register(c.Request.Context(), &req)
+	if errors.Is(err, service.ErrWeakPassword) || errors.Is(err, service.ErrBreachedPassword) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		switch err {
 		case service.ErrUserExists:
 			c.JSON(http.StatusConflict, gin.H{"error": "user already exists"})
 		case service.ErrRegistrationDisabled:
 			c.JSON(http.StatusForbidden, gin.H{"error": "registration is disabled"})
+		case service.ErrInvalidVerifier, service.ErrInvalidSalt, service.ErrInvalidKDFSettings:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case service.ErrServerBusy:
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
 		default:
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		}
@@ -92,10 +104,14 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		switch err {
 		case service.ErrInvalidCredentials:
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid email or password"})
+		case service.ErrSRPRequired:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		case service.ErrUserInactive:
 			c.JSON(http.StatusForbidden, gin.H{"error": "account is inactive"})
 		case service.ErrUserNotInvited:
 			c.JSON(http.StatusForbidden, gin.H{"error": "please complete your account activation first"})
+		case service.ErrServerBusy:
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
 		default:
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		}
@@ -105,6 +121,137 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	c.JSON(http.StatusOK, resp)
 }
 
+// Prelogin returns the KDF parameters and salt for an email address
+func (h *AuthHandler) Prelogin(c *gin.Context) {
+	var req service.PreloginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.authService.Prelogin(c.Request.Context(), &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// SRPInit starts an SRP login handshake
+func (h *AuthHandler) SRPInit(c *gin.Context) {
+	var req service.SRPInitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.authService.SRPInit(c.Request.Context(), &req)
+	if err != nil {
+		switch err {
+		case srp.ErrInvalidPublicValue:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid SRP public value"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// SRPVerify completes an SRP login handshake
+func (h *AuthHandler) SRPVerify(c *gin.Context) {
+	var req service.SRPVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.authService.SRPVerify(c.Request.Context(), &req)
+	if err != nil {
+		switch err {
+		case service.ErrInvalidCredentials:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid email or password"})
+		case service.ErrUserInactive:
+			c.JSON(http.StatusForbidden, gin.H{"error": "account is inactive"})
+		case service.ErrUserNotInvited:
+			c.JSON(http.StatusForbidden, gin.H{"error": "please complete your account activation first"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// VerifyTwoFactor completes a login with a TOTP or recovery code
+func (h *AuthHandler) VerifyTwoFactor(c *gin.Context) {
+	var req service.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.authService.VerifyTwoFactor(c.Request.Context(), &req)
+	if err != nil {
+		h.respondMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// BeginTwoFactorEnrollment returns a TOTP seed for a login that requires enrollment
+func (h *AuthHandler) BeginTwoFactorEnrollment(c *gin.Context) {
+	var req service.MFATokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	enrollment, err := h.authService.BeginTwoFactorEnrollment(c.Request.Context(), &req)
+	if err != nil {
+		h.respondMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// ConfirmTwoFactorEnrollment enables two-factor authentication and completes the login
+func (h *AuthHandler) ConfirmTwoFactorEnrollment(c *gin.Context) {
+	var req service.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.authService.ConfirmTwoFactorEnrollment(c.Request.Context(), &req)
+	if err != nil {
+		h.respondMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// respondMFAError maps errors of the second login step to HTTP responses
+func (h *AuthHandler) respondMFAError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidMFAToken), errors.Is(err, service.ErrInvalidTwoFactorCode):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrUserInactive):
+		c.JSON(http.StatusForbidden, gin.H{"error": "account is inactive"})
+	case errors.Is(err, service.ErrMFAStep), errors.Is(err, service.ErrTwoFactorEnabled),
+		errors.Is(err, service.ErrTwoFactorNotEnabled), errors.Is(err, service.ErrTwoFactorNotEnrolling):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
 // OAuthLogin initiates OAuth flow
 func (h *AuthHandler) OAuthLogin(c *gin.Context) {
 	provider := c.Param("provider")
@@ -202,6 +349,19 @@ func (h *AuthHandler) OAuthCallback(c *gin.Context) {
 		return
 	}
 
+	// Users with two-factor authentication continue with the MFA token. It is
+	// passed in the fragment, which browsers neither send to the frontend's
+	// server nor include in Referer headers, so it stays out of access logs.
+	if resp.MFAToken != "" {
+		fragment := url.Values{
+			"mfa_token":   {resp.MFAToken},
+			"mfa":         {resp.MFA},
+			"mfa_methods": {strings.Join(resp.MFAMethods, ",")},
+		}
+		c.Redirect(http.StatusTemporaryRedirect, frontendURL+"/auth/callback#"+fragment.Encode())
+		return
+	}
+
 	// Redirect to frontend with token
 	c.Redirect(http.StatusTemporaryRedirect, frontendURL+"/auth/callback?token="+resp.Token)
 }
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/askuy/passwordx/backend/internal/pkg/breach"
+	"github.com/askuy/passwordx/backend/internal/service"
+)
+
+type BreachHandler struct {
+	breachService *service.BreachService
+}
+
+func NewBreachHandler(breachService *service.BreachService) *BreachHandler {
+	return &BreachHandler{
+		breachService: breachService,
+	}
+}
+
+// Range returns the breached hash suffixes for a SHA-1 prefix in the Pwned
+// Passwords range format, one "SUFFIX:COUNT" per line. Clients send only the
+// first five hex digits of the hash and compare the suffixes locally.
+// "Add-Padding: true" mixes in decoy entries with a count of 0.
+func (h *BreachHandler) Range(c *gin.Context) {
+	pad := strings.EqualFold(c.GetHeader("Add-Padding"), "true")
+	entries, err := h.breachService.Range(c.Param("prefix"), pad)
+	if err != nil {
+		switch {
+		case errors.Is(err, breach.ErrInvalidPrefix):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrBreachDisabled):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	var b strings.Builder
+	for _, e := range entries {
+		b.WriteString(e.Suffix)
+		b.WriteByte(':')
+		b.WriteString(strconv.FormatUint(uint64(e.Count), 10))
+		b.WriteString("\r\n")
+	}
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.String(http.StatusOK, b.String())
+}
@@ -1,12 +1,16 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/askuy/passwordx/backend/internal/middleware"
+	"github.com/askuy/passwordx/backend/internal/model"
 	"github.com/askuy/passwordx/backend/internal/service"
 )
 
@@ -43,6 +47,14 @@ func (h *CredentialHandler) Create(c *gin.Context) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
 			return
 		}
+		if err == service.ErrStaleKeyGeneration {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, service.ErrInvalidCiphertext) || errors.Is(err, service.ErrInvalidItem) || errors.Is(err, service.ErrInvalidCustomFields) || errors.Is(err, service.ErrInvalidSearchToken) || err == service.ErrInvalidMatchMode || err == service.ErrItemIDRequired || err == service.ErrItemIDImmutable {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -77,7 +89,59 @@ func (h *CredentialHandler) Get(c *gin.Context) {
 	c.JSON(http.StatusOK, credential)
 }
 
-// List returns all credentials in a vault
+// parseCredentialFilter reads the filters and sort order from the query:
+// ?category=<category>, ?updated_since=<RFC 3339 time>, ?folder=<id> for a
+// folder of the user and its subfolders, ?folder=none for unfiled
+// credentials, ?tag=<id>, repeatable, for credentials carrying every tag,
+// ?term=<token>,<token>..., repeatable, for credentials carrying one of the
+// blind index tokens of every term, ?autofill=true to leave out credentials
+// never filled automatically and ?sort=id, created_at, updated_at, most_used,
+// recent or favorites, "-" first to reverse. It returns nil if none is given.
+func parseCredentialFilter(c *gin.Context) (*service.CredentialFilter, error) {
+	category := c.Query("category")
+	updatedSince := c.Query("updated_since")
+	folder := c.Query("folder")
+	tags := c.QueryArray("tag")
+	terms := c.QueryArray("term")
+	autofill := c.Query("autofill") == "true"
+	sort := c.Query("sort")
+	if category == "" && updatedSince == "" && folder == "" && len(tags) == 0 && len(terms) == 0 && !autofill && sort == "" {
+		return nil, nil
+	}
+
+	filter := &service.CredentialFilter{Category: category, Autofill: autofill, Sort: sort}
+	if updatedSince != "" {
+		t, err := time.Parse(time.RFC3339, updatedSince)
+		if err != nil {
+			return nil, errors.New("invalid updated_since")
+		}
+		filter.UpdatedSince = t
+	}
+	for _, term := range terms {
+		filter.Terms = append(filter.Terms, strings.Split(term, ","))
+	}
+	if folder == "none" {
+		filter.Unfiled = true
+	} else if folder != "" {
+		id, err := strconv.ParseInt(folder, 10, 64)
+		if err != nil {
+			return nil, errors.New("invalid folder ID")
+		}
+		filter.FolderID = id
+	}
+	for _, tag := range tags {
+		id, err := strconv.ParseInt(tag, 10, 64)
+		if err != nil {
+			return nil, errors.New("invalid tag ID")
+		}
+		filter.TagIDs = append(filter.TagIDs, id)
+	}
+	return filter, nil
+}
+
+// List returns a page of the credentials in a vault, see parsePage, optionally
+// filtered and sorted, see parseCredentialFilter. With ?unbound=true it only
+// returns credentials whose ciphertexts still need to be bound to their item.
 func (h *CredentialHandler) List(c *gin.Context) {
 	userID := middleware.GetUserID(c)
 
@@ -87,17 +151,42 @@ func (h *CredentialHandler) List(c *gin.Context) {
 		return
 	}
 
-	credentials, err := h.credentialService.List(c.Request.Context(), vaultID, userID)
+	filter, err := parseCredentialFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	page, err := parsePage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var credentials []model.Credential
+	var next string
+	if c.Query("unbound") == "true" {
+		credentials, next, err = h.credentialService.ListUnbound(c.Request.Context(), vaultID, userID, page)
+	} else {
+		credentials, next, err = h.credentialService.List(c.Request.Context(), vaultID, userID, filter, page)
+	}
 	if err != nil {
 		if err == service.ErrCredentialAccessDenied {
 			c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
 			return
 		}
+		if err == service.ErrFolderNotFound || err == service.ErrTagNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err == service.ErrInvalidSort || err == service.ErrInvalidCursor || errors.Is(err, service.ErrInvalidSearchTerms) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"credentials": credentials})
+	c.JSON(http.StatusOK, gin.H{"credentials": credentials, "next_cursor": next})
 }
 
 // Update updates a credential
@@ -126,6 +215,14 @@ func (h *CredentialHandler) Update(c *gin.Context) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
 			return
 		}
+		if err == service.ErrStaleKeyGeneration {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, service.ErrInvalidCiphertext) || errors.Is(err, service.ErrInvalidItem) || errors.Is(err, service.ErrInvalidCustomFields) || errors.Is(err, service.ErrInvalidSearchToken) || err == service.ErrInvalidMatchMode || err == service.ErrItemIDRequired || err == service.ErrItemIDImmutable {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -159,17 +256,100 @@ func (h *CredentialHandler) Delete(c *gin.Context) {
 	c.JSON(http.StatusNoContent, nil)
 }
 
-// Search searches credentials across all user's vaults
+// Search returns a page of the credentials across all user's vaults, see
+// parsePage. Servers cannot read the encrypted fields, so clients search with
+// blind index terms and the other filters of parseCredentialFilter. ?q is
+// rejected rather than ignored, since ignoring it would answer a text search
+// with every credential the user can see.
 func (h *CredentialHandler) Search(c *gin.Context) {
 	userID := middleware.GetUserID(c)
 	tenantID := middleware.GetTenantID(c)
-	query := c.Query("q")
 
-	credentials, err := h.credentialService.Search(c.Request.Context(), tenantID, userID, query)
+	if _, ok := c.GetQuery("q"); ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is not supported, search with blind index terms (?term=)"})
+		return
+	}
+
+	filter, err := parseCredentialFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := parsePage(c)
 	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	credentials, next, err := h.credentialService.Search(c.Request.Context(), tenantID, userID, filter, page)
+	if err != nil {
+		if err == service.ErrFolderNotFound || err == service.ErrTagNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err == service.ErrInvalidSort || err == service.ErrInvalidCursor || errors.Is(err, service.ErrInvalidSearchTerms) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"credentials": credentials})
+	c.JSON(http.StatusOK, gin.H{"credentials": credentials, "next_cursor": next})
+}
+
+// SetFavorite marks or unmarks a credential as one of the current user's favorites
+func (h *CredentialHandler) SetFavorite(c *gin.Context) {
+	vaultID, credID, ok := credentialParams(c)
+	if !ok {
+		return
+	}
+
+	var req service.SetFavoriteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	metadata, err := h.credentialService.SetFavorite(c.Request.Context(), vaultID, credID, middleware.GetUserID(c), &req)
+	if err != nil {
+		h.respondMetadataError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, metadata)
+}
+
+// ReportUsage records that the current user used or filled a credential
+func (h *CredentialHandler) ReportUsage(c *gin.Context) {
+	vaultID, credID, ok := credentialParams(c)
+	if !ok {
+		return
+	}
+
+	var req service.ReportUsageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	metadata, err := h.credentialService.ReportUsage(c.Request.Context(), vaultID, credID, middleware.GetUserID(c), &req)
+	if err != nil {
+		h.respondMetadataError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, metadata)
+}
+
+func (h *CredentialHandler) respondMetadataError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrCredentialNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "credential not found"})
+	case errors.Is(err, service.ErrCredentialAccessDenied):
+		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
 }
@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/askuy/passwordx/backend/internal/middleware"
+	"github.com/askuy/passwordx/backend/internal/pkg/domain"
+	"github.com/askuy/passwordx/backend/internal/service"
+)
+
+type DomainHandler struct {
+	domainService *service.DomainService
+}
+
+func NewDomainHandler(domainService *service.DomainService) *DomainHandler {
+	return &DomainHandler{
+		domainService: domainService,
+	}
+}
+
+// MatchModes lists the match modes a credential can have
+func (h *DomainHandler) MatchModes(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"match_modes": domain.MatchModes})
+}
+
+// List returns the equivalent domain groups of the current user's tenant and
+// their own
+func (h *DomainHandler) List(c *gin.Context) {
+	groups, err := h.domainService.List(c.Request.Context(), middleware.GetTenantID(c), middleware.GetUserID(c))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, groups)
+}
+
+// Create creates an equivalent domain group of the current user's own
+func (h *DomainHandler) Create(c *gin.Context) {
+	var req service.EquivalentDomainsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	group, err := h.domainService.CreateGroup(c.Request.Context(), middleware.GetTenantID(c), middleware.GetUserID(c), &req)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, group)
+}
+
+// Update replaces the domains of one of the current user's groups
+func (h *DomainHandler) Update(c *gin.Context) {
+	groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid group ID"})
+		return
+	}
+
+	var req service.EquivalentDomainsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	group, err := h.domainService.UpdateGroup(c.Request.Context(), middleware.GetTenantID(c), middleware.GetUserID(c), groupID, &req)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+// Delete deletes one of the current user's groups
+func (h *DomainHandler) Delete(c *gin.Context) {
+	groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid group ID"})
+		return
+	}
+
+	if err := h.domainService.DeleteGroup(c.Request.Context(), middleware.GetTenantID(c), middleware.GetUserID(c), groupID); err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// ListTenant returns the equivalent domain groups of the tenant (admin only)
+func (h *DomainHandler) ListTenant(c *gin.Context) {
+	groups, err := h.domainService.ListTenantGroups(c.Request.Context(), middleware.GetUser(c))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"groups": groups})
+}
+
+// CreateTenant creates an equivalent domain group for the tenant (admin only)
+func (h *DomainHandler) CreateTenant(c *gin.Context) {
+	var req service.EquivalentDomainsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	group, err := h.domainService.CreateTenantGroup(c.Request.Context(), middleware.GetUser(c), &req)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, group)
+}
+
+// UpdateTenant replaces the domains of a tenant group (admin only)
+func (h *DomainHandler) UpdateTenant(c *gin.Context) {
+	groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid group ID"})
+		return
+	}
+
+	var req service.EquivalentDomainsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	group, err := h.domainService.UpdateTenantGroup(c.Request.Context(), middleware.GetUser(c), groupID, &req)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+// DeleteTenant deletes a tenant group (admin only)
+func (h *DomainHandler) DeleteTenant(c *gin.Context) {
+	groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid group ID"})
+		return
+	}
+
+	if err := h.domainService.DeleteTenantGroup(c.Request.Context(), middleware.GetUser(c), groupID); err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+func (h *DomainHandler) respondError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrDomainGroupNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrDomainGrouped), errors.Is(err, service.ErrTooManyDomainGroups):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidDomain):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,280 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/askuy/passwordx/backend/internal/middleware"
+	"github.com/askuy/passwordx/backend/internal/pkg/crypto"
+	"github.com/askuy/passwordx/backend/internal/service"
+)
+
+type EscrowHandler struct {
+	escrowService *service.EscrowService
+}
+
+func NewEscrowHandler(escrowService *service.EscrowService) *EscrowHandler {
+	return &EscrowHandler{
+		escrowService: escrowService,
+	}
+}
+
+// GetPolicy returns the escrow policy of the current user's tenant
+func (h *EscrowHandler) GetPolicy(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	policy, err := h.escrowService.GetPolicy(c.Request.Context(), userID)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// Enroll escrows the current user's private key
+func (h *EscrowHandler) Enroll(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	var req service.EnrollEscrowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.escrowService.Enroll(c.Request.Context(), userID, &req); err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "keys escrowed"})
+}
+
+// GetConfig returns the escrow configuration (admin only)
+func (h *EscrowHandler) GetConfig(c *gin.Context) {
+	config, err := h.escrowService.GetConfig(c.Request.Context(), middleware.GetUser(c))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, config)
+}
+
+// Configure enables escrow or proposes to replace the escrow key (super admin only)
+func (h *EscrowHandler) Configure(c *gin.Context) {
+	var req service.ConfigureEscrowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	config, err := h.escrowService.Configure(c.Request.Context(), middleware.GetUser(c), &req)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	h.respondConfig(c, config)
+}
+
+// Disable proposes to turn escrow off (super admin only)
+func (h *EscrowHandler) Disable(c *gin.Context) {
+	config, err := h.escrowService.Disable(c.Request.Context(), middleware.GetUser(c))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	h.respondConfig(c, config)
+}
+
+// ApproveChange approves the pending escrow change (share holders only)
+func (h *EscrowHandler) ApproveChange(c *gin.Context) {
+	changeID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid change id"})
+		return
+	}
+
+	config, err := h.escrowService.ApproveChange(c.Request.Context(), middleware.GetUser(c), changeID)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	h.respondConfig(c, config)
+}
+
+// CancelChange withdraws the pending escrow change (admin only)
+func (h *EscrowHandler) CancelChange(c *gin.Context) {
+	changeID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid change id"})
+		return
+	}
+
+	if err := h.escrowService.CancelChange(c.Request.Context(), middleware.GetUser(c), changeID); err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "escrow change cancelled"})
+}
+
+// respondConfig answers 202 while a change still waits for approval
+func (h *EscrowHandler) respondConfig(c *gin.Context, config *service.EscrowConfig) {
+	if config.PendingChange != nil {
+		c.JSON(http.StatusAccepted, config)
+		return
+	}
+	c.JSON(http.StatusOK, config)
+}
+
+// GetShare returns the current admin's escrow share (admin only)
+func (h *EscrowHandler) GetShare(c *gin.Context) {
+	share, err := h.escrowService.GetShare(c.Request.Context(), middleware.GetUser(c))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, share)
+}
+
+// ListRequests lists escrow requests (admin only)
+func (h *EscrowHandler) ListRequests(c *gin.Context) {
+	requests, err := h.escrowService.ListRequests(c.Request.Context(), middleware.GetUser(c))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, requests)
+}
+
+// CreateRequest opens an escrow request for a user (admin only)
+func (h *EscrowHandler) CreateRequest(c *gin.Context) {
+	var req service.CreateEscrowRequestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	request, err := h.escrowService.CreateRequest(c.Request.Context(), middleware.GetUser(c), &req)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, request)
+}
+
+// GetRequest gets an escrow request (admin only)
+func (h *EscrowHandler) GetRequest(c *gin.Context) {
+	requestID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request id"})
+		return
+	}
+
+	request, err := h.escrowService.GetRequest(c.Request.Context(), middleware.GetUser(c), requestID)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, request)
+}
+
+// Approve releases the current admin's share for a request (admin only)
+func (h *EscrowHandler) Approve(c *gin.Context) {
+	requestID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request id"})
+		return
+	}
+
+	var req service.ApproveEscrowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	request, err := h.escrowService.Approve(c.Request.Context(), middleware.GetUser(c), requestID, &req)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, request)
+}
+
+// Complete re-keys the user of an approved request (admin only)
+func (h *EscrowHandler) Complete(c *gin.Context) {
+	requestID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request id"})
+		return
+	}
+
+	var req service.CompleteEscrowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.escrowService.Complete(c.Request.Context(), middleware.GetUser(c), requestID, &req); err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "user re-keyed"})
+}
+
+// Cancel withdraws an escrow request (admin only)
+func (h *EscrowHandler) Cancel(c *gin.Context) {
+	requestID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request id"})
+		return
+	}
+
+	if err := h.escrowService.Cancel(c.Request.Context(), middleware.GetUser(c), requestID); err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "escrow request cancelled"})
+}
+
+// respondError maps escrow errors to HTTP responses
+func (h *EscrowHandler) respondError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, service.ErrEscrowRequestNotFound),
+		errors.Is(err, service.ErrEscrowChangeNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrUserNotAllowed), errors.Is(err, service.ErrNotShareHolder),
+		errors.Is(err, service.ErrEscrowSelfApproval), errors.Is(err, service.ErrEscrowOwnRequest),
+		errors.Is(err, service.ErrEscrowOwnChange), errors.Is(err, service.ErrCannotModifySelf):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrEscrowKeyChanged), errors.Is(err, service.ErrEscrowRequestOpen),
+		errors.Is(err, service.ErrEscrowRequestState), errors.Is(err, service.ErrEscrowAlreadyApproved),
+		errors.Is(err, service.ErrEscrowChangePending), errors.Is(err, service.ErrEscrowChangeState):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrEscrowDisabled), errors.Is(err, service.ErrEscrowNotEnrolled),
+		errors.Is(err, service.ErrInvalidEscrowPolicy), errors.Is(err, service.ErrInvalidShareHolder),
+		errors.Is(err, service.ErrInvalidEscrowShare), errors.Is(err, service.ErrKeysRequired),
+		errors.Is(err, service.ErrEscrowSoleHolder), errors.Is(err, service.ErrEscrowNoQuorum),
+		errors.Is(err, service.ErrLegacyVaults), errors.Is(err, service.ErrInvalidVerifier),
+		errors.Is(err, service.ErrInvalidSalt), errors.Is(err, service.ErrInvalidKDFSettings),
+		errors.Is(err, crypto.ErrInvalidPublicKey), errors.Is(err, crypto.ErrInvalidEnvelope),
+		errors.Is(err, crypto.ErrUnsupportedAlgorithm):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,228 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/askuy/passwordx/backend/internal/middleware"
+	"github.com/askuy/passwordx/backend/internal/service"
+)
+
+type FolderHandler struct {
+	folderService *service.FolderService
+}
+
+func NewFolderHandler(folderService *service.FolderService) *FolderHandler {
+	return &FolderHandler{
+		folderService: folderService,
+	}
+}
+
+// ListFolders returns the current user's folders
+func (h *FolderHandler) ListFolders(c *gin.Context) {
+	folders, err := h.folderService.ListFolders(c.Request.Context(), middleware.GetUserID(c))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"folders": folders})
+}
+
+// CreateFolder creates a folder for the current user
+func (h *FolderHandler) CreateFolder(c *gin.Context) {
+	var req service.CreateFolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	folder, err := h.folderService.CreateFolder(c.Request.Context(), middleware.GetUserID(c), &req)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, folder)
+}
+
+// UpdateFolder renames or moves a folder
+func (h *FolderHandler) UpdateFolder(c *gin.Context) {
+	folderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid folder ID"})
+		return
+	}
+
+	var req service.UpdateFolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	folder, err := h.folderService.UpdateFolder(c.Request.Context(), middleware.GetUserID(c), folderID, &req)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, folder)
+}
+
+// DeleteFolder deletes a folder and its subfolders
+func (h *FolderHandler) DeleteFolder(c *gin.Context) {
+	folderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid folder ID"})
+		return
+	}
+
+	if err := h.folderService.DeleteFolder(c.Request.Context(), middleware.GetUserID(c), folderID); err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// ListTags returns the current user's tags
+func (h *FolderHandler) ListTags(c *gin.Context) {
+	tags, err := h.folderService.ListTags(c.Request.Context(), middleware.GetUserID(c))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tags": tags})
+}
+
+// CreateTag creates a tag for the current user
+func (h *FolderHandler) CreateTag(c *gin.Context) {
+	var req service.CreateTagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tag, err := h.folderService.CreateTag(c.Request.Context(), middleware.GetUserID(c), &req)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, tag)
+}
+
+// UpdateTag renames a tag
+func (h *FolderHandler) UpdateTag(c *gin.Context) {
+	tagID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tag ID"})
+		return
+	}
+
+	var req service.UpdateTagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tag, err := h.folderService.UpdateTag(c.Request.Context(), middleware.GetUserID(c), tagID, &req)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tag)
+}
+
+// DeleteTag deletes a tag
+func (h *FolderHandler) DeleteTag(c *gin.Context) {
+	tagID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tag ID"})
+		return
+	}
+
+	if err := h.folderService.DeleteTag(c.Request.Context(), middleware.GetUserID(c), tagID); err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// credentialParams parses the vault and credential IDs of a credential route
+func credentialParams(c *gin.Context) (vaultID, credID int64, ok bool) {
+	vaultID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid vault ID"})
+		return 0, 0, false
+	}
+	credID, err = strconv.ParseInt(c.Param("credId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid credential ID"})
+		return 0, 0, false
+	}
+	return vaultID, credID, true
+}
+
+// SetCredentialFolder files a credential in one of the current user's folders
+func (h *FolderHandler) SetCredentialFolder(c *gin.Context) {
+	vaultID, credID, ok := credentialParams(c)
+	if !ok {
+		return
+	}
+
+	var req service.SetCredentialFolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.folderService.SetCredentialFolder(c.Request.Context(), vaultID, credID, middleware.GetUserID(c), &req); err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// SetCredentialTags replaces the current user's tags on a credential
+func (h *FolderHandler) SetCredentialTags(c *gin.Context) {
+	vaultID, credID, ok := credentialParams(c)
+	if !ok {
+		return
+	}
+
+	var req service.SetCredentialTagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.folderService.SetCredentialTags(c.Request.Context(), vaultID, credID, middleware.GetUserID(c), &req); err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+func (h *FolderHandler) respondError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrFolderNotFound), errors.Is(err, service.ErrTagNotFound), errors.Is(err, service.ErrCredentialNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrCredentialAccessDenied):
+		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+	case errors.Is(err, service.ErrFolderExists), errors.Is(err, service.ErrTagExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidFolderParent), errors.Is(err, service.ErrInvalidCiphertext):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
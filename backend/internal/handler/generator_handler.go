@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/askuy/passwordx/backend/internal/pkg/generator"
+)
+
+type GeneratorHandler struct{}
+
+func NewGeneratorHandler() *GeneratorHandler {
+	return &GeneratorHandler{}
+}
+
+// Generate generates a password or passphrase. Options missing from the
+// request body keep their defaults, see generator.DefaultOptions.
+func (h *GeneratorHandler) Generate(c *gin.Context) {
+	opts := generator.DefaultOptions()
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&opts); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	result, err := generator.Generate(opts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// Wordlist returns the passphrase wordlist so clients can verify they
+// generate from the same list
+func (h *GeneratorHandler) Wordlist(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.JSON(http.StatusOK, gin.H{"words": generator.Wordlist()})
+}
@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/askuy/passwordx/backend/internal/pkg/itemtype"
+)
+
+type ItemTypeHandler struct{}
+
+func NewItemTypeHandler() *ItemTypeHandler {
+	return &ItemTypeHandler{}
+}
+
+// List returns the schema of every item type
+func (h *ItemTypeHandler) List(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.JSON(http.StatusOK, itemtype.All())
+}
+
+// Get returns the schema of one item type
+func (h *ItemTypeHandler) Get(c *gin.Context) {
+	t, err := itemtype.Lookup(c.Param("type"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.JSON(http.StatusOK, t)
+}
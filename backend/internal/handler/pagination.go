@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/askuy/passwordx/backend/internal/repository"
+)
+
+// parsePage reads the page a listing asks for: ?limit=<rows>, capped at
+// repository.MaxPageLimit, and ?cursor=<next_cursor of the previous page>
+func parsePage(c *gin.Context) (repository.Page, error) {
+	page := repository.Page{Cursor: c.Query("cursor")}
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return page, errors.New("invalid limit")
+		}
+		page.Limit = n
+	}
+	return page, nil
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/askuy/passwordx/backend/internal/middleware"
+	"github.com/askuy/passwordx/backend/internal/service"
+)
+
+type PasswordPolicyHandler struct {
+	policyService *service.PasswordPolicyService
+}
+
+func NewPasswordPolicyHandler(policyService *service.PasswordPolicyService) *PasswordPolicyHandler {
+	return &PasswordPolicyHandler{
+		policyService: policyService,
+	}
+}
+
+// GetDefault returns the policy for new registrations (no auth required)
+func (h *PasswordPolicyHandler) GetDefault(c *gin.Context) {
+	c.JSON(http.StatusOK, h.policyService.DefaultPolicy())
+}
+
+// Get returns the password policy of the current user's tenant
+func (h *PasswordPolicyHandler) Get(c *gin.Context) {
+	policy, err := h.policyService.GetPolicy(c.Request.Context(), middleware.GetUserID(c))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// Evaluate estimates the strength of a password. Passwords are neither
+// stored nor logged.
+func (h *PasswordPolicyHandler) Evaluate(c *gin.Context) {
+	var req service.EvaluatePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	evaluation, err := h.policyService.Evaluate(c.Request.Context(), middleware.GetUserID(c), &req)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, evaluation)
+}
+
+// Set sets the tenant's password policy (admin only)
+func (h *PasswordPolicyHandler) Set(c *gin.Context) {
+	var req service.PasswordPolicy
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.policyService.SetPolicy(c.Request.Context(), middleware.GetUser(c), &req); err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, req)
+}
+
+// Reset restores the default password policy (admin only)
+func (h *PasswordPolicyHandler) Reset(c *gin.Context) {
+	if err := h.policyService.ResetPolicy(c.Request.Context(), middleware.GetUser(c)); err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, h.policyService.DefaultPolicy())
+}
+
+// respondError maps password policy errors to HTTP responses
+func (h *PasswordPolicyHandler) respondError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
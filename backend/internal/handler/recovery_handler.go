@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/askuy/passwordx/backend/internal/middleware"
+	"github.com/askuy/passwordx/backend/internal/pkg/srp"
+	"github.com/askuy/passwordx/backend/internal/service"
+)
+
+type RecoveryHandler struct {
+	recoveryService *service.RecoveryService
+}
+
+func NewRecoveryHandler(recoveryService *service.RecoveryService) *RecoveryHandler {
+	return &RecoveryHandler{
+		recoveryService: recoveryService,
+	}
+}
+
+// GetStatus reports whether the current user has a recovery key
+func (h *RecoveryHandler) GetStatus(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	status, err := h.recoveryService.GetStatus(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// SetRecoveryKey registers or replaces the current user's recovery key
+func (h *RecoveryHandler) SetRecoveryKey(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	var req service.SetRecoveryKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.recoveryService.SetRecoveryKey(c.Request.Context(), userID, &req); err != nil {
+		switch err {
+		case service.ErrInvalidVerifier, service.ErrKeysRequired:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case service.ErrRecoveryKeyExists:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case service.ErrInvalidCredentials:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "current password is incorrect"})
+		case service.ErrUserNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		case service.ErrServerBusy:
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "recovery key saved"})
+}
+
+// EmergencyKit downloads the current user's printable emergency kit
+func (h *RecoveryHandler) EmergencyKit(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	kit, err := h.recoveryService.EmergencyKit(c.Request.Context(), userID)
+	if err != nil {
+		if err == service.ErrUserNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="passwordx-emergency-kit.txt"`)
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(kit))
+}
+
+// Init starts an account recovery handshake
+func (h *RecoveryHandler) Init(c *gin.Context) {
+	var req service.SRPInitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.recoveryService.Init(c.Request.Context(), &req)
+	if err != nil {
+		if err == srp.ErrInvalidPublicValue {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid SRP public value"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// Verify checks the recovery key proof
+func (h *RecoveryHandler) Verify(c *gin.Context) {
+	var req service.SRPVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.recoveryService.Verify(c.Request.Context(), &req)
+	if err != nil {
+		switch err {
+		case service.ErrInvalidCredentials:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid email or recovery key"})
+		case service.ErrLegacyVaults:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// Reset sets a new master password on a recovered account
+func (h *RecoveryHandler) Reset(c *gin.Context) {
+	var req service.RecoveryResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.recoveryService.Reset(c.Request.Context(), &req); err != nil {
+		switch err {
+		case service.ErrInvalidVerifier, service.ErrInvalidSalt, service.ErrInvalidKDFSettings:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case service.ErrInvalidCredentials:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "reset token is invalid or expired"})
+		case service.ErrLegacyVaults:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "account recovered, sign in with the new master password"})
+}
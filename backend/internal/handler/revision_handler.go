@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/askuy/passwordx/backend/internal/middleware"
+	"github.com/askuy/passwordx/backend/internal/service"
+)
+
+type RevisionHandler struct {
+	credentialService *service.CredentialService
+}
+
+func NewRevisionHandler(credentialService *service.CredentialService) *RevisionHandler {
+	return &RevisionHandler{
+		credentialService: credentialService,
+	}
+}
+
+// revisionParams parses the credential ID and revision number of a request;
+// the revision only when the route has one
+func revisionParams(c *gin.Context) (credID int64, revision int, ok bool) {
+	credID, err := strconv.ParseInt(c.Param("credId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid credential ID"})
+		return 0, 0, false
+	}
+	if c.Param("revision") != "" {
+		revision, err = strconv.Atoi(c.Param("revision"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid revision"})
+			return 0, 0, false
+		}
+	}
+	return credID, revision, true
+}
+
+// List returns the previous versions of a credential, newest first
+func (h *RevisionHandler) List(c *gin.Context) {
+	credID, _, ok := revisionParams(c)
+	if !ok {
+		return
+	}
+
+	revisions, err := h.credentialService.ListRevisions(c.Request.Context(), credID, middleware.GetUserID(c))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revisions": revisions})
+}
+
+// Get returns one previous version of a credential
+func (h *RevisionHandler) Get(c *gin.Context) {
+	credID, revision, ok := revisionParams(c)
+	if !ok {
+		return
+	}
+
+	rev, err := h.credentialService.GetRevision(c.Request.Context(), credID, middleware.GetUserID(c), revision)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, rev)
+}
+
+// Restore makes a previous version the credential's current content
+func (h *RevisionHandler) Restore(c *gin.Context) {
+	credID, revision, ok := revisionParams(c)
+	if !ok {
+		return
+	}
+
+	credential, err := h.credentialService.RestoreRevision(c.Request.Context(), credID, middleware.GetUserID(c), revision)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, credential)
+}
+
+// GetPolicy returns the tenant's revision retention policy (admin only)
+func (h *RevisionHandler) GetPolicy(c *gin.Context) {
+	policy, err := h.credentialService.GetRevisionPolicy(c.Request.Context(), middleware.GetUser(c))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// SetPolicy sets the tenant's revision retention policy (admin only)
+func (h *RevisionHandler) SetPolicy(c *gin.Context) {
+	var req service.RevisionPolicy
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.credentialService.SetRevisionPolicy(c.Request.Context(), middleware.GetUser(c), &req); err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, req)
+}
+
+// ResetPolicy restores the default revision retention policy (admin only)
+func (h *RevisionHandler) ResetPolicy(c *gin.Context) {
+	policy, err := h.credentialService.ResetRevisionPolicy(c.Request.Context(), middleware.GetUser(c))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// respondError maps revision errors to HTTP responses
+func (h *RevisionHandler) respondError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrCredentialAccessDenied):
+		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+	case errors.Is(err, service.ErrCredentialNotFound), errors.Is(err, service.ErrRevisionNotFound), errors.Is(err, service.ErrVaultNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrStaleKeyGeneration):
+		// The revision predates a key rotation that did not re-encrypt it
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidItem), errors.Is(err, service.ErrInvalidCustomFields):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
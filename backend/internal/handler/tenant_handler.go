@@ -64,17 +64,28 @@ func (h *TenantHandler) Get(c *gin.Context) {
 	c.JSON(http.StatusOK, tenant)
 }
 
-// List returns all tenants for the current user
+// List returns a page of the current user's tenants, see parsePage, ordered
+// by ?sort=id, name or created_at, "-" first to reverse
 func (h *TenantHandler) List(c *gin.Context) {
 	userID := middleware.GetUserID(c)
 
-	tenants, err := h.tenantService.List(c.Request.Context(), userID)
+	page, err := parsePage(c)
 	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tenants, next, err := h.tenantService.List(c.Request.Context(), userID, c.Query("sort"), page)
+	if err != nil {
+		if err == service.ErrInvalidCursor || err == service.ErrInvalidSort {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"tenants": tenants})
+	c.JSON(http.StatusOK, gin.H{"tenants": tenants, "next_cursor": next})
 }
 
 // Update updates a tenant
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/askuy/passwordx/backend/internal/middleware"
+	"github.com/askuy/passwordx/backend/internal/service"
+)
+
+type TrashHandler struct {
+	trashService *service.TrashService
+}
+
+func NewTrashHandler(trashService *service.TrashService) *TrashHandler {
+	return &TrashHandler{
+		trashService: trashService,
+	}
+}
+
+// trashParams parses the vault ID and, when the route has one, the credential ID
+func trashParams(c *gin.Context) (vaultID, credID int64, ok bool) {
+	vaultID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid vault ID"})
+		return 0, 0, false
+	}
+	if c.Param("credId") != "" {
+		credID, err = strconv.ParseInt(c.Param("credId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid credential ID"})
+			return 0, 0, false
+		}
+	}
+	return vaultID, credID, true
+}
+
+// ListCredentials returns the credentials in the trash of a vault
+func (h *TrashHandler) ListCredentials(c *gin.Context) {
+	vaultID, _, ok := trashParams(c)
+	if !ok {
+		return
+	}
+
+	trash, err := h.trashService.ListCredentials(c.Request.Context(), vaultID, middleware.GetUserID(c))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, trash)
+}
+
+// RestoreCredential takes a credential out of the trash
+func (h *TrashHandler) RestoreCredential(c *gin.Context) {
+	vaultID, credID, ok := trashParams(c)
+	if !ok {
+		return
+	}
+
+	credential, err := h.trashService.RestoreCredential(c.Request.Context(), vaultID, credID, middleware.GetUserID(c))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, credential)
+}
+
+// DeleteCredential permanently deletes a credential in the trash
+func (h *TrashHandler) DeleteCredential(c *gin.Context) {
+	vaultID, credID, ok := trashParams(c)
+	if !ok {
+		return
+	}
+
+	if err := h.trashService.DeleteCredential(c.Request.Context(), vaultID, credID, middleware.GetUserID(c)); err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// ListVaults returns the vaults in the trash the current user owns
+func (h *TrashHandler) ListVaults(c *gin.Context) {
+	trash, err := h.trashService.ListVaults(c.Request.Context(), middleware.GetTenantID(c), middleware.GetUserID(c))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, trash)
+}
+
+// RestoreVault takes a vault out of the trash
+func (h *TrashHandler) RestoreVault(c *gin.Context) {
+	vaultID, _, ok := trashParams(c)
+	if !ok {
+		return
+	}
+
+	vault, err := h.trashService.RestoreVault(c.Request.Context(), vaultID, middleware.GetUserID(c))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, vault)
+}
+
+// DeleteVault permanently deletes a vault in the trash
+func (h *TrashHandler) DeleteVault(c *gin.Context) {
+	vaultID, _, ok := trashParams(c)
+	if !ok {
+		return
+	}
+
+	if err := h.trashService.DeleteVault(c.Request.Context(), vaultID, middleware.GetUserID(c)); err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// respondError maps trash errors to HTTP responses
+func (h *TrashHandler) respondError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrCredentialAccessDenied):
+		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+	case errors.Is(err, service.ErrNotInTrash):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -53,6 +53,8 @@ func (h *UserHandler) Create(c *gin.Context) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
 		case service.ErrUserExists:
 			c.JSON(http.StatusConflict, gin.H{"error": "user already exists"})
+		case service.ErrServerBusy:
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
 		default:
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		}
@@ -62,7 +64,9 @@ func (h *UserHandler) Create(c *gin.Context) {
 	c.JSON(http.StatusCreated, user)
 }
 
-// List lists users (admin only)
+// List lists a page of users (admin only), see parsePage, narrowed by
+// ?tenant_id (super admin only), ?status and ?role and ordered by ?sort=id,
+// email, name or created_at, "-" first to reverse
 func (h *UserHandler) List(c *gin.Context) {
 	currentUser, err := h.getCurrentUser(c)
 	if err != nil {
@@ -81,17 +85,33 @@ func (h *UserHandler) List(c *gin.Context) {
 		tenantID = tid
 	}
 
-	users, err := h.userService.ListUsers(c.Request.Context(), currentUser, tenantID)
+	page, err := parsePage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter := &repository.UserFilter{
+		TenantID: tenantID,
+		Status:   c.Query("status"),
+		Role:     c.Query("role"),
+		Sort:     c.Query("sort"),
+	}
+
+	users, next, err := h.userService.ListUsers(c.Request.Context(), currentUser, filter, page)
 	if err != nil {
 		if err == service.ErrUserNotAllowed {
 			c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
 			return
 		}
+		if err == service.ErrInvalidUserStatus || err == service.ErrInvalidUserRole || err == service.ErrInvalidCursor || err == service.ErrInvalidSort {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, users)
+	c.JSON(http.StatusOK, gin.H{"users": users, "next_cursor": next})
 }
 
 // Get gets a user by ID (admin only)
@@ -223,6 +243,10 @@ func (h *UserHandler) ResetPassword(c *gin.Context) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
 		case service.ErrUserNotAllowed:
 			c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+		case service.ErrResetDestroysData:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case service.ErrServerBusy:
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
 		default:
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		}
@@ -1,12 +1,14 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/askuy/passwordx/backend/internal/middleware"
+	"github.com/askuy/passwordx/backend/internal/repository"
 	"github.com/askuy/passwordx/backend/internal/service"
 )
 
@@ -33,6 +35,10 @@ func (h *VaultHandler) Create(c *gin.Context) {
 
 	vault, err := h.vaultService.Create(c.Request.Context(), tenantID, userID, &req)
 	if err != nil {
+		if errors.Is(err, service.ErrVaultKeyRequired) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -67,18 +73,31 @@ func (h *VaultHandler) Get(c *gin.Context) {
 	c.JSON(http.StatusOK, vault)
 }
 
-// List returns all vaults for the current user
+// List returns a page of the current user's vaults, see parsePage, with
+// ?role=<vault role> narrowing it to the vaults the user has that role in and
+// ordered by ?sort=id, name, created_at or updated_at, "-" first to reverse
 func (h *VaultHandler) List(c *gin.Context) {
 	userID := middleware.GetUserID(c)
 	tenantID := middleware.GetTenantID(c)
 
-	vaults, err := h.vaultService.List(c.Request.Context(), tenantID, userID)
+	page, err := parsePage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter := &repository.VaultFilter{Role: c.Query("role"), Sort: c.Query("sort")}
+
+	vaults, next, err := h.vaultService.List(c.Request.Context(), tenantID, userID, filter, page)
 	if err != nil {
+		if err == service.ErrInvalidVaultRole || err == service.ErrInvalidCursor || err == service.ErrInvalidSort {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"vaults": vaults})
+	c.JSON(http.StatusOK, gin.H{"vaults": vaults, "next_cursor": next})
 }
 
 // Update updates a vault
@@ -153,6 +172,38 @@ func (h *VaultHandler) AddMember(c *gin.Context) {
 	}
 
 	member, err := h.vaultService.AddMember(c.Request.Context(), id, userID, &req)
+	if err != nil {
+		switch err {
+		case service.ErrVaultAccessDenied:
+			c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+		case service.ErrVaultNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "vault not found"})
+		case service.ErrUserNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		case service.ErrVaultKeyRequired, service.ErrMemberKeyMissing, service.ErrPersonalVaultNoMembers, service.ErrInvalidVaultRole:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case service.ErrStaleKeyGeneration:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, member)
+}
+
+// GetKey returns the current user's wrapped vault key
+func (h *VaultHandler) GetKey(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid vault ID"})
+		return
+	}
+
+	member, err := h.vaultService.GetMemberKey(c.Request.Context(), id, userID)
 	if err != nil {
 		if err == service.ErrVaultAccessDenied {
 			c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
@@ -162,7 +213,11 @@ func (h *VaultHandler) AddMember(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, member)
+	c.JSON(http.StatusOK, gin.H{
+		"vault_id":            member.VaultID,
+		"role":                member.Role,
+		"encrypted_vault_key": member.EncryptedVaultKey,
+	})
 }
 
 // RemoveMember removes a member from a vault
@@ -192,3 +247,43 @@ func (h *VaultHandler) RemoveMember(c *gin.Context) {
 
 	c.JSON(http.StatusNoContent, nil)
 }
+
+// RotateKey replaces the vault key with a re-encrypted batch
+func (h *VaultHandler) RotateKey(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid vault ID"})
+		return
+	}
+
+	var req service.RotateVaultKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	vault, err := h.vaultService.RotateKey(c.Request.Context(), id, userID, &req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCiphertext) || errors.Is(err, service.ErrInvalidItem) || errors.Is(err, service.ErrInvalidCustomFields) || errors.Is(err, service.ErrInvalidAttachments) || errors.Is(err, service.ErrInvalidRevisions) || errors.Is(err, service.ErrInvalidSearchToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		switch err {
+		case service.ErrVaultAccessDenied:
+			c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+		case service.ErrVaultNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "vault not found"})
+		case service.ErrRotationIncomplete, service.ErrItemIDRequired, service.ErrItemIDImmutable:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case service.ErrStaleKeyGeneration, service.ErrRotationConflict:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, vault)
+}
@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/askuy/passwordx/backend/internal/middleware"
+	"github.com/askuy/passwordx/backend/internal/service"
+)
+
+type WebAuthnHandler struct {
+	webauthnService *service.WebAuthnService
+}
+
+func NewWebAuthnHandler(webauthnService *service.WebAuthnService) *WebAuthnHandler {
+	return &WebAuthnHandler{
+		webauthnService: webauthnService,
+	}
+}
+
+// BeginRegistration returns the options to register a security key
+func (h *WebAuthnHandler) BeginRegistration(c *gin.Context) {
+	// The body is optional
+	var req service.BeginWebAuthnRegistrationRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	resp, err := h.webauthnService.BeginRegistration(c.Request.Context(), middleware.GetUserID(c), &req)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// FinishRegistration stores a security key for the current user
+func (h *WebAuthnHandler) FinishRegistration(c *gin.Context) {
+	var req service.FinishWebAuthnRegistrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	registration, err := h.webauthnService.FinishRegistration(c.Request.Context(), middleware.GetUserID(c), &req)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, registration)
+}
+
+// List returns the current user's security keys
+func (h *WebAuthnHandler) List(c *gin.Context) {
+	credentials, err := h.webauthnService.ListCredentials(c.Request.Context(), middleware.GetUserID(c))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, credentials)
+}
+
+// Delete removes one of the current user's security keys
+func (h *WebAuthnHandler) Delete(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid security key id"})
+		return
+	}
+
+	if err := h.webauthnService.DeleteCredential(c.Request.Context(), middleware.GetUserID(c), id); err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "security key removed"})
+}
+
+// BeginLogin returns the options to sign in with a security key
+func (h *WebAuthnHandler) BeginLogin(c *gin.Context) {
+	// The body is optional
+	var req service.BeginWebAuthnLoginRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	resp, err := h.webauthnService.BeginLogin(c.Request.Context(), &req)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// FinishLogin completes a security key login and returns the session
+func (h *WebAuthnHandler) FinishLogin(c *gin.Context) {
+	var req service.FinishWebAuthnLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.webauthnService.FinishLogin(c.Request.Context(), &req)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// respondError maps security key errors to HTTP responses
+func (h *WebAuthnHandler) respondError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, service.ErrSecurityKeyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidSecurityKey), errors.Is(err, service.ErrInvalidWebAuthnChallenge),
+		errors.Is(err, service.ErrInvalidMFAToken):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrUserInactive):
+		c.JSON(http.StatusForbidden, gin.H{"error": "account is inactive"})
+	case errors.Is(err, service.ErrTwoFactorRequired):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrSecurityKeyRegistered):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrMFAStep), errors.Is(err, service.ErrNoSecurityKeys):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
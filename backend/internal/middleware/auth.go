@@ -14,18 +14,21 @@ import (
 
 type AuthMiddleware struct {
 	jwtSecret string
+	userRepo  *repository.UserRepository
 }
 
-func NewAuthMiddleware() *AuthMiddleware {
+func NewAuthMiddleware(userRepo *repository.UserRepository) *AuthMiddleware {
 	return &AuthMiddleware{
 		jwtSecret: econf.GetString("jwt.secret"),
+		userRepo:  userRepo,
 	}
 }
 
 type Claims struct {
-	UserID   int64  `json:"user_id"`
-	TenantID int64  `json:"tenant_id"`
-	Email    string `json:"email"`
+	UserID       int64  `json:"user_id"`
+	TenantID     int64  `json:"tenant_id"`
+	Email        string `json:"email"`
+	TokenVersion int    `json:"token_version"` // must match the user's, see model.User.TokenVersion
 	jwt.RegisteredClaims
 }
 
@@ -59,6 +62,15 @@ func (m *AuthMiddleware) JWT() gin.HandlerFunc {
 			return
 		}
 
+		// Tokens issued before the user's sessions were revoked are rejected
+		user, err := m.userRepo.GetByID(c.Request.Context(), claims.UserID)
+		if err != nil || user.TokenVersion != claims.TokenVersion {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+			c.Abort()
+			return
+		}
+		c.Set("user", user)
+
 		// Set user info in context
 		c.Set("user_id", claims.UserID)
 		c.Set("tenant_id", claims.TenantID)
@@ -116,11 +128,15 @@ func RequireUser(userRepo *repository.UserRepository) gin.HandlerFunc {
 			return
 		}
 
-		user, err := userRepo.GetByID(c.Request.Context(), userID)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
-			c.Abort()
-			return
+		// JWT already loaded the user
+		user := GetUser(c)
+		if user == nil {
+			var err error
+			if user, err = userRepo.GetByID(c.Request.Context(), userID); err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+				c.Abort()
+				return
+			}
 		}
 
 		// Check if user is active
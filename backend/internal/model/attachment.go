@@ -0,0 +1,29 @@
+package model
+
+import (
+	"time"
+)
+
+// Attachment is an encrypted file attached to a credential. The client
+// encrypts the file with a key of its own and wraps that key with the vault
+// key, so rotating the vault key only rewraps the key and never touches the
+// blob. The server stores the blob under StorageKey in the blob store and
+// never sees the file, its name or its key.
+type Attachment struct {
+	ID                int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	TenantID          int64     `gorm:"index;not null" json:"-"`
+	VaultID           int64     `gorm:"index;not null" json:"vault_id"`
+	CredentialID      int64     `gorm:"index;not null" json:"credential_id"`
+	AttachmentID      string    `gorm:"size:36;uniqueIndex;not null" json:"attachment_id"` // client generated UUID bound into the ciphertexts' associated data
+	FileNameEncrypted string    `gorm:"size:1000;not null" json:"file_name_encrypted"`
+	KeyEncrypted      string    `gorm:"size:500;not null" json:"key_encrypted"` // file key wrapped with the vault key
+	KeyGeneration     int       `gorm:"not null;default:1" json:"key_generation"`
+	Size              int64     `gorm:"not null" json:"size"` // bytes of the encrypted blob
+	StorageKey        string    `gorm:"size:255;not null" json:"-"`
+	CreatedBy         int64     `gorm:"not null" json:"created_by"`
+	CreatedAt         time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (Attachment) TableName() string {
+	return "attachments"
+}
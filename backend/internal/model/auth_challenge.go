@@ -0,0 +1,31 @@
+package model
+
+import (
+	"time"
+)
+
+// Auth challenge purpose constants
+const (
+	ChallengePurposeSRP              = "srp"               // SRP-6a login handshake
+	ChallengePurposeRecovery         = "recovery"          // SRP-6a handshake against the recovery key verifier
+	ChallengePurposeRecoveryReset    = "recovery_reset"    // token allowing one account reset after recovery
+	ChallengePurposeMFAPending       = "mfa_pending"       // first factor passed, waiting for a two-factor code
+	ChallengePurposeWebAuthnRegister = "webauthn_register" // security key registration ceremony
+	ChallengePurposeWebAuthnLogin    = "webauthn_login"    // security key login ceremony
+)
+
+// AuthChallenge holds short-lived server state between the steps of a
+// multi-step authentication flow. Challenges are single use.
+type AuthChallenge struct {
+	ID        string    `gorm:"primaryKey;size:64" json:"id"`
+	UserID    int64     `gorm:"index" json:"user_id"` // 0 for decoy challenges issued to unknown accounts
+	Purpose   string    `gorm:"size:30;not null" json:"purpose"`
+	Data      string    `gorm:"type:text" json:"-"`          // purpose specific JSON state
+	Attempts  int       `gorm:"not null;default:0" json:"-"` // failed answers so far
+	ExpiresAt time.Time `gorm:"index;not null" json:"expires_at"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (AuthChallenge) TableName() string {
+	return "auth_challenges"
+}
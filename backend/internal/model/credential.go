@@ -2,26 +2,46 @@ package model
 
 import (
 	"time"
+
+	"gorm.io/gorm"
 )
 
-// Credential represents an encrypted password entry
+// Credential represents an encrypted vault item. ItemType selects the schema
+// of its fields, see package itemtype; logins use the standard columns only.
 type Credential struct {
-	ID                int64     `gorm:"primaryKey;autoIncrement" json:"id"`
-	VaultID           int64     `gorm:"index;not null" json:"vault_id"`
-	TenantID          int64     `gorm:"index;not null" json:"tenant_id"`
-	TitleEncrypted    string    `gorm:"size:500;not null" json:"title_encrypted"`
-	URLEncrypted      string    `gorm:"size:2000" json:"url_encrypted,omitempty"`
-	UsernameEncrypted string    `gorm:"size:500" json:"username_encrypted,omitempty"`
-	PasswordEncrypted string    `gorm:"size:1000;not null" json:"password_encrypted"`
-	NotesEncrypted    string    `gorm:"type:text" json:"notes_encrypted,omitempty"`
-	Category          string    `gorm:"size:100" json:"category,omitempty"`
-	Favicon           string    `gorm:"size:500" json:"favicon,omitempty"`
-	CreatedAt         time.Time `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt         time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	ID                int64             `gorm:"primaryKey;autoIncrement" json:"id"`
+	VaultID           int64             `gorm:"index;index:idx_credentials_vault_category,priority:1;index:idx_credentials_vault_updated,priority:1;not null" json:"vault_id"`
+	TenantID          int64             `gorm:"index;not null" json:"tenant_id"`
+	ItemID            string            `gorm:"size:36;index" json:"item_id"` // client generated UUID bound into each field's associated data
+	ItemType          string            `gorm:"size:30;not null;default:login" json:"item_type"`
+	TitleEncrypted    string            `gorm:"size:500;not null" json:"title_encrypted"`
+	URLEncrypted      string            `gorm:"size:2000" json:"url_encrypted,omitempty"`
+	UsernameEncrypted string            `gorm:"size:500" json:"username_encrypted,omitempty"`
+	PasswordEncrypted string            `gorm:"size:1000" json:"password_encrypted,omitempty"`
+	NotesEncrypted    string            `gorm:"type:text" json:"notes_encrypted,omitempty"`
+	TOTPEncrypted     string            `gorm:"size:2000" json:"totp_encrypted,omitempty"`                   // otpauth:// URI of the item's one-time password seed
+	FieldsEncrypted   map[string]string `gorm:"type:text;serializer:json" json:"fields_encrypted,omitempty"` // the type's other fields by name
+	Category          string            `gorm:"size:100;index:idx_credentials_vault_category,priority:2" json:"category,omitempty"`
+	Favicon           string            `gorm:"size:500" json:"favicon,omitempty"`
+	MatchMode         string            `gorm:"size:20;not null;default:base_domain" json:"match_mode"` // which pages the URL fills, see domain.MatchMode
+	KeyGeneration     int               `gorm:"not null;default:1" json:"key_generation"`               // vault key generation the fields are encrypted under
+	UpdatedBy         int64             `gorm:"not null;default:0" json:"updated_by,omitempty"`         // user who last changed the encrypted content
+	CreatedAt         time.Time         `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt         time.Time         `gorm:"autoUpdateTime;index:idx_credentials_vault_updated,priority:2" json:"updated_at"`
+	DeletedAt         gorm.DeletedAt    `gorm:"index" json:"deleted_at,omitempty"` // set while the credential is in the trash
 
 	// Relations
-	Vault  *Vault  `gorm:"foreignKey:VaultID" json:"vault,omitempty"`
-	Tenant *Tenant `gorm:"foreignKey:TenantID" json:"tenant,omitempty"`
+	CustomFields []CredentialField       `gorm:"foreignKey:CredentialID" json:"custom_fields,omitempty"` // in display order
+	Attachments  []Attachment            `gorm:"foreignKey:CredentialID" json:"attachments,omitempty"`
+	SearchTokens []CredentialSearchToken `gorm:"foreignKey:CredentialID" json:"-"` // never loaded, set to replace them
+	Vault        *Vault                  `gorm:"foreignKey:VaultID" json:"vault,omitempty"`
+	Tenant       *Tenant                 `gorm:"foreignKey:TenantID" json:"tenant,omitempty"`
+
+	// Where the requesting user filed the credential, see Folder and Tag, and
+	// their own metadata for it
+	FolderID *int64              `gorm:"-" json:"folder_id,omitempty"`
+	TagIDs   []int64             `gorm:"-" json:"tag_ids,omitempty"`
+	Metadata *CredentialMetadata `gorm:"-" json:"metadata,omitempty"`
 }
 
 func (Credential) TableName() string {
@@ -30,15 +50,19 @@ func (Credential) TableName() string {
 
 // CredentialDTO is the decrypted representation sent to/from clients
 type CredentialDTO struct {
-	ID        int64     `json:"id"`
-	VaultID   int64     `json:"vault_id"`
-	Title     string    `json:"title"`
-	URL       string    `json:"url,omitempty"`
-	Username  string    `json:"username,omitempty"`
-	Password  string    `json:"password"`
-	Notes     string    `json:"notes,omitempty"`
-	Category  string    `json:"category,omitempty"`
-	Favicon   string    `json:"favicon,omitempty"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID           int64             `json:"id"`
+	VaultID      int64             `json:"vault_id"`
+	ItemType     string            `json:"item_type"`
+	Title        string            `json:"title"`
+	URL          string            `json:"url,omitempty"`
+	Username     string            `json:"username,omitempty"`
+	Password     string            `json:"password,omitempty"`
+	Notes        string            `json:"notes,omitempty"`
+	TOTP         string            `json:"totp,omitempty"` // otpauth:// URI, see package totp
+	Fields       map[string]string `json:"fields,omitempty"`
+	CustomFields []CustomFieldDTO  `json:"custom_fields,omitempty"`
+	Category     string            `json:"category,omitempty"`
+	Favicon      string            `json:"favicon,omitempty"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
 }
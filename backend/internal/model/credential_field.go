@@ -0,0 +1,43 @@
+package model
+
+import (
+	"time"
+)
+
+// Custom field type constants
+const (
+	CustomFieldText      = "text"
+	CustomFieldConcealed = "concealed"
+	CustomFieldURL       = "url"
+	CustomFieldEmail     = "email"
+	CustomFieldDate      = "date"
+	CustomFieldTOTP      = "totp" // otpauth:// URI, see package totp
+)
+
+// CredentialField is a user defined field of a credential, such as a
+// security question or a PIN. Label and value are encrypted like the
+// credential's own fields; FieldID is a client generated UUID bound into
+// their associated data.
+type CredentialField struct {
+	ID             int64     `gorm:"primaryKey;autoIncrement" json:"-"`
+	CredentialID   int64     `gorm:"not null;uniqueIndex:idx_credential_field" json:"-"`
+	FieldID        string    `gorm:"size:36;not null;uniqueIndex:idx_credential_field" json:"id"`
+	Type           string    `gorm:"size:20;not null" json:"type"`
+	LabelEncrypted string    `gorm:"size:1000;not null" json:"label_encrypted"`
+	ValueEncrypted string    `gorm:"type:text" json:"value_encrypted,omitempty"`
+	Position       int       `gorm:"not null;default:0" json:"position"`
+	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (CredentialField) TableName() string {
+	return "credential_fields"
+}
+
+// CustomFieldDTO is the decrypted representation of a custom field
+type CustomFieldDTO struct {
+	ID    string `json:"id"`
+	Type  string `json:"type"`
+	Label string `json:"label"`
+	Value string `json:"value,omitempty"`
+}
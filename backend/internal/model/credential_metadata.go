@@ -0,0 +1,24 @@
+package model
+
+import (
+	"time"
+)
+
+// CredentialMetadata is a user's own state for a credential: whether they
+// marked it a favorite and how they used it. Members of a shared vault each
+// keep their own, so it never shows up in another member's view.
+type CredentialMetadata struct {
+	ID           int64      `gorm:"primaryKey;autoIncrement" json:"-"`
+	UserID       int64      `gorm:"not null;uniqueIndex:idx_credential_metadata" json:"-"`
+	CredentialID int64      `gorm:"not null;uniqueIndex:idx_credential_metadata;index" json:"-"`
+	Favorite     bool       `gorm:"not null;default:false" json:"favorite"`
+	UseCount     int64      `gorm:"not null;default:0" json:"use_count"`  // every reported use, fills included
+	FillCount    int64      `gorm:"not null;default:0" json:"fill_count"` // uses that filled a form
+	LastUsedAt   *time.Time `json:"last_used_at,omitempty"`
+	LastFilledAt *time.Time `json:"last_filled_at,omitempty"`
+	UpdatedAt    time.Time  `gorm:"autoUpdateTime" json:"-"`
+}
+
+func (CredentialMetadata) TableName() string {
+	return "credential_metadata"
+}
@@ -0,0 +1,34 @@
+package model
+
+import (
+	"time"
+)
+
+// CredentialRevision is a previous version of a credential's encrypted
+// content, kept when an update or restore replaces it. Its ciphertexts are
+// bound to the credential's item and fields like the current ones, so a
+// revision can be restored by copying it back.
+type CredentialRevision struct {
+	ID                int64             `gorm:"primaryKey;autoIncrement" json:"-"`
+	CredentialID      int64             `gorm:"not null;uniqueIndex:idx_credential_revision" json:"credential_id"`
+	Revision          int               `gorm:"not null;uniqueIndex:idx_credential_revision" json:"revision"` // increases with every change of the credential
+	VaultID           int64             `gorm:"index;not null" json:"vault_id"`
+	ItemType          string            `gorm:"size:30;not null" json:"item_type"`
+	TitleEncrypted    string            `gorm:"size:500;not null" json:"title_encrypted"`
+	URLEncrypted      string            `gorm:"size:2000" json:"url_encrypted,omitempty"`
+	UsernameEncrypted string            `gorm:"size:500" json:"username_encrypted,omitempty"`
+	PasswordEncrypted string            `gorm:"size:1000" json:"password_encrypted,omitempty"`
+	NotesEncrypted    string            `gorm:"type:text" json:"notes_encrypted,omitempty"`
+	TOTPEncrypted     string            `gorm:"size:2000" json:"totp_encrypted,omitempty"`
+	FieldsEncrypted   map[string]string `gorm:"type:text;serializer:json" json:"fields_encrypted,omitempty"`
+	CustomFields      []CredentialField `gorm:"type:text;serializer:json" json:"custom_fields,omitempty"`
+	KeyGeneration     int               `gorm:"not null;default:1" json:"key_generation"`
+	UpdatedBy         int64             `gorm:"not null;default:0" json:"updated_by,omitempty"` // author of this version, unknown for versions saved before revisions existed
+	UpdatedAt         time.Time         `gorm:"autoUpdateTime:false" json:"updated_at"`         // when this version was saved
+	ReplacedBy        int64             `gorm:"not null" json:"replaced_by"`                    // user whose change archived this version
+	CreatedAt         time.Time         `gorm:"autoCreateTime" json:"created_at"`               // when this version was replaced
+}
+
+func (CredentialRevision) TableName() string {
+	return "credential_revisions"
+}
@@ -0,0 +1,14 @@
+package model
+
+// CredentialSearchToken is one blind index token of a credential: a keyed
+// HMAC of its domain or of a title word, see crypto.SearchToken. Searches
+// look credentials up by token without learning what was searched for.
+type CredentialSearchToken struct {
+	ID           int64  `gorm:"primaryKey;autoIncrement" json:"-"`
+	CredentialID int64  `gorm:"index;not null" json:"-"`
+	Token        string `gorm:"size:22;index;not null" json:"-"`
+}
+
+func (CredentialSearchToken) TableName() string {
+	return "credential_search_tokens"
+}
@@ -0,0 +1,22 @@
+package model
+
+import (
+	"time"
+)
+
+// EquivalentDomainGroup lists registrable domains that belong to the same
+// site and share accounts, such as google.com and youtube.com. Tenant admins
+// manage the groups of their tenant, which have no UserID; users add their
+// own on top.
+type EquivalentDomainGroup struct {
+	ID        int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	TenantID  int64     `gorm:"index;not null" json:"-"`
+	UserID    int64     `gorm:"index;not null;default:0" json:"-"`
+	Domains   []string  `gorm:"type:text;serializer:json" json:"domains"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (EquivalentDomainGroup) TableName() string {
+	return "equivalent_domain_groups"
+}
@@ -0,0 +1,127 @@
+package model
+
+import (
+	"time"
+)
+
+// Escrow request status constants
+const (
+	EscrowRequestPending   = "pending"   // Waiting for share holders to approve
+	EscrowRequestApproved  = "approved"  // Enough shares released, the requester can re-key the user
+	EscrowRequestCompleted = "completed" // The user has been re-keyed
+	EscrowRequestCancelled = "cancelled" // Withdrawn by an admin
+)
+
+// EscrowShare is one admin's share of the tenant escrow secret, wrapped to
+// that admin's public key
+type EscrowShare struct {
+	ID             int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	TenantID       int64     `gorm:"index;not null" json:"tenant_id"`
+	UserID         int64     `gorm:"index;not null" json:"user_id"`
+	EncryptedShare string    `gorm:"type:text;not null" json:"encrypted_share"` // RSA-OAEP wrapped Shamir share
+	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (EscrowShare) TableName() string {
+	return "escrow_shares"
+}
+
+// UserEscrow is a member's private key escrowed to the tenant escrow key. The
+// private key is encrypted with a random key, which is wrapped to the escrow
+// public key.
+type UserEscrow struct {
+	ID                  int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID              int64     `gorm:"uniqueIndex;not null" json:"user_id"`
+	TenantID            int64     `gorm:"index;not null" json:"tenant_id"`
+	EscrowKeyID         string    `gorm:"size:64;not null" json:"escrow_key_id"`
+	WrappedKey          string    `gorm:"type:text;not null" json:"wrapped_key"`
+	EncryptedPrivateKey string    `gorm:"type:text;not null" json:"encrypted_private_key"`
+	CreatedAt           time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt           time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (UserEscrow) TableName() string {
+	return "user_escrows"
+}
+
+// EscrowRequest asks the share holders to release their shares so that the
+// requesting admin can re-key a member
+type EscrowRequest struct {
+	ID          int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	TenantID    int64      `gorm:"index;not null" json:"tenant_id"`
+	UserID      int64      `gorm:"index;not null" json:"user_id"` // the member to re-key
+	RequestedBy int64      `gorm:"not null" json:"requested_by"`
+	Reason      string     `gorm:"size:500" json:"reason"`
+	Status      string     `gorm:"size:20;not null;default:'pending'" json:"status"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+
+	// Relations
+	Approvals []EscrowApproval `gorm:"foreignKey:RequestID" json:"approvals,omitempty"`
+}
+
+func (EscrowRequest) TableName() string {
+	return "escrow_requests"
+}
+
+// EscrowApproval is a share released by a share holder, re-wrapped to the
+// requesting admin's public key
+type EscrowApproval struct {
+	ID             int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	RequestID      int64     `gorm:"uniqueIndex:idx_escrow_approval;not null" json:"request_id"`
+	AdminID        int64     `gorm:"uniqueIndex:idx_escrow_approval;not null" json:"admin_id"`
+	EncryptedShare string    `gorm:"type:text;not null" json:"encrypted_share"`
+	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (EscrowApproval) TableName() string {
+	return "escrow_approvals"
+}
+
+// Escrow change status constants
+const (
+	EscrowChangePending   = "pending"   // Waiting for share holders to approve
+	EscrowChangeApplied   = "applied"   // Approved and in effect
+	EscrowChangeCancelled = "cancelled" // Withdrawn, or outdated by another change
+)
+
+// EscrowChange proposes to replace or disable a tenant's escrow key. Whoever
+// controls the escrow key can re-key members, so once escrow is enabled a
+// change only takes effect when the tenant's threshold of current share
+// holders, not counting the proposer, have approved it.
+type EscrowChange struct {
+	ID                  int64         `gorm:"primaryKey;autoIncrement" json:"id"`
+	TenantID            int64         `gorm:"index;not null" json:"tenant_id"`
+	ProposedBy          int64         `gorm:"not null" json:"proposed_by"`
+	EscrowKeyID         string        `gorm:"size:64;not null" json:"escrow_key_id"` // the escrow key being replaced
+	Disable             bool          `gorm:"default:false" json:"disable"`          // turn escrow off instead of replacing the key
+	PublicKey           string        `gorm:"type:text" json:"public_key,omitempty"`
+	EncryptedPrivateKey string        `gorm:"type:text" json:"-"`
+	Threshold           int           `gorm:"default:0" json:"threshold,omitempty"`
+	Shares              []EscrowShare `gorm:"type:text;serializer:json" json:"-"`
+	ShareHolders        []int64       `gorm:"type:text;serializer:json" json:"share_holders,omitempty"`
+	Status              string        `gorm:"size:20;not null;default:'pending'" json:"status"`
+	AppliedAt           *time.Time    `json:"applied_at,omitempty"`
+	CreatedAt           time.Time     `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt           time.Time     `gorm:"autoUpdateTime" json:"updated_at"`
+
+	// Relations
+	Approvals []EscrowChangeApproval `gorm:"foreignKey:ChangeID" json:"approvals,omitempty"`
+}
+
+func (EscrowChange) TableName() string {
+	return "escrow_changes"
+}
+
+// EscrowChangeApproval records a current share holder's consent to a change
+type EscrowChangeApproval struct {
+	ID        int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	ChangeID  int64     `gorm:"uniqueIndex:idx_escrow_change_approval;not null" json:"change_id"`
+	AdminID   int64     `gorm:"uniqueIndex:idx_escrow_change_approval;not null" json:"admin_id"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (EscrowChangeApproval) TableName() string {
+	return "escrow_change_approvals"
+}
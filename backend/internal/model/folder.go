@@ -0,0 +1,63 @@
+package model
+
+import (
+	"time"
+)
+
+// Folder is a user's own folder for organizing credentials across the vaults
+// they can see. Folders nest through ParentID. The name is encrypted with the
+// user's organizer key, see crypto.OrganizerKey.
+type Folder struct {
+	ID            int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID        int64     `gorm:"index;not null" json:"-"`
+	FolderID      string    `gorm:"size:36;uniqueIndex;not null" json:"folder_id"` // client generated UUID bound into the name's associated data
+	ParentID      *int64    `gorm:"index" json:"parent_id"`                        // nil for top-level folders
+	NameEncrypted string    `gorm:"size:1000;not null" json:"name_encrypted"`
+	CreatedAt     time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt     time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (Folder) TableName() string {
+	return "folders"
+}
+
+// Tag is a user's own label for credentials; a credential can carry many
+type Tag struct {
+	ID            int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID        int64     `gorm:"index;not null" json:"-"`
+	TagID         string    `gorm:"size:36;uniqueIndex;not null" json:"tag_id"` // client generated UUID bound into the name's associated data
+	NameEncrypted string    `gorm:"size:1000;not null" json:"name_encrypted"`
+	CreatedAt     time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt     time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (Tag) TableName() string {
+	return "tags"
+}
+
+// CredentialFolder files a credential in one of a user's folders. Members of
+// a shared vault each file its credentials their own way.
+type CredentialFolder struct {
+	ID           int64     `gorm:"primaryKey;autoIncrement" json:"-"`
+	UserID       int64     `gorm:"not null;uniqueIndex:idx_credential_folder" json:"-"`
+	CredentialID int64     `gorm:"not null;uniqueIndex:idx_credential_folder;index" json:"credential_id"`
+	FolderID     int64     `gorm:"index;not null" json:"folder_id"`
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (CredentialFolder) TableName() string {
+	return "credential_folders"
+}
+
+// CredentialTag attaches one of a user's tags to a credential
+type CredentialTag struct {
+	ID           int64     `gorm:"primaryKey;autoIncrement" json:"-"`
+	UserID       int64     `gorm:"index;not null" json:"-"`
+	CredentialID int64     `gorm:"not null;uniqueIndex:idx_credential_tag;index" json:"credential_id"`
+	TagID        int64     `gorm:"not null;uniqueIndex:idx_credential_tag;index" json:"tag_id"`
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (CredentialTag) TableName() string {
+	return "credential_tags"
+}
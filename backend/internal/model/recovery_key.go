@@ -0,0 +1,22 @@
+package model
+
+import (
+	"time"
+)
+
+// RecoveryKey holds a user's account recovery material. The recovery key
+// itself never reaches the server: only an SRP verifier derived from it and a
+// copy of the user's private key encrypted with it are stored.
+type RecoveryKey struct {
+	ID                  int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID              int64     `gorm:"uniqueIndex;not null" json:"user_id"`
+	SRPSalt             string    `gorm:"size:64;not null" json:"-"`
+	SRPVerifier         string    `gorm:"type:text;not null" json:"-"`
+	EncryptedPrivateKey string    `gorm:"type:text;not null" json:"-"` // private key encrypted with the recovery wrap key
+	CreatedAt           time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt           time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (RecoveryKey) TableName() string {
+	return "recovery_keys"
+}
@@ -12,6 +12,24 @@ type Tenant struct {
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 
+	RequireTwoFactor bool `gorm:"default:false" json:"require_two_factor"` // members must enroll two-factor authentication to log in
+
+	// Master password policy; a zero PasswordMinLength means the configured default applies
+	PasswordMinLength int `gorm:"default:0" json:"password_min_length,omitempty"`
+	PasswordMinScore  int `gorm:"default:0" json:"password_min_score,omitempty"` // strength score 0-4
+
+	AttachmentQuota int64 `gorm:"default:0" json:"attachment_quota,omitempty"` // bytes of attachments; zero means the configured default
+	MaxRevisions    int   `gorm:"default:0" json:"max_revisions,omitempty"`    // revisions kept per credential; zero means the configured default
+
+	// Organization escrow: members' private keys are wrapped to the escrow
+	// public key. The escrow private key is encrypted with a secret that is
+	// split among admins (see EscrowShare), so the server cannot use it.
+	EscrowEnabled             bool   `gorm:"default:false" json:"escrow_enabled"`
+	EscrowKeyID               string `gorm:"size:64" json:"escrow_key_id,omitempty"`
+	EscrowPublicKey           string `gorm:"type:text" json:"escrow_public_key,omitempty"` // base64 SPKI
+	EscrowEncryptedPrivateKey string `gorm:"type:text" json:"-"`                           // encrypted with the shared escrow secret
+	EscrowThreshold           int    `gorm:"default:0" json:"escrow_threshold,omitempty"`  // shares needed to rebuild the escrow secret
+
 	// Relations
 	Users  []User  `gorm:"foreignKey:TenantID" json:"users,omitempty"`
 	Vaults []Vault `gorm:"foreignKey:TenantID" json:"vaults,omitempty"`
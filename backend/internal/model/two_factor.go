@@ -0,0 +1,19 @@
+package model
+
+import (
+	"time"
+)
+
+// TwoFactorRecoveryCode is a single use code that replaces a TOTP code when
+// the authenticator is lost. Only a hash of the code is stored.
+type TwoFactorRecoveryCode struct {
+	ID        int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    int64      `gorm:"index;not null" json:"user_id"`
+	CodeHash  string     `gorm:"size:64;not null" json:"-"` // hex SHA-256 of the normalized code
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (TwoFactorRecoveryCode) TableName() string {
+	return "two_factor_recovery_codes"
+}
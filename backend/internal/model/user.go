@@ -26,20 +26,32 @@ const (
 
 // User represents a user in the system
 type User struct {
-	ID            int64     `gorm:"primaryKey;autoIncrement" json:"id"`
-	TenantID      int64     `gorm:"index;not null" json:"tenant_id"`
-	Email         string    `gorm:"size:255;uniqueIndex;not null" json:"email"`
-	PasswordHash  string    `gorm:"size:255" json:"-"`
-	MasterKeySalt string    `gorm:"size:64" json:"master_key_salt,omitempty"`
-	OAuthProvider string    `gorm:"size:50" json:"oauth_provider,omitempty"`
-	OAuthID       string    `gorm:"size:255" json:"-"`
-	Name          string    `gorm:"size:255" json:"name"`
-	Avatar        string    `gorm:"size:500" json:"avatar,omitempty"`
-	Role          string    `gorm:"size:50;default:'user'" json:"role"`         // super_admin, admin, user
-	AccountType   string    `gorm:"size:50;default:'team'" json:"account_type"` // personal, team
-	Status        string    `gorm:"size:50;default:'active'" json:"status"`     // active, inactive, invited
-	CreatedAt     time.Time `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt     time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	ID                  int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	TenantID            int64     `gorm:"index;index:idx_users_tenant_status,priority:1;index:idx_users_tenant_role,priority:1;index:idx_users_tenant_created,priority:1;not null" json:"tenant_id"`
+	Email               string    `gorm:"size:255;uniqueIndex;not null" json:"email"`
+	PasswordHash        string    `gorm:"size:255" json:"-"` // legacy bcrypt hash, cleared once an SRP verifier is set
+	SRPSalt             string    `gorm:"size:64" json:"-"`
+	SRPVerifier         string    `gorm:"type:text" json:"-"` // base64 SRP-6a verifier, the server never sees the password
+	MasterKeySalt       string    `gorm:"size:64" json:"master_key_salt,omitempty"`
+	KDFAlgorithm        string    `gorm:"size:20;default:'pbkdf2-sha256'" json:"kdf"` // pbkdf2-sha256, argon2id
+	KDFIterations       int       `gorm:"default:100000" json:"kdf_iterations"`       // PBKDF2 iterations or Argon2 time cost
+	KDFMemory           int       `gorm:"default:0" json:"kdf_memory,omitempty"`      // Argon2 memory in KiB
+	KDFParallelism      int       `gorm:"default:0" json:"kdf_parallelism,omitempty"` // Argon2 lanes
+	PublicKey           string    `gorm:"type:text" json:"public_key,omitempty"`      // base64 SPKI, used to wrap vault keys for this user
+	EncryptedPrivateKey string    `gorm:"type:text" json:"-"`                         // private key encrypted client-side with the master key
+	TwoFactorEnabled    bool      `gorm:"default:false" json:"two_factor_enabled"`
+	TwoFactorSecret     string    `gorm:"type:text" json:"-"`          // TOTP seed sealed with the server's two-factor key, pending until enabled
+	TwoFactorLastStep   int64     `gorm:"default:0" json:"-"`          // last accepted TOTP time step, so a code can't be replayed
+	TokenVersion        int       `gorm:"not null;default:0" json:"-"` // incremented to revoke every issued session token
+	OAuthProvider       string    `gorm:"size:50" json:"oauth_provider,omitempty"`
+	OAuthID             string    `gorm:"size:255" json:"-"`
+	Name                string    `gorm:"size:255" json:"name"`
+	Avatar              string    `gorm:"size:500" json:"avatar,omitempty"`
+	Role                string    `gorm:"size:50;default:'user';index:idx_users_tenant_role,priority:2" json:"role"`       // super_admin, admin, user
+	AccountType         string    `gorm:"size:50;default:'team'" json:"account_type"`                                      // personal, team
+	Status              string    `gorm:"size:50;default:'active';index:idx_users_tenant_status,priority:2" json:"status"` // active, inactive, invited
+	CreatedAt           time.Time `gorm:"autoCreateTime;index:idx_users_tenant_created,priority:2" json:"created_at"`
+	UpdatedAt           time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 
 	// Relations
 	Tenant       *Tenant       `gorm:"foreignKey:TenantID" json:"tenant,omitempty"`
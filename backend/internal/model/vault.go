@@ -2,19 +2,24 @@ package model
 
 import (
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // Vault represents a password vault that can contain multiple credentials
 type Vault struct {
-	ID          int64     `gorm:"primaryKey;autoIncrement" json:"id"`
-	TenantID    int64     `gorm:"index;not null" json:"tenant_id"`
-	Name        string    `gorm:"size:255;not null" json:"name"`
-	Description string    `gorm:"size:1000" json:"description,omitempty"`
-	Icon        string    `gorm:"size:100" json:"icon,omitempty"`
-	IsPersonal  bool      `gorm:"default:false" json:"is_personal"` // true = personal vault (only owner can see)
-	OwnerID     int64     `gorm:"index" json:"owner_id,omitempty"`  // Owner ID for personal vaults
-	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	ID              int64          `gorm:"primaryKey;autoIncrement" json:"id"`
+	TenantID        int64          `gorm:"index;not null" json:"tenant_id"`
+	Name            string         `gorm:"size:255;not null" json:"name"`
+	Description     string         `gorm:"size:1000" json:"description,omitempty"`
+	Icon            string         `gorm:"size:100" json:"icon,omitempty"`
+	IsPersonal      bool           `gorm:"default:false" json:"is_personal"`         // true = personal vault (only owner can see)
+	OwnerID         int64          `gorm:"index" json:"owner_id,omitempty"`          // Owner ID for personal vaults
+	KeyGeneration   int            `gorm:"not null;default:1" json:"key_generation"` // Incremented on every vault key rotation
+	RotationPending bool           `gorm:"default:false" json:"rotation_pending"`    // true = a member lost access and the key must be rotated
+	CreatedAt       time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt       time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"` // set while the vault is in the trash
 
 	// Relations
 	Tenant      *Tenant       `gorm:"foreignKey:TenantID" json:"tenant,omitempty"`
@@ -29,11 +34,14 @@ func (Vault) TableName() string {
 
 // VaultMember represents the membership of a user in a vault
 type VaultMember struct {
-	ID        int64     `gorm:"primaryKey;autoIncrement" json:"id"`
-	VaultID   int64     `gorm:"index;not null" json:"vault_id"`
-	UserID    int64     `gorm:"index;not null" json:"user_id"`
-	Role      string    `gorm:"size:50;not null;default:'viewer'" json:"role"` // owner, admin, editor, viewer
-	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	ID                int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	VaultID           int64     `gorm:"index;not null" json:"vault_id"`
+	UserID            int64     `gorm:"index;index:idx_vault_members_user_role,priority:1;not null" json:"user_id"`
+	Role              string    `gorm:"size:50;not null;default:'viewer';index:idx_vault_members_user_role,priority:2" json:"role"` // owner, admin, editor, viewer
+	EncryptedVaultKey string    `gorm:"type:text" json:"encrypted_vault_key,omitempty"`                                             // vault key wrapped with this member's public key
+	KeyGeneration     int       `gorm:"not null;default:1" json:"key_generation"`                                                   // generation of the wrapped vault key
+	KeyRevoked        bool      `gorm:"default:false" json:"key_revoked"`                                                           // true = the key was dropped by a password reset and must be shared again
+	CreatedAt         time.Time `gorm:"autoCreateTime" json:"created_at"`
 
 	// Relations
 	Vault *Vault `gorm:"foreignKey:VaultID" json:"vault,omitempty"`
@@ -52,6 +60,19 @@ const (
 	VaultRoleViewer = "viewer" // Read-only access
 )
 
+// vaultRoleRank orders vault roles from least to most privileged
+var vaultRoleRank = map[string]int{
+	VaultRoleViewer: 1,
+	VaultRoleEditor: 2,
+	VaultRoleAdmin:  3,
+	VaultRoleOwner:  4,
+}
+
+// IsVaultRoleDowngrade checks if changing from one role to another removes privileges
+func IsVaultRoleDowngrade(from, to string) bool {
+	return vaultRoleRank[to] < vaultRoleRank[from]
+}
+
 // CanManageMembers checks if the role can manage vault members
 func CanManageMembers(role string) bool {
 	return role == VaultRoleOwner || role == VaultRoleAdmin
@@ -0,0 +1,30 @@
+package model
+
+import (
+	"time"
+)
+
+// WebAuthnCredential is a security key or passkey registered to a user. It
+// serves as a second factor, and as a first factor too when it is
+// passwordless: stored on the authenticator and protected by a PIN or
+// biometric.
+type WebAuthnCredential struct {
+	ID               int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID           int64      `gorm:"index;not null" json:"user_id"`
+	CredentialID     string     `gorm:"type:text;not null" json:"credential_id"` // base64url, up to 1023 bytes decoded
+	CredentialIDHash string     `gorm:"size:64;uniqueIndex;not null" json:"-"`   // hex SHA-256 of the raw ID, for lookups
+	PublicKey        string     `gorm:"type:text;not null" json:"-"`             // base64 COSE_Key
+	Algorithm        int64      `gorm:"not null" json:"algorithm"`               // COSE algorithm
+	SignCount        uint32     `gorm:"not null;default:0" json:"-"`             // last signature counter seen
+	AAGUID           string     `gorm:"column:aaguid;size:36" json:"aaguid"`     // authenticator model
+	Transports       string     `gorm:"size:255" json:"transports"`              // comma separated hints for the browser
+	Name             string     `gorm:"size:100;not null" json:"name"`
+	Passwordless     bool       `gorm:"not null;default:false" json:"passwordless"`
+	BackupEligible   bool       `gorm:"not null;default:false" json:"backup_eligible"` // synced passkey rather than a hardware key
+	LastUsedAt       *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt        time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (WebAuthnCredential) TableName() string {
+	return "webauthn_credentials"
+}
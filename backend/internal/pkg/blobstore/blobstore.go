@@ -0,0 +1,85 @@
+// Package blobstore stores opaque blobs, such as encrypted file attachments,
+// by key. Drivers store the bytes they are given as is; encryption is the
+// caller's business.
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Drivers
+const (
+	DriverLocal = "local"
+	DriverS3    = "s3"
+)
+
+var (
+	ErrNotFound      = errors.New("blob not found")
+	ErrInvalidKey    = errors.New("invalid blob key")
+	ErrSizeMismatch  = errors.New("blob size does not match the declared size")
+	ErrUnknownDriver = errors.New("unknown blob store driver")
+)
+
+// Store is a blob storage backend
+type Store interface {
+	// Put stores size bytes read from r under key, replacing any blob with
+	// the same key
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get opens the blob stored under key
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob stored under key. Deleting a missing blob is
+	// not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Config selects and configures a driver
+type Config struct {
+	Driver string
+
+	// Local filesystem
+	Dir string
+
+	// S3-compatible object storage
+	Endpoint  string // e.g. https://s3.us-east-1.amazonaws.com or http://localhost:9000
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool // address the bucket in the path rather than the host name, as MinIO expects
+}
+
+// Open returns the store a config describes
+func Open(cfg Config) (Store, error) {
+	switch cfg.Driver {
+	case DriverLocal, "":
+		return NewLocal(cfg.Dir)
+	case DriverS3:
+		return NewS3(cfg)
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownDriver, cfg.Driver)
+}
+
+// validKey reports whether key is a relative, slash separated path of
+// letters, digits, '-', '_' and '.' that never leaves its root
+func validKey(key string) bool {
+	if key == "" || len(key) > 512 {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+		for _, c := range segment {
+			switch {
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,183 @@
+package blobstore_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/askuy/passwordx/backend/internal/pkg/blobstore"
+)
+
+func newLocal(t *testing.T) (*blobstore.Local, string) {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "blobs")
+	store, err := blobstore.NewLocal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, dir
+}
+
+func get(t *testing.T, store blobstore.Store, key string) string {
+	t.Helper()
+	rc, err := store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// files lists the regular files under dir, temporary files included
+func files(t *testing.T, dir string) []string {
+	t.Helper()
+	var names []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			rel, _ := filepath.Rel(dir, path)
+			names = append(names, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func TestLocal(t *testing.T) {
+	store, dir := newLocal(t)
+	ctx := context.Background()
+	key := "tenant-1/credential-7/3f2a.bin"
+
+	if err := store.Put(ctx, key, strings.NewReader("first"), 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(ctx, key, strings.NewReader("ciphertext"), 10); err != nil {
+		t.Fatal(err)
+	}
+	if got := get(t, store, key); got != "ciphertext" {
+		t.Errorf("Get = %q, want ciphertext", got)
+	}
+	if got := files(t, dir); len(got) != 1 || got[0] != key {
+		t.Errorf("files = %v, want [%s]", got, key)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, key); !errors.Is(err, blobstore.ErrNotFound) {
+		t.Errorf("Get after Delete error = %v, want %v", err, blobstore.ErrNotFound)
+	}
+	// Deleting a missing blob is not an error
+	if err := store.Delete(ctx, key); err != nil {
+		t.Errorf("Delete of a missing blob = %v", err)
+	}
+}
+
+func TestLocalSizeMismatch(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		size int64
+	}{
+		{"short", "abc", 10},
+		{"long", "abcdef", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, dir := newLocal(t)
+			ctx := context.Background()
+			if err := store.Put(ctx, "a.bin", strings.NewReader("kept"), 4); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Put(ctx, "a.bin", strings.NewReader(tt.data), tt.size); !errors.Is(err, blobstore.ErrSizeMismatch) {
+				t.Errorf("Put error = %v, want %v", err, blobstore.ErrSizeMismatch)
+			}
+			// A failed upload leaves the previous blob and no temporary file
+			if got := get(t, store, "a.bin"); got != "kept" {
+				t.Errorf("Get = %q, want kept", got)
+			}
+			if got := files(t, dir); len(got) != 1 {
+				t.Errorf("files = %v, want [a.bin]", got)
+			}
+		})
+	}
+}
+
+func TestLocalCancelled(t *testing.T) {
+	store, dir := newLocal(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := store.Put(ctx, "a.bin", strings.NewReader("abc"), 3); !errors.Is(err, context.Canceled) {
+		t.Errorf("Put error = %v, want %v", err, context.Canceled)
+	}
+	if got := files(t, dir); len(got) != 0 {
+		t.Errorf("files = %v, want none", got)
+	}
+}
+
+func TestLocalInvalidKey(t *testing.T) {
+	store, dir := newLocal(t)
+	ctx := context.Background()
+	keys := []string{
+		"",
+		"../escape",
+		"a/../../escape",
+		"/abs",
+		"a//b",
+		"a/",
+		".",
+		"a b",
+		`a\b`,
+		strings.Repeat("a", 513),
+	}
+	for _, key := range keys {
+		if err := store.Put(ctx, key, strings.NewReader("x"), 1); !errors.Is(err, blobstore.ErrInvalidKey) {
+			t.Errorf("Put(%q) error = %v, want %v", key, err, blobstore.ErrInvalidKey)
+		}
+		if _, err := store.Get(ctx, key); !errors.Is(err, blobstore.ErrInvalidKey) {
+			t.Errorf("Get(%q) error = %v, want %v", key, err, blobstore.ErrInvalidKey)
+		}
+		if err := store.Delete(ctx, key); !errors.Is(err, blobstore.ErrInvalidKey) {
+			t.Errorf("Delete(%q) error = %v, want %v", key, err, blobstore.ErrInvalidKey)
+		}
+	}
+	if got := files(t, filepath.Dir(dir)); len(got) != 0 {
+		t.Errorf("files = %v, want none", got)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		cfg     blobstore.Config
+		wantErr bool
+	}{
+		{"default driver", blobstore.Config{Dir: dir}, false},
+		{"local", blobstore.Config{Driver: blobstore.DriverLocal, Dir: dir}, false},
+		{"local without directory", blobstore.Config{Driver: blobstore.DriverLocal}, true},
+		{"s3", blobstore.Config{Driver: blobstore.DriverS3, Endpoint: "http://localhost:9000", Bucket: "b", AccessKey: "a", SecretKey: "s"}, false},
+		{"s3 without bucket", blobstore.Config{Driver: blobstore.DriverS3, Endpoint: "http://localhost:9000", AccessKey: "a", SecretKey: "s"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := blobstore.Open(tt.cfg); (err != nil) != tt.wantErr {
+				t.Errorf("Open error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := blobstore.Open(blobstore.Config{Driver: "gcs"}); !errors.Is(err, blobstore.ErrUnknownDriver) {
+		t.Errorf("Open error = %v, want %v", err, blobstore.ErrUnknownDriver)
+	}
+}
@@ -0,0 +1,313 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testAccessKey = "AKIDEXAMPLE"
+	testSecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+)
+
+// fakeS3 is an in-memory stand-in for an S3 bucket. It checks the signature
+// of every request the way S3 does, from what arrives on the wire.
+type fakeS3 struct {
+	bucket    string
+	pathStyle bool
+
+	mu      sync.Mutex
+	objects map[string][]byte
+	hosts   []string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := f.verify(r); err != "" {
+		writeS3Error(w, http.StatusForbidden, err)
+		return
+	}
+
+	// Every test endpoint has the path /prefix
+	key := strings.TrimPrefix(r.URL.EscapedPath(), "/prefix/")
+	if f.pathStyle {
+		if !strings.HasPrefix(key, f.bucket+"/") {
+			writeS3Error(w, http.StatusNotFound, "NoSuchBucket")
+			return
+		}
+		key = strings.TrimPrefix(key, f.bucket+"/")
+	} else if !strings.HasPrefix(r.Host, f.bucket+".") {
+		writeS3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.hosts = append(f.hosts, r.Host)
+	switch r.Method {
+	case http.MethodPut:
+		body, err := io.ReadAll(r.Body)
+		if err != nil || int64(len(body)) != r.ContentLength {
+			writeS3Error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		f.objects[key] = body
+	case http.MethodGet:
+		body, ok := f.objects[key]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Write(body)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeS3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+// verify recomputes the signature of r from the headers its Authorization
+// header lists and returns an S3 error code if it does not match
+func (f *fakeS3) verify(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	prefix := sigV4Algorithm + " Credential=" + testAccessKey + "/"
+	if !strings.HasPrefix(auth, prefix) {
+		return "InvalidAccessKeyId"
+	}
+	parts := strings.Split(strings.TrimPrefix(auth, prefix), ", ")
+	if len(parts) != 3 || !strings.HasPrefix(parts[1], "SignedHeaders=") || !strings.HasPrefix(parts[2], "Signature=") {
+		return "AuthorizationHeaderMalformed"
+	}
+	scope := parts[0]
+	signedHeaders := strings.TrimPrefix(parts[1], "SignedHeaders=")
+	signature := strings.TrimPrefix(parts[2], "Signature=")
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	date, err := time.Parse(sigV4Time, amzDate)
+	if err != nil || scope != date.Format(sigV4Date)+"/us-east-1/s3/aws4_request" {
+		return "AuthorizationHeaderMalformed"
+	}
+
+	var canonicalHeaders strings.Builder
+	names := strings.Split(signedHeaders, ";")
+	if !sort.StringsAreSorted(names) {
+		return "AuthorizationHeaderMalformed"
+	}
+	for _, name := range names {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + value + "\n")
+	}
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		r.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		r.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	stringToSign := strings.Join([]string{sigV4Algorithm, amzDate, scope, hexSHA256([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+testSecretKey), date.Format(sigV4Date))
+	key = hmacSHA256(key, "us-east-1")
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	if !hmac.Equal([]byte(hex.EncodeToString(hmacSHA256(key, stringToSign))), []byte(signature)) {
+		return "SignatureDoesNotMatch"
+	}
+	return ""
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>`+code+`</Code><Message>test</Message></Error>`)
+}
+
+// newTestS3 starts a stand-in bucket and returns a store for it. The store
+// dials the stand-in whatever host name it addresses, so virtual-hosted
+// style works without DNS.
+func newTestS3(t *testing.T, pathStyle bool, secretKey string) (*S3, *fakeS3) {
+	t.Helper()
+	fake := &fakeS3{bucket: "attachments", pathStyle: pathStyle, objects: make(map[string][]byte)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	store, err := NewS3(Config{
+		Endpoint:  "http://s3.test/prefix",
+		Bucket:    fake.bucket,
+		AccessKey: testAccessKey,
+		SecretKey: secretKey,
+		PathStyle: pathStyle,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := server.Listener.Addr().String()
+	store.client = &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	return store, fake
+}
+
+func TestS3(t *testing.T) {
+	for _, pathStyle := range []bool{true, false} {
+		name := "virtual-hosted style"
+		if pathStyle {
+			name = "path style"
+		}
+		t.Run(name, func(t *testing.T) {
+			store, fake := newTestS3(t, pathStyle, testSecretKey)
+			ctx := context.Background()
+			key := "tenant-1/credential-7/3f2a.bin"
+
+			if err := store.Put(ctx, key, bytes.NewReader([]byte("first")), 5); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Put(ctx, key, bytes.NewReader([]byte("ciphertext")), 10); err != nil {
+				t.Fatal(err)
+			}
+			if got := readAll(t, store, key); got != "ciphertext" {
+				t.Errorf("Get = %q, want ciphertext", got)
+			}
+
+			if _, ok := fake.objects[key]; !ok || len(fake.objects) != 1 {
+				t.Errorf("stored objects %v, want only %s", fake.objects, key)
+			}
+			wantHost := "s3.test"
+			if !pathStyle {
+				wantHost = "attachments.s3.test"
+			}
+			for _, host := range fake.hosts {
+				if host != wantHost {
+					t.Errorf("request to host %s, want %s", host, wantHost)
+				}
+			}
+
+			if err := store.Delete(ctx, key); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get after Delete error = %v, want %v", err, ErrNotFound)
+			}
+			// Deleting a missing blob is not an error
+			if err := store.Delete(ctx, key); err != nil {
+				t.Errorf("Delete of a missing blob = %v", err)
+			}
+		})
+	}
+}
+
+func TestS3RejectsBadSignature(t *testing.T) {
+	store, _ := newTestS3(t, true, "not-the-secret")
+	err := store.Put(context.Background(), "a.bin", strings.NewReader("x"), 1)
+	if err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Errorf("Put error = %v, want SignatureDoesNotMatch", err)
+	}
+}
+
+func TestS3ShortBody(t *testing.T) {
+	store, fake := newTestS3(t, true, testSecretKey)
+	if err := store.Put(context.Background(), "a.bin", strings.NewReader("abc"), 10); err == nil {
+		t.Error("Put of fewer bytes than declared succeeded")
+	}
+	if len(fake.objects) != 0 {
+		t.Errorf("objects = %v, want none", fake.objects)
+	}
+}
+
+func TestS3InvalidKey(t *testing.T) {
+	store, fake := newTestS3(t, true, testSecretKey)
+	ctx := context.Background()
+	for _, key := range []string{"", "../escape", "a//b", "/abs", "a b", "a?b"} {
+		if err := store.Put(ctx, key, strings.NewReader("x"), 1); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q) error = %v, want %v", key, err, ErrInvalidKey)
+		}
+		if _, err := store.Get(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Get(%q) error = %v, want %v", key, err, ErrInvalidKey)
+		}
+	}
+	if len(fake.hosts) != 0 {
+		t.Errorf("%d requests sent for invalid keys", len(fake.hosts))
+	}
+}
+
+func TestS3ObjectURL(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoint  string
+		pathStyle bool
+		key       string
+		want      string
+	}{
+		{"path style", "http://localhost:9000", true, "a/b.bin", "http://localhost:9000/attachments/a/b.bin"},
+		{"virtual-hosted style", "https://s3.us-east-1.amazonaws.com", false, "a/b.bin", "https://attachments.s3.us-east-1.amazonaws.com/a/b.bin"},
+		{"endpoint path", "https://storage.example.com/s3/", true, "a.bin", "https://storage.example.com/s3/attachments/a.bin"},
+		{"endpoint query dropped", "https://storage.example.com?x=1", true, "a.bin", "https://storage.example.com/attachments/a.bin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := NewS3(Config{Endpoint: tt.endpoint, Bucket: "attachments", AccessKey: "a", SecretKey: "s", PathStyle: tt.pathStyle})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := store.objectURL(tt.key).String(); got != tt.want {
+				t.Errorf("objectURL = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewS3Invalid(t *testing.T) {
+	valid := Config{Endpoint: "https://s3.example.com", Bucket: "b", AccessKey: "a", SecretKey: "s"}
+	tests := []struct {
+		name   string
+		modify func(*Config)
+	}{
+		{"no endpoint", func(c *Config) { c.Endpoint = "" }},
+		{"no bucket", func(c *Config) { c.Bucket = "" }},
+		{"no access key", func(c *Config) { c.AccessKey = "" }},
+		{"no secret key", func(c *Config) { c.SecretKey = "" }},
+		{"bad scheme", func(c *Config) { c.Endpoint = "ftp://s3.example.com" }},
+		{"no host", func(c *Config) { c.Endpoint = "https://" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid
+			tt.modify(&cfg)
+			if _, err := NewS3(cfg); err == nil {
+				t.Error("NewS3 succeeded")
+			}
+		})
+	}
+}
+
+func readAll(t *testing.T, store Store, key string) string {
+	t.Helper()
+	rc, err := store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
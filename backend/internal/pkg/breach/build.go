@@ -0,0 +1,212 @@
+package breach
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+var (
+	ErrInvalidLine   = errors.New("invalid breach corpus line")
+	ErrDuplicateHash = errors.New("duplicate hash in breach corpus")
+	ErrTooManyHashes = errors.New("breach corpus has too many hashes")
+)
+
+// Build imports a breach corpus into an index at path. The corpus has one
+// "SHA1HEX:COUNT" line per hash, as in the Pwned Passwords downloads; a
+// missing count counts as 1. Input ordered by hash is written in one
+// sequential pass, other orders are sorted per prefix afterwards. The index
+// is written to a temporary file and renamed into place, so a running
+// server never sees a partial index. Build returns the number of hashes.
+func Build(path string, corpus io.ReadSeeker) (int, error) {
+	// First pass: validate and count the hashes of every prefix
+	counts := make([]uint32, prefixCount)
+	total, sorted := 0, true
+	var last [sha1.Size]byte
+	err := scanCorpus(corpus, func(hash [sha1.Size]byte, count uint32) error {
+		if uint64(total) == math.MaxUint32 {
+			return ErrTooManyHashes
+		}
+		if total > 0 && bytes.Compare(hash[:], last[:]) <= 0 {
+			if hash == last {
+				return fmt.Errorf("%w: %X", ErrDuplicateHash, hash)
+			}
+			sorted = false
+		}
+		counts[prefixOf(hash[:])]++
+		total++
+		last = hash
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	fanout := make([]uint32, prefixCount+1)
+	for p, n := range counts {
+		fanout[p+1] = fanout[p] + n
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err := writeIndex(f, corpus, fanout, sorted); err != nil {
+		return 0, err
+	}
+	if err := f.Sync(); err != nil {
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	return total, os.Rename(f.Name(), path)
+}
+
+func writeIndex(f *os.File, corpus io.ReadSeeker, fanout []uint32, sorted bool) error {
+	header := make([]byte, headerSize)
+	copy(header, magic)
+	binary.BigEndian.PutUint32(header[len(magic):], version)
+	for i, v := range fanout {
+		binary.BigEndian.PutUint32(header[len(magic)+8+i*4:], v)
+	}
+	if _, err := f.Write(header); err != nil {
+		return err
+	}
+
+	if _, err := corpus.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	record := make([]byte, recordSize)
+	encode := func(hash [sha1.Size]byte, count uint32) []byte {
+		copy(record, hash[recordOffset:])
+		binary.BigEndian.PutUint32(record[recordHashLen:], count)
+		return record
+	}
+
+	// Second pass: write the records, sequentially if the corpus is ordered
+	if sorted {
+		w := bufio.NewWriterSize(f, 1<<20)
+		err := scanCorpus(corpus, func(hash [sha1.Size]byte, count uint32) error {
+			_, err := w.Write(encode(hash, count))
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		return w.Flush()
+	}
+
+	next := make([]uint32, prefixCount)
+	copy(next, fanout)
+	err := scanCorpus(corpus, func(hash [sha1.Size]byte, count uint32) error {
+		p := prefixOf(hash[:])
+		offset := int64(headerSize) + int64(next[p])*recordSize
+		next[p]++
+		_, err := f.WriteAt(encode(hash, count), offset)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return sortBuckets(f, fanout)
+}
+
+// sortBuckets sorts the records of every prefix in place
+func sortBuckets(f *os.File, fanout []uint32) error {
+	for p := 0; p < prefixCount; p++ {
+		n := int(fanout[p+1] - fanout[p])
+		if n < 2 {
+			continue
+		}
+		offset := int64(headerSize) + int64(fanout[p])*recordSize
+		bucket := make([]byte, n*recordSize)
+		if _, err := f.ReadAt(bucket, offset); err != nil {
+			return err
+		}
+		sort.Sort(records(bucket))
+		for i := 1; i < n; i++ {
+			if bytes.Equal(bucket[(i-1)*recordSize:(i-1)*recordSize+recordHashLen], bucket[i*recordSize:i*recordSize+recordHashLen]) {
+				return ErrDuplicateHash
+			}
+		}
+		if _, err := f.WriteAt(bucket, offset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// records sorts packed records by hash
+type records []byte
+
+func (r records) Len() int { return len(r) / recordSize }
+
+func (r records) Less(i, j int) bool {
+	return bytes.Compare(r[i*recordSize:i*recordSize+recordHashLen], r[j*recordSize:j*recordSize+recordHashLen]) < 0
+}
+
+func (r records) Swap(i, j int) {
+	var tmp [recordSize]byte
+	a, b := r[i*recordSize:(i+1)*recordSize], r[j*recordSize:(j+1)*recordSize]
+	copy(tmp[:], a)
+	copy(a, b)
+	copy(b, tmp[:])
+}
+
+// scanCorpus calls fn for every hash in the corpus
+func scanCorpus(corpus io.Reader, fn func(hash [sha1.Size]byte, count uint32) error) error {
+	scanner := bufio.NewScanner(corpus)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		hash, count, err := parseLine(text)
+		if err != nil {
+			return fmt.Errorf("%w: line %d", err, line)
+		}
+		if err := fn(hash, count); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func parseLine(line []byte) ([sha1.Size]byte, uint32, error) {
+	var hash [sha1.Size]byte
+	hexHash, countText, hasCount := bytes.Cut(line, []byte{':'})
+	if len(hexHash) != sha1.Size*2 {
+		return hash, 0, ErrInvalidLine
+	}
+	for i := range hash {
+		hi, ok1 := hexValue(hexHash[i*2])
+		lo, ok2 := hexValue(hexHash[i*2+1])
+		if !ok1 || !ok2 {
+			return hash, 0, ErrInvalidLine
+		}
+		hash[i] = hi<<4 | lo
+	}
+
+	count := uint64(1)
+	if hasCount {
+		var err error
+		if count, err = strconv.ParseUint(string(countText), 10, 64); err != nil {
+			return hash, 0, ErrInvalidLine
+		}
+	}
+	// Counts beyond uint32 are saturated, they only need to be "a lot"
+	return hash, uint32(min(count, math.MaxUint32)), nil
+}
@@ -0,0 +1,201 @@
+// Package breach looks up SHA-1 password hashes in a local copy of a breach
+// corpus such as Pwned Passwords.
+//
+// The corpus is imported once into a compact binary index: a fan-out table of
+// the 2^20 five hex digit prefixes followed by fixed size records sorted by
+// hash. A range query for a prefix is a single read, so the server can answer
+// k-anonymity lookups without any password or full hash leaving the client.
+//
+// Index layout, all integers big endian:
+//
+//	magic   [8]byte   "PXBREACH"
+//	version uint32    1
+//	_       uint32    reserved
+//	fanout  [2^20+1]uint32  index of the first record of every prefix
+//	records []record  hash[2:20] followed by a uint32 count
+package breach
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// PrefixLength is the number of hex digits of a range query
+const PrefixLength = 5
+
+const (
+	magic         = "PXBREACH"
+	version       = 1
+	prefixCount   = 1 << (PrefixLength * 4)
+	fanoutSize    = (prefixCount + 1) * 4
+	headerSize    = len(magic) + 8 + fanoutSize
+	recordOffset  = 2 // the first two hash bytes are part of the prefix
+	recordHashLen = sha1.Size - recordOffset
+	recordSize    = recordHashLen + 4
+)
+
+var (
+	ErrInvalidPrefix = errors.New("hash prefix must be 5 hex digits")
+	ErrInvalidIndex  = errors.New("invalid breach index")
+)
+
+// Entry is a hash suffix in a range and how often it was seen in breaches
+type Entry struct {
+	Suffix string // the remaining 35 uppercase hex digits of the SHA-1 hash
+	Count  uint32
+}
+
+// Index is an open breach index. It is safe for concurrent use.
+type Index struct {
+	f      *os.File
+	fanout []uint32
+}
+
+// Open opens an index written by Build
+func Open(path string) (*Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(f, header); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIndex, err)
+	}
+	if string(header[:len(magic)]) != magic || binary.BigEndian.Uint32(header[len(magic):]) != version {
+		f.Close()
+		return nil, fmt.Errorf("%w: unknown format", ErrInvalidIndex)
+	}
+
+	fanout := make([]uint32, prefixCount+1)
+	table := header[len(magic)+8:]
+	for i := range fanout {
+		fanout[i] = binary.BigEndian.Uint32(table[i*4:])
+		if i > 0 && fanout[i] < fanout[i-1] {
+			f.Close()
+			return nil, fmt.Errorf("%w: corrupt fan-out table", ErrInvalidIndex)
+		}
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.Size() != int64(headerSize)+int64(fanout[prefixCount])*recordSize {
+		f.Close()
+		return nil, fmt.Errorf("%w: truncated", ErrInvalidIndex)
+	}
+
+	return &Index{f: f, fanout: fanout}, nil
+}
+
+// Close closes the index file
+func (ix *Index) Close() error {
+	return ix.f.Close()
+}
+
+// Len returns the number of hashes in the index
+func (ix *Index) Len() int {
+	return int(ix.fanout[prefixCount])
+}
+
+// Range returns all hashes that start with prefix, in order
+func (ix *Index) Range(prefix string) ([]Entry, error) {
+	p, err := parsePrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	records, err := ix.bucket(p)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, len(records)/recordSize)
+	for i := range entries {
+		record := records[i*recordSize:]
+		// The first hex digit of the record belongs to the prefix
+		suffix := hex.EncodeToString(record[:recordHashLen])[1:]
+		entries[i] = Entry{
+			Suffix: strings.ToUpper(suffix),
+			Count:  binary.BigEndian.Uint32(record[recordHashLen:]),
+		}
+	}
+	return entries, nil
+}
+
+// Lookup returns how often hash was seen in breaches, or 0 if never
+func (ix *Index) Lookup(hash [sha1.Size]byte) (uint32, error) {
+	records, err := ix.bucket(prefixOf(hash[:]))
+	if err != nil {
+		return 0, err
+	}
+
+	n := len(records) / recordSize
+	want := hash[recordOffset:]
+	i := sort.Search(n, func(i int) bool {
+		return string(records[i*recordSize:i*recordSize+recordHashLen]) >= string(want)
+	})
+	if i < n && string(records[i*recordSize:i*recordSize+recordHashLen]) == string(want) {
+		return binary.BigEndian.Uint32(records[i*recordSize+recordHashLen:]), nil
+	}
+	return 0, nil
+}
+
+// LookupPassword returns how often password was seen in breaches
+func (ix *Index) LookupPassword(password string) (uint32, error) {
+	return ix.Lookup(sha1.Sum([]byte(password)))
+}
+
+// bucket reads the records of a prefix
+func (ix *Index) bucket(prefix uint32) ([]byte, error) {
+	start, end := ix.fanout[prefix], ix.fanout[prefix+1]
+	records := make([]byte, int(end-start)*recordSize)
+	if len(records) == 0 {
+		return records, nil
+	}
+	if _, err := ix.f.ReadAt(records, int64(headerSize)+int64(start)*recordSize); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func parsePrefix(prefix string) (uint32, error) {
+	if len(prefix) != PrefixLength {
+		return 0, ErrInvalidPrefix
+	}
+	var p uint32
+	for _, c := range []byte(prefix) {
+		v, ok := hexValue(c)
+		if !ok {
+			return 0, ErrInvalidPrefix
+		}
+		p = p<<4 | uint32(v)
+	}
+	return p, nil
+}
+
+// prefixOf returns the first PrefixLength hex digits of a hash as a number
+func prefixOf(hash []byte) uint32 {
+	return uint32(hash[0])<<12 | uint32(hash[1])<<4 | uint32(hash[2])>>4
+}
+
+func hexValue(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
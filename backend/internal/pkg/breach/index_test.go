@@ -0,0 +1,225 @@
+package breach_test
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/askuy/passwordx/backend/internal/pkg/breach"
+)
+
+// SHA-1 of "password"
+const passwordHash = "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8"
+
+// corpus is ordered by hash. Three of its hashes share the prefix 5BAA6 and
+// one more differs from them in the fifth hex digit only.
+var corpus = []string{
+	"0000000000000000000000000000000000000000:7",
+	"5BAA6000000000000000000000000000000000FF:3",
+	passwordHash + ":9545824",
+	"5baa6fffffffffffffffffffffffffffffffffff",
+	"5BAA700000000000000000000000000000000000:2",
+	"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF:99999999999",
+}
+
+func build(t *testing.T, lines []string) (string, int, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "breach.idx")
+	n, err := breach.Build(path, strings.NewReader(strings.Join(lines, "\n")+"\n"))
+	return path, n, err
+}
+
+func open(t *testing.T, lines []string) *breach.Index {
+	t.Helper()
+	path, n, err := build(t, lines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(lines) {
+		t.Fatalf("Build = %d, want %d", n, len(lines))
+	}
+	ix, err := breach.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ix.Close() })
+	return ix
+}
+
+func hash(t *testing.T, hexHash string) [sha1.Size]byte {
+	t.Helper()
+	var h [sha1.Size]byte
+	if _, err := hex.Decode(h[:], []byte(hexHash)); err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestBuildOrderIndependent(t *testing.T) {
+	shuffled := []string{corpus[3], corpus[5], corpus[2], corpus[0], corpus[4], corpus[1]}
+	sortedPath, _, err := build(t, corpus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shuffledPath, _, err := build(t, shuffled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := os.ReadFile(sortedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(shuffledPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a, b) {
+		t.Error("sorted and shuffled corpora built different indexes")
+	}
+}
+
+func TestRange(t *testing.T) {
+	ix := open(t, corpus)
+	if ix.Len() != len(corpus) {
+		t.Errorf("Len = %d, want %d", ix.Len(), len(corpus))
+	}
+
+	bucket := []breach.Entry{
+		{Suffix: "000000000000000000000000000000000FF", Count: 3},
+		{Suffix: passwordHash[breach.PrefixLength:], Count: 9545824},
+		{Suffix: "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF", Count: 1},
+	}
+	tests := []struct {
+		prefix string
+		want   []breach.Entry
+	}{
+		{"5BAA6", bucket},
+		{"5baa6", bucket},
+		{"5BAA7", []breach.Entry{{Suffix: "00000000000000000000000000000000000", Count: 2}}},
+		{"00000", []breach.Entry{{Suffix: "00000000000000000000000000000000000", Count: 7}}},
+		// Counts beyond uint32 saturate
+		{"FFFFF", []breach.Entry{{Suffix: "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF", Count: 1<<32 - 1}}},
+		{"12345", []breach.Entry{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			got, err := ix.Range(tt.prefix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Range(%s) = %v, want %v", tt.prefix, got, tt.want)
+			}
+		})
+	}
+
+	for _, prefix := range []string{"", "5BAA", "5BAA61", "5BAAG", "5BAA-"} {
+		if _, err := ix.Range(prefix); !errors.Is(err, breach.ErrInvalidPrefix) {
+			t.Errorf("Range(%q) error = %v, want %v", prefix, err, breach.ErrInvalidPrefix)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	ix := open(t, corpus)
+
+	tests := []struct {
+		name string
+		hash string
+		want uint32
+	}{
+		{"present", passwordHash, 9545824},
+		{"first hash", "0000000000000000000000000000000000000000", 7},
+		{"default count", "5BAA6FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF", 1},
+		{"absent, same bucket", "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD9", 0},
+		{"absent, empty bucket", "1234500000000000000000000000000000000000", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ix.Lookup(hash(t, tt.hash))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Lookup = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	if got, err := ix.LookupPassword("password"); err != nil || got != 9545824 {
+		t.Errorf("LookupPassword = %d, %v, want 9545824", got, err)
+	}
+	if got, err := ix.LookupPassword("correct horse battery staple"); err != nil || got != 0 {
+		t.Errorf("LookupPassword = %d, %v, want 0", got, err)
+	}
+}
+
+func TestBuildInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		wantErr error
+	}{
+		{"short hash", []string{"5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD:1"}, breach.ErrInvalidLine},
+		{"not hex", []string{"5BAA61E4C9B93F3F0682250B6CF8331B7EE68FDX:1"}, breach.ErrInvalidLine},
+		{"bad count", []string{passwordHash + ":many"}, breach.ErrInvalidLine},
+		{"negative count", []string{passwordHash + ":-1"}, breach.ErrInvalidLine},
+		{"duplicate, sorted", []string{passwordHash + ":1", passwordHash + ":2"}, breach.ErrDuplicateHash},
+		{"duplicate, unsorted", []string{passwordHash, corpus[1], strings.ToLower(passwordHash)}, breach.ErrDuplicateHash},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, _, err := build(t, tt.lines)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Build error = %v, want %v", err, tt.wantErr)
+			}
+			// Failed builds leave nothing behind
+			if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 0 {
+				t.Errorf("Build left %d files", len(entries))
+			}
+		})
+	}
+}
+
+func TestOpenInvalid(t *testing.T) {
+	path, _, err := build(t, corpus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"short header", valid[:100]},
+		{"wrong magic", append([]byte("NOTBREACH"), valid[9:]...)},
+		{"truncated records", valid[:len(valid)-1]},
+		{"trailing data", append(bytes.Clone(valid), 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "breach.idx")
+			if err := os.WriteFile(path, tt.data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			ix, err := breach.Open(path)
+			if err == nil {
+				ix.Close()
+			}
+			if !errors.Is(err, breach.ErrInvalidIndex) {
+				t.Errorf("Open error = %v, want %v", err, breach.ErrInvalidIndex)
+			}
+		})
+	}
+}
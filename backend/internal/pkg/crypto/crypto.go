@@ -9,7 +9,7 @@ import (
 	"errors"
 	"io"
 
-	"golang.org/x/crypto/pbkdf2"
+	"github.com/askuy/passwordx/backend/internal/pkg/generator"
 )
 
 const (
@@ -19,7 +19,7 @@ const (
 	KeySize = 32
 	// NonceSize is the size of the GCM nonce
 	NonceSize = 12
-	// PBKDF2Iterations is the number of iterations for PBKDF2
+	// PBKDF2Iterations is the number of iterations for legacy PBKDF2 accounts
 	PBKDF2Iterations = 100000
 )
 
@@ -32,28 +32,23 @@ func GenerateSalt() (string, error) {
 	return base64.StdEncoding.EncodeToString(salt), nil
 }
 
-// DeriveKey derives an AES-256 key from a password using PBKDF2
+// DeriveKey derives an AES-256 key from a password using the legacy PBKDF2 parameters.
+// Use DeriveKeyWithParams with the user's stored KDF parameters instead.
 func DeriveKey(password, saltBase64 string) ([]byte, error) {
-	salt, err := base64.StdEncoding.DecodeString(saltBase64)
-	if err != nil {
-		return nil, err
-	}
-	key := pbkdf2.Key([]byte(password), salt, PBKDF2Iterations, KeySize, sha256.New)
-	return key, nil
+	return DeriveKeyWithParams(password, saltBase64, LegacyKDFParams())
 }
 
-// Encrypt encrypts plaintext using AES-256-GCM
-func Encrypt(plaintext string, key []byte) (string, error) {
-	if len(key) != KeySize {
-		return "", errors.New("invalid key size")
-	}
+var ErrUnboundCiphertext = errors.New("ciphertext is not bound to associated data")
 
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return "", err
+// Encrypt encrypts plaintext using AES-256-GCM and returns an envelope
+// recording the algorithm and the key it was encrypted under. The envelope
+// header and ad are authenticated, so Decrypt fails unless given the same ad.
+func Encrypt(plaintext string, key []byte, ref KeyRef, ad []byte) (string, error) {
+	if !validKeyID(ref.ID) || ref.Generation < 1 {
+		return "", errors.New("invalid key reference")
 	}
 
-	gcm, err := cipher.NewGCM(block)
+	gcm, err := newGCM(key)
 	if err != nil {
 		return "", err
 	}
@@ -63,16 +58,52 @@ func Encrypt(plaintext string, key []byte) (string, error) {
 		return "", err
 	}
 
-	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+	env := &Envelope{
+		Version:       EnvelopeVersion,
+		Algorithm:     AlgAES256GCM,
+		KeyID:         ref.ID,
+		KeyGeneration: ref.Generation,
+		Nonce:         nonce,
+	}
+	env.Ciphertext = gcm.Seal(nil, nonce, []byte(plaintext), env.additionalData(ad))
+	return env.String(), nil
+}
+
+// Decrypt decrypts an envelope sealed with the given associated data. Unbound
+// ciphertexts are rejected; use DecryptUnbound to read them during migration.
+func Decrypt(ciphertext string, key []byte, ad []byte) (string, error) {
+	if !IsEnvelope(ciphertext) {
+		return "", ErrUnboundCiphertext
+	}
+	env, err := ParseEnvelope(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	if env.Version < EnvelopeVersion {
+		return "", ErrUnboundCiphertext
+	}
+	return decryptAESGCM(env.Nonce, env.Ciphertext, key, env.additionalData(ad))
 }
 
-// Decrypt decrypts ciphertext using AES-256-GCM
-func Decrypt(ciphertextBase64 string, key []byte) (string, error) {
-	if len(key) != KeySize {
-		return "", errors.New("invalid key size")
+// DecryptUnbound decrypts a version 1 envelope or a legacy bare
+// base64(nonce||ciphertext) blob, neither of which carries associated data.
+// It exists so clients can migrate old items; re-encrypt them with Encrypt.
+func DecryptUnbound(ciphertext string, key []byte) (string, error) {
+	if IsEnvelope(ciphertext) {
+		env, err := ParseEnvelope(ciphertext)
+		if err != nil {
+			return "", err
+		}
+		if env.Version != EnvelopeVersionUnbound {
+			return "", ErrInvalidEnvelope
+		}
+		return decryptAESGCM(env.Nonce, env.Ciphertext, key, nil)
 	}
+	return decryptLegacy(ciphertext, key)
+}
 
+// decryptLegacy decrypts the pre-envelope format
+func decryptLegacy(ciphertextBase64 string, key []byte) (string, error) {
 	ciphertext, err := base64.StdEncoding.DecodeString(ciphertextBase64)
 	if err != nil {
 		return "", err
@@ -82,25 +113,34 @@ func Decrypt(ciphertextBase64 string, key []byte) (string, error) {
 		return "", errors.New("ciphertext too short")
 	}
 
-	block, err := aes.NewCipher(key)
+	return decryptAESGCM(ciphertext[:NonceSize], ciphertext[NonceSize:], key, nil)
+}
+
+func decryptAESGCM(nonce, ciphertext, key, ad []byte) (string, error) {
+	gcm, err := newGCM(key)
 	if err != nil {
 		return "", err
 	}
 
-	gcm, err := cipher.NewGCM(block)
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, ad)
 	if err != nil {
 		return "", err
 	}
 
-	nonce := ciphertext[:NonceSize]
-	ciphertext = ciphertext[NonceSize:]
+	return string(plaintext), nil
+}
 
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, errors.New("invalid key size")
+	}
+
+	block, err := aes.NewCipher(key)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return string(plaintext), nil
+	return cipher.NewGCM(block)
 }
 
 // HashPassword hashes a password using SHA-256 (for storage, use bcrypt in auth)
@@ -109,20 +149,14 @@ func HashPassword(password string) string {
 	return base64.StdEncoding.EncodeToString(hash[:])
 }
 
-// GenerateRandomPassword generates a random password of specified length
+// GenerateRandomPassword generates a random password of specified length from
+// all character classes. See the generator package for more control.
 func GenerateRandomPassword(length int) (string, error) {
-	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!@#$%^&*()_+-=[]{}|;:,.<>?"
-	password := make([]byte, length)
-	charsetLen := len(charset)
-
-	randomBytes := make([]byte, length)
-	if _, err := io.ReadFull(rand.Reader, randomBytes); err != nil {
+	opts := generator.DefaultOptions()
+	opts.Length = length
+	result, err := generator.Generate(opts)
+	if err != nil {
 		return "", err
 	}
-
-	for i := 0; i < length; i++ {
-		password[i] = charset[int(randomBytes[i])%charsetLen]
-	}
-
-	return string(password), nil
+	return result.Value, nil
 }
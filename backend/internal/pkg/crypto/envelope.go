@@ -0,0 +1,181 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Envelope format:
+//
+//	px<version>.<algorithm>.<key id>.<key generation>.<base64(nonce||ciphertext)>
+//
+// The header is plain text so clients can inspect it without decoding the
+// payload. Legacy ciphertexts are bare base64(nonce||ciphertext) and never
+// contain a '.', which keeps the two formats unambiguous.
+//
+// Version 1 envelopes were sealed without associated data. Version 2 envelopes
+// authenticate the header plus caller supplied associated data, which binds a
+// ciphertext to the item and field it belongs to.
+const (
+	// EnvelopeVersion is the current envelope format version
+	EnvelopeVersion = 2
+	// EnvelopeVersionUnbound is the first envelope version, sealed without associated data
+	EnvelopeVersionUnbound = 1
+	// AlgAES256GCM identifies AES-256-GCM with a 96-bit nonce
+	AlgAES256GCM = "A256GCM"
+
+	envelopePrefix = "px"
+	envelopeSep    = "."
+	maxKeyIDLength = 64
+	gcmTagSize     = 16
+)
+
+var (
+	ErrInvalidEnvelope      = errors.New("invalid ciphertext envelope")
+	ErrUnsupportedAlgorithm = errors.New("unsupported encryption algorithm")
+)
+
+// KeyRef identifies the key a ciphertext is encrypted under
+type KeyRef struct {
+	ID         string
+	Generation int
+}
+
+// Envelope is a parsed, self-describing ciphertext
+type Envelope struct {
+	Version       int
+	Algorithm     string
+	KeyID         string
+	KeyGeneration int
+	Nonce         []byte
+	Ciphertext    []byte
+}
+
+// Header returns the plain text envelope header
+func (e *Envelope) Header() string {
+	return strings.Join([]string{
+		envelopePrefix + strconv.Itoa(e.Version),
+		e.Algorithm,
+		e.KeyID,
+		strconv.Itoa(e.KeyGeneration),
+	}, envelopeSep)
+}
+
+// String encodes the envelope
+func (e *Envelope) String() string {
+	payload := make([]byte, 0, len(e.Nonce)+len(e.Ciphertext))
+	payload = append(payload, e.Nonce...)
+	payload = append(payload, e.Ciphertext...)
+	return e.Header() + envelopeSep + base64.StdEncoding.EncodeToString(payload)
+}
+
+// additionalData is what a version 2 envelope authenticates: the header, so the
+// key reference cannot be rewritten, followed by the caller's associated data
+func (e *Envelope) additionalData(ad []byte) []byte {
+	header := e.Header()
+	out := make([]byte, 0, len(header)+1+len(ad))
+	out = append(out, header...)
+	out = append(out, '|')
+	return append(out, ad...)
+}
+
+// IsEnvelope reports whether s looks like an envelope rather than a legacy ciphertext
+func IsEnvelope(s string) bool {
+	return strings.HasPrefix(s, envelopePrefix) && strings.Contains(s, envelopeSep)
+}
+
+// ParseEnvelope decodes and validates an envelope
+func ParseEnvelope(s string) (*Envelope, error) {
+	parts := strings.Split(s, envelopeSep)
+	if len(parts) != 5 || !strings.HasPrefix(parts[0], envelopePrefix) {
+		return nil, ErrInvalidEnvelope
+	}
+
+	version, err := strconv.Atoi(strings.TrimPrefix(parts[0], envelopePrefix))
+	if err != nil || version < 1 || version > EnvelopeVersion {
+		return nil, ErrInvalidEnvelope
+	}
+	if parts[1] != AlgAES256GCM {
+		return nil, ErrUnsupportedAlgorithm
+	}
+	if !validKeyID(parts[2]) {
+		return nil, ErrInvalidEnvelope
+	}
+	generation, err := strconv.Atoi(parts[3])
+	if err != nil || generation < 1 {
+		return nil, ErrInvalidEnvelope
+	}
+	payload, err := base64.StdEncoding.DecodeString(parts[4])
+	if err != nil || len(payload) < NonceSize+gcmTagSize {
+		return nil, ErrInvalidEnvelope
+	}
+
+	return &Envelope{
+		Version:       version,
+		Algorithm:     parts[1],
+		KeyID:         parts[2],
+		KeyGeneration: generation,
+		Nonce:         payload[:NonceSize],
+		Ciphertext:    payload[NonceSize:],
+	}, nil
+}
+
+// ValidateEnvelope checks that s is a well-formed current-version envelope
+// encrypted under the given key generation. Use it to reject plaintext or
+// unbound ciphertexts submitted by a buggy client.
+func ValidateEnvelope(s string, keyGeneration int) error {
+	env, err := ParseEnvelope(s)
+	if err != nil {
+		return err
+	}
+	if env.Version != EnvelopeVersion {
+		return fmt.Errorf("%w: version %d, expected %d", ErrInvalidEnvelope, env.Version, EnvelopeVersion)
+	}
+	if env.KeyGeneration != keyGeneration {
+		return fmt.Errorf("%w: key generation %d, expected %d", ErrInvalidEnvelope, env.KeyGeneration, keyGeneration)
+	}
+	return nil
+}
+
+// ValidateLegacy checks that s is a well-formed legacy ciphertext, the bare
+// base64(nonce||ciphertext) written by clients that predate envelopes
+func ValidateLegacy(s string) error {
+	if IsEnvelope(s) {
+		return ErrInvalidEnvelope
+	}
+	payload, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(payload) < NonceSize+gcmTagSize {
+		return ErrInvalidEnvelope
+	}
+	return nil
+}
+
+// IsBound reports whether s is an envelope sealed with associated data
+func IsBound(s string) bool {
+	if !IsEnvelope(s) {
+		return false
+	}
+	env, err := ParseEnvelope(s)
+	return err == nil && env.Version >= EnvelopeVersion
+}
+
+// CredentialAAD builds the associated data that binds a credential field
+// ciphertext to its vault, its item and the field it is stored in
+func CredentialAAD(vaultID int64, itemID, field string) []byte {
+	return []byte("passwordx:credential|vault=" + strconv.FormatInt(vaultID, 10) + "|item=" + itemID + "|field=" + field)
+}
+
+func validKeyID(id string) bool {
+	if id == "" || len(id) > maxKeyIDLength {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,264 @@
+package crypto_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/askuy/passwordx/backend/internal/pkg/crypto"
+)
+
+var testRef = crypto.KeyRef{ID: "vault-7", Generation: 3}
+
+func testKey(t *testing.T) []byte {
+	t.Helper()
+	key, err := crypto.GenerateVaultKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func seal(t *testing.T, key []byte, plaintext string, ad []byte) string {
+	t.Helper()
+	ciphertext, err := crypto.Encrypt(plaintext, key, testRef, ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ciphertext
+}
+
+// modify parses an envelope, lets fn change it and encodes it again
+func modify(t *testing.T, ciphertext string, fn func(*crypto.Envelope)) string {
+	t.Helper()
+	env, err := crypto.ParseEnvelope(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.Nonce = bytes.Clone(env.Nonce)
+	env.Ciphertext = bytes.Clone(env.Ciphertext)
+	fn(env)
+	return env.String()
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	key := testKey(t)
+	ad := crypto.CredentialAAD(7, "item-1", "password_encrypted")
+
+	for _, plaintext := range []string{"", "hunter2", strings.Repeat("x", 10000), "пароль 密码"} {
+		ciphertext := seal(t, key, plaintext, ad)
+		if !crypto.IsBound(ciphertext) {
+			t.Errorf("IsBound(%q) = false", ciphertext)
+		}
+		if err := crypto.ValidateEnvelope(ciphertext, testRef.Generation); err != nil {
+			t.Errorf("ValidateEnvelope: %v", err)
+		}
+		got, err := crypto.Decrypt(ciphertext, key, ad)
+		if err != nil {
+			t.Fatalf("Decrypt: %v", err)
+		}
+		if got != plaintext {
+			t.Errorf("Decrypt = %q, want %q", got, plaintext)
+		}
+	}
+}
+
+func TestDecryptTampered(t *testing.T) {
+	key := testKey(t)
+	ad := crypto.CredentialAAD(7, "item-1", "password_encrypted")
+	ciphertext := seal(t, key, "hunter2", ad)
+
+	tests := []struct {
+		name       string
+		ciphertext string
+	}{
+		{"flipped ciphertext bit", modify(t, ciphertext, func(e *crypto.Envelope) { e.Ciphertext[0] ^= 1 })},
+		{"flipped tag bit", modify(t, ciphertext, func(e *crypto.Envelope) { e.Ciphertext[len(e.Ciphertext)-1] ^= 1 })},
+		{"flipped nonce bit", modify(t, ciphertext, func(e *crypto.Envelope) { e.Nonce[0] ^= 1 })},
+		{"truncated ciphertext", modify(t, ciphertext, func(e *crypto.Envelope) { e.Ciphertext = e.Ciphertext[:len(e.Ciphertext)-1] })},
+		{"rewritten key id", modify(t, ciphertext, func(e *crypto.Envelope) { e.KeyID = "vault-8" })},
+		{"rewritten key generation", modify(t, ciphertext, func(e *crypto.Envelope) { e.KeyGeneration = 4 })},
+		{"downgraded to unbound version", modify(t, ciphertext, func(e *crypto.Envelope) { e.Version = crypto.EnvelopeVersionUnbound })},
+		{"bare payload", ciphertext[strings.LastIndex(ciphertext, ".")+1:]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := crypto.Decrypt(tt.ciphertext, key, ad); err == nil {
+				t.Error("Decrypt accepted a tampered ciphertext")
+			}
+		})
+	}
+}
+
+func TestDecryptAADMismatch(t *testing.T) {
+	key := testKey(t)
+	ciphertext := seal(t, key, "hunter2", crypto.CredentialAAD(7, "item-1", "password_encrypted"))
+
+	tests := []struct {
+		name string
+		ad   []byte
+	}{
+		{"other vault", crypto.CredentialAAD(8, "item-1", "password_encrypted")},
+		{"other item", crypto.CredentialAAD(7, "item-2", "password_encrypted")},
+		{"other field", crypto.CredentialAAD(7, "item-1", "notes_encrypted")},
+		{"no associated data", nil},
+		{"escrow associated data", crypto.EscrowAAD("vault-7", 7)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := crypto.Decrypt(ciphertext, key, tt.ad); err == nil {
+				t.Error("Decrypt accepted mismatched associated data")
+			}
+		})
+	}
+
+	if _, err := crypto.Decrypt(ciphertext, testKey(t), crypto.CredentialAAD(7, "item-1", "password_encrypted")); err == nil {
+		t.Error("Decrypt accepted the wrong key")
+	}
+}
+
+func TestDecryptUnbound(t *testing.T) {
+	key := testKey(t)
+	gcm := newTestGCM(t, key)
+	nonce := bytes.Repeat([]byte{1}, crypto.NonceSize)
+	sealed := gcm.Seal(nil, nonce, []byte("hunter2"), nil)
+	legacy := base64.StdEncoding.EncodeToString(append(bytes.Clone(nonce), sealed...))
+	unbound := (&crypto.Envelope{
+		Version:       crypto.EnvelopeVersionUnbound,
+		Algorithm:     crypto.AlgAES256GCM,
+		KeyID:         testRef.ID,
+		KeyGeneration: testRef.Generation,
+		Nonce:         nonce,
+		Ciphertext:    sealed,
+	}).String()
+
+	tests := []struct {
+		name       string
+		ciphertext string
+		wantErr    bool
+	}{
+		{"legacy", legacy, false},
+		{"version 1 envelope", unbound, false},
+		{"bound envelope", seal(t, key, "hunter2", nil), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := crypto.DecryptUnbound(tt.ciphertext, key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecryptUnbound error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != "hunter2" {
+				t.Errorf("DecryptUnbound = %q", got)
+			}
+			// Unbound ciphertexts never pass as bound ones
+			if !tt.wantErr {
+				if _, err := crypto.Decrypt(tt.ciphertext, key, nil); !errors.Is(err, crypto.ErrUnboundCiphertext) {
+					t.Errorf("Decrypt error = %v, want %v", err, crypto.ErrUnboundCiphertext)
+				}
+			}
+		})
+	}
+}
+
+func TestParseEnvelopeInvalid(t *testing.T) {
+	payload := base64.StdEncoding.EncodeToString(make([]byte, crypto.NonceSize+16))
+	short := base64.StdEncoding.EncodeToString(make([]byte, crypto.NonceSize+15))
+
+	tests := []struct {
+		name     string
+		envelope string
+		wantErr  error
+	}{
+		{"too few parts", "px2.A256GCM.vault-7." + payload, crypto.ErrInvalidEnvelope},
+		{"too many parts", "px2.A256GCM.vault-7.3.x." + payload, crypto.ErrInvalidEnvelope},
+		{"wrong prefix", "qx2.A256GCM.vault-7.3." + payload, crypto.ErrInvalidEnvelope},
+		{"version 0", "px0.A256GCM.vault-7.3." + payload, crypto.ErrInvalidEnvelope},
+		{"future version", "px3.A256GCM.vault-7.3." + payload, crypto.ErrInvalidEnvelope},
+		{"unknown algorithm", "px2.A128CBC.vault-7.3." + payload, crypto.ErrUnsupportedAlgorithm},
+		{"empty key id", "px2.A256GCM..3." + payload, crypto.ErrInvalidEnvelope},
+		{"key id with invalid characters", "px2.A256GCM.vault/7.3." + payload, crypto.ErrInvalidEnvelope},
+		{"key id too long", "px2.A256GCM." + strings.Repeat("k", 65) + ".3." + payload, crypto.ErrInvalidEnvelope},
+		{"generation 0", "px2.A256GCM.vault-7.0." + payload, crypto.ErrInvalidEnvelope},
+		{"non-numeric generation", "px2.A256GCM.vault-7.three." + payload, crypto.ErrInvalidEnvelope},
+		{"payload not base64", "px2.A256GCM.vault-7.3.!!!", crypto.ErrInvalidEnvelope},
+		{"payload too short", "px2.A256GCM.vault-7.3." + short, crypto.ErrInvalidEnvelope},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := crypto.ParseEnvelope(tt.envelope); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ParseEnvelope error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateCiphertexts(t *testing.T) {
+	key := testKey(t)
+	bound := seal(t, key, "hunter2", nil)
+	unbound := modify(t, bound, func(e *crypto.Envelope) { e.Version = crypto.EnvelopeVersionUnbound })
+	legacy := base64.StdEncoding.EncodeToString(make([]byte, crypto.NonceSize+16))
+
+	tests := []struct {
+		name       string
+		ciphertext string
+		wantBound  bool
+		envelope   bool // passes ValidateEnvelope at testRef.Generation
+		legacy     bool // passes ValidateLegacy
+	}{
+		{"bound envelope", bound, true, true, false},
+		{"unbound envelope", unbound, false, false, false},
+		{"stale generation", modify(t, bound, func(e *crypto.Envelope) { e.KeyGeneration = 2 }), true, false, false},
+		{"legacy", legacy, false, false, true},
+		{"plaintext", "hunter2", false, false, false},
+		{"short legacy payload", base64.StdEncoding.EncodeToString(make([]byte, crypto.NonceSize)), false, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := crypto.IsBound(tt.ciphertext); got != tt.wantBound {
+				t.Errorf("IsBound = %v, want %v", got, tt.wantBound)
+			}
+			if err := crypto.ValidateEnvelope(tt.ciphertext, testRef.Generation); (err == nil) != tt.envelope {
+				t.Errorf("ValidateEnvelope error = %v, want valid %v", err, tt.envelope)
+			}
+			if err := crypto.ValidateLegacy(tt.ciphertext); (err == nil) != tt.legacy {
+				t.Errorf("ValidateLegacy error = %v, want valid %v", err, tt.legacy)
+			}
+		})
+	}
+}
+
+func TestEncryptInvalidKeyRef(t *testing.T) {
+	key := testKey(t)
+	tests := []struct {
+		name string
+		ref  crypto.KeyRef
+	}{
+		{"empty id", crypto.KeyRef{Generation: 1}},
+		{"id with separator", crypto.KeyRef{ID: "vault.7", Generation: 1}},
+		{"generation 0", crypto.KeyRef{ID: "vault-7"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := crypto.Encrypt("hunter2", key, tt.ref, nil); err == nil {
+				t.Error("Encrypt accepted an invalid key reference")
+			}
+		})
+	}
+}
+
+func newTestGCM(t *testing.T, key []byte) cipher.AEAD {
+	t.Helper()
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gcm
+}
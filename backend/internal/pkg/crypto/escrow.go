@@ -0,0 +1,62 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"strconv"
+)
+
+// Escrowed private keys are sealed with a random AES-256 key, which is wrapped
+// to the tenant escrow public key with RSA-OAEP. The envelope key ID is the
+// escrow key ID, so a copy made for a replaced escrow key is easy to spot.
+
+// EscrowAAD binds an escrowed private key to its escrow key and its owner
+func EscrowAAD(escrowKeyID string, userID int64) []byte {
+	return []byte("passwordx:escrow|key=" + escrowKeyID + "|user=" + strconv.FormatInt(userID, 10))
+}
+
+// SealForEscrow encrypts a private key for the escrow public key. It returns
+// the wrapped data key and the encrypted private key.
+func SealForEscrow(privateKey, escrowPublicKey, escrowKeyID string, userID int64) (string, string, error) {
+	dataKey, err := GenerateVaultKey()
+	if err != nil {
+		return "", "", err
+	}
+	wrapped, err := WrapKey(dataKey, escrowPublicKey)
+	if err != nil {
+		return "", "", err
+	}
+	sealed, err := Encrypt(privateKey, dataKey, KeyRef{ID: escrowKeyID, Generation: 1}, EscrowAAD(escrowKeyID, userID))
+	if err != nil {
+		return "", "", err
+	}
+	return wrapped, sealed, nil
+}
+
+// OpenEscrow decrypts a private key sealed by SealForEscrow
+func OpenEscrow(wrappedKey, encryptedPrivateKey, escrowPrivateKey, escrowKeyID string, userID int64) (string, error) {
+	dataKey, err := UnwrapKey(wrappedKey, escrowPrivateKey)
+	if err != nil {
+		return "", err
+	}
+	return Decrypt(encryptedPrivateKey, dataKey, EscrowAAD(escrowKeyID, userID))
+}
+
+// ValidateEscrowCiphertext checks that an escrowed private key is sealed for
+// the given escrow key and that its wrapped data key has the right size
+func ValidateEscrowCiphertext(wrappedKey, encryptedPrivateKey, escrowKeyID string) error {
+	if err := ValidateEnvelope(encryptedPrivateKey, 1); err != nil {
+		return err
+	}
+	env, err := ParseEnvelope(encryptedPrivateKey)
+	if err != nil {
+		return err
+	}
+	if env.KeyID != escrowKeyID {
+		return ErrInvalidEnvelope
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(wrappedKey)
+	if err != nil || len(wrapped) < RSAKeySize/8 {
+		return ErrInvalidEnvelope
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Supported key derivation functions
+const (
+	KDFPBKDF2SHA256 = "pbkdf2-sha256"
+	KDFArgon2id     = "argon2id"
+)
+
+// Lower bounds accepted for user supplied KDF parameters
+const (
+	MinPBKDF2Iterations  = PBKDF2Iterations
+	MinArgon2Iterations  = 2
+	MinArgon2Memory      = 19 * 1024 // KiB
+	MaxArgon2Memory      = 1024 * 1024
+	MaxArgon2Parallelism = 16
+)
+
+var ErrInvalidKDFParams = errors.New("invalid KDF parameters")
+
+// KDFParams describes how a user's master key is derived from their password
+type KDFParams struct {
+	Algorithm   string `json:"kdf"`
+	Iterations  int    `json:"kdf_iterations"`            // PBKDF2 iterations or Argon2 time cost
+	Memory      int    `json:"kdf_memory,omitempty"`      // Argon2 memory in KiB
+	Parallelism int    `json:"kdf_parallelism,omitempty"` // Argon2 lanes
+}
+
+// LegacyKDFParams returns the parameters used before KDF settings were stored per user
+func LegacyKDFParams() KDFParams {
+	return KDFParams{
+		Algorithm:  KDFPBKDF2SHA256,
+		Iterations: PBKDF2Iterations,
+	}
+}
+
+// DefaultKDFParams returns the recommended parameters for new accounts
+func DefaultKDFParams() KDFParams {
+	return KDFParams{
+		Algorithm:   KDFArgon2id,
+		Iterations:  3,
+		Memory:      64 * 1024,
+		Parallelism: 4,
+	}
+}
+
+// Validate checks that the parameters name a supported KDF with a sane work factor
+func (p KDFParams) Validate() error {
+	switch p.Algorithm {
+	case KDFPBKDF2SHA256:
+		if p.Iterations < MinPBKDF2Iterations {
+			return ErrInvalidKDFParams
+		}
+	case KDFArgon2id:
+		if p.Iterations < MinArgon2Iterations ||
+			p.Memory < MinArgon2Memory || p.Memory > MaxArgon2Memory ||
+			p.Parallelism < 1 || p.Parallelism > MaxArgon2Parallelism {
+			return ErrInvalidKDFParams
+		}
+	default:
+		return ErrInvalidKDFParams
+	}
+	return nil
+}
+
+// WeakerThan reports whether p should be upgraded to target.
+// Argon2id is always preferred over PBKDF2.
+func (p KDFParams) WeakerThan(target KDFParams) bool {
+	if p.Algorithm != target.Algorithm {
+		return target.Algorithm == KDFArgon2id
+	}
+	if p.Algorithm == KDFArgon2id {
+		return p.Iterations < target.Iterations || p.Memory < target.Memory
+	}
+	return p.Iterations < target.Iterations
+}
+
+// DeriveKeyWithParams derives an AES-256 key from a password using the given KDF
+func DeriveKeyWithParams(password, saltBase64 string, params KDFParams) ([]byte, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	salt, err := base64.StdEncoding.DecodeString(saltBase64)
+	if err != nil {
+		return nil, err
+	}
+
+	switch params.Algorithm {
+	case KDFArgon2id:
+		return argon2.IDKey([]byte(password), salt, uint32(params.Iterations), uint32(params.Memory), uint8(params.Parallelism), KeySize), nil
+	default:
+		return pbkdf2.Key([]byte(password), salt, params.Iterations, KeySize, sha256.New), nil
+	}
+}
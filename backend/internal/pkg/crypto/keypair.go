@@ -0,0 +1,109 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"io"
+)
+
+const (
+	// RSAKeySize is the modulus size of user keypairs
+	RSAKeySize = 2048
+)
+
+var (
+	ErrInvalidPublicKey  = errors.New("invalid public key")
+	ErrInvalidPrivateKey = errors.New("invalid private key")
+)
+
+// GenerateKeyPair generates an RSA keypair used to wrap vault keys.
+// The public key is returned as base64 SPKI and the private key as base64 PKCS#8,
+// which are the formats WebCrypto exports for RSA-OAEP keys.
+func GenerateKeyPair() (publicKey string, privateKey string, err error) {
+	key, err := rsa.GenerateKey(rand.Reader, RSAKeySize)
+	if err != nil {
+		return "", "", err
+	}
+
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", "", err
+	}
+	priv, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(pub), base64.StdEncoding.EncodeToString(priv), nil
+}
+
+// ParsePublicKey parses a base64 SPKI RSA public key
+func ParsePublicKey(publicKeyBase64 string) (*rsa.PublicKey, error) {
+	der, err := base64.StdEncoding.DecodeString(publicKeyBase64)
+	if err != nil {
+		return nil, ErrInvalidPublicKey
+	}
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, ErrInvalidPublicKey
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok || rsaPub.N.BitLen() < RSAKeySize {
+		return nil, ErrInvalidPublicKey
+	}
+	return rsaPub, nil
+}
+
+// ValidatePublicKey checks that a public key can be used to wrap vault keys
+func ValidatePublicKey(publicKeyBase64 string) error {
+	_, err := ParsePublicKey(publicKeyBase64)
+	return err
+}
+
+// WrapKey encrypts a symmetric key with RSA-OAEP-SHA256
+func WrapKey(key []byte, publicKeyBase64 string) (string, error) {
+	pub, err := ParsePublicKey(publicKeyBase64)
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, key, nil)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(wrapped), nil
+}
+
+// UnwrapKey decrypts a key wrapped by WrapKey
+func UnwrapKey(wrappedBase64, privateKeyBase64 string) ([]byte, error) {
+	der, err := base64.StdEncoding.DecodeString(privateKeyBase64)
+	if err != nil {
+		return nil, ErrInvalidPrivateKey
+	}
+	priv, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, ErrInvalidPrivateKey
+	}
+	rsaPriv, ok := priv.(*rsa.PrivateKey)
+	if !ok {
+		return nil, ErrInvalidPrivateKey
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(wrappedBase64)
+	if err != nil {
+		return nil, err
+	}
+	return rsa.DecryptOAEP(sha256.New(), rand.Reader, rsaPriv, wrapped, nil)
+}
+
+// GenerateVaultKey generates a random AES-256 vault key
+func GenerateVaultKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
@@ -0,0 +1,32 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+)
+
+// OrganizerKeyGeneration is the key generation of folder and tag name
+// envelopes. The organizer key is derived rather than rotated, so it is
+// always the first.
+const OrganizerKeyGeneration = 1
+
+// OrganizerKey derives the AES-256 key that encrypts a user's folder and tag
+// names from their private key (base64 PKCS#8). Master password changes and
+// recovery only re-encrypt the private key, so the names stay readable.
+func OrganizerKey(privateKeyBase64 string) ([]byte, error) {
+	der, err := base64.StdEncoding.DecodeString(privateKeyBase64)
+	if err != nil {
+		return nil, ErrInvalidPrivateKey
+	}
+	mac := hmac.New(sha256.New, der)
+	mac.Write([]byte("passwordx-organizer"))
+	return mac.Sum(nil), nil
+}
+
+// OrganizerAAD builds the associated data that binds a folder or tag name
+// ciphertext to its owner and to the folder or tag, kind being "folder" or "tag"
+func OrganizerAAD(userID int64, kind, id string) []byte {
+	return []byte("passwordx:" + kind + "|user=" + strconv.FormatInt(userID, 10) + "|id=" + id)
+}
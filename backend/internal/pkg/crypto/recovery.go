@@ -0,0 +1,67 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"io"
+	"strings"
+)
+
+const (
+	// RecoveryKeySize is the size of a recovery key in bytes (160 bits)
+	RecoveryKeySize = 20
+
+	recoveryKeyGroup = 4
+)
+
+var ErrInvalidRecoveryKey = errors.New("invalid recovery key")
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateRecoveryKey generates a recovery key formatted for printing, e.g.
+// ABCD-EFGH-... (8 groups of 4 base32 characters). Clients generate it at
+// signup; the server only ever stores material derived from it.
+func GenerateRecoveryKey() (string, error) {
+	key := make([]byte, RecoveryKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+
+	encoded := recoveryEncoding.EncodeToString(key)
+	groups := make([]string, 0, len(encoded)/recoveryKeyGroup)
+	for i := 0; i < len(encoded); i += recoveryKeyGroup {
+		groups = append(groups, encoded[i:i+recoveryKeyGroup])
+	}
+	return strings.Join(groups, "-"), nil
+}
+
+// ParseRecoveryKey decodes a recovery key, ignoring case, dashes and spaces
+func ParseRecoveryKey(s string) ([]byte, error) {
+	s = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(s))
+	key, err := recoveryEncoding.DecodeString(s)
+	if err != nil || len(key) != RecoveryKeySize {
+		return nil, ErrInvalidRecoveryKey
+	}
+	return key, nil
+}
+
+// RecoveryWrapKey derives the AES-256 key that encrypts the private key copy
+// stored for recovery
+func RecoveryWrapKey(recoveryKey []byte) []byte {
+	return recoveryHMAC(recoveryKey, "passwordx-recovery-wrap")
+}
+
+// RecoveryAuthSecret derives the SRP password input used to prove possession
+// of the recovery key
+func RecoveryAuthSecret(recoveryKey []byte) []byte {
+	return recoveryHMAC(recoveryKey, "passwordx-recovery-auth")
+}
+
+func recoveryHMAC(key []byte, label string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(label))
+	return mac.Sum(nil)
+}
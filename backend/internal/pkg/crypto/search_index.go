@@ -0,0 +1,64 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"unicode"
+)
+
+// Kinds of search tokens
+const (
+	SearchTokenDomain = "domain" // registrable domain of the item's URL, e.g. example.co.uk
+	SearchTokenHost   = "host"   // host of the item's URL, for items matched by host
+	SearchTokenTitle  = "title"  // one word of the item's title
+)
+
+// searchTokenSize is how many bytes of the HMAC a search token keeps
+const searchTokenSize = 16
+
+// SearchIndexKey derives a vault's blind index key from its vault key. It
+// changes with every key rotation, so rotations resubmit the tokens.
+func SearchIndexKey(vaultKey []byte) []byte {
+	mac := hmac.New(sha256.New, vaultKey)
+	mac.Write([]byte("passwordx-search-index"))
+	return mac.Sum(nil)
+}
+
+// SearchToken computes the blind index token of a normalized value, see
+// NormalizeDomain and TitleWords. The server only ever sees tokens, which are
+// equal exactly when kind and value are, within one vault.
+func SearchToken(indexKey []byte, kind, value string) string {
+	mac := hmac.New(sha256.New, indexKey)
+	mac.Write([]byte(kind + ":" + value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:searchTokenSize])
+}
+
+// ValidSearchToken reports whether s has the form of a search token
+func ValidSearchToken(s string) bool {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	return err == nil && len(raw) == searchTokenSize
+}
+
+// NormalizeDomain lowercases a domain and drops a trailing dot. See
+// domain.Registrable for the registrable domain of a host.
+func NormalizeDomain(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
+
+// TitleWords splits a title into its distinct lowercase words
+func TitleWords(title string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	words := make([]string, 0, len(fields))
+	seen := make(map[string]bool, len(fields))
+	for _, w := range fields {
+		if !seen[w] {
+			seen[w] = true
+			words = append(words, w)
+		}
+	}
+	return words
+}
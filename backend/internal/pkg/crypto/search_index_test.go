@@ -0,0 +1,121 @@
+package crypto_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"reflect"
+	"testing"
+
+	"github.com/askuy/passwordx/backend/internal/pkg/crypto"
+)
+
+func TestSearchIndexKey(t *testing.T) {
+	vaultKey := bytes.Repeat([]byte{1}, crypto.KeySize)
+	indexKey := crypto.SearchIndexKey(vaultKey)
+
+	if !bytes.Equal(indexKey, crypto.SearchIndexKey(vaultKey)) {
+		t.Error("SearchIndexKey is not deterministic")
+	}
+	if bytes.Equal(indexKey, vaultKey) {
+		t.Error("SearchIndexKey returned the vault key")
+	}
+	// A rotated vault key yields a new index key
+	if bytes.Equal(indexKey, crypto.SearchIndexKey(bytes.Repeat([]byte{2}, crypto.KeySize))) {
+		t.Error("different vault keys share an index key")
+	}
+}
+
+func TestSearchToken(t *testing.T) {
+	indexKey := crypto.SearchIndexKey(bytes.Repeat([]byte{1}, crypto.KeySize))
+	otherKey := crypto.SearchIndexKey(bytes.Repeat([]byte{2}, crypto.KeySize))
+	token := crypto.SearchToken(indexKey, crypto.SearchTokenDomain, "example.com")
+
+	tests := []struct {
+		name      string
+		key       []byte
+		kind      string
+		value     string
+		wantEqual bool
+	}{
+		{"same kind and value", indexKey, crypto.SearchTokenDomain, "example.com", true},
+		{"other value", indexKey, crypto.SearchTokenDomain, "example.org", false},
+		{"other kind", indexKey, crypto.SearchTokenHost, "example.com", false},
+		{"other vault", otherKey, crypto.SearchTokenDomain, "example.com", false},
+		{"not normalized", indexKey, crypto.SearchTokenDomain, "Example.com", false},
+		// The separator keeps kind and value apart
+		{"shifted separator", indexKey, "domain:example", "com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := crypto.SearchToken(tt.key, tt.kind, tt.value)
+			if !crypto.ValidSearchToken(got) {
+				t.Errorf("ValidSearchToken(%q) = false", got)
+			}
+			if (got == token) != tt.wantEqual {
+				t.Errorf("SearchToken = %q, equal to %q: %v, want %v", got, token, got == token, tt.wantEqual)
+			}
+		})
+	}
+}
+
+func TestValidSearchToken(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+		want  bool
+	}{
+		{"16 bytes", base64.RawURLEncoding.EncodeToString(make([]byte, 16)), true},
+		{"15 bytes", base64.RawURLEncoding.EncodeToString(make([]byte, 15)), false},
+		{"17 bytes", base64.RawURLEncoding.EncodeToString(make([]byte, 17)), false},
+		{"padded", base64.URLEncoding.EncodeToString(make([]byte, 16)), false},
+		{"standard alphabet", "+/" + base64.RawURLEncoding.EncodeToString(make([]byte, 16))[2:], false},
+		{"plaintext", "example.com", false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := crypto.ValidSearchToken(tt.token); got != tt.want {
+				t.Errorf("ValidSearchToken(%q) = %v, want %v", tt.token, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeDomain(t *testing.T) {
+	tests := []struct {
+		domain string
+		want   string
+	}{
+		{"example.com", "example.com"},
+		{"Example.COM", "example.com"},
+		{"example.com.", "example.com"},
+		{"  example.com ", "example.com"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := crypto.NormalizeDomain(tt.domain); got != tt.want {
+			t.Errorf("NormalizeDomain(%q) = %q, want %q", tt.domain, got, tt.want)
+		}
+	}
+}
+
+func TestTitleWords(t *testing.T) {
+	tests := []struct {
+		title string
+		want  []string
+	}{
+		{"GitHub", []string{"github"}},
+		{"Work GitHub account", []string{"work", "github", "account"}},
+		{"github / GitHub (work)", []string{"github", "work"}},
+		{"AWS-prod_2", []string{"aws", "prod", "2"}},
+		{"Почта Яндекс", []string{"почта", "яндекс"}},
+		{"銀行 口座", []string{"銀行", "口座"}},
+		{"  ...  ", []string{}},
+		{"", []string{}},
+	}
+	for _, tt := range tests {
+		if got := crypto.TitleWords(tt.title); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("TitleWords(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+// Package domain works out which site a URL belongs to, for autofill: the
+// registrable domain per the Public Suffix List, equivalent domain groups
+// and the match modes of credentials.
+package domain
+
+import (
+	_ "embed"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/idna"
+)
+
+var (
+	ErrInvalidHost  = errors.New("invalid host name")
+	ErrPublicSuffix = errors.New("host is a public suffix")
+)
+
+// publicSuffixList is the Public Suffix List, verbatim, ICANN and private
+// sections alike, so that e.g. the sites under github.io stay apart. See
+// https://publicsuffix.org/list/
+//
+//go:embed public_suffix_list.dat
+var publicSuffixList string
+
+// suffixRules holds the list's rules in ASCII form by kind
+type suffixRules struct {
+	normal     map[string]bool // example.com
+	wildcards  map[string]bool // *.example.com, stored as example.com
+	exceptions map[string]bool // !www.example.com, stored as www.example.com
+}
+
+var rules = sync.OnceValue(func() *suffixRules {
+	r := &suffixRules{
+		normal:     make(map[string]bool),
+		wildcards:  make(map[string]bool),
+		exceptions: make(map[string]bool),
+	}
+	for _, line := range strings.Split(publicSuffixList, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		rule := strings.Fields(line)[0]
+		set := r.normal
+		if strings.HasPrefix(rule, "!") {
+			rule, set = rule[1:], r.exceptions
+		} else if strings.HasPrefix(rule, "*.") {
+			rule, set = rule[2:], r.wildcards
+		}
+		if ascii, err := idna.ToASCII(rule); err == nil {
+			set[strings.ToLower(ascii)] = true
+		}
+	}
+	return r
+})
+
+// NormalizeHost lowercases a host name, converts it to its ASCII (punycode)
+// form and drops a trailing dot. IP addresses are returned as they are.
+func NormalizeHost(host string) (string, error) {
+	host = strings.TrimSuffix(strings.TrimSpace(host), ".")
+	if host == "" {
+		return "", ErrInvalidHost
+	}
+	if net.ParseIP(strings.Trim(host, "[]")) != nil {
+		return strings.ToLower(host), nil
+	}
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", ErrInvalidHost
+	}
+	return strings.ToLower(ascii), nil
+}
+
+// HostOf returns the normalized host of a URL. URLs without a scheme, such
+// as "example.com/login", are read as https.
+func HostOf(rawURL string) (string, error) {
+	u, err := parseURL(rawURL)
+	if err != nil {
+		return "", err
+	}
+	return NormalizeHost(u.Hostname())
+}
+
+func parseURL(rawURL string) (*url.URL, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, ErrInvalidHost
+	}
+	return u, nil
+}
+
+// PublicSuffix returns the public suffix of a normalized host, e.g. "co.uk"
+// for "login.example.co.uk". Hosts under no rule get their last label, as
+// the list's implicit "*" rule says.
+func PublicSuffix(host string) string {
+	r := rules()
+	labels := strings.Split(host, ".")
+	for i := range labels {
+		suffix := strings.Join(labels[i:], ".")
+		if r.exceptions[suffix] {
+			return strings.Join(labels[i+1:], ".")
+		}
+		if r.normal[suffix] {
+			return suffix
+		}
+		if i+1 < len(labels) && r.wildcards[strings.Join(labels[i+1:], ".")] {
+			return suffix
+		}
+	}
+	return labels[len(labels)-1]
+}
+
+// Registrable returns the registrable domain of a host: its public suffix
+// and one more label, e.g. "example.co.uk" for "login.example.co.uk". IP
+// addresses and single-label intranet hosts such as "wiki" are their own
+// registrable domain.
+func Registrable(host string) (string, error) {
+	host, err := NormalizeHost(host)
+	if err != nil {
+		return "", err
+	}
+	if net.ParseIP(strings.Trim(host, "[]")) != nil || !strings.Contains(host, ".") {
+		return host, nil
+	}
+	suffix := PublicSuffix(host)
+	if suffix == host {
+		return "", ErrPublicSuffix
+	}
+	rest := strings.TrimSuffix(host, "."+suffix)
+	return rest[strings.LastIndex(rest, ".")+1:] + "." + suffix, nil
+}
@@ -0,0 +1,139 @@
+package domain
+
+import (
+	"regexp"
+	"strings"
+)
+
+// MatchMode says which page URLs a credential's URL fills
+type MatchMode string
+
+const (
+	MatchBaseDomain MatchMode = "base_domain" // same registrable domain or an equivalent one, the default
+	MatchHost       MatchMode = "host"        // same host and port
+	MatchExact      MatchMode = "exact"       // the same URL
+	MatchStartsWith MatchMode = "starts_with" // URLs starting with the credential's URL
+	MatchRegex      MatchMode = "regex"       // URLs matching the credential's URL as a regular expression
+	MatchNever      MatchMode = "never"       // never filled automatically
+)
+
+// MatchModes lists the match modes
+var MatchModes = []MatchMode{MatchBaseDomain, MatchHost, MatchExact, MatchStartsWith, MatchRegex, MatchNever}
+
+// ValidMatchMode reports whether mode is one of MatchModes
+func ValidMatchMode(mode string) bool {
+	for _, m := range MatchModes {
+		if string(m) == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// Groups are sets of registrable domains that belong to the same site and
+// share accounts, such as google.com and youtube.com
+type Groups [][]string
+
+// Equivalent reports whether two registrable domains are the same or share
+// a group
+func (g Groups) Equivalent(a, b string) bool {
+	if a == b {
+		return true
+	}
+	for _, group := range g {
+		hasA, hasB := false, false
+		for _, d := range group {
+			hasA = hasA || d == a
+			hasB = hasB || d == b
+		}
+		if hasA && hasB {
+			return true
+		}
+	}
+	return false
+}
+
+// Equivalents returns a registrable domain and the domains sharing a group
+// with it, without duplicates
+func (g Groups) Equivalents(domain string) []string {
+	domains := []string{domain}
+	seen := map[string]bool{domain: true}
+	for _, group := range g {
+		if !contains(group, domain) {
+			continue
+		}
+		for _, d := range group {
+			if !seen[d] {
+				seen[d] = true
+				domains = append(domains, d)
+			}
+		}
+	}
+	return domains
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether a credential with the given URL and match mode should
+// be filled into the page at pageURL. The empty mode is MatchBaseDomain.
+func Match(mode MatchMode, credentialURL, pageURL string, groups Groups) bool {
+	switch mode {
+	case MatchBaseDomain, "":
+		a, err := registrableOf(credentialURL)
+		if err != nil {
+			return false
+		}
+		b, err := registrableOf(pageURL)
+		if err != nil {
+			return false
+		}
+		return groups.Equivalent(a, b)
+	case MatchHost:
+		a, err := hostPortOf(credentialURL)
+		if err != nil {
+			return false
+		}
+		b, err := hostPortOf(pageURL)
+		return err == nil && a == b
+	case MatchExact:
+		return credentialURL == pageURL
+	case MatchStartsWith:
+		return credentialURL != "" && strings.HasPrefix(pageURL, credentialURL)
+	case MatchRegex:
+		re, err := regexp.Compile(credentialURL)
+		return err == nil && re.MatchString(pageURL)
+	default:
+		return false
+	}
+}
+
+func registrableOf(rawURL string) (string, error) {
+	host, err := HostOf(rawURL)
+	if err != nil {
+		return "", err
+	}
+	return Registrable(host)
+}
+
+// hostPortOf returns the normalized host of a URL with its port, if any
+func hostPortOf(rawURL string) (string, error) {
+	u, err := parseURL(rawURL)
+	if err != nil {
+		return "", err
+	}
+	host, err := NormalizeHost(u.Hostname())
+	if err != nil {
+		return "", err
+	}
+	if port := u.Port(); port != "" {
+		return host + ":" + port, nil
+	}
+	return host, nil
+}
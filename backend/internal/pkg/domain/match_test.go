@@ -0,0 +1,112 @@
+package domain_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/askuy/passwordx/backend/internal/pkg/domain"
+)
+
+func TestMatch(t *testing.T) {
+	groups := domain.Groups{{"google.com", "youtube.com"}}
+
+	tests := []struct {
+		name       string
+		mode       domain.MatchMode
+		credential string
+		page       string
+		groups     domain.Groups
+		want       bool
+	}{
+		{"base domain, sibling host", domain.MatchBaseDomain, "https://login.example.com", "https://www.example.com/x", nil, true},
+		{"base domain, empty mode", "", "https://login.example.com", "https://www.example.com/x", nil, true},
+		{"base domain, no scheme", domain.MatchBaseDomain, "example.com", "https://www.example.com", nil, true},
+		{"base domain, other port", domain.MatchBaseDomain, "https://example.com", "https://example.com:8443", nil, true},
+		{"base domain, lookalike", domain.MatchBaseDomain, "https://example.com", "https://example.com.evil.net", nil, false},
+		{"base domain, shared suffix", domain.MatchBaseDomain, "https://example.co.uk", "https://other.co.uk", nil, false},
+		{"base domain, private suffix", domain.MatchBaseDomain, "https://alice.github.io", "https://bob.github.io", nil, false},
+		{"base domain, public suffix", domain.MatchBaseDomain, "https://co.uk", "https://co.uk", nil, false},
+		{"base domain, unicode and punycode", domain.MatchBaseDomain, "https://bücher.example", "https://xn--bcher-kva.example/", nil, true},
+		{"base domain, IP address", domain.MatchBaseDomain, "http://10.0.0.1", "http://10.0.0.1:8080", nil, true},
+		{"base domain, other IP address", domain.MatchBaseDomain, "http://10.0.0.1", "http://10.0.0.2", nil, false},
+		{"base domain, grouped", domain.MatchBaseDomain, "https://accounts.google.com", "https://www.youtube.com", groups, true},
+		{"base domain, ungrouped", domain.MatchBaseDomain, "https://accounts.google.com", "https://www.youtube.com", nil, false},
+		{"base domain, invalid URL", domain.MatchBaseDomain, "", "https://example.com", nil, false},
+		{"host, same", domain.MatchHost, "https://login.example.com/a", "https://LOGIN.example.com/b", nil, true},
+		{"host, sibling", domain.MatchHost, "https://login.example.com", "https://www.example.com", nil, false},
+		{"host, same port", domain.MatchHost, "https://example.com:8443", "https://example.com:8443/x", nil, true},
+		{"host, other port", domain.MatchHost, "https://example.com:8443", "https://example.com", nil, false},
+		{"host, grouped", domain.MatchHost, "https://google.com", "https://youtube.com", groups, false},
+		{"exact, same", domain.MatchExact, "https://example.com/login", "https://example.com/login", nil, true},
+		{"exact, trailing slash", domain.MatchExact, "https://example.com/login", "https://example.com/login/", nil, false},
+		{"starts with, prefix", domain.MatchStartsWith, "https://example.com/app", "https://example.com/app/login", nil, true},
+		{"starts with, other path", domain.MatchStartsWith, "https://example.com/app", "https://example.com/admin", nil, false},
+		{"starts with, empty", domain.MatchStartsWith, "", "https://example.com", nil, false},
+		{"regex, match", domain.MatchRegex, `^https://(www\.)?example\.com/`, "https://www.example.com/login", nil, true},
+		{"regex, no match", domain.MatchRegex, `^https://(www\.)?example\.com/`, "https://evil.net/?https://example.com/", nil, false},
+		{"regex, invalid", domain.MatchRegex, `(`, "https://example.com", nil, false},
+		{"never", domain.MatchNever, "https://example.com", "https://example.com", nil, false},
+		{"unknown mode", "fuzzy", "https://example.com", "https://example.com", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := domain.Match(tt.mode, tt.credential, tt.page, tt.groups); got != tt.want {
+				t.Errorf("Match(%q, %q, %q) = %v, want %v", tt.mode, tt.credential, tt.page, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroups(t *testing.T) {
+	groups := domain.Groups{
+		{"google.com", "youtube.com"},
+		{"google.com", "gmail.com"},
+		{"example.com", "example.net"},
+	}
+
+	equivalent := []struct {
+		a, b string
+		want bool
+	}{
+		{"google.com", "google.com", true},
+		{"google.com", "youtube.com", true},
+		{"youtube.com", "google.com", true},
+		{"google.com", "gmail.com", true},
+		// Groups are not transitive through a shared member
+		{"youtube.com", "gmail.com", false},
+		{"google.com", "example.com", false},
+		{"other.com", "other.com", true},
+	}
+	for _, tt := range equivalent {
+		if got := groups.Equivalent(tt.a, tt.b); got != tt.want {
+			t.Errorf("Equivalent(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+
+	equivalents := []struct {
+		domain string
+		want   []string
+	}{
+		{"google.com", []string{"google.com", "youtube.com", "gmail.com"}},
+		{"youtube.com", []string{"youtube.com", "google.com"}},
+		{"other.com", []string{"other.com"}},
+	}
+	for _, tt := range equivalents {
+		if got := groups.Equivalents(tt.domain); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Equivalents(%q) = %q, want %q", tt.domain, got, tt.want)
+		}
+	}
+}
+
+func TestValidMatchMode(t *testing.T) {
+	for _, mode := range domain.MatchModes {
+		if !domain.ValidMatchMode(string(mode)) {
+			t.Errorf("ValidMatchMode(%q) = false", mode)
+		}
+	}
+	for _, mode := range []string{"", "Host", "fuzzy"} {
+		if domain.ValidMatchMode(mode) {
+			t.Errorf("ValidMatchMode(%q) = true", mode)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+// Package generator generates passwords and passphrases.
+//
+// All randomness goes through rejection sampling, so every character and word
+// is chosen uniformly. Given the same options and the same random bytes the
+// output is identical, which lets clients and audits reproduce results.
+package generator
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"math"
+	"strings"
+)
+
+// Generation modes
+const (
+	ModePassword      = "password"      // random characters
+	ModePronounceable = "pronounceable" // alternating consonants and vowels
+	ModePassphrase    = "passphrase"    // diceware words
+)
+
+// Character classes
+const (
+	Lowercase = "abcdefghijklmnopqrstuvwxyz"
+	Uppercase = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	Digits    = "0123456789"
+	Symbols   = "!@#$%^&*()_+-=[]{}|;:,.<>?"
+
+	// Ambiguous are characters that are easily confused when read or typed
+	Ambiguous = "Il1O0o|"
+
+	consonants = "bcdfghjklmnprstvwz"
+	vowels     = "aeiou"
+)
+
+// Limits on generated secrets
+const (
+	MinLength = 4
+	MaxLength = 128
+	MinWords  = 3
+	MaxWords  = 20
+)
+
+var (
+	ErrInvalidMode      = errors.New("generator: unknown mode")
+	ErrInvalidLength    = errors.New("generator: length out of range")
+	ErrNoCharacters     = errors.New("generator: no characters left to choose from")
+	ErrTooManyRequired  = errors.New("generator: required characters exceed the length")
+	ErrInvalidWordCount = errors.New("generator: word count out of range")
+	ErrInvalidMinimum   = errors.New("generator: minimum counts must not be negative")
+)
+
+// Options controls generation. Callers usually start from DefaultOptions and
+// override what they need.
+type Options struct {
+	Mode string `json:"mode"`
+
+	// Password and pronounceable modes
+	Length           int    `json:"length"`
+	Lowercase        bool   `json:"lowercase"`
+	Uppercase        bool   `json:"uppercase"`
+	Digits           bool   `json:"digits"`
+	Symbols          bool   `json:"symbols"`
+	MinLowercase     int    `json:"min_lowercase"`
+	MinUppercase     int    `json:"min_uppercase"`
+	MinDigits        int    `json:"min_digits"`
+	MinSymbols       int    `json:"min_symbols"`
+	ExcludeAmbiguous bool   `json:"exclude_ambiguous"`
+	Exclude          string `json:"exclude"` // characters never to use
+
+	// Passphrase mode
+	Words         int    `json:"words"`
+	Separator     string `json:"separator"`
+	Capitalize    bool   `json:"capitalize"`
+	IncludeNumber bool   `json:"include_number"` // append a digit to one random word
+}
+
+// Result is a generated secret and an estimate of its strength
+type Result struct {
+	Value string  `json:"value"`
+	Mode  string  `json:"mode"`
+	Bits  float64 `json:"entropy_bits"` // entropy of the generation process
+}
+
+// DefaultOptions returns the options used when a client sends none: a
+// 20 character password with every class and at least one of each
+func DefaultOptions() Options {
+	return Options{
+		Mode:         ModePassword,
+		Length:       20,
+		Lowercase:    true,
+		Uppercase:    true,
+		Digits:       true,
+		Symbols:      true,
+		MinLowercase: 1,
+		MinUppercase: 1,
+		MinDigits:    1,
+		MinSymbols:   1,
+		Words:        6,
+		Separator:    "-",
+	}
+}
+
+// Generate generates a secret with crypto/rand
+func Generate(opts Options) (*Result, error) {
+	return GenerateFrom(rand.Reader, opts)
+}
+
+// GenerateFrom generates a secret from the random bytes in r
+func GenerateFrom(r io.Reader, opts Options) (*Result, error) {
+	if opts.MinLowercase < 0 || opts.MinUppercase < 0 || opts.MinDigits < 0 || opts.MinSymbols < 0 {
+		return nil, ErrInvalidMinimum
+	}
+
+	switch opts.Mode {
+	case ModePassword, "":
+		return password(r, opts)
+	case ModePronounceable:
+		return pronounceable(r, opts)
+	case ModePassphrase:
+		return passphrase(r, opts)
+	default:
+		return nil, ErrInvalidMode
+	}
+}
+
+// class is a character class with its minimum count
+type class struct {
+	chars string
+	min   int
+}
+
+// classes returns the enabled classes with exclusions applied
+func (o *Options) classes() ([]class, error) {
+	all := []struct {
+		enabled bool
+		chars   string
+		min     int
+	}{
+		{o.Lowercase, Lowercase, o.MinLowercase},
+		{o.Uppercase, Uppercase, o.MinUppercase},
+		{o.Digits, Digits, o.MinDigits},
+		{o.Symbols, Symbols, o.MinSymbols},
+	}
+
+	exclude := o.Exclude
+	if o.ExcludeAmbiguous {
+		exclude += Ambiguous
+	}
+
+	var classes []class
+	for _, c := range all {
+		if !c.enabled {
+			continue
+		}
+		chars := without(c.chars, exclude)
+		if chars == "" {
+			if c.min > 0 {
+				return nil, ErrNoCharacters
+			}
+			continue
+		}
+		classes = append(classes, class{chars: chars, min: c.min})
+	}
+	if len(classes) == 0 {
+		return nil, ErrNoCharacters
+	}
+	return classes, nil
+}
+
+func password(r io.Reader, opts Options) (*Result, error) {
+	if opts.Length < MinLength || opts.Length > MaxLength {
+		return nil, ErrInvalidLength
+	}
+	classes, err := opts.classes()
+	if err != nil {
+		return nil, err
+	}
+
+	var union strings.Builder
+	required := 0
+	for _, c := range classes {
+		union.WriteString(c.chars)
+		required += c.min
+	}
+	if required > opts.Length {
+		return nil, ErrTooManyRequired
+	}
+
+	// Satisfy the minimums first, fill up from all classes, then shuffle so
+	// the required characters end up at random positions
+	out := make([]byte, 0, opts.Length)
+	for _, c := range classes {
+		for i := 0; i < c.min; i++ {
+			ch, err := pick(r, c.chars)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, ch)
+		}
+	}
+	all := union.String()
+	for len(out) < opts.Length {
+		ch, err := pick(r, all)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ch)
+	}
+	if err := shuffle(r, out); err != nil {
+		return nil, err
+	}
+
+	return &Result{
+		Value: string(out),
+		Mode:  ModePassword,
+		Bits:  float64(opts.Length) * math.Log2(float64(len(all))),
+	}, nil
+}
+
+// pronounceable builds lowercase consonant-vowel syllables, upper-cases
+// MinUppercase letters and appends the required digits and symbols, so the
+// result can be read out loud
+func pronounceable(r io.Reader, opts Options) (*Result, error) {
+	if opts.Length < MinLength || opts.Length > MaxLength {
+		return nil, ErrInvalidLength
+	}
+	exclude := opts.Exclude
+	if opts.ExcludeAmbiguous {
+		exclude += Ambiguous
+	}
+	cons := without(consonants, exclude)
+	vows := without(vowels, exclude)
+	if cons == "" || vows == "" {
+		return nil, ErrNoCharacters
+	}
+
+	var tail []class
+	if opts.Digits && opts.MinDigits > 0 {
+		tail = append(tail, class{chars: without(Digits, exclude), min: opts.MinDigits})
+	}
+	if opts.Symbols && opts.MinSymbols > 0 {
+		tail = append(tail, class{chars: without(Symbols, exclude), min: opts.MinSymbols})
+	}
+	letters := opts.Length
+	for _, c := range tail {
+		if c.chars == "" {
+			return nil, ErrNoCharacters
+		}
+		letters -= c.min
+	}
+	if letters < 2 {
+		return nil, ErrTooManyRequired
+	}
+
+	bits := 0.0
+	out := make([]byte, 0, opts.Length)
+	for i := 0; i < letters; i++ {
+		set := cons
+		if i%2 == 1 {
+			set = vows
+		}
+		ch, err := pick(r, set)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ch)
+		bits += math.Log2(float64(len(set)))
+	}
+
+	if opts.Uppercase && opts.MinUppercase > 0 {
+		// Only letters whose capital is not excluded can be upper-cased
+		var positions []byte
+		for i, ch := range out {
+			if strings.IndexByte(exclude, ch-'a'+'A') < 0 {
+				positions = append(positions, byte(i))
+			}
+		}
+		if opts.MinUppercase > len(positions) {
+			return nil, ErrTooManyRequired
+		}
+		if err := shuffle(r, positions); err != nil {
+			return nil, err
+		}
+		for _, p := range positions[:opts.MinUppercase] {
+			out[p] = out[p] - 'a' + 'A'
+		}
+	}
+
+	for _, c := range tail {
+		for i := 0; i < c.min; i++ {
+			ch, err := pick(r, c.chars)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, ch)
+			bits += math.Log2(float64(len(c.chars)))
+		}
+	}
+
+	return &Result{Value: string(out), Mode: ModePronounceable, Bits: bits}, nil
+}
+
+// without removes every byte of exclude from set
+func without(set, exclude string) string {
+	if exclude == "" {
+		return set
+	}
+	var b strings.Builder
+	for i := 0; i < len(set); i++ {
+		if strings.IndexByte(exclude, set[i]) < 0 {
+			b.WriteByte(set[i])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,257 @@
+package generator_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/askuy/passwordx/backend/internal/pkg/generator"
+)
+
+// count returns how many bytes of s are in set
+func count(s, set string) int {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(set, s[i]) >= 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func TestPassword(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*generator.Options)
+		allowed string
+	}{
+		{"defaults", func(*generator.Options) {}, generator.Lowercase + generator.Uppercase + generator.Digits + generator.Symbols},
+		{"minimum length", func(o *generator.Options) { o.Length = generator.MinLength }, generator.Lowercase + generator.Uppercase + generator.Digits + generator.Symbols},
+		{"maximum length", func(o *generator.Options) { o.Length = generator.MaxLength }, generator.Lowercase + generator.Uppercase + generator.Digits + generator.Symbols},
+		{"digits only", func(o *generator.Options) {
+			o.Lowercase, o.Uppercase, o.Symbols = false, false, false
+			o.MinDigits = 4
+		}, generator.Digits},
+		{"no symbols", func(o *generator.Options) { o.Symbols, o.MinSymbols = false, 0 }, generator.Lowercase + generator.Uppercase + generator.Digits},
+		{"high minimums", func(o *generator.Options) {
+			o.MinLowercase, o.MinUppercase, o.MinDigits, o.MinSymbols = 5, 5, 5, 5
+		}, generator.Lowercase + generator.Uppercase + generator.Digits + generator.Symbols},
+		{"exclude ambiguous", func(o *generator.Options) { o.ExcludeAmbiguous = true }, "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789!@#$%^&*()_+-=[]{};:,.<>?"},
+		{"exclude characters", func(o *generator.Options) {
+			o.Uppercase, o.Digits, o.Symbols = false, false, false
+			o.MinUppercase, o.MinDigits, o.MinSymbols = 0, 0, 0
+			o.Exclude = "abcdefghijklmnopqrstuvw"
+		}, "xyz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := generator.DefaultOptions()
+			tt.modify(&opts)
+			for i := 0; i < 50; i++ {
+				result, err := generator.Generate(opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				value := result.Value
+				if len(value) != opts.Length {
+					t.Fatalf("len(%q) = %d, want %d", value, len(value), opts.Length)
+				}
+				if n := count(value, tt.allowed); n != len(value) {
+					t.Fatalf("%q has characters outside %q", value, tt.allowed)
+				}
+				minimums := []struct {
+					enabled bool
+					set     string
+					min     int
+				}{
+					{opts.Lowercase, generator.Lowercase, opts.MinLowercase},
+					{opts.Uppercase, generator.Uppercase, opts.MinUppercase},
+					{opts.Digits, generator.Digits, opts.MinDigits},
+					{opts.Symbols, generator.Symbols, opts.MinSymbols},
+				}
+				for _, m := range minimums {
+					if m.enabled && count(value, m.set) < m.min {
+						t.Fatalf("%q has fewer than %d of %q", value, m.min, m.set)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPasswordBits(t *testing.T) {
+	result, err := generator.Generate(generator.DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	alphabet := len(generator.Lowercase + generator.Uppercase + generator.Digits + generator.Symbols)
+	if want := 20 * math.Log2(float64(alphabet)); math.Abs(result.Bits-want) > 1e-9 {
+		t.Errorf("Bits = %v, want %v", result.Bits, want)
+	}
+}
+
+func TestPronounceable(t *testing.T) {
+	opts := generator.DefaultOptions()
+	opts.Mode = generator.ModePronounceable
+	opts.Length = 12
+	opts.MinDigits, opts.MinSymbols, opts.MinUppercase = 2, 1, 2
+
+	for i := 0; i < 50; i++ {
+		result, err := generator.Generate(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		value := result.Value
+		if len(value) != opts.Length {
+			t.Fatalf("len(%q) = %d, want %d", value, len(value), opts.Length)
+		}
+		letters := strings.ToLower(value[:opts.Length-3])
+		for j := 0; j < len(letters); j++ {
+			set := "bcdfghjklmnprstvwz"
+			if j%2 == 1 {
+				set = "aeiou"
+			}
+			if strings.IndexByte(set, letters[j]) < 0 {
+				t.Fatalf("%q does not alternate consonants and vowels", value)
+			}
+		}
+		if n := count(value, generator.Uppercase); n != 2 {
+			t.Fatalf("%q has %d capitals, want 2", value, n)
+		}
+		if count(value[opts.Length-3:opts.Length-1], generator.Digits) != 2 || count(value[opts.Length-1:], generator.Symbols) != 1 {
+			t.Fatalf("%q does not end with 2 digits and a symbol", value)
+		}
+	}
+}
+
+func TestPassphrase(t *testing.T) {
+	words := make(map[string]bool, len(generator.Wordlist()))
+	for _, w := range generator.Wordlist() {
+		words[w] = true
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*generator.Options)
+	}{
+		{"defaults", func(*generator.Options) {}},
+		{"minimum words", func(o *generator.Options) { o.Words = generator.MinWords }},
+		{"maximum words", func(o *generator.Options) { o.Words = generator.MaxWords }},
+		{"space separator", func(o *generator.Options) { o.Separator = " " }},
+		{"capitalized", func(o *generator.Options) { o.Capitalize = true }},
+		{"with number", func(o *generator.Options) { o.IncludeNumber = true }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := generator.DefaultOptions()
+			opts.Mode = generator.ModePassphrase
+			tt.modify(&opts)
+			result, err := generator.Generate(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parts := strings.Split(result.Value, opts.Separator)
+			if len(parts) != opts.Words {
+				t.Fatalf("%q has %d words, want %d", result.Value, len(parts), opts.Words)
+			}
+			digits := 0
+			for _, part := range parts {
+				if opts.Capitalize && !unicode.IsUpper(rune(part[0])) {
+					t.Errorf("%q is not capitalized", part)
+				}
+				word := strings.ToLower(strings.TrimRight(part, generator.Digits))
+				digits += len(part) - len(strings.TrimRight(part, generator.Digits))
+				if !words[word] {
+					t.Errorf("%q is not in the wordlist", word)
+				}
+			}
+			if want := map[bool]int{true: 1, false: 0}[opts.IncludeNumber]; digits != want {
+				t.Errorf("%q has %d appended digits, want %d", result.Value, digits, want)
+			}
+			wantBits := float64(opts.Words) * math.Log2(float64(len(generator.Wordlist())))
+			if opts.IncludeNumber {
+				wantBits += math.Log2(float64(opts.Words * 10))
+			}
+			if math.Abs(result.Bits-wantBits) > 1e-9 {
+				t.Errorf("Bits = %v, want %v", result.Bits, wantBits)
+			}
+		})
+	}
+}
+
+func TestWordlist(t *testing.T) {
+	words := generator.Wordlist()
+	if len(words) != 7776 {
+		t.Fatalf("len(Wordlist()) = %d, want 7776", len(words))
+	}
+	if words[0] != "abacus" {
+		t.Errorf("first word = %q, want abacus", words[0])
+	}
+}
+
+func TestGenerateFromIsDeterministic(t *testing.T) {
+	random := make([]byte, 4096)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatal(err)
+	}
+	for _, mode := range []string{generator.ModePassword, generator.ModePronounceable, generator.ModePassphrase} {
+		t.Run(mode, func(t *testing.T) {
+			opts := generator.DefaultOptions()
+			opts.Mode = mode
+			a, err := generator.GenerateFrom(bytes.NewReader(random), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := generator.GenerateFrom(bytes.NewReader(random), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a.Value != b.Value {
+				t.Errorf("same random bytes gave %q and %q", a.Value, b.Value)
+			}
+			// Running out of randomness is an error, not a weaker secret
+			if _, err := generator.GenerateFrom(bytes.NewReader(random[:8]), opts); err == nil {
+				t.Error("GenerateFrom succeeded with too few random bytes")
+			}
+		})
+	}
+}
+
+func TestGenerateInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*generator.Options)
+		wantErr error
+	}{
+		{"unknown mode", func(o *generator.Options) { o.Mode = "emoji" }, generator.ErrInvalidMode},
+		{"too short", func(o *generator.Options) { o.Length = generator.MinLength - 1 }, generator.ErrInvalidLength},
+		{"too long", func(o *generator.Options) { o.Length = generator.MaxLength + 1 }, generator.ErrInvalidLength},
+		{"negative minimum", func(o *generator.Options) { o.MinDigits = -1 }, generator.ErrInvalidMinimum},
+		{"no classes", func(o *generator.Options) {
+			o.Lowercase, o.Uppercase, o.Digits, o.Symbols = false, false, false, false
+		}, generator.ErrNoCharacters},
+		{"required class fully excluded", func(o *generator.Options) { o.Exclude = generator.Digits }, generator.ErrNoCharacters},
+		{"minimums exceed length", func(o *generator.Options) { o.Length, o.MinSymbols = 8, 6 }, generator.ErrTooManyRequired},
+		{"too few words", func(o *generator.Options) { o.Mode, o.Words = generator.ModePassphrase, generator.MinWords - 1 }, generator.ErrInvalidWordCount},
+		{"too many words", func(o *generator.Options) { o.Mode, o.Words = generator.ModePassphrase, generator.MaxWords + 1 }, generator.ErrInvalidWordCount},
+		{"pronounceable without vowels", func(o *generator.Options) {
+			o.Mode, o.Exclude = generator.ModePronounceable, "aeiou"
+		}, generator.ErrNoCharacters},
+		{"pronounceable minimums exceed length", func(o *generator.Options) {
+			o.Mode, o.Length, o.MinDigits = generator.ModePronounceable, 6, 5
+		}, generator.ErrTooManyRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := generator.DefaultOptions()
+			tt.modify(&opts)
+			if _, err := generator.Generate(opts); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Generate error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
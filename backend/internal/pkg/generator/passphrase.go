@@ -0,0 +1,71 @@
+package generator
+
+import (
+	_ "embed"
+	"io"
+	"math"
+	"strings"
+	"sync"
+)
+
+// effLargeWordlist is the EFF large diceware wordlist, verbatim: a five dice
+// roll and a word per line. See
+// https://www.eff.org/deeplinks/2016/07/new-wordlists-random-passphrases
+//
+//go:embed eff_large_wordlist.txt
+var effLargeWordlist string
+
+var wordlist = sync.OnceValue(func() []string {
+	lines := strings.Split(strings.TrimSpace(effLargeWordlist), "\n")
+	words := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if _, word, ok := strings.Cut(line, "\t"); ok {
+			words = append(words, word)
+		}
+	}
+	return words
+})
+
+// Wordlist returns the diceware wordlist in dice roll order
+func Wordlist() []string {
+	return wordlist()
+}
+
+func passphrase(r io.Reader, opts Options) (*Result, error) {
+	if opts.Words < MinWords || opts.Words > MaxWords {
+		return nil, ErrInvalidWordCount
+	}
+	words := wordlist()
+
+	out := make([]string, opts.Words)
+	for i := range out {
+		n, err := uniform(r, len(words))
+		if err != nil {
+			return nil, err
+		}
+		out[i] = words[n]
+		if opts.Capitalize {
+			out[i] = strings.ToUpper(out[i][:1]) + out[i][1:]
+		}
+	}
+	bits := float64(opts.Words) * math.Log2(float64(len(words)))
+
+	if opts.IncludeNumber {
+		w, err := uniform(r, len(out))
+		if err != nil {
+			return nil, err
+		}
+		d, err := pick(r, Digits)
+		if err != nil {
+			return nil, err
+		}
+		out[w] += string(d)
+		bits += math.Log2(float64(len(out) * len(Digits)))
+	}
+
+	return &Result{
+		Value: strings.Join(out, opts.Separator),
+		Mode:  ModePassphrase,
+		Bits:  bits,
+	}, nil
+}
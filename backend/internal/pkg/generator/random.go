@@ -0,0 +1,49 @@
+package generator
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// uniform returns a uniformly distributed integer in [0, n) read from r.
+// Values from the incomplete top range are rejected instead of reduced modulo
+// n, which would favor small results.
+func uniform(r io.Reader, n int) (int, error) {
+	if n <= 0 || uint64(n) > math.MaxUint32 {
+		panic("generator: invalid range")
+	}
+	bound := uint32(n)
+	limit := math.MaxUint32 - (math.MaxUint32%bound+1)%bound
+	var buf [4]byte
+	for {
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return 0, err
+		}
+		v := binary.BigEndian.Uint32(buf[:])
+		if v <= limit {
+			return int(v % bound), nil
+		}
+	}
+}
+
+// pick returns a uniformly chosen byte of set
+func pick(r io.Reader, set string) (byte, error) {
+	i, err := uniform(r, len(set))
+	if err != nil {
+		return 0, err
+	}
+	return set[i], nil
+}
+
+// shuffle permutes b with an unbiased Fisher-Yates shuffle
+func shuffle(r io.Reader, b []byte) error {
+	for i := len(b) - 1; i > 0; i-- {
+		j, err := uniform(r, i+1)
+		if err != nil {
+			return err
+		}
+		b[i], b[j] = b[j], b[i]
+	}
+	return nil
+}
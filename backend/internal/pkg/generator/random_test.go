@@ -0,0 +1,50 @@
+package generator
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestUniformRejectsTopRange(t *testing.T) {
+	tests := []struct {
+		name  string
+		n     int
+		input []byte
+		want  int
+	}{
+		{"in range", 26, []byte{0, 0, 0, 3}, 3},
+		{"reduced", 26, []byte{0, 0, 0, 29}, 3},
+		// 2^32 is not a multiple of 26, so the top values are rejected and
+		// the next four bytes are used instead
+		{"top value rejected", 26, []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 5}, 5},
+		// 2^32 is a multiple of 16, so nothing is rejected
+		{"power of two", 16, []byte{0xff, 0xff, 0xff, 0xff}, 15},
+		{"single value", 1, []byte{0xff, 0xff, 0xff, 0xff}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := uniform(bytes.NewReader(tt.input), tt.n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("uniform = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShuffleIsPermutation(t *testing.T) {
+	b := []byte("abcdefgh")
+	random := bytes.Repeat([]byte{0x12, 0x34, 0x56, 0x78}, len(b))
+	if err := shuffle(bytes.NewReader(random), b); err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[byte]bool)
+	for _, c := range b {
+		seen[c] = true
+	}
+	if len(seen) != len(b) {
+		t.Errorf("shuffle lost or duplicated elements: %q", b)
+	}
+}
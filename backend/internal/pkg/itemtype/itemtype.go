@@ -0,0 +1,133 @@
+// Package itemtype defines the kinds of items a vault holds and the fields
+// each kind stores. The server only ever sees field names, never values, so
+// a schema is what it can check: that an item stores no fields foreign to
+// its type and every required field is present.
+//
+// Every item has an encrypted title. The standard fields url, username,
+// password, notes and totp have their own columns, as logins always had;
+// every other field of a type is stored in the item's field map.
+package itemtype
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Item types
+const (
+	Login      = "login"
+	SecureNote = "secure_note"
+	CreditCard = "credit_card"
+	Identity   = "identity"
+	SSHKey     = "ssh_key"
+	APIKey     = "api_key"
+	Database   = "database"
+)
+
+// Standard fields, stored in their own columns
+const (
+	FieldURL      = "url"
+	FieldUsername = "username"
+	FieldPassword = "password"
+	FieldNotes    = "notes"
+	FieldTOTP     = "totp"
+)
+
+// Field kinds tell clients which input to show and how to format the value
+const (
+	KindText      = "text"
+	KindSecret    = "secret" // a password-like value with generator support
+	KindURL       = "url"
+	KindEmail     = "email"
+	KindPhone     = "phone"
+	KindNumber    = "number"
+	KindDate      = "date"       // YYYY-MM-DD
+	KindMonthYear = "month_year" // MM/YYYY, card expiry
+	KindMultiline = "multiline"
+	KindTOTP      = "totp" // otpauth:// URI, see package totp
+)
+
+var (
+	ErrUnknownType  = errors.New("unknown item type")
+	ErrUnknownField = errors.New("field does not belong to the item type")
+	ErrMissingField = errors.New("required field is missing")
+)
+
+// Field describes one encrypted field of an item type
+type Field struct {
+	Name      string `json:"name"`
+	Label     string `json:"label"`
+	Kind      string `json:"kind"`
+	Required  bool   `json:"required"`
+	Concealed bool   `json:"concealed"` // hidden until revealed
+	Standard  bool   `json:"standard"`  // stored in its own column rather than the field map
+}
+
+// Type is the schema of an item type
+type Type struct {
+	Name     string  `json:"name"`
+	Label    string  `json:"label"`
+	Icon     string  `json:"icon"`
+	Subtitle string  `json:"subtitle,omitempty"` // field shown under the title in lists
+	Fields   []Field `json:"fields"`
+}
+
+// All returns every item type in display order
+func All() []*Type {
+	return types
+}
+
+// Lookup returns the item type with a name
+func Lookup(name string) (*Type, error) {
+	if t, ok := byName[name]; ok {
+		return t, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownType, name)
+}
+
+// IsStandardField reports whether a field is stored in its own column
+func IsStandardField(name string) bool {
+	switch name {
+	case FieldURL, FieldUsername, FieldPassword, FieldNotes, FieldTOTP:
+		return true
+	}
+	return false
+}
+
+// Field returns the field of the type with a name
+func (t *Type) Field(name string) (*Field, bool) {
+	for i := range t.Fields {
+		if t.Fields[i].Name == name {
+			return &t.Fields[i], true
+		}
+	}
+	return nil, false
+}
+
+// Validate checks the names of the fields an item stores a value for
+func (t *Type) Validate(present []string) error {
+	set := make(map[string]bool, len(present))
+	for _, name := range present {
+		if _, ok := t.Field(name); !ok {
+			return fmt.Errorf("%w: %s has no field %q", ErrUnknownField, t.Name, name)
+		}
+		set[name] = true
+	}
+	for _, f := range t.Fields {
+		if f.Required && !set[f.Name] {
+			return fmt.Errorf("%w: %s requires %q", ErrMissingField, t.Name, f.Name)
+		}
+	}
+	return nil
+}
+
+var byName = func() map[string]*Type {
+	m := make(map[string]*Type, len(types))
+	for _, t := range types {
+		for i := range t.Fields {
+			t.Fields[i].Standard = IsStandardField(t.Fields[i].Name)
+		}
+		m[t.Name] = t
+	}
+	return m
+}()
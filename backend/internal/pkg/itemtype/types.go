@@ -0,0 +1,104 @@
+package itemtype
+
+// notes is the free text every type allows
+var notes = Field{Name: FieldNotes, Label: "Notes", Kind: KindMultiline}
+
+var types = []*Type{
+	{
+		Name:     Login,
+		Label:    "Login",
+		Icon:     "key",
+		Subtitle: FieldUsername,
+		Fields: []Field{
+			{Name: FieldUsername, Label: "Username", Kind: KindText},
+			{Name: FieldPassword, Label: "Password", Kind: KindSecret, Required: true, Concealed: true},
+			{Name: FieldURL, Label: "Website", Kind: KindURL},
+			{Name: FieldTOTP, Label: "One-time password", Kind: KindTOTP, Concealed: true},
+			notes,
+		},
+	},
+	{
+		Name:  SecureNote,
+		Label: "Secure note",
+		Icon:  "note",
+		Fields: []Field{
+			{Name: FieldNotes, Label: "Note", Kind: KindMultiline, Required: true},
+		},
+	},
+	{
+		Name:     CreditCard,
+		Label:    "Credit card",
+		Icon:     "credit-card",
+		Subtitle: "cardholder",
+		Fields: []Field{
+			{Name: "cardholder", Label: "Cardholder name", Kind: KindText},
+			{Name: "brand", Label: "Brand", Kind: KindText},
+			{Name: "number", Label: "Number", Kind: KindNumber, Required: true, Concealed: true},
+			{Name: "expiry", Label: "Expiry date", Kind: KindMonthYear},
+			{Name: "cvv", Label: "Security code", Kind: KindNumber, Concealed: true},
+			{Name: "pin", Label: "PIN", Kind: KindNumber, Concealed: true},
+			notes,
+		},
+	},
+	{
+		Name:     Identity,
+		Label:    "Identity",
+		Icon:     "user",
+		Subtitle: "email",
+		Fields: []Field{
+			{Name: "first_name", Label: "First name", Kind: KindText},
+			{Name: "last_name", Label: "Last name", Kind: KindText},
+			{Name: "email", Label: "Email", Kind: KindEmail},
+			{Name: "phone", Label: "Phone", Kind: KindPhone},
+			{Name: "birth_date", Label: "Date of birth", Kind: KindDate},
+			{Name: "company", Label: "Company", Kind: KindText},
+			{Name: "address", Label: "Address", Kind: KindMultiline},
+			{Name: "country", Label: "Country", Kind: KindText},
+			{Name: "id_number", Label: "ID or passport number", Kind: KindText, Concealed: true},
+			notes,
+		},
+	},
+	{
+		Name:     SSHKey,
+		Label:    "SSH key",
+		Icon:     "terminal",
+		Subtitle: "fingerprint",
+		Fields: []Field{
+			{Name: "private_key", Label: "Private key", Kind: KindMultiline, Required: true, Concealed: true},
+			{Name: "public_key", Label: "Public key", Kind: KindMultiline},
+			{Name: "fingerprint", Label: "Fingerprint", Kind: KindText},
+			{Name: "passphrase", Label: "Passphrase", Kind: KindSecret, Concealed: true},
+			{Name: "host", Label: "Host", Kind: KindText},
+			notes,
+		},
+	},
+	{
+		Name:     APIKey,
+		Label:    "API key",
+		Icon:     "code",
+		Subtitle: FieldURL,
+		Fields: []Field{
+			{Name: "key", Label: "Key", Kind: KindSecret, Required: true, Concealed: true},
+			{Name: "secret", Label: "Secret", Kind: KindSecret, Concealed: true},
+			{Name: FieldURL, Label: "Website", Kind: KindURL},
+			{Name: "expires", Label: "Expires", Kind: KindDate},
+			notes,
+		},
+	},
+	{
+		Name:     Database,
+		Label:    "Database",
+		Icon:     "database",
+		Subtitle: "host",
+		Fields: []Field{
+			{Name: "engine", Label: "Type", Kind: KindText},
+			{Name: "host", Label: "Host", Kind: KindText, Required: true},
+			{Name: "port", Label: "Port", Kind: KindNumber},
+			{Name: "database", Label: "Database", Kind: KindText},
+			{Name: FieldUsername, Label: "Username", Kind: KindText},
+			{Name: FieldPassword, Label: "Password", Kind: KindSecret, Concealed: true},
+			{Name: "connection_string", Label: "Connection string", Kind: KindText, Concealed: true},
+			notes,
+		},
+	},
+}
@@ -0,0 +1,146 @@
+// Package shamir implements Shamir's secret sharing over GF(2^8).
+//
+// Each share is the secret's length plus one byte: the polynomial values for
+// every secret byte followed by the share's x coordinate.
+package shamir
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"io"
+)
+
+const (
+	// MaxShares is the largest number of shares a secret can be split into
+	MaxShares = 255
+)
+
+var (
+	ErrInvalidParameters = errors.New("shamir: invalid threshold or share count")
+	ErrInvalidShares     = errors.New("shamir: invalid shares")
+)
+
+// GF(2^8) with the AES polynomial x^8 + x^4 + x^3 + x + 1
+var expTable, logTable [256]byte
+
+func init() {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		expTable[i] = x
+		logTable[x] = byte(i)
+		// multiply by the generator 3
+		x ^= xtime(x)
+	}
+	expTable[255] = expTable[0]
+}
+
+func xtime(b byte) byte {
+	if b&0x80 != 0 {
+		return b<<1 ^ 0x1b
+	}
+	return b << 1
+}
+
+func mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return expTable[(int(logTable[a])+int(logTable[b]))%255]
+}
+
+func div(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return expTable[(int(logTable[a])-int(logTable[b])+255)%255]
+}
+
+// Split splits secret into n shares, any threshold of which reconstruct it
+func Split(secret []byte, n, threshold int) ([][]byte, error) {
+	if len(secret) == 0 || threshold < 1 || n < threshold || n > MaxShares {
+		return nil, ErrInvalidParameters
+	}
+
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][len(secret)] = byte(i + 1)
+	}
+
+	coefficients := make([]byte, threshold)
+	for idx, s := range secret {
+		coefficients[0] = s
+		if _, err := io.ReadFull(rand.Reader, coefficients[1:]); err != nil {
+			return nil, err
+		}
+		for i := range shares {
+			shares[i][idx] = evaluate(coefficients, byte(i+1))
+		}
+	}
+	subtle.XORBytes(coefficients, coefficients, coefficients)
+	return shares, nil
+}
+
+// Combine reconstructs a secret from at least threshold shares. With fewer
+// shares it returns garbage rather than an error, as the threshold is not
+// encoded in the shares.
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, ErrInvalidShares
+	}
+	size := len(shares[0])
+	if size < 2 {
+		return nil, ErrInvalidShares
+	}
+
+	xs := make([]byte, len(shares))
+	seen := make(map[byte]bool, len(shares))
+	for i, share := range shares {
+		if len(share) != size {
+			return nil, ErrInvalidShares
+		}
+		x := share[size-1]
+		if x == 0 || seen[x] {
+			return nil, ErrInvalidShares
+		}
+		seen[x] = true
+		xs[i] = x
+	}
+
+	secret := make([]byte, size-1)
+	ys := make([]byte, len(shares))
+	for idx := range secret {
+		for i, share := range shares {
+			ys[i] = share[idx]
+		}
+		secret[idx] = interpolateAtZero(xs, ys)
+	}
+	return secret, nil
+}
+
+// evaluate computes the polynomial at x using Horner's method
+func evaluate(coefficients []byte, x byte) byte {
+	result := byte(0)
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		result = mul(result, x) ^ coefficients[i]
+	}
+	return result
+}
+
+// interpolateAtZero evaluates the Lagrange polynomial through the points at 0
+func interpolateAtZero(xs, ys []byte) byte {
+	result := byte(0)
+	for i := range xs {
+		basis := byte(1)
+		for j := range xs {
+			if i == j {
+				continue
+			}
+			// (0 - x_j) / (x_i - x_j); subtraction is XOR in GF(2^8)
+			basis = mul(basis, div(xs[j], xs[i]^xs[j]))
+		}
+		result ^= mul(ys[i], basis)
+	}
+	return result
+}
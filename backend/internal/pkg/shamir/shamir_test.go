@@ -0,0 +1,147 @@
+package shamir_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/askuy/passwordx/backend/internal/pkg/shamir"
+)
+
+func randomSecret(t *testing.T, size int) []byte {
+	t.Helper()
+	secret := make([]byte, size)
+	if _, err := rand.Read(secret); err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+func TestSplitCombine(t *testing.T) {
+	tests := []struct {
+		name      string
+		n         int
+		threshold int
+	}{
+		{"1 of 1", 1, 1},
+		{"1 of 3", 3, 1},
+		{"2 of 3", 3, 2},
+		{"3 of 3", 3, 3},
+		{"3 of 5", 5, 3},
+		{"5 of 10", 10, 5},
+		{"max shares", shamir.MaxShares, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := randomSecret(t, 32)
+			shares, err := shamir.Split(secret, tt.n, tt.threshold)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(shares) != tt.n {
+				t.Fatalf("got %d shares, want %d", len(shares), tt.n)
+			}
+
+			// Any threshold shares reconstruct the secret, in any order
+			subsets := map[string][][]byte{
+				"first": shares[:tt.threshold],
+				"last":  shares[tt.n-tt.threshold:],
+				"all":   shares,
+			}
+			reversed := make([][]byte, tt.threshold)
+			for i := range reversed {
+				reversed[i] = shares[tt.threshold-1-i]
+			}
+			subsets["reversed"] = reversed
+			for name, subset := range subsets {
+				got, err := shamir.Combine(subset)
+				if err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+				if !bytes.Equal(got, secret) {
+					t.Errorf("%s: Combine = %x, want %x", name, got, secret)
+				}
+			}
+		})
+	}
+}
+
+func TestCombineBelowThreshold(t *testing.T) {
+	tests := []struct {
+		name      string
+		n         int
+		threshold int
+	}{
+		{"1 share, threshold 2", 2, 2},
+		{"2 shares, threshold 3", 5, 3},
+		{"4 shares, threshold 5", 5, 5},
+		{"9 shares, threshold 10", 12, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := randomSecret(t, 32)
+			shares, err := shamir.Split(secret, tt.n, tt.threshold)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The threshold is not encoded in the shares, so fewer shares
+			// yield a wrong secret instead of an error
+			got, err := shamir.Combine(shares[:tt.threshold-1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Equal(got, secret) {
+				t.Error("Combine recovered the secret from fewer shares than the threshold")
+			}
+		})
+	}
+}
+
+func TestSplitInvalidParameters(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    []byte
+		n         int
+		threshold int
+	}{
+		{"empty secret", nil, 3, 2},
+		{"zero threshold", []byte("secret"), 3, 0},
+		{"threshold above shares", []byte("secret"), 2, 3},
+		{"too many shares", []byte("secret"), shamir.MaxShares + 1, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := shamir.Split(tt.secret, tt.n, tt.threshold); !errors.Is(err, shamir.ErrInvalidParameters) {
+				t.Errorf("Split error = %v, want %v", err, shamir.ErrInvalidParameters)
+			}
+		})
+	}
+}
+
+func TestCombineInvalidShares(t *testing.T) {
+	shares, err := shamir.Split([]byte("secret"), 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zeroX := bytes.Clone(shares[0])
+	zeroX[len(zeroX)-1] = 0
+
+	tests := []struct {
+		name   string
+		shares [][]byte
+	}{
+		{"no shares", nil},
+		{"share too short", [][]byte{{1}}},
+		{"different lengths", [][]byte{shares[0], shares[1][1:]}},
+		{"duplicate x", [][]byte{shares[0], shares[0]}},
+		{"zero x", [][]byte{zeroX, shares[1]}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := shamir.Combine(tt.shares); !errors.Is(err, shamir.ErrInvalidShares) {
+				t.Errorf("Combine error = %v, want %v", err, shamir.ErrInvalidShares)
+			}
+		})
+	}
+}
@@ -0,0 +1,308 @@
+// Package srp implements the Secure Remote Password protocol (SRP-6a, RFC 5054)
+// with the 2048-bit group and SHA-256.
+//
+// The password input is not the master password itself but an auth secret
+// derived from the master key (see AuthSecret), so clients run the KDF once per
+// unlock and the server never learns anything that decrypts vault data.
+//
+//	x  = H(s | H(I | ":" | secret))
+//	v  = g^x
+//	k  = H(N | PAD(g))
+//	B  = k*v + g^b
+//	u  = H(PAD(A) | PAD(B))
+//	S  = (A * v^u)^b = (B - k*g^x)^(a + u*x)
+//	K  = H(PAD(S))
+//	M1 = H(H(N) xor H(g) | H(I) | s | PAD(A) | PAD(B) | K)
+//	M2 = H(PAD(A) | M1 | K)
+package srp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"hash"
+	"io"
+	"math/big"
+	"strings"
+)
+
+const (
+	// SaltSize is the size of SRP salts in bytes
+	SaltSize = 32
+	// privateSize is the size of the ephemeral private values a and b in bytes
+	privateSize = 32
+)
+
+// RFC 5054 2048-bit group
+var (
+	groupN, _ = new(big.Int).SetString(strings.Join([]string{
+		"AC6BDB41324A9A9BF166DE5E1389582FAF72B6651987EE07FC3192943DB56050",
+		"A37329CBB4A099ED8193E0757767A13DD52312AB4B03310DCD7F48A9DA04FD50",
+		"E8083969EDB767B0CF6095179A163AB3661A05FBD5FAAAE82918A9962F0B93B8",
+		"55F97993EC975EEAA80D740ADBF4FF747359D041D5C33EA71D281E446B14773B",
+		"CA97B43A23FB801676BD207A436C6481F1D2B9078717461A5B9D32E688F87748",
+		"544523B524B0D57D5EA77A2775D2ECFA032CFBDBF52FB3786160279004E57AE6",
+		"AF874E7303CE53299CCC041C7BC308D82A5698F3A8D0C38271AE35F8E9DBFBB6",
+		"94B5C803D89F7AE435DE236D525F54759B65E372FCD68EF20FA7111F9E4AFF73",
+	}, ""), 16)
+	defaultGroup = newGroup(groupN, 2, sha256.New)
+)
+
+var (
+	ErrInvalidPublicValue = errors.New("srp: invalid public value")
+	ErrProofMismatch      = errors.New("srp: proof mismatch")
+)
+
+// AuthSecret derives the SRP password input from the user's master key, so the
+// value sent through SRP is independent of the key that encrypts vault data
+func AuthSecret(masterKey []byte) []byte {
+	mac := hmac.New(sha256.New, masterKey)
+	mac.Write([]byte("passwordx-srp-auth"))
+	return mac.Sum(nil)
+}
+
+// NormalizeIdentity returns the SRP identity for an email address
+func NormalizeIdentity(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// GenerateSalt generates a random SRP salt
+func GenerateSalt() ([]byte, error) {
+	salt := make([]byte, SaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// ComputeVerifier computes the verifier v = g^x stored by the server
+func ComputeVerifier(salt []byte, identity string, secret []byte) []byte {
+	return defaultGroup.pad(defaultGroup.verifier(defaultGroup.computeX(salt, identity, secret)))
+}
+
+// ValidateVerifier checks that a client supplied verifier is a group element
+func ValidateVerifier(verifier []byte) error {
+	grp := defaultGroup
+	if len(verifier) > len(grp.pad(grp.N)) || !grp.validPublic(new(big.Int).SetBytes(verifier)) {
+		return ErrInvalidPublicValue
+	}
+	return nil
+}
+
+// ServerSession is the server half of a handshake. Its exported fields are
+// persisted between the challenge and the verification request.
+type ServerSession struct {
+	Identity string `json:"identity"`
+	Salt     []byte `json:"salt"`
+	Verifier []byte `json:"verifier"`
+	A        []byte `json:"a"`
+	B        []byte `json:"b"`
+	Secret   []byte `json:"secret"` // server ephemeral private value b
+}
+
+// NewServerSession validates the client's public value A and generates the
+// server's public value B
+func NewServerSession(identity string, salt, verifier, clientPublic []byte) (*ServerSession, error) {
+	grp := defaultGroup
+	A := new(big.Int).SetBytes(clientPublic)
+	if !grp.validPublic(A) {
+		return nil, ErrInvalidPublicValue
+	}
+
+	b, err := randomPrivate()
+	if err != nil {
+		return nil, err
+	}
+	B := grp.serverPublic(new(big.Int).SetBytes(verifier), b)
+
+	return &ServerSession{
+		Identity: identity,
+		Salt:     salt,
+		Verifier: verifier,
+		A:        grp.pad(A),
+		B:        grp.pad(B),
+		Secret:   b.Bytes(),
+	}, nil
+}
+
+// Verify checks the client proof M1 and returns the server proof M2
+func (s *ServerSession) Verify(clientProof []byte) ([]byte, error) {
+	grp := defaultGroup
+	A := new(big.Int).SetBytes(s.A)
+	B := new(big.Int).SetBytes(s.B)
+	u := grp.scramble(A, B)
+	if u.Sign() == 0 {
+		return nil, ErrInvalidPublicValue
+	}
+
+	S := grp.serverPremaster(A, new(big.Int).SetBytes(s.Verifier), u, new(big.Int).SetBytes(s.Secret))
+	key := grp.digest(grp.pad(S))
+	expected := grp.clientProof(s.Identity, s.Salt, s.A, s.B, key)
+	if subtle.ConstantTimeCompare(expected, clientProof) != 1 {
+		return nil, ErrProofMismatch
+	}
+	return grp.digest(s.A, expected, key), nil
+}
+
+// Client is the client half of a handshake. The server only needs it for
+// tooling; browsers and the extension implement the same steps in JavaScript.
+type Client struct {
+	grp      *group
+	identity string
+	secret   []byte
+	a        *big.Int
+	A        *big.Int
+	m1       []byte
+	key      []byte
+}
+
+// NewClient starts a handshake and generates the public value A
+func NewClient(identity string, secret []byte) (*Client, error) {
+	a, err := randomPrivate()
+	if err != nil {
+		return nil, err
+	}
+	return defaultGroup.newClient(identity, secret, a), nil
+}
+
+// PublicValue returns A
+func (c *Client) PublicValue() []byte {
+	return c.grp.pad(c.A)
+}
+
+// Proof computes the client proof M1 from the server's salt and public value B
+func (c *Client) Proof(salt, serverPublic []byte) ([]byte, error) {
+	grp := c.grp
+	B := new(big.Int).SetBytes(serverPublic)
+	if !grp.validPublic(B) {
+		return nil, ErrInvalidPublicValue
+	}
+	u := grp.scramble(c.A, B)
+	if u.Sign() == 0 {
+		return nil, ErrInvalidPublicValue
+	}
+
+	S := grp.clientPremaster(B, grp.computeX(salt, c.identity, c.secret), u, c.a)
+	c.key = grp.digest(grp.pad(S))
+	c.m1 = grp.clientProof(c.identity, salt, grp.pad(c.A), grp.pad(B), c.key)
+	return c.m1, nil
+}
+
+// VerifyServer checks the server proof M2
+func (c *Client) VerifyServer(serverProof []byte) error {
+	if c.m1 == nil {
+		return ErrProofMismatch
+	}
+	if subtle.ConstantTimeCompare(c.grp.digest(c.grp.pad(c.A), c.m1, c.key), serverProof) != 1 {
+		return ErrProofMismatch
+	}
+	return nil
+}
+
+// group is an SRP group with the hash function used over it. The protocol
+// only uses defaultGroup; other groups exist for the RFC 5054 test vectors.
+type group struct {
+	N       *big.Int
+	g       *big.Int
+	k       *big.Int // multiplier H(N | PAD(g))
+	newHash func() hash.Hash
+}
+
+func newGroup(N *big.Int, g int64, newHash func() hash.Hash) *group {
+	grp := &group{N: N, g: big.NewInt(g), newHash: newHash}
+	grp.k = grp.digestToInt(grp.pad(grp.N), grp.pad(grp.g))
+	return grp
+}
+
+func (grp *group) newClient(identity string, secret []byte, a *big.Int) *Client {
+	return &Client{
+		grp:      grp,
+		identity: identity,
+		secret:   secret,
+		a:        a,
+		A:        new(big.Int).Exp(grp.g, a, grp.N),
+	}
+}
+
+func (grp *group) computeX(salt []byte, identity string, secret []byte) *big.Int {
+	inner := grp.digest([]byte(identity), []byte(":"), secret)
+	return new(big.Int).SetBytes(grp.digest(salt, inner))
+}
+
+// verifier returns v = g^x
+func (grp *group) verifier(x *big.Int) *big.Int {
+	return new(big.Int).Exp(grp.g, x, grp.N)
+}
+
+// serverPublic returns B = k*v + g^b
+func (grp *group) serverPublic(v, b *big.Int) *big.Int {
+	B := new(big.Int).Mul(grp.k, v)
+	B.Add(B, new(big.Int).Exp(grp.g, b, grp.N))
+	return B.Mod(B, grp.N)
+}
+
+// scramble returns u = H(PAD(A) | PAD(B))
+func (grp *group) scramble(A, B *big.Int) *big.Int {
+	return grp.digestToInt(grp.pad(A), grp.pad(B))
+}
+
+// serverPremaster returns S = (A * v^u) ^ b
+func (grp *group) serverPremaster(A, v, u, b *big.Int) *big.Int {
+	S := new(big.Int).Exp(v, u, grp.N)
+	S.Mul(S, A)
+	return S.Exp(S, b, grp.N)
+}
+
+// clientPremaster returns S = (B - k*g^x) ^ (a + u*x)
+func (grp *group) clientPremaster(B, x, u, a *big.Int) *big.Int {
+	base := new(big.Int).Exp(grp.g, x, grp.N)
+	base.Mul(base, grp.k)
+	base.Sub(B, base)
+	base.Mod(base, grp.N)
+	exp := new(big.Int).Mul(u, x)
+	exp.Add(exp, a)
+	return new(big.Int).Exp(base, exp, grp.N)
+}
+
+func (grp *group) clientProof(identity string, salt, A, B, key []byte) []byte {
+	hn := grp.digest(grp.pad(grp.N))
+	hg := grp.digest(grp.pad(grp.g))
+	for i := range hn {
+		hn[i] ^= hg[i]
+	}
+	return grp.digest(hn, grp.digest([]byte(identity)), salt, A, B, key)
+}
+
+// validPublic requires 0 < v < N. A value that is 0 mod N would let an
+// attacker force a known shared secret.
+func (grp *group) validPublic(v *big.Int) bool {
+	return v.Sign() > 0 && v.Cmp(grp.N) < 0
+}
+
+// pad left-pads a group element to the byte length of N
+func (grp *group) pad(v *big.Int) []byte {
+	out := make([]byte, (grp.N.BitLen()+7)/8)
+	return v.FillBytes(out)
+}
+
+func (grp *group) digest(parts ...[]byte) []byte {
+	h := grp.newHash()
+	for _, p := range parts {
+		h.Write(p)
+	}
+	return h.Sum(nil)
+}
+
+func (grp *group) digestToInt(parts ...[]byte) *big.Int {
+	return new(big.Int).SetBytes(grp.digest(parts...))
+}
+
+func randomPrivate() (*big.Int, error) {
+	buf := make([]byte, privateSize)
+	if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(buf), nil
+}
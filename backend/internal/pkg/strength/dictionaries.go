@@ -0,0 +1,80 @@
+package strength
+
+import (
+	_ "embed"
+	"strings"
+	"sync"
+)
+
+// Dictionary names
+const (
+	DictionaryPasswords = "passwords"
+	DictionaryEnglish   = "english_wikipedia"
+	DictionaryFemale    = "female_names"
+	DictionaryMale      = "male_names"
+	DictionarySurnames  = "surnames"
+	DictionaryUser      = "user_inputs"
+)
+
+var (
+	//go:embed data/passwords.txt
+	passwordsList string
+	//go:embed data/english.txt
+	englishList string
+	//go:embed data/female_names.txt
+	femaleNamesList string
+	//go:embed data/male_names.txt
+	maleNamesList string
+	//go:embed data/surnames.txt
+	surnamesList string
+)
+
+// rankedDictionary maps a lowercase word to its frequency rank, starting at 1
+type rankedDictionary map[string]int
+
+type dictionary struct {
+	name  string
+	words rankedDictionary
+}
+
+var dictionaries = sync.OnceValue(func() []dictionary {
+	return []dictionary{
+		{DictionaryPasswords, rank(strings.Split(strings.TrimSpace(passwordsList), "\n"))},
+		{DictionaryEnglish, rank(strings.Split(strings.TrimSpace(englishList), "\n"))},
+		{DictionaryFemale, rank(strings.Split(strings.TrimSpace(femaleNamesList), "\n"))},
+		{DictionaryMale, rank(strings.Split(strings.TrimSpace(maleNamesList), "\n"))},
+		{DictionarySurnames, rank(strings.Split(strings.TrimSpace(surnamesList), "\n"))},
+	}
+})
+
+// maxWordLength bounds the substrings looked up in the dictionaries
+const maxWordLength = 32
+
+func rank(words []string) rankedDictionary {
+	ranked := make(rankedDictionary, len(words))
+	for i, word := range words {
+		word = strings.ToLower(strings.TrimSpace(word))
+		if word == "" {
+			continue
+		}
+		if _, ok := ranked[word]; !ok {
+			ranked[word] = i + 1
+		}
+	}
+	return ranked
+}
+
+// userDictionary ranks words the user is likely to reuse, such as their name
+// or email, as if they were the most common words
+func userDictionary(inputs []string) rankedDictionary {
+	var words []string
+	for _, input := range inputs {
+		input = strings.ToLower(input)
+		words = append(words, input)
+		// Also add the parts of an email address or a full name
+		words = append(words, strings.FieldsFunc(input, func(r rune) bool {
+			return !('a' <= r && r <= 'z' || '0' <= r && r <= '9' || r > 127)
+		})...)
+	}
+	return rank(words)
+}
@@ -0,0 +1,116 @@
+package strength
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Feedback explains a weak score and how to improve the password
+type Feedback struct {
+	Warning     string   `json:"warning,omitempty"`
+	Suggestions []string `json:"suggestions"`
+}
+
+const suggestionAddWord = "Add another word or two. Uncommon words are better."
+
+func feedback(score int, sequence []*Match, length int) Feedback {
+	if length == 0 {
+		return Feedback{Suggestions: []string{
+			"Use a few words, avoid common phrases.",
+			"No need for symbols, digits, or uppercase letters.",
+		}}
+	}
+	if score > 2 {
+		return Feedback{Suggestions: []string{}}
+	}
+
+	// The longest match is what makes the password weak
+	var longest *Match
+	for _, m := range sequence {
+		if longest == nil || m.J-m.I > longest.J-longest.I {
+			longest = m
+		}
+	}
+
+	fb := Feedback{Suggestions: []string{suggestionAddWord}}
+	if longest == nil {
+		return fb
+	}
+	warning, suggestions := matchFeedback(longest, len(sequence) == 1)
+	fb.Warning = warning
+	fb.Suggestions = append(fb.Suggestions, suggestions...)
+	return fb
+}
+
+func matchFeedback(m *Match, isSoleMatch bool) (string, []string) {
+	switch m.Pattern {
+	case PatternDictionary:
+		return dictionaryFeedback(m, isSoleMatch)
+	case PatternSpatial:
+		warning := "Short keyboard patterns are easy to guess."
+		if m.Turns == 1 {
+			warning = "Straight rows of keys are easy to guess."
+		}
+		return warning, []string{"Use a longer keyboard pattern with more turns."}
+	case PatternRepeat:
+		warning := "Repeats like \"abcabcabc\" are only slightly harder to guess than \"abc\"."
+		if len([]rune(m.BaseToken)) == 1 {
+			warning = "Repeats like \"aaa\" are easy to guess."
+		}
+		return warning, []string{"Avoid repeated words and characters."}
+	case PatternSequence:
+		return "Sequences like abc or 6543 are easy to guess.", []string{"Avoid sequences."}
+	case PatternYear:
+		return "Recent years are easy to guess.", []string{
+			"Avoid recent years.",
+			"Avoid years that are associated with you.",
+		}
+	case PatternDate:
+		return "Dates are often easy to guess.", []string{"Avoid dates and years that are associated with you."}
+	}
+	return "", nil
+}
+
+func dictionaryFeedback(m *Match, isSoleMatch bool) (string, []string) {
+	var warning string
+	switch m.Dictionary {
+	case DictionaryPasswords:
+		switch {
+		case isSoleMatch && !m.L33t && !m.Reversed && m.Rank <= 10:
+			warning = "This is a top-10 common password."
+		case isSoleMatch && !m.L33t && !m.Reversed && m.Rank <= 100:
+			warning = "This is a top-100 common password."
+		case isSoleMatch && !m.L33t && !m.Reversed:
+			warning = "This is a very common password."
+		case m.Guesses <= 1e4:
+			warning = "This is similar to a commonly used password."
+		}
+	case DictionaryEnglish:
+		if isSoleMatch {
+			warning = "A word by itself is easy to guess."
+		}
+	case DictionarySurnames, DictionaryMale, DictionaryFemale:
+		warning = "Common names and surnames are easy to guess."
+		if isSoleMatch {
+			warning = "Names and surnames by themselves are easy to guess."
+		}
+	case DictionaryUser:
+		warning = "Avoid your name, email address or other details about you."
+	}
+
+	var suggestions []string
+	runes := []rune(m.Token)
+	switch {
+	case unicode.IsUpper(runes[0]) && strings.ToLower(string(runes[1:])) == string(runes[1:]):
+		suggestions = append(suggestions, "Capitalization doesn't help very much.")
+	case strings.ToUpper(m.Token) == m.Token && strings.ToLower(m.Token) != m.Token:
+		suggestions = append(suggestions, "All-uppercase is almost as easy to guess as all-lowercase.")
+	}
+	if m.Reversed && len(runes) >= 4 {
+		suggestions = append(suggestions, "Reversed words aren't much harder to guess.")
+	}
+	if m.L33t {
+		suggestions = append(suggestions, "Predictable substitutions like '@' instead of 'a' don't help very much.")
+	}
+	return warning, suggestions
+}
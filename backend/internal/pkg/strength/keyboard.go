@@ -0,0 +1,120 @@
+package strength
+
+import (
+	"strings"
+	"sync"
+)
+
+// keyboard is an adjacency graph of keys. Each key lists its neighbors; a
+// shifted character maps to the same key as its unshifted one.
+type keyboard struct {
+	name      string
+	neighbors map[byte][]string // key character -> neighbor keys, each "unshifted+shifted"
+	shifted   map[byte]bool     // characters typed with shift
+	starts    float64           // number of keys
+	degree    float64           // average number of neighbors
+}
+
+// Rows of key pairs (unshifted, shifted) and the column each row starts at.
+// Slanted keyboards stagger rows by half a key, so a key touches two keys of
+// the rows above and below.
+var (
+	qwertyRows = []string{
+		"`~ 1! 2@ 3# 4$ 5% 6^ 7& 8* 9( 0) -_ =+",
+		"qQ wW eE rR tT yY uU iI oO pP [{ ]} \\|",
+		"aA sS dD fF gG hH jJ kK lL ;: '\"",
+		"zZ xX cC vV bB nN mM ,< .> /?",
+	}
+	qwertyOffsets = []int{0, 1, 1, 1}
+
+	dvorakRows = []string{
+		"`~ 1! 2@ 3# 4$ 5% 6^ 7& 8* 9( 0) [{ ]}",
+		"'\" ,< .> pP yY fF gG cC rR lL /? =+ \\|",
+		"aA oO eE uU iI dD hH tT nN sS -_",
+		";: qQ jJ kK xX bB mM wW vV zZ",
+	}
+
+	// Keypad keys are aligned, so diagonal keys are neighbors too
+	keypadRows = []string{
+		"  / * -",
+		"7 8 9 +",
+		"4 5 6",
+		"1 2 3",
+		"  0 .",
+	}
+)
+
+var keyboards = sync.OnceValue(func() []*keyboard {
+	return []*keyboard{
+		slantedKeyboard("qwerty", qwertyRows, qwertyOffsets),
+		slantedKeyboard("dvorak", dvorakRows, qwertyOffsets),
+		alignedKeyboard("keypad", keypadRows),
+	}
+})
+
+type coord struct{ x, y int }
+
+func slantedKeyboard(name string, rows []string, offsets []int) *keyboard {
+	keys := map[coord]string{}
+	for y, row := range rows {
+		for x, key := range strings.Fields(row) {
+			keys[coord{offsets[y] + x, y}] = key
+		}
+	}
+	return buildKeyboard(name, keys, func(c coord) []coord {
+		return []coord{{c.x - 1, c.y}, {c.x, c.y - 1}, {c.x + 1, c.y - 1}, {c.x + 1, c.y}, {c.x, c.y + 1}, {c.x - 1, c.y + 1}}
+	})
+}
+
+func alignedKeyboard(name string, rows []string) *keyboard {
+	keys := map[coord]string{}
+	for y, row := range rows {
+		for i := 0; i < len(row); i += 2 {
+			if row[i] != ' ' {
+				keys[coord{i / 2, y}] = string(row[i])
+			}
+		}
+	}
+	return buildKeyboard(name, keys, func(c coord) []coord {
+		return []coord{
+			{c.x - 1, c.y}, {c.x - 1, c.y - 1}, {c.x, c.y - 1}, {c.x + 1, c.y - 1},
+			{c.x + 1, c.y}, {c.x + 1, c.y + 1}, {c.x, c.y + 1}, {c.x - 1, c.y + 1},
+		}
+	})
+}
+
+// buildKeyboard records, in direction order, the neighbor of every key or ""
+// where there is none, so a direction change can be detected as a turn
+func buildKeyboard(name string, keys map[coord]string, adjacent func(coord) []coord) *keyboard {
+	kb := &keyboard{name: name, neighbors: map[byte][]string{}, shifted: map[byte]bool{}}
+	total := 0
+	for c, key := range keys {
+		var neighbors []string
+		for _, n := range adjacent(c) {
+			neighbors = append(neighbors, keys[n])
+			if keys[n] != "" {
+				total++
+			}
+		}
+		for i := 0; i < len(key); i++ {
+			kb.neighbors[key[i]] = neighbors
+		}
+		if len(key) == 2 {
+			kb.shifted[key[1]] = true
+		}
+	}
+	kb.starts = float64(len(keys))
+	kb.degree = float64(total) / float64(len(keys))
+	return kb
+}
+
+// adjacent returns the direction in which next neighbors cur, and whether
+// next is the shifted character of that key
+func (kb *keyboard) adjacent(cur, next byte) (direction int, shifted, ok bool) {
+	for dir, key := range kb.neighbors[cur] {
+		if i := strings.IndexByte(key, next); i >= 0 {
+			return dir, i == 1, true
+		}
+	}
+	return 0, false, false
+}
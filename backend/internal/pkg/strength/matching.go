@@ -0,0 +1,582 @@
+package strength
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Match patterns
+const (
+	PatternDictionary = "dictionary"
+	PatternSpatial    = "spatial"
+	PatternRepeat     = "repeat"
+	PatternSequence   = "sequence"
+	PatternYear       = "year"
+	PatternDate       = "date"
+	PatternBruteforce = "bruteforce"
+)
+
+// Match is a part of the password that follows a guessable pattern. I and J
+// are the rune offsets of its first and last character.
+type Match struct {
+	Pattern string  `json:"pattern"`
+	I       int     `json:"i"`
+	J       int     `json:"j"`
+	Token   string  `json:"token"`
+	Guesses float64 `json:"guesses"`
+
+	// dictionary
+	Dictionary  string `json:"dictionary,omitempty"`
+	Rank        int    `json:"rank,omitempty"`
+	MatchedWord string `json:"matched_word,omitempty"`
+	Reversed    bool   `json:"reversed,omitempty"`
+	L33t        bool   `json:"l33t,omitempty"`
+	subs        map[rune]rune
+
+	// spatial
+	Keyboard string `json:"keyboard,omitempty"`
+	Turns    int    `json:"turns,omitempty"`
+	shifted  int
+
+	// repeat
+	BaseToken   string `json:"base_token,omitempty"`
+	RepeatCount int    `json:"repeat_count,omitempty"`
+	baseGuesses float64
+
+	// sequence
+	Ascending     bool `json:"ascending,omitempty"`
+	sequenceSpace int
+
+	// year and date
+	Year      int    `json:"year,omitempty"`
+	Month     int    `json:"month,omitempty"`
+	Day       int    `json:"day,omitempty"`
+	Separator string `json:"separator,omitempty"`
+}
+
+// l33tTable lists the characters commonly substituted for each letter
+var l33tTable = map[rune][]rune{
+	'a': {'4', '@'},
+	'b': {'8'},
+	'c': {'(', '{', '[', '<'},
+	'e': {'3'},
+	'g': {'6', '9'},
+	'i': {'1', '!', '|'},
+	'l': {'1', '|', '7'},
+	'o': {'0'},
+	's': {'$', '5'},
+	't': {'+', '7'},
+	'x': {'%'},
+	'z': {'2'},
+}
+
+// omnimatch returns every match found in password
+func omnimatch(password []rune, user rankedDictionary) []*Match {
+	var matches []*Match
+	matches = append(matches, dictionaryMatch(password, user)...)
+	matches = append(matches, reverseDictionaryMatch(password, user)...)
+	matches = append(matches, l33tMatch(password, user)...)
+	matches = append(matches, spatialMatch(password)...)
+	matches = append(matches, repeatMatch(password, user)...)
+	matches = append(matches, sequenceMatch(password)...)
+	matches = append(matches, yearMatch(password)...)
+	matches = append(matches, dateMatch(password)...)
+	sort.SliceStable(matches, func(a, b int) bool {
+		if matches[a].I != matches[b].I {
+			return matches[a].I < matches[b].I
+		}
+		return matches[a].J < matches[b].J
+	})
+	return matches
+}
+
+func dictionaryMatch(password []rune, user rankedDictionary) []*Match {
+	lower := []rune(strings.ToLower(string(password)))
+	if len(lower) != len(password) {
+		// Lowercasing changed the rune count, fall back to per-rune mapping
+		lower = make([]rune, len(password))
+		for i, r := range password {
+			lower[i] = unicode.ToLower(r)
+		}
+	}
+
+	dicts := dictionaries()
+	if len(user) > 0 {
+		dicts = append(dicts[:len(dicts):len(dicts)], dictionary{DictionaryUser, user})
+	}
+
+	var matches []*Match
+	for i := range lower {
+		for j := i; j < len(lower) && j-i < maxWordLength; j++ {
+			word := string(lower[i : j+1])
+			for _, dict := range dicts {
+				if rank, ok := dict.words[word]; ok {
+					matches = append(matches, &Match{
+						Pattern:     PatternDictionary,
+						I:           i,
+						J:           j,
+						Token:       string(password[i : j+1]),
+						Dictionary:  dict.name,
+						Rank:        rank,
+						MatchedWord: word,
+					})
+				}
+			}
+		}
+	}
+	return matches
+}
+
+func reverseDictionaryMatch(password []rune, user rankedDictionary) []*Match {
+	reversed := reverse(password)
+	matches := dictionaryMatch(reversed, user)
+	n := len(password)
+	for _, m := range matches {
+		m.Token = string(reverse([]rune(m.Token)))
+		m.Reversed = true
+		m.I, m.J = n-1-m.J, n-1-m.I
+	}
+	return matches
+}
+
+// l33tMatch undoes every combination of substitutions of the l33t characters
+// present in the password and keeps dictionary matches that contain one
+func l33tMatch(password []rune, user rankedDictionary) []*Match {
+	// l33t character -> letters it may stand for
+	candidates := map[rune][]rune{}
+	for letter, subs := range l33tTable {
+		for _, sub := range subs {
+			if containsRune(password, sub) {
+				candidates[sub] = append(candidates[sub], letter)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	var matches []*Match
+	for _, subs := range substitutionCombinations(candidates) {
+		translated := make([]rune, len(password))
+		for i, r := range password {
+			if letter, ok := subs[r]; ok {
+				translated[i] = letter
+			} else {
+				translated[i] = r
+			}
+		}
+
+		for _, m := range dictionaryMatch(translated, user) {
+			token := password[m.I : m.J+1]
+			used := map[rune]rune{}
+			for _, r := range token {
+				if letter, ok := subs[r]; ok {
+					used[r] = letter
+				}
+			}
+			// Single characters like "1" would match every word list entry
+			if len(used) == 0 || len(token) <= 1 {
+				continue
+			}
+			key := strconv.Itoa(m.I) + ":" + strconv.Itoa(m.J) + ":" + m.Dictionary + ":" + m.MatchedWord
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			m.Token = string(token)
+			m.L33t = true
+			m.subs = used
+			matches = append(matches, m)
+		}
+	}
+	return matches
+}
+
+// substitutionCombinations enumerates the ways to map each l33t character to
+// one letter. Characters like '1' are ambiguous ('i' or 'l').
+func substitutionCombinations(candidates map[rune][]rune) []map[rune]rune {
+	keys := make([]rune, 0, len(candidates))
+	for k := range candidates {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(a, b int) bool { return keys[a] < keys[b] })
+
+	combos := []map[rune]rune{{}}
+	for _, k := range keys {
+		var next []map[rune]rune
+		for _, combo := range combos {
+			for _, letter := range candidates[k] {
+				extended := make(map[rune]rune, len(combo)+1)
+				for from, to := range combo {
+					extended[from] = to
+				}
+				extended[k] = letter
+				next = append(next, extended)
+			}
+		}
+		combos = next
+	}
+	return combos
+}
+
+// spatialMatch finds runs of at least three adjacent keys on a keyboard
+func spatialMatch(password []rune) []*Match {
+	var matches []*Match
+	for _, kb := range keyboards() {
+		i := 0
+		for i < len(password)-2 {
+			j := i + 1
+			turns := 0
+			shifted := 0
+			lastDirection := -1
+			if isShifted(kb, password[i]) {
+				shifted++
+			}
+			for j < len(password) {
+				cur, next := password[j-1], password[j]
+				if cur > 127 || next > 127 {
+					break
+				}
+				direction, isShift, ok := kb.adjacent(byte(cur), byte(next))
+				if !ok {
+					break
+				}
+				if isShift {
+					shifted++
+				}
+				if direction != lastDirection {
+					turns++
+					lastDirection = direction
+				}
+				j++
+			}
+			if j-i > 2 {
+				matches = append(matches, &Match{
+					Pattern:  PatternSpatial,
+					I:        i,
+					J:        j - 1,
+					Token:    string(password[i:j]),
+					Keyboard: kb.name,
+					Turns:    turns,
+					shifted:  shifted,
+				})
+			}
+			if j-i > 1 {
+				i = j - 1
+			} else {
+				i = j
+			}
+		}
+	}
+	return matches
+}
+
+// isShifted reports whether r is the shifted character of its key
+func isShifted(kb *keyboard, r rune) bool {
+	return r <= 127 && kb.shifted[byte(r)]
+}
+
+// repeatMatch finds a token repeated at least twice, such as "aaa" or "abcabc"
+func repeatMatch(password []rune, user rankedDictionary) []*Match {
+	var matches []*Match
+	n := len(password)
+	i := 0
+	for i < n-1 {
+		bestSpan, bestBase := 0, 0
+		for base := 1; base <= (n-i)/2; base++ {
+			count := 1
+			for i+(count+1)*base <= n && equalRunes(password[i:i+base], password[i+count*base:i+(count+1)*base]) {
+				count++
+			}
+			if count >= 2 && count*base > bestSpan {
+				bestSpan, bestBase = count*base, base
+			}
+		}
+		if bestSpan == 0 {
+			i++
+			continue
+		}
+
+		base := password[i : i+bestBase]
+		matches = append(matches, &Match{
+			Pattern:     PatternRepeat,
+			I:           i,
+			J:           i + bestSpan - 1,
+			Token:       string(password[i : i+bestSpan]),
+			BaseToken:   string(base),
+			RepeatCount: bestSpan / bestBase,
+			baseGuesses: mostGuessable(base, omnimatch(base, user)).guesses,
+		})
+		i += bestSpan
+	}
+	return matches
+}
+
+// maxSequenceDelta is the largest code point step still considered a sequence
+const maxSequenceDelta = 5
+
+// sequenceMatch finds runs with a constant step, such as "abcd", "9753" or "aceg"
+func sequenceMatch(password []rune) []*Match {
+	var matches []*Match
+	if len(password) < 3 {
+		return nil
+	}
+
+	add := func(i, j, delta int) {
+		if j-i < 2 || delta == 0 || abs(delta) > maxSequenceDelta {
+			return
+		}
+		token := password[i : j+1]
+		space := 26
+		switch {
+		case allRunes(token, unicode.IsDigit):
+			space = 10
+		case allRunes(token, unicode.IsLower), allRunes(token, unicode.IsUpper):
+			space = 26
+		default:
+			return
+		}
+		matches = append(matches, &Match{
+			Pattern:       PatternSequence,
+			I:             i,
+			J:             j,
+			Token:         string(token),
+			Ascending:     delta > 0,
+			sequenceSpace: space,
+		})
+	}
+
+	i := 0
+	lastDelta := 0
+	for k := 1; k < len(password); k++ {
+		delta := int(password[k]) - int(password[k-1])
+		if k == 1 {
+			lastDelta = delta
+			continue
+		}
+		if delta == lastDelta {
+			continue
+		}
+		add(i, k-1, lastDelta)
+		i = k - 1
+		lastDelta = delta
+	}
+	add(i, len(password)-1, lastDelta)
+	return matches
+}
+
+// yearMatch finds years between 1900 and 2099
+func yearMatch(password []rune) []*Match {
+	var matches []*Match
+	for i := 0; i+4 <= len(password); i++ {
+		token := password[i : i+4]
+		if !allRunes(token, isASCIIDigit) {
+			continue
+		}
+		year, _ := strconv.Atoi(string(token))
+		if year >= 1900 && year <= 2099 {
+			matches = append(matches, &Match{
+				Pattern: PatternYear,
+				I:       i,
+				J:       i + 3,
+				Token:   string(token),
+				Year:    year,
+			})
+		}
+	}
+	return matches
+}
+
+// dateSplits lists where to split digit-only dates of each length into three
+// numbers, e.g. 1191 -> 1 1 91 and 11 9 1
+var dateSplits = map[int][][2]int{
+	4: {{1, 2}, {2, 3}},
+	5: {{1, 3}, {2, 3}},
+	6: {{1, 2}, {2, 4}, {4, 5}},
+	7: {{1, 3}, {2, 3}, {4, 5}, {4, 6}},
+	8: {{2, 4}, {4, 6}},
+}
+
+// dateMatch finds dates with or without separators, such as 13.5.1991 or 19910513
+func dateMatch(password []rune) []*Match {
+	var matches []*Match
+	n := len(password)
+
+	// Without separators: 4 to 8 digits
+	for i := 0; i < n-3; i++ {
+		for j := i + 3; j < n && j-i < 8; j++ {
+			token := password[i : j+1]
+			if !allRunes(token, isASCIIDigit) {
+				continue
+			}
+			s := string(token)
+			var best *Match
+			for _, split := range dateSplits[len(token)] {
+				a, _ := strconv.Atoi(s[:split[0]])
+				b, _ := strconv.Atoi(s[split[0]:split[1]])
+				c, _ := strconv.Atoi(s[split[1]:])
+				if m := mapToDate(a, b, c, s[:split[0]], s[split[1]:]); m != nil {
+					if best == nil || abs(m.Year-referenceYear) < abs(best.Year-referenceYear) {
+						best = m
+					}
+				}
+			}
+			if best != nil {
+				best.I, best.J, best.Token = i, j, s
+				matches = append(matches, best)
+			}
+		}
+	}
+
+	// With separators: 6 to 10 characters
+	for i := 0; i < n-5; i++ {
+		for j := i + 5; j < n && j-i < 10; j++ {
+			token := string(password[i : j+1])
+			parts, sep := splitDate(token)
+			if parts == nil {
+				continue
+			}
+			a, _ := strconv.Atoi(parts[0])
+			b, _ := strconv.Atoi(parts[1])
+			c, _ := strconv.Atoi(parts[2])
+			if m := mapToDate(a, b, c, parts[0], parts[2]); m != nil {
+				m.I, m.J, m.Token, m.Separator = i, j, token, sep
+				matches = append(matches, m)
+			}
+		}
+	}
+
+	// Drop dates contained in a longer date
+	var filtered []*Match
+	for _, m := range matches {
+		contained := false
+		for _, other := range matches {
+			if other != m && other.I <= m.I && other.J >= m.J && (other.I != m.I || other.J != m.J) {
+				contained = true
+				break
+			}
+		}
+		if !contained {
+			filtered = append(filtered, m)
+		}
+	}
+	return filtered
+}
+
+// splitDate splits d<sep>m<sep>y style tokens that use one separator twice
+func splitDate(token string) ([]string, string) {
+	for _, sep := range []string{" ", "-", "/", "\\", "_", "."} {
+		parts := strings.Split(token, sep)
+		if len(parts) != 3 {
+			continue
+		}
+		ok := true
+		for _, p := range parts {
+			if p == "" || len(p) > 4 || !allRunes([]rune(p), isASCIIDigit) {
+				ok = false
+				break
+			}
+		}
+		if ok && len(parts[1]) <= 2 {
+			return parts, sep
+		}
+	}
+	return nil, ""
+}
+
+// mapToDate interprets three numbers as a date with the year first or last
+func mapToDate(a, b, c int, first, last string) *Match {
+	candidates := []struct {
+		year, rest1, rest2 int
+		digits             string
+	}{
+		{c, a, b, last},  // d m y / m d y
+		{a, b, c, first}, // y m d / y d m
+	}
+	for _, cand := range candidates {
+		year := cand.year
+		switch len(cand.digits) {
+		case 4:
+			if year < 1000 || year > 2050 {
+				continue
+			}
+		case 2:
+			if year > 50 {
+				year += 1900
+			} else {
+				year += 2000
+			}
+		case 1:
+			continue
+		default:
+			continue
+		}
+		if day, month, ok := dayMonth(cand.rest1, cand.rest2); ok {
+			return &Match{Pattern: PatternDate, Year: year, Month: month, Day: day}
+		}
+	}
+	return nil
+}
+
+func dayMonth(a, b int) (int, int, bool) {
+	if a >= 1 && a <= 31 && b >= 1 && b <= 12 {
+		return a, b, true
+	}
+	if b >= 1 && b <= 31 && a >= 1 && a <= 12 {
+		return b, a, true
+	}
+	return 0, 0, false
+}
+
+func reverse(runes []rune) []rune {
+	out := make([]rune, len(runes))
+	for i, r := range runes {
+		out[len(runes)-1-i] = r
+	}
+	return out
+}
+
+func containsRune(runes []rune, r rune) bool {
+	for _, c := range runes {
+		if c == r {
+			return true
+		}
+	}
+	return false
+}
+
+func equalRunes(a, b []rune) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func allRunes(runes []rune, f func(rune) bool) bool {
+	for _, r := range runes {
+		if !f(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isASCIIDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
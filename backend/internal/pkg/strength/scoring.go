@@ -0,0 +1,301 @@
+package strength
+
+import (
+	"math"
+	"time"
+	"unicode"
+)
+
+const (
+	// bruteforceCardinality is the assumed number of choices per character for
+	// parts of the password that match no pattern
+	bruteforceCardinality = 10
+	// minGuessesBeforeGrowingSequence makes a sequence of many cheap matches
+	// cost at least this much per additional match
+	minGuessesBeforeGrowingSequence = 10000
+	minSubmatchGuessesSingleChar    = 10
+	minSubmatchGuessesMultiChar     = 50
+	minYearSpace                    = 20
+)
+
+// referenceYear is the year dates and years are compared against
+var referenceYear = time.Now().Year()
+
+// guessResult is the cheapest way found to guess a password
+type guessResult struct {
+	guesses  float64
+	sequence []*Match
+}
+
+// mostGuessable finds the sequence of non-overlapping matches covering the
+// password that needs the fewest guesses, filling gaps with bruteforce. A
+// sequence of l matches costs l! * product(guesses) + D^(l-1): the attacker
+// has to try the patterns in every order, and every extra match costs at
+// least D guesses.
+func mostGuessable(password []rune, matches []*Match) guessResult {
+	n := len(password)
+	if n == 0 {
+		return guessResult{guesses: 1}
+	}
+
+	byEnd := make([][]*Match, n)
+	for _, m := range matches {
+		byEnd[m.J] = append(byEnd[m.J], m)
+	}
+
+	// For every end position k and sequence length l, the best last match,
+	// the product of guesses and the overall cost
+	type entry struct {
+		match *Match
+		pi    float64
+		g     float64
+	}
+	optimal := make([]map[int]entry, n)
+	for k := range optimal {
+		optimal[k] = map[int]entry{}
+	}
+
+	update := func(m *Match, l int) {
+		k := m.J
+		pi := estimateGuesses(m, n)
+		if l > 1 {
+			pi *= optimal[m.I-1][l-1].pi
+		}
+		g := factorial(l)*pi + math.Pow(minGuessesBeforeGrowingSequence, float64(l-1))
+		// A shorter or equally long sequence that is at least as cheap wins
+		for competingL, competing := range optimal[k] {
+			if competingL <= l && competing.g <= g {
+				return
+			}
+		}
+		optimal[k][l] = entry{match: m, pi: pi, g: g}
+	}
+
+	bruteforceUpdate := func(k int) {
+		update(bruteforceMatch(password, 0, k), 1)
+		for i := 1; i <= k; i++ {
+			m := bruteforceMatch(password, i, k)
+			for l, last := range optimal[i-1] {
+				// Two adjacent bruteforce matches are never better than one
+				if last.match.Pattern == PatternBruteforce {
+					continue
+				}
+				update(m, l+1)
+			}
+		}
+	}
+
+	for k := 0; k < n; k++ {
+		for _, m := range byEnd[k] {
+			if m.I > 0 {
+				for l := range optimal[m.I-1] {
+					update(m, l+1)
+				}
+			} else {
+				update(m, 1)
+			}
+		}
+		bruteforceUpdate(k)
+	}
+
+	// Walk back from the cheapest sequence covering the whole password
+	bestL, bestG := 0, math.Inf(1)
+	for l, e := range optimal[n-1] {
+		if e.g < bestG {
+			bestL, bestG = l, e.g
+		}
+	}
+	sequence := make([]*Match, bestL)
+	for k, l := n-1, bestL; k >= 0 && l > 0; l-- {
+		m := optimal[k][l].match
+		sequence[l-1] = m
+		k = m.I - 1
+	}
+
+	return guessResult{guesses: bestG, sequence: sequence}
+}
+
+func bruteforceMatch(password []rune, i, j int) *Match {
+	return &Match{
+		Pattern: PatternBruteforce,
+		I:       i,
+		J:       j,
+		Token:   string(password[i : j+1]),
+	}
+}
+
+// estimateGuesses computes and caches the guesses needed for a single match
+func estimateGuesses(m *Match, passwordLength int) float64 {
+	if m.Guesses > 0 {
+		return m.Guesses
+	}
+
+	length := m.J - m.I + 1
+	minGuesses := 1.0
+	if length < passwordLength {
+		minGuesses = minSubmatchGuessesMultiChar
+		if length == 1 {
+			minGuesses = minSubmatchGuessesSingleChar
+		}
+	}
+
+	var guesses float64
+	switch m.Pattern {
+	case PatternDictionary:
+		guesses = float64(m.Rank) * uppercaseVariations(m.Token) * l33tVariations(m)
+		if m.Reversed {
+			guesses *= 2
+		}
+	case PatternSpatial:
+		guesses = spatialGuesses(m)
+	case PatternRepeat:
+		guesses = m.baseGuesses * float64(m.RepeatCount)
+	case PatternSequence:
+		guesses = sequenceGuesses(m)
+	case PatternYear:
+		guesses = math.Max(math.Abs(float64(m.Year-referenceYear)), minYearSpace)
+	case PatternDate:
+		guesses = math.Max(math.Abs(float64(m.Year-referenceYear)), minYearSpace) * 365
+		if m.Separator != "" {
+			guesses *= 4
+		}
+	default:
+		guesses = math.Pow(bruteforceCardinality, float64(length))
+		if math.IsInf(guesses, 1) {
+			guesses = math.MaxFloat64
+		}
+		// Bruteforce must not undercut the minimum, or it would win by default
+		minGuesses = math.Max(minGuesses, minSubmatchGuessesSingleChar+1)
+		if length > 1 {
+			minGuesses = math.Max(minGuesses, minSubmatchGuessesMultiChar+1)
+		}
+	}
+
+	m.Guesses = math.Max(guesses, minGuesses)
+	return m.Guesses
+}
+
+// uppercaseVariations counts the capitalizations an attacker tries: common
+// ones like "Password" or "PASSWORD" are cheap, random ones are not
+func uppercaseVariations(token string) float64 {
+	runes := []rune(token)
+	upper, lower := 0, 0
+	for _, r := range runes {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		}
+	}
+	if upper == 0 {
+		return 1
+	}
+	first, last := unicode.IsUpper(runes[0]), unicode.IsUpper(runes[len(runes)-1])
+	if lower == 0 || upper == 1 && (first || last) {
+		return 2
+	}
+	return sumBinomials(upper+lower, min(upper, lower))
+}
+
+// l33tVariations counts the substitution combinations of a l33t match
+func l33tVariations(m *Match) float64 {
+	if !m.L33t {
+		return 1
+	}
+	variations := 1.0
+	runes := []rune(m.Token)
+	for sub, letter := range m.subs {
+		subbed, unsubbed := 0, 0
+		for _, r := range runes {
+			switch unicode.ToLower(r) {
+			case sub:
+				subbed++
+			case letter:
+				unsubbed++
+			}
+		}
+		if subbed == 0 || unsubbed == 0 {
+			// Every occurrence is substituted: the attacker tries both
+			variations *= 2
+		} else {
+			variations *= sumBinomials(subbed+unsubbed, min(subbed, unsubbed))
+		}
+	}
+	return variations
+}
+
+func spatialGuesses(m *Match) float64 {
+	var kb *keyboard
+	for _, k := range keyboards() {
+		if k.name == m.Keyboard {
+			kb = k
+		}
+	}
+
+	length := m.J - m.I + 1
+	guesses := 0.0
+	// Sum over all shorter patterns with up to as many turns
+	for i := 2; i <= length; i++ {
+		for j := 1; j <= min(m.Turns, i-1); j++ {
+			guesses += binomial(i-1, j-1) * kb.starts * math.Pow(kb.degree, float64(j))
+		}
+	}
+
+	if m.shifted > 0 {
+		unshifted := length - m.shifted
+		if unshifted == 0 {
+			guesses *= 2
+		} else {
+			guesses *= sumBinomials(m.shifted+unshifted, min(m.shifted, unshifted))
+		}
+	}
+	return guesses
+}
+
+func sequenceGuesses(m *Match) float64 {
+	first := []rune(m.Token)[0]
+	var base float64
+	switch {
+	case first == 'a' || first == 'A' || first == 'z' || first == 'Z' || first == '0' || first == '1' || first == '9':
+		// Obvious starting points are tried first
+		base = 4
+	case m.sequenceSpace == 10:
+		base = 10
+	default:
+		base = 26
+	}
+	if !m.Ascending {
+		base *= 2
+	}
+	return base * float64(m.J-m.I+1)
+}
+
+// sumBinomials returns C(n, 1) + ... + C(n, k)
+func sumBinomials(n, k int) float64 {
+	sum := 0.0
+	for i := 1; i <= k; i++ {
+		sum += binomial(n, i)
+	}
+	return sum
+}
+
+func binomial(n, k int) float64 {
+	if k < 0 || k > n {
+		return 0
+	}
+	r := 1.0
+	for d := 1; d <= k; d++ {
+		r *= float64(n - k + d)
+		r /= float64(d)
+	}
+	return r
+}
+
+func factorial(n int) float64 {
+	f := 1.0
+	for i := 2; i <= n; i++ {
+		f *= float64(i)
+	}
+	return f
+}
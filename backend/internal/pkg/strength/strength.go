@@ -0,0 +1,133 @@
+// Package strength estimates password strength offline, in the style of
+// zxcvbn: it finds guessable patterns (common passwords, dictionary words and
+// names, l33t substitutions, keyboard walks, repeats, sequences, years and
+// dates), picks the combination an attacker would need the fewest guesses for,
+// and turns the guess count into a score, crack times and feedback.
+//
+// Clients implement the same model, so a score computed here matches the
+// score shown in the web app and the extension.
+package strength
+
+import (
+	"fmt"
+	"math"
+)
+
+// maxPasswordLength bounds the analyzed prefix; the rest counts as bruteforce
+const maxPasswordLength = 100
+
+// Score thresholds in guesses; a score is the number of thresholds exceeded
+var scoreThresholds = []float64{1e3, 1e6, 1e8, 1e10}
+
+// Guess rates of the crack time scenarios, in guesses per second
+const (
+	rateOnlineThrottled   = 100.0 / 3600
+	rateOnlineUnthrottled = 10.0
+	rateOfflineSlowHash   = 1e4
+	rateOfflineFastHash   = 1e10
+)
+
+// Result is the strength estimate of a password
+type Result struct {
+	Score        int        `json:"score"` // 0 (too guessable) to 4 (very unguessable)
+	Guesses      float64    `json:"guesses"`
+	GuessesLog10 float64    `json:"guesses_log10"`
+	Entropy      float64    `json:"entropy_bits"` // log2 of the guesses
+	CrackTimes   CrackTimes `json:"crack_times"`
+	Feedback     Feedback   `json:"feedback"`
+	Sequence     []*Match   `json:"sequence"`
+}
+
+// CrackTimes estimates how long an attacker needs in several scenarios
+type CrackTimes struct {
+	OnlineThrottled   CrackTime `json:"online_throttled"`   // 100 guesses per hour
+	OnlineUnthrottled CrackTime `json:"online_unthrottled"` // 10 guesses per second
+	OfflineSlowHash   CrackTime `json:"offline_slow_hash"`  // 10k guesses per second, e.g. Argon2 or PBKDF2
+	OfflineFastHash   CrackTime `json:"offline_fast_hash"`  // 10B guesses per second, e.g. unsalted SHA-1
+}
+
+// CrackTime is a crack time in seconds and as a human readable string
+type CrackTime struct {
+	Seconds float64 `json:"seconds"`
+	Display string  `json:"display"`
+}
+
+// Estimate estimates the strength of password. userInputs are words the
+// attacker may know about the user, such as their email address and name.
+func Estimate(password string, userInputs ...string) *Result {
+	runes := []rune(password)
+	var rest []rune
+	if len(runes) > maxPasswordLength {
+		runes, rest = runes[:maxPasswordLength], runes[maxPasswordLength:]
+	}
+
+	best := mostGuessable(runes, omnimatch(runes, userDictionary(userInputs)))
+	guesses := best.guesses * math.Pow(bruteforceCardinality, float64(len(rest)))
+	if math.IsInf(guesses, 1) {
+		guesses = math.MaxFloat64
+	}
+
+	score := 0
+	for _, threshold := range scoreThresholds {
+		// A little slack so that exactly 10^n guesses lands in the lower score
+		if guesses > threshold+5 {
+			score++
+		}
+	}
+
+	sequence := best.sequence
+	if sequence == nil {
+		sequence = []*Match{}
+	}
+	return &Result{
+		Score:        score,
+		Guesses:      guesses,
+		GuessesLog10: math.Log10(guesses),
+		Entropy:      math.Log2(guesses),
+		CrackTimes: CrackTimes{
+			OnlineThrottled:   crackTime(guesses / rateOnlineThrottled),
+			OnlineUnthrottled: crackTime(guesses / rateOnlineUnthrottled),
+			OfflineSlowHash:   crackTime(guesses / rateOfflineSlowHash),
+			OfflineFastHash:   crackTime(guesses / rateOfflineFastHash),
+		},
+		Feedback: feedback(score, sequence, len(runes)),
+		Sequence: sequence,
+	}
+}
+
+func crackTime(seconds float64) CrackTime {
+	const (
+		minute  = 60
+		hour    = minute * 60
+		day     = hour * 24
+		month   = day * 31
+		year    = month * 12
+		century = year * 100
+	)
+
+	display := "centuries"
+	unit := func(value float64, name string) string {
+		n := int64(math.Round(value))
+		if n == 1 {
+			return fmt.Sprintf("1 %s", name)
+		}
+		return fmt.Sprintf("%d %ss", n, name)
+	}
+	switch {
+	case seconds < 1:
+		display = "less than a second"
+	case seconds < minute:
+		display = unit(seconds, "second")
+	case seconds < hour:
+		display = unit(seconds/minute, "minute")
+	case seconds < day:
+		display = unit(seconds/hour, "hour")
+	case seconds < month:
+		display = unit(seconds/day, "day")
+	case seconds < year:
+		display = unit(seconds/month, "month")
+	case seconds < century:
+		display = unit(seconds/year, "year")
+	}
+	return CrackTime{Seconds: seconds, Display: display}
+}
@@ -0,0 +1,163 @@
+package strength_test
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/askuy/passwordx/backend/internal/pkg/strength"
+)
+
+// token is the part of a match the tests compare
+type token struct {
+	pattern string
+	token   string
+}
+
+func tokens(sequence []*strength.Match) []token {
+	got := []token{}
+	for _, m := range sequence {
+		got = append(got, token{m.Pattern, m.Token})
+	}
+	return got
+}
+
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		password string
+		score    int
+		sequence []token
+		warning  string
+	}{
+		{"password", 0, []token{{strength.PatternDictionary, "password"}}, "This is a top-10 common password."},
+		{"PASSWORD", 0, []token{{strength.PatternDictionary, "PASSWORD"}}, "This is a top-10 common password."},
+		{"p@ssw0rd", 0, []token{{strength.PatternDictionary, "p@ssw0rd"}}, "This is similar to a commonly used password."},
+		{"drowssap", 0, []token{{strength.PatternDictionary, "drowssap"}}, "This is similar to a commonly used password."},
+		{"zxcvbn", 0, []token{{strength.PatternDictionary, "zxcvbn"}}, "This is a very common password."},
+		{"jennifer", 0, []token{{strength.PatternDictionary, "jennifer"}}, "Names and surnames by themselves are easy to guess."},
+		{"poiuyt", 1, []token{{strength.PatternSpatial, "poiuyt"}}, "Straight rows of keys are easy to guess."},
+		{"ZXCVBNM<", 1, []token{{strength.PatternSpatial, "ZXCVBNM<"}}, "Straight rows of keys are easy to guess."},
+		{"xsw2cde3", 1, []token{{strength.PatternSpatial, "xsw2"}, {strength.PatternSpatial, "cde3"}}, "Straight rows of keys are easy to guess."},
+		{"aaaaaa", 0, []token{{strength.PatternRepeat, "aaaaaa"}}, `Repeats like "aaa" are easy to guess.`},
+		{"abcabcabc", 0, []token{{strength.PatternRepeat, "abcabcabc"}}, `Repeats like "abcabcabc" are only slightly harder to guess than "abc".`},
+		{"abcdefg", 0, []token{{strength.PatternSequence, "abcdefg"}}, "Sequences like abc or 6543 are easy to guess."},
+		{"9876543", 0, []token{{strength.PatternSequence, "9876543"}}, "Sequences like abc or 6543 are easy to guess."},
+		{"1987", 0, []token{{strength.PatternYear, "1987"}}, "Recent years are easy to guess."},
+		{"13.05.1987", 1, []token{{strength.PatternDate, "13.05.1987"}}, "Dates are often easy to guess."},
+		{"19870513", 1, []token{{strength.PatternDate, "19870513"}}, "Dates are often easy to guess."},
+		{"Tr0ub4dour&3", 2, []token{{strength.PatternDictionary, "Tr0ub4dour"}, {strength.PatternBruteforce, "&3"}}, ""},
+		{"coRrecthorsebatterystaple", 4, []token{
+			{strength.PatternDictionary, "coRrect"},
+			{strength.PatternDictionary, "horse"},
+			{strength.PatternDictionary, "battery"},
+			{strength.PatternDictionary, "staple"},
+		}, ""},
+		{"kj3$9Lq!vZ#2pWx8", 4, []token{{strength.PatternBruteforce, "kj3$9Lq!vZ#2pWx8"}}, ""},
+		{"", 0, []token{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			result := strength.Estimate(tt.password)
+			if result.Score != tt.score {
+				t.Errorf("Score = %d, want %d", result.Score, tt.score)
+			}
+			if got := tokens(result.Sequence); !reflect.DeepEqual(got, tt.sequence) {
+				t.Errorf("Sequence = %v, want %v", got, tt.sequence)
+			}
+			if result.Feedback.Warning != tt.warning {
+				t.Errorf("Warning = %q, want %q", result.Feedback.Warning, tt.warning)
+			}
+			if result.Score > 2 && len(result.Feedback.Suggestions) != 0 {
+				t.Errorf("Suggestions = %q for score %d", result.Feedback.Suggestions, result.Score)
+			}
+			if math.Abs(result.Entropy-math.Log2(result.Guesses)) > 1e-9 || math.Abs(result.GuessesLog10-math.Log10(result.Guesses)) > 1e-9 {
+				t.Errorf("Entropy %v and GuessesLog10 %v disagree with Guesses %v", result.Entropy, result.GuessesLog10, result.Guesses)
+			}
+		})
+	}
+}
+
+func TestEstimateMatchDetails(t *testing.T) {
+	tests := []struct {
+		password string
+		check    func(*strength.Match) bool
+	}{
+		{"password", func(m *strength.Match) bool { return m.Dictionary == strength.DictionaryPasswords && m.Rank == 1 }},
+		{"p@ssw0rd", func(m *strength.Match) bool { return m.L33t && m.MatchedWord == "password" }},
+		{"drowssap", func(m *strength.Match) bool { return m.Reversed && m.MatchedWord == "password" }},
+		{"poiuyt", func(m *strength.Match) bool { return m.Keyboard != "" && m.Turns == 1 }},
+		{"abcabcabc", func(m *strength.Match) bool { return m.BaseToken == "abc" && m.RepeatCount == 3 }},
+		{"abcdefg", func(m *strength.Match) bool { return m.Ascending }},
+		{"9876543", func(m *strength.Match) bool { return !m.Ascending }},
+		{"13.05.1987", func(m *strength.Match) bool {
+			return m.Year == 1987 && m.Month == 5 && m.Day == 13 && m.Separator == "."
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			result := strength.Estimate(tt.password)
+			if len(result.Sequence) != 1 || !tt.check(result.Sequence[0]) {
+				t.Errorf("unexpected match %+v", result.Sequence)
+			}
+		})
+	}
+}
+
+func TestEstimateUserInputs(t *testing.T) {
+	without := strength.Estimate("zebulon2024")
+	with := strength.Estimate("zebulon2024", "Zebulon Smith", "zeb@example.com")
+	if with.Guesses >= without.Guesses {
+		t.Errorf("user inputs did not lower the guesses: %v >= %v", with.Guesses, without.Guesses)
+	}
+	if with.Sequence[0].Dictionary != strength.DictionaryUser || with.Sequence[0].Token != "zebulon" {
+		t.Errorf("first match = %+v, want the user input zebulon", with.Sequence[0])
+	}
+	if with.Feedback.Warning != "Avoid your name, email address or other details about you." {
+		t.Errorf("Warning = %q", with.Feedback.Warning)
+	}
+}
+
+func TestEstimateLongPassword(t *testing.T) {
+	password := strings.Repeat("kj3$9Lq!", 50)
+	short := strength.Estimate(password[:100])
+	long := strength.Estimate(password)
+	if long.Guesses <= short.Guesses {
+		t.Errorf("characters beyond the analyzed prefix did not add guesses")
+	}
+	if math.IsInf(long.Guesses, 0) || math.IsInf(long.Entropy, 0) {
+		t.Errorf("Guesses = %v, Entropy = %v, want finite values", long.Guesses, long.Entropy)
+	}
+	if long.Score != 4 {
+		t.Errorf("Score = %d, want 4", long.Score)
+	}
+}
+
+func TestCrackTimes(t *testing.T) {
+	result := strength.Estimate("password")
+	tests := []struct {
+		name string
+		time strength.CrackTime
+		want string
+	}{
+		{"online throttled", result.CrackTimes.OnlineThrottled, "1 minute"},
+		{"online unthrottled", result.CrackTimes.OnlineUnthrottled, "less than a second"},
+		{"offline fast hash", result.CrackTimes.OfflineFastHash, "less than a second"},
+		{"strong password", strength.Estimate("kj3$9Lq!vZ#2pWx8").CrackTimes.OnlineThrottled, "centuries"},
+		{"strong password, fast hash", strength.Estimate("kj3$9Lq!vZ#2pWx8").CrackTimes.OfflineFastHash, "12 days"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.time.Display != tt.want {
+				t.Errorf("Display = %q (%v seconds), want %q", tt.time.Display, tt.time.Seconds, tt.want)
+			}
+		})
+	}
+
+	times := result.CrackTimes
+	if !(times.OnlineThrottled.Seconds > times.OnlineUnthrottled.Seconds &&
+		times.OnlineUnthrottled.Seconds > times.OfflineSlowHash.Seconds &&
+		times.OfflineSlowHash.Seconds > times.OfflineFastHash.Seconds) {
+		t.Errorf("crack times are not ordered by guess rate: %+v", times)
+	}
+}
@@ -0,0 +1,195 @@
+// Package totp implements HMAC-based one-time passwords (RFC 4226) and their
+// time-based variant (RFC 6238), and reads and writes otpauth:// URIs in the
+// Key Uri Format used by authenticator apps.
+//
+// Credentials store their seed as an encrypted otpauth:// URI, so the server
+// never sees it; this package is shared by the clients that decrypt it and by
+// account two-factor authentication, so every client produces the same codes.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Hash algorithms
+const (
+	AlgorithmSHA1   = "SHA1"
+	AlgorithmSHA256 = "SHA256"
+	AlgorithmSHA512 = "SHA512"
+)
+
+// Defaults used by virtually every authenticator
+const (
+	DefaultAlgorithm = AlgorithmSHA1
+	DefaultDigits    = 6
+	DefaultPeriod    = 30
+)
+
+// Limits on key parameters
+const (
+	MinDigits       = 6
+	MaxDigits       = 8
+	MinSecretLength = 10 // 80 bits, the RFC 4226 minimum
+	MaxPeriod       = 300
+)
+
+var (
+	ErrInvalidSecret    = errors.New("invalid one-time password secret")
+	ErrInvalidAlgorithm = errors.New("unsupported one-time password algorithm")
+	ErrInvalidDigits    = errors.New("one-time passwords must have 6 to 8 digits")
+	ErrInvalidPeriod    = errors.New("invalid one-time password period")
+)
+
+// Key is a one-time password seed with its parameters
+type Key struct {
+	Type      string // TypeTOTP or TypeHOTP; empty means TypeTOTP
+	Issuer    string
+	Account   string
+	Secret    []byte
+	Algorithm string
+	Digits    int
+	Period    int    // seconds, TOTP only; DefaultPeriod if zero
+	Counter   uint64 // HOTP only
+}
+
+// NewKey returns a TOTP key with the default parameters
+func NewKey(secret []byte) *Key {
+	return &Key{
+		Type:      TypeTOTP,
+		Secret:    secret,
+		Algorithm: DefaultAlgorithm,
+		Digits:    DefaultDigits,
+		Period:    DefaultPeriod,
+	}
+}
+
+// Validate checks the key parameters
+func (k *Key) Validate() error {
+	if len(k.Secret) < MinSecretLength {
+		return ErrInvalidSecret
+	}
+	if _, err := hashFunc(k.Algorithm); err != nil {
+		return err
+	}
+	if k.Digits < MinDigits || k.Digits > MaxDigits {
+		return ErrInvalidDigits
+	}
+	if k.Type != TypeHOTP && (k.Period <= 0 || k.Period > MaxPeriod) {
+		return ErrInvalidPeriod
+	}
+	return nil
+}
+
+// Code returns the code at t; HOTP keys return the code of their counter
+func (k *Key) Code(t time.Time) (string, error) {
+	if k.Type == TypeHOTP {
+		return HOTP(k.Secret, k.Counter, k.Digits, k.Algorithm)
+	}
+	return HOTP(k.Secret, k.step(t), k.Digits, k.Algorithm)
+}
+
+// Remaining returns how long the code at t stays valid
+func (k *Key) Remaining(t time.Time) time.Duration {
+	period := time.Duration(k.period()) * time.Second
+	return period - time.Duration(t.UnixNano())%period
+}
+
+// Verify checks a TOTP code at t, accepting up to skew periods of clock drift
+// in either direction. It returns the matching time step so callers can
+// reject a code that was already used.
+func (k *Key) Verify(code string, t time.Time, skew int) (uint64, bool) {
+	step := k.step(t)
+	for i := -skew; i <= skew; i++ {
+		if i < 0 && uint64(-i) > step {
+			continue
+		}
+		candidate := step + uint64(int64(i))
+		expected, err := HOTP(k.Secret, candidate, k.Digits, k.Algorithm)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(code), []byte(expected)) == 1 {
+			return candidate, true
+		}
+	}
+	return 0, false
+}
+
+func (k *Key) step(t time.Time) uint64 {
+	return uint64(t.Unix()) / uint64(k.period())
+}
+
+// period guards keys that skipped Validate against dividing by zero
+func (k *Key) period() int {
+	if k.Period <= 0 {
+		return DefaultPeriod
+	}
+	return k.Period
+}
+
+// HOTP computes the RFC 4226 code of a counter value
+func HOTP(secret []byte, counter uint64, digits int, algorithm string) (string, error) {
+	if digits < MinDigits || digits > MaxDigits {
+		return "", ErrInvalidDigits
+	}
+	h, err := hashFunc(algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(h, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	code := strconv.FormatUint(uint64(value%mod), 10)
+	return strings.Repeat("0", digits-len(code)) + code, nil
+}
+
+// DecodeSecret decodes a base32 secret as shown by services, tolerating
+// lowercase letters, spaces, dashes and missing padding
+func DecodeSecret(s string) ([]byte, error) {
+	s = strings.ToUpper(strings.NewReplacer(" ", "", "-", "", "=", "").Replace(s))
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(s)
+	if err != nil || len(secret) == 0 {
+		return nil, ErrInvalidSecret
+	}
+	return secret, nil
+}
+
+// EncodeSecret encodes a secret as unpadded base32
+func EncodeSecret(secret []byte) string {
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret)
+}
+
+func hashFunc(algorithm string) (func() hash.Hash, error) {
+	switch strings.ToUpper(algorithm) {
+	case AlgorithmSHA1:
+		return sha1.New, nil
+	case AlgorithmSHA256:
+		return sha256.New, nil
+	case AlgorithmSHA512:
+		return sha512.New, nil
+	}
+	return nil, ErrInvalidAlgorithm
+}
@@ -0,0 +1,245 @@
+package totp_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/askuy/passwordx/backend/internal/pkg/totp"
+)
+
+// Seeds of the RFC 6238 Appendix B test vectors, one per hash algorithm
+var rfcSeeds = map[string][]byte{
+	totp.AlgorithmSHA1:   []byte("12345678901234567890"),
+	totp.AlgorithmSHA256: []byte("12345678901234567890123456789012"),
+	totp.AlgorithmSHA512: []byte("1234567890123456789012345678901234567890123456789012345678901234"),
+}
+
+func TestRFC6238Vectors(t *testing.T) {
+	tests := []struct {
+		unix      int64
+		algorithm string
+		want      string
+	}{
+		{59, totp.AlgorithmSHA1, "94287082"},
+		{59, totp.AlgorithmSHA256, "46119246"},
+		{59, totp.AlgorithmSHA512, "90693936"},
+		{1111111109, totp.AlgorithmSHA1, "07081804"},
+		{1111111109, totp.AlgorithmSHA256, "68084774"},
+		{1111111109, totp.AlgorithmSHA512, "25091201"},
+		{1111111111, totp.AlgorithmSHA1, "14050471"},
+		{1111111111, totp.AlgorithmSHA256, "67062674"},
+		{1111111111, totp.AlgorithmSHA512, "99943326"},
+		{1234567890, totp.AlgorithmSHA1, "89005924"},
+		{1234567890, totp.AlgorithmSHA256, "91819424"},
+		{1234567890, totp.AlgorithmSHA512, "93441116"},
+		{2000000000, totp.AlgorithmSHA1, "69279037"},
+		{2000000000, totp.AlgorithmSHA256, "90698825"},
+		{2000000000, totp.AlgorithmSHA512, "38618901"},
+		{20000000000, totp.AlgorithmSHA1, "65353130"},
+		{20000000000, totp.AlgorithmSHA256, "77737706"},
+		{20000000000, totp.AlgorithmSHA512, "47863826"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.algorithm+"/"+time.Unix(tt.unix, 0).UTC().Format(time.RFC3339), func(t *testing.T) {
+			key := &totp.Key{
+				Type:      totp.TypeTOTP,
+				Secret:    rfcSeeds[tt.algorithm],
+				Algorithm: tt.algorithm,
+				Digits:    8,
+				Period:    30,
+			}
+			if err := key.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			got, err := key.Code(time.Unix(tt.unix, 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Code = %s, want %s", got, tt.want)
+			}
+			if _, ok := key.Verify(tt.want, time.Unix(tt.unix, 0), 0); !ok {
+				t.Error("Verify rejected the expected code")
+			}
+		})
+	}
+}
+
+// TestRFC4226Vectors checks the HOTP values of RFC 4226 Appendix D
+func TestRFC4226Vectors(t *testing.T) {
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	for counter, code := range want {
+		got, err := totp.HOTP(rfcSeeds[totp.AlgorithmSHA1], uint64(counter), 6, totp.AlgorithmSHA1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != code {
+			t.Errorf("HOTP(counter %d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+func TestVerifySkew(t *testing.T) {
+	key := totp.NewKey(rfcSeeds[totp.AlgorithmSHA1])
+	now := time.Unix(1111111111, 0)
+	step := uint64(now.Unix() / totp.DefaultPeriod)
+
+	tests := []struct {
+		name     string
+		offset   time.Duration
+		skew     int
+		wantStep uint64
+		wantOK   bool
+	}{
+		{"current period", 0, 0, step, true},
+		{"previous period within skew", -totp.DefaultPeriod * time.Second, 1, step - 1, true},
+		{"next period within skew", totp.DefaultPeriod * time.Second, 1, step + 1, true},
+		{"previous period without skew", -totp.DefaultPeriod * time.Second, 0, 0, false},
+		{"two periods back with skew 1", -2 * totp.DefaultPeriod * time.Second, 1, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := key.Code(now.Add(tt.offset))
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotStep, ok := key.Verify(code, now, tt.skew)
+			if ok != tt.wantOK || gotStep != tt.wantStep {
+				t.Errorf("Verify = (%d, %v), want (%d, %v)", gotStep, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := rfcSeeds[totp.AlgorithmSHA1]
+	tests := []struct {
+		name    string
+		key     totp.Key
+		wantErr error
+	}{
+		{"defaults", *totp.NewKey(secret), nil},
+		{"empty type is TOTP", totp.Key{Secret: secret, Algorithm: "SHA1", Digits: 6, Period: 30}, nil},
+		{"empty type without period", totp.Key{Secret: secret, Algorithm: "SHA1", Digits: 6}, totp.ErrInvalidPeriod},
+		{"TOTP without period", totp.Key{Type: totp.TypeTOTP, Secret: secret, Algorithm: "SHA1", Digits: 6}, totp.ErrInvalidPeriod},
+		{"period too long", totp.Key{Type: totp.TypeTOTP, Secret: secret, Algorithm: "SHA1", Digits: 6, Period: totp.MaxPeriod + 1}, totp.ErrInvalidPeriod},
+		{"HOTP without period", totp.Key{Type: totp.TypeHOTP, Secret: secret, Algorithm: "SHA1", Digits: 6}, nil},
+		{"short secret", totp.Key{Type: totp.TypeTOTP, Secret: secret[:totp.MinSecretLength-1], Algorithm: "SHA1", Digits: 6, Period: 30}, totp.ErrInvalidSecret},
+		{"unknown algorithm", totp.Key{Type: totp.TypeTOTP, Secret: secret, Algorithm: "MD5", Digits: 6, Period: 30}, totp.ErrInvalidAlgorithm},
+		{"too few digits", totp.Key{Type: totp.TypeTOTP, Secret: secret, Algorithm: "SHA1", Digits: 5, Period: 30}, totp.ErrInvalidDigits},
+		{"too many digits", totp.Key{Type: totp.TypeTOTP, Secret: secret, Algorithm: "SHA1", Digits: 9, Period: 30}, totp.ErrInvalidDigits},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.key.Validate(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestZeroPeriod checks that keys which skipped Validate fall back to the
+// default period instead of dividing by zero
+func TestZeroPeriod(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	key := &totp.Key{Secret: rfcSeeds[totp.AlgorithmSHA1], Algorithm: "SHA1", Digits: 8}
+
+	got, err := key.Code(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "14050471" {
+		t.Errorf("Code = %s, want the 30 second code 14050471", got)
+	}
+	if _, ok := key.Verify(got, now, 1); !ok {
+		t.Error("Verify rejected the code")
+	}
+	if remaining := key.Remaining(now); remaining <= 0 || remaining > totp.DefaultPeriod*time.Second {
+		t.Errorf("Remaining = %v", remaining)
+	}
+}
+
+func TestURI(t *testing.T) {
+	tests := []struct {
+		name    string
+		uri     string
+		want    totp.Key
+		wantErr error
+	}{
+		{
+			name: "defaults",
+			uri:  "otpauth://totp/Example:alice@example.com?secret=JBSWY3DPEHPK3PXP&issuer=Example",
+			want: totp.Key{Type: totp.TypeTOTP, Issuer: "Example", Account: "alice@example.com", Algorithm: "SHA1", Digits: 6, Period: 30},
+		},
+		{
+			name: "issuer parameter wins over label",
+			uri:  "otpauth://totp/Label:alice?secret=JBSWY3DPEHPK3PXP&issuer=Param",
+			want: totp.Key{Type: totp.TypeTOTP, Issuer: "Param", Account: "alice", Algorithm: "SHA1", Digits: 6, Period: 30},
+		},
+		{
+			name: "explicit parameters",
+			uri:  "otpauth://totp/alice?secret=jbswy3dpehpk3pxp&algorithm=sha256&digits=8&period=60",
+			want: totp.Key{Type: totp.TypeTOTP, Account: "alice", Algorithm: "SHA256", Digits: 8, Period: 60},
+		},
+		{
+			name: "hotp",
+			uri:  "otpauth://hotp/alice?secret=JBSWY3DPEHPK3PXP&counter=7",
+			want: totp.Key{Type: totp.TypeHOTP, Account: "alice", Algorithm: "SHA1", Digits: 6, Period: 30, Counter: 7},
+		},
+		{name: "wrong scheme", uri: "https://totp/alice?secret=JBSWY3DPEHPK3PXP", wantErr: totp.ErrInvalidURI},
+		{name: "unknown type", uri: "otpauth://motp/alice?secret=JBSWY3DPEHPK3PXP", wantErr: totp.ErrInvalidURI},
+		{name: "missing secret", uri: "otpauth://totp/alice", wantErr: totp.ErrInvalidSecret},
+		{name: "hotp without counter", uri: "otpauth://hotp/alice?secret=JBSWY3DPEHPK3PXP", wantErr: totp.ErrInvalidURI},
+		{name: "zero period", uri: "otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&period=0", wantErr: totp.ErrInvalidPeriod},
+		{name: "bad digits", uri: "otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&digits=x", wantErr: totp.ErrInvalidDigits},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := totp.ParseURI(tt.uri)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseURI error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			key.Secret = nil
+			if !reflect.DeepEqual(*key, tt.want) {
+				t.Errorf("ParseURI = %+v, want %+v", *key, tt.want)
+			}
+		})
+	}
+}
+
+func TestURIRoundTrip(t *testing.T) {
+	secret := rfcSeeds[totp.AlgorithmSHA1]
+	tests := []struct {
+		name string
+		key  totp.Key
+	}{
+		{"defaults", totp.Key{Type: totp.TypeTOTP, Issuer: "Example", Account: "alice@example.com", Secret: secret, Algorithm: "SHA1", Digits: 6, Period: 30}},
+		{"custom parameters", totp.Key{Type: totp.TypeTOTP, Account: "alice", Secret: secret, Algorithm: "SHA512", Digits: 8, Period: 60}},
+		{"empty type", totp.Key{Account: "alice", Secret: secret, Algorithm: "SHA1", Digits: 6, Period: 30}},
+		{"hotp", totp.Key{Type: totp.TypeHOTP, Account: "alice", Secret: secret, Algorithm: "SHA1", Digits: 6, Period: 30, Counter: 42}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := totp.ParseURI(tt.key.URI())
+			if err != nil {
+				t.Fatalf("ParseURI(%s): %v", tt.key.URI(), err)
+			}
+			want := tt.key
+			if want.Type == "" {
+				want.Type = totp.TypeTOTP
+			}
+			if string(parsed.Secret) != string(want.Secret) {
+				t.Errorf("Secret = %x, want %x", parsed.Secret, want.Secret)
+			}
+			parsed.Secret, want.Secret = nil, nil
+			if !reflect.DeepEqual(*parsed, want) {
+				t.Errorf("round trip = %+v, want %+v", *parsed, want)
+			}
+		})
+	}
+}
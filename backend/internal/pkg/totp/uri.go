@@ -0,0 +1,113 @@
+package totp
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Key types of an otpauth:// URI
+const (
+	TypeTOTP = "totp"
+	TypeHOTP = "hotp"
+)
+
+var ErrInvalidURI = errors.New("invalid otpauth URI")
+
+// ParseURI parses an otpauth:// URI such as
+// otpauth://totp/Example:alice@example.com?secret=JBSWY3DPEHPK3PXP&issuer=Example
+func ParseURI(uri string) (*Key, error) {
+	u, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil || u.Scheme != "otpauth" {
+		return nil, ErrInvalidURI
+	}
+
+	k := &Key{
+		Type:      strings.ToLower(u.Host),
+		Algorithm: DefaultAlgorithm,
+		Digits:    DefaultDigits,
+		Period:    DefaultPeriod,
+	}
+	if k.Type != TypeTOTP && k.Type != TypeHOTP {
+		return nil, ErrInvalidURI
+	}
+
+	// The label is "issuer:account" or just "account"
+	label := strings.TrimPrefix(u.Path, "/")
+	if issuer, account, ok := strings.Cut(label, ":"); ok {
+		k.Issuer = strings.TrimSpace(issuer)
+		k.Account = strings.TrimSpace(account)
+	} else {
+		k.Account = strings.TrimSpace(label)
+	}
+
+	q := u.Query()
+	if k.Secret, err = DecodeSecret(q.Get("secret")); err != nil {
+		return nil, err
+	}
+	// The issuer parameter takes precedence over the label prefix
+	if issuer := q.Get("issuer"); issuer != "" {
+		k.Issuer = issuer
+	}
+	if algorithm := q.Get("algorithm"); algorithm != "" {
+		k.Algorithm = strings.ToUpper(algorithm)
+	}
+	if digits := q.Get("digits"); digits != "" {
+		if k.Digits, err = strconv.Atoi(digits); err != nil {
+			return nil, ErrInvalidDigits
+		}
+	}
+	if period := q.Get("period"); period != "" {
+		if k.Period, err = strconv.Atoi(period); err != nil {
+			return nil, ErrInvalidPeriod
+		}
+	}
+	if k.Type == TypeHOTP {
+		if k.Counter, err = strconv.ParseUint(q.Get("counter"), 10, 64); err != nil {
+			return nil, ErrInvalidURI
+		}
+	}
+
+	if err := k.Validate(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// URI formats the key as an otpauth:// URI, omitting default parameters
+func (k *Key) URI() string {
+	label := k.Account
+	if k.Issuer != "" {
+		label = k.Issuer + ":" + k.Account
+	}
+
+	q := url.Values{}
+	q.Set("secret", EncodeSecret(k.Secret))
+	if k.Issuer != "" {
+		q.Set("issuer", k.Issuer)
+	}
+	if k.Algorithm != "" && k.Algorithm != DefaultAlgorithm {
+		q.Set("algorithm", k.Algorithm)
+	}
+	if k.Digits != 0 && k.Digits != DefaultDigits {
+		q.Set("digits", strconv.Itoa(k.Digits))
+	}
+	if k.Type == TypeHOTP {
+		q.Set("counter", strconv.FormatUint(k.Counter, 10))
+	} else if k.Period != 0 && k.Period != DefaultPeriod {
+		q.Set("period", strconv.Itoa(k.Period))
+	}
+
+	keyType := k.Type
+	if keyType == "" {
+		keyType = TypeTOTP
+	}
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     keyType,
+		Path:     "/" + label,
+		RawQuery: q.Encode(),
+	}
+	return u.String()
+}
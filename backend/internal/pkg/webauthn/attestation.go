@@ -0,0 +1,95 @@
+package webauthn
+
+import (
+	"crypto/x509"
+	"errors"
+)
+
+// Attestation statement formats
+const (
+	AttestationNone   = "none"
+	AttestationPacked = "packed"
+)
+
+var (
+	ErrInvalidAttestation     = errors.New("invalid attestation")
+	ErrUnsupportedAttestation = errors.New("unsupported attestation format")
+)
+
+// attestationObject is a decoded attestationObject
+type attestationObject struct {
+	format      string
+	statement   map[interface{}]interface{}
+	rawAuthData []byte
+}
+
+func parseAttestationObject(raw []byte) (*attestationObject, error) {
+	v, n, err := decodeCBOR(raw)
+	if err != nil || n != len(raw) {
+		return nil, ErrInvalidAttestation
+	}
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrInvalidAttestation
+	}
+	format, ok1 := mapText(m, "fmt")
+	statement, ok2 := m["attStmt"].(map[interface{}]interface{})
+	authData, ok3 := mapBytes(m, "authData")
+	if !ok1 || !ok2 || !ok3 {
+		return nil, ErrInvalidAttestation
+	}
+	return &attestationObject{format: format, statement: statement, rawAuthData: authData}, nil
+}
+
+// verify checks the attestation statement signs the authenticator data and
+// client data hash. Attestation certificates are not chained to a root: the
+// statement proves the key pair exists, not who made the authenticator.
+func (o *attestationObject) verify(credentialKey *PublicKey, clientDataHash []byte) error {
+	switch o.format {
+	case AttestationNone:
+		if len(o.statement) != 0 {
+			return ErrInvalidAttestation
+		}
+		return nil
+	case AttestationPacked:
+		return o.verifyPacked(credentialKey, clientDataHash)
+	}
+	return ErrUnsupportedAttestation
+}
+
+func (o *attestationObject) verifyPacked(credentialKey *PublicKey, clientDataHash []byte) error {
+	alg, ok1 := mapInt(o.statement, "alg")
+	sig, ok2 := mapBytes(o.statement, "sig")
+	if !ok1 || !ok2 {
+		return ErrInvalidAttestation
+	}
+	signed := append(append([]byte(nil), o.rawAuthData...), clientDataHash...)
+
+	x5c, hasCert := o.statement["x5c"].([]interface{})
+	if !hasCert {
+		// Self attestation is signed by the credential itself
+		if alg != credentialKey.Algorithm {
+			return ErrInvalidAttestation
+		}
+		if err := credentialKey.Verify(signed, sig); err != nil {
+			return ErrInvalidAttestation
+		}
+		return nil
+	}
+
+	if len(x5c) == 0 {
+		return ErrInvalidAttestation
+	}
+	der, ok := x5c[0].([]byte)
+	if !ok {
+		return ErrInvalidAttestation
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil || cert.Version != 3 || cert.IsCA {
+		return ErrInvalidAttestation
+	}
+	if err := verifySignature(alg, cert.PublicKey, signed, sig); err != nil {
+		return ErrInvalidAttestation
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Authenticator data flags
+const (
+	FlagUserPresent    = 0x01
+	FlagUserVerified   = 0x04
+	FlagBackupEligible = 0x08
+	FlagBackupState    = 0x10
+	FlagAttestedData   = 0x40
+	FlagExtensionData  = 0x80
+)
+
+const (
+	authDataMinLength = 37 // rpIdHash, flags, signCount
+
+	// maxCredentialIDLength is the limit set by WebAuthn Level 3
+	maxCredentialIDLength = 1023
+)
+
+var ErrInvalidAuthenticatorData = errors.New("invalid authenticator data")
+
+// AuthenticatorData is the authenticator's signed statement about a ceremony
+type AuthenticatorData struct {
+	RPIDHash  [32]byte
+	Flags     byte
+	SignCount uint32
+
+	// Set during registration only
+	AAGUID       [16]byte
+	CredentialID []byte
+	PublicKey    []byte // COSE_Key
+}
+
+// UserPresent reports whether the user touched the authenticator
+func (a *AuthenticatorData) UserPresent() bool { return a.Flags&FlagUserPresent != 0 }
+
+// UserVerified reports whether the authenticator verified the user, with a PIN
+// or biometric
+func (a *AuthenticatorData) UserVerified() bool { return a.Flags&FlagUserVerified != 0 }
+
+// BackupEligible reports whether the credential can be synced, as passkeys are
+func (a *AuthenticatorData) BackupEligible() bool { return a.Flags&FlagBackupEligible != 0 }
+
+// ParseAuthenticatorData decodes authenticator data
+func ParseAuthenticatorData(b []byte) (*AuthenticatorData, error) {
+	if len(b) < authDataMinLength {
+		return nil, ErrInvalidAuthenticatorData
+	}
+	a := &AuthenticatorData{
+		Flags:     b[32],
+		SignCount: binary.BigEndian.Uint32(b[33:37]),
+	}
+	copy(a.RPIDHash[:], b[:32])
+	rest := b[authDataMinLength:]
+
+	if a.Flags&FlagAttestedData != 0 {
+		if len(rest) < 18 {
+			return nil, ErrInvalidAuthenticatorData
+		}
+		copy(a.AAGUID[:], rest[:16])
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLen == 0 || idLen > maxCredentialIDLength || len(rest) < idLen {
+			return nil, ErrInvalidAuthenticatorData
+		}
+		a.CredentialID = append([]byte(nil), rest[:idLen]...)
+		rest = rest[idLen:]
+
+		// The COSE key has no length prefix, its CBOR encoding delimits it
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, ErrInvalidAuthenticatorData
+		}
+		a.PublicKey = append([]byte(nil), rest[:n]...)
+		rest = rest[n:]
+	}
+
+	if a.Flags&FlagExtensionData != 0 {
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, ErrInvalidAuthenticatorData
+		}
+		rest = rest[n:]
+	}
+	if len(rest) != 0 {
+		return nil, ErrInvalidAuthenticatorData
+	}
+	return a, nil
+}
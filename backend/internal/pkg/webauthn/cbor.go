@@ -0,0 +1,179 @@
+package webauthn
+
+import (
+	"errors"
+	"math"
+)
+
+// CBOR (RFC 8949) decoding, limited to what authenticators send: unsigned and
+// negative integers, byte and text strings, arrays, maps and simple values,
+// all with definite lengths as required by CTAP2 canonical encoding.
+
+var ErrInvalidCBOR = errors.New("invalid CBOR")
+
+const (
+	cborUint   = 0
+	cborNegInt = 1
+	cborBytes  = 2
+	cborText   = 3
+	cborArray  = 4
+	cborMap    = 5
+	cborSimple = 7
+
+	// cborMaxDepth bounds nesting so hostile input can't exhaust the stack
+	cborMaxDepth = 16
+)
+
+// decodeCBOR decodes the first CBOR item in data and returns it with the
+// number of bytes it took. Integers decode to int64, byte strings to []byte,
+// text to string, arrays to []interface{} and maps to map[interface{}]interface{}.
+func decodeCBOR(data []byte) (interface{}, int, error) {
+	d := &cborDecoder{data: data}
+	v, err := d.decode(0)
+	if err != nil {
+		return nil, 0, err
+	}
+	return v, d.pos, nil
+}
+
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *cborDecoder) decode(depth int) (interface{}, error) {
+	if depth > cborMaxDepth {
+		return nil, ErrInvalidCBOR
+	}
+	major, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case cborUint:
+		if arg > math.MaxInt64 {
+			return nil, ErrInvalidCBOR
+		}
+		return int64(arg), nil
+	case cborNegInt:
+		if arg > math.MaxInt64 {
+			return nil, ErrInvalidCBOR
+		}
+		return -1 - int64(arg), nil
+	case cborBytes, cborText:
+		b, err := d.take(arg)
+		if err != nil {
+			return nil, err
+		}
+		if major == cborText {
+			return string(b), nil
+		}
+		return append([]byte(nil), b...), nil
+	case cborArray:
+		// Every item takes at least one byte
+		if arg > uint64(len(d.data)-d.pos) {
+			return nil, ErrInvalidCBOR
+		}
+		items := make([]interface{}, arg)
+		for i := range items {
+			if items[i], err = d.decode(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	case cborMap:
+		if arg > uint64(len(d.data)-d.pos)/2 {
+			return nil, ErrInvalidCBOR
+		}
+		m := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, ErrInvalidCBOR
+			}
+			if _, dup := m[key]; dup {
+				return nil, ErrInvalidCBOR
+			}
+			if m[key], err = d.decode(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case cborSimple:
+		switch arg {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22:
+			return nil, nil
+		}
+	}
+	// Tags, floats and undefined never appear in WebAuthn structures
+	return nil, ErrInvalidCBOR
+}
+
+// head reads an initial byte and its argument
+func (d *cborDecoder) head() (byte, uint64, error) {
+	if d.pos >= len(d.data) {
+		return 0, 0, ErrInvalidCBOR
+	}
+	initial := d.data[d.pos]
+	d.pos++
+	major, info := initial>>5, initial&0x1f
+
+	// Simple values and floats carry their value in the argument; only the
+	// one byte simple values are supported
+	if major == cborSimple && info > 23 {
+		return 0, 0, ErrInvalidCBOR
+	}
+
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info <= 27:
+		b, err := d.take(1 << (info - 24))
+		if err != nil {
+			return 0, 0, err
+		}
+		var arg uint64
+		for _, c := range b {
+			arg = arg<<8 | uint64(c)
+		}
+		return major, arg, nil
+	}
+	// Indefinite lengths are not allowed in canonical CTAP2 encoding
+	return 0, 0, ErrInvalidCBOR
+}
+
+func (d *cborDecoder) take(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, ErrInvalidCBOR
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+// Typed reads from a decoded map
+
+func mapBytes(m map[interface{}]interface{}, key interface{}) ([]byte, bool) {
+	b, ok := m[key].([]byte)
+	return b, ok
+}
+
+func mapInt(m map[interface{}]interface{}, key interface{}) (int64, bool) {
+	v, ok := m[key].(int64)
+	return v, ok
+}
+
+func mapText(m map[interface{}]interface{}, key interface{}) (string, bool) {
+	s, ok := m[key].(string)
+	return s, ok
+}
@@ -0,0 +1,151 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+// COSE algorithm identifiers (RFC 9053) accepted for credentials
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// COSE key parameters (RFC 9052)
+const (
+	coseKeyType  = 1
+	coseKeyAlg   = 3
+	coseCurve    = -1 // EC2 and OKP
+	coseX        = -2 // EC2 and OKP
+	coseY        = -3 // EC2
+	coseModulus  = -1 // RSA
+	coseExponent = -2 // RSA
+
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+
+	coseCurveP256    = 1
+	coseCurveEd25519 = 6
+
+	// minRSABits rejects keys too short to resist factoring
+	minRSABits = 2048
+)
+
+var (
+	ErrInvalidPublicKey     = errors.New("invalid credential public key")
+	ErrUnsupportedAlgorithm = errors.New("unsupported credential algorithm")
+	ErrInvalidSignature     = errors.New("invalid signature")
+)
+
+// PublicKey is a credential public key decoded from its COSE encoding
+type PublicKey struct {
+	Algorithm int64
+	key       crypto.PublicKey
+}
+
+// ParsePublicKey decodes a COSE_Key as stored for a credential
+func ParsePublicKey(cose []byte) (*PublicKey, error) {
+	v, n, err := decodeCBOR(cose)
+	if err != nil || n != len(cose) {
+		return nil, ErrInvalidPublicKey
+	}
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrInvalidPublicKey
+	}
+	return publicKeyFromMap(m)
+}
+
+func publicKeyFromMap(m map[interface{}]interface{}) (*PublicKey, error) {
+	kty, ok1 := mapInt(m, int64(coseKeyType))
+	alg, ok2 := mapInt(m, int64(coseKeyAlg))
+	if !ok1 || !ok2 {
+		return nil, ErrInvalidPublicKey
+	}
+
+	switch alg {
+	case AlgES256:
+		crv, _ := mapInt(m, int64(coseCurve))
+		x, _ := mapBytes(m, int64(coseX))
+		y, _ := mapBytes(m, int64(coseY))
+		if kty != coseKeyTypeEC2 || crv != coseCurveP256 || len(x) != 32 || len(y) != 32 {
+			return nil, ErrInvalidPublicKey
+		}
+		// Uncompressed point encoding, which also checks the point is on the curve
+		point := append(append([]byte{4}, x...), y...)
+		px, py := elliptic.Unmarshal(elliptic.P256(), point)
+		if px == nil {
+			return nil, ErrInvalidPublicKey
+		}
+		return &PublicKey{Algorithm: alg, key: &ecdsa.PublicKey{Curve: elliptic.P256(), X: px, Y: py}}, nil
+
+	case AlgEdDSA:
+		crv, _ := mapInt(m, int64(coseCurve))
+		x, _ := mapBytes(m, int64(coseX))
+		if kty != coseKeyTypeOKP || crv != coseCurveEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, ErrInvalidPublicKey
+		}
+		return &PublicKey{Algorithm: alg, key: ed25519.PublicKey(x)}, nil
+
+	case AlgRS256:
+		n, _ := mapBytes(m, int64(coseModulus))
+		e, _ := mapBytes(m, int64(coseExponent))
+		if kty != coseKeyTypeRSA || len(e) == 0 || len(e) > 4 {
+			return nil, ErrInvalidPublicKey
+		}
+		modulus := new(big.Int).SetBytes(n)
+		if modulus.BitLen() < minRSABits {
+			return nil, ErrInvalidPublicKey
+		}
+		exponent := 0
+		for _, b := range e {
+			exponent = exponent<<8 | int(b)
+		}
+		if exponent < 3 || exponent%2 == 0 {
+			return nil, ErrInvalidPublicKey
+		}
+		return &PublicKey{Algorithm: alg, key: &rsa.PublicKey{N: modulus, E: exponent}}, nil
+	}
+	return nil, ErrUnsupportedAlgorithm
+}
+
+// Verify checks a signature over data
+func (k *PublicKey) Verify(data, sig []byte) error {
+	return verifySignature(k.Algorithm, k.key, data, sig)
+}
+
+// verifySignature checks a signature made with a COSE algorithm by any key of
+// the matching type, so attestation certificates share the code
+func verifySignature(alg int64, key crypto.PublicKey, data, sig []byte) error {
+	ok := false
+	switch alg {
+	case AlgES256:
+		if pub, isEC := key.(*ecdsa.PublicKey); isEC {
+			digest := sha256.Sum256(data)
+			ok = ecdsa.VerifyASN1(pub, digest[:], sig)
+		}
+	case AlgEdDSA:
+		if pub, isEd := key.(ed25519.PublicKey); isEd {
+			ok = ed25519.Verify(pub, data, sig)
+		}
+	case AlgRS256:
+		if pub, isRSA := key.(*rsa.PublicKey); isRSA {
+			digest := sha256.Sum256(data)
+			ok = rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) == nil
+		}
+	default:
+		return ErrUnsupportedAlgorithm
+	}
+	if !ok {
+		return ErrInvalidSignature
+	}
+	return nil
+}
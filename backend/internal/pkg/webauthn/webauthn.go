@@ -0,0 +1,400 @@
+// Package webauthn implements the relying party side of Web Authentication
+// (WebAuthn Level 2): it issues the options for navigator.credentials.create
+// and navigator.credentials.get and verifies the authenticator's responses.
+//
+// Only what a password manager login needs is supported: ES256, EdDSA and
+// RS256 credentials, and "none" or "packed" attestation, whose certificates
+// are checked for a valid signature but not against a trust store, since
+// any security key is welcome. The webauthntest package has a software
+// authenticator for exercising the ceremonies without hardware.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// Ceremony types in client data
+const (
+	ceremonyCreate = "webauthn.create"
+	ceremonyGet    = "webauthn.get"
+)
+
+// User verification requirements
+const (
+	UserVerificationRequired    = "required"
+	UserVerificationPreferred   = "preferred"
+	UserVerificationDiscouraged = "discouraged"
+)
+
+// Resident key requirements
+const (
+	ResidentKeyRequired    = "required"
+	ResidentKeyPreferred   = "preferred"
+	ResidentKeyDiscouraged = "discouraged"
+)
+
+const (
+	// ChallengeSize is the number of random bytes in a challenge
+	ChallengeSize = 32
+	// Timeout is how long the browser gives the user, in milliseconds
+	Timeout = 5 * 60 * 1000
+
+	credentialType = "public-key"
+)
+
+var (
+	ErrCredentialType    = errors.New("credential is not a public key credential")
+	ErrInvalidClientData = errors.New("invalid client data")
+	ErrCeremonyType      = errors.New("client data is for another ceremony")
+	ErrChallengeMismatch = errors.New("challenge does not match")
+	ErrOriginMismatch    = errors.New("origin is not allowed")
+	ErrRPIDMismatch      = errors.New("relying party ID does not match")
+	ErrUserNotPresent    = errors.New("user presence is required")
+	ErrUserNotVerified   = errors.New("user verification is required")
+	ErrCredentialMissing = errors.New("authenticator returned no credential")
+	ErrCredentialID      = errors.New("credential ID does not match")
+	ErrSignCount         = errors.New("signature counter did not increase, the authenticator may be cloned")
+)
+
+// URLEncodedBytes is binary data carried as unpadded base64url in JSON, the
+// encoding of PublicKeyCredential.toJSON()
+type URLEncodedBytes []byte
+
+// MarshalJSON implements json.Marshaler
+func (b URLEncodedBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+// UnmarshalJSON implements json.Unmarshaler, tolerating padding
+func (b *URLEncodedBytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// RelyingParty is the site credentials are scoped to
+type RelyingParty struct {
+	ID      string   // a registrable domain such as "example.com"
+	Name    string   // shown by the authenticator
+	Origins []string // origins allowed to run ceremonies, e.g. "https://vault.example.com"
+}
+
+// RPEntity describes the relying party to the authenticator
+type RPEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// UserEntity describes the account a credential is created for
+type UserEntity struct {
+	ID          URLEncodedBytes `json:"id"` // opaque user handle, at most 64 bytes
+	Name        string          `json:"name"`
+	DisplayName string          `json:"displayName"`
+}
+
+// CredentialParameter is an accepted credential type and algorithm
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+// CredentialDescriptor identifies an existing credential
+type CredentialDescriptor struct {
+	Type       string          `json:"type"`
+	ID         URLEncodedBytes `json:"id"`
+	Transports []string        `json:"transports,omitempty"`
+}
+
+// AuthenticatorSelection states what kind of authenticator to create on
+type AuthenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+// CreationOptions are the options for navigator.credentials.create
+type CreationOptions struct {
+	RP                     RPEntity               `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	Challenge              URLEncodedBytes        `json:"challenge"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int                    `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions are the options for navigator.credentials.get
+type RequestOptions struct {
+	Challenge        URLEncodedBytes        `json:"challenge"`
+	Timeout          int                    `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// AttestationResponse is the JSON form of a PublicKeyCredential returned by
+// navigator.credentials.create
+type AttestationResponse struct {
+	ID       string          `json:"id"`
+	RawID    URLEncodedBytes `json:"rawId" binding:"required"`
+	Type     string          `json:"type"`
+	Response struct {
+		ClientDataJSON    URLEncodedBytes `json:"clientDataJSON" binding:"required"`
+		AttestationObject URLEncodedBytes `json:"attestationObject" binding:"required"`
+		Transports        []string        `json:"transports"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the JSON form of a PublicKeyCredential returned by
+// navigator.credentials.get
+type AssertionResponse struct {
+	ID       string          `json:"id"`
+	RawID    URLEncodedBytes `json:"rawId" binding:"required"`
+	Type     string          `json:"type"`
+	Response struct {
+		ClientDataJSON    URLEncodedBytes `json:"clientDataJSON" binding:"required"`
+		AuthenticatorData URLEncodedBytes `json:"authenticatorData" binding:"required"`
+		Signature         URLEncodedBytes `json:"signature" binding:"required"`
+		UserHandle        URLEncodedBytes `json:"userHandle"`
+	} `json:"response"`
+}
+
+// Credential is a newly registered credential, to be stored for the user
+type Credential struct {
+	ID                []byte
+	PublicKey         []byte // COSE_Key
+	Algorithm         int64
+	SignCount         uint32
+	AAGUID            [16]byte
+	Transports        []string
+	AttestationFormat string
+	UserVerified      bool
+	BackupEligible    bool
+}
+
+// Assertion is the result of a verified login
+type Assertion struct {
+	SignCount    uint32
+	UserVerified bool
+}
+
+// ClientData is the client's description of a ceremony
+type ClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// supportedAlgorithms in order of preference
+var supportedAlgorithms = []CredentialParameter{
+	{Type: credentialType, Alg: AlgES256},
+	{Type: credentialType, Alg: AlgEdDSA},
+	{Type: credentialType, Alg: AlgRS256},
+}
+
+// NewChallenge returns a random challenge
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, ChallengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// CreationOptions returns registration options with a new challenge. Existing
+// credentials are excluded so a key can't be registered twice. A discoverable
+// credential is stored on the authenticator with user verification, so it can
+// log in without a password.
+func (rp *RelyingParty) CreationOptions(user UserEntity, exclude []CredentialDescriptor, discoverable bool) (*CreationOptions, error) {
+	challenge, err := NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+	selection := AuthenticatorSelection{
+		ResidentKey:      ResidentKeyDiscouraged,
+		UserVerification: UserVerificationPreferred,
+	}
+	if discoverable {
+		selection = AuthenticatorSelection{
+			ResidentKey:        ResidentKeyRequired,
+			RequireResidentKey: true,
+			UserVerification:   UserVerificationRequired,
+		}
+	}
+	if exclude == nil {
+		exclude = []CredentialDescriptor{}
+	}
+	return &CreationOptions{
+		RP:                     RPEntity{ID: rp.ID, Name: rp.Name},
+		User:                   user,
+		Challenge:              challenge,
+		PubKeyCredParams:       supportedAlgorithms,
+		Timeout:                Timeout,
+		ExcludeCredentials:     exclude,
+		AuthenticatorSelection: selection,
+		Attestation:            "none",
+	}, nil
+}
+
+// RequestOptions returns login options with a new challenge. An empty allow
+// list lets the user pick any discoverable credential for the site.
+func (rp *RelyingParty) RequestOptions(allow []CredentialDescriptor, userVerification string) (*RequestOptions, error) {
+	challenge, err := NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+	if allow == nil {
+		allow = []CredentialDescriptor{}
+	}
+	return &RequestOptions{
+		Challenge:        challenge,
+		Timeout:          Timeout,
+		RPID:             rp.ID,
+		AllowCredentials: allow,
+		UserVerification: userVerification,
+	}, nil
+}
+
+// VerifyRegistration checks the response to CreationOptions with the given
+// challenge and returns the new credential
+func (rp *RelyingParty) VerifyRegistration(challenge []byte, resp *AttestationResponse, requireUserVerification bool) (*Credential, error) {
+	if resp.Type != credentialType {
+		return nil, ErrCredentialType
+	}
+	clientDataHash, err := rp.verifyClientData(resp.Response.ClientDataJSON, ceremonyCreate, challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := parseAttestationObject(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, err
+	}
+	authData, err := rp.verifyAuthenticatorData(obj.rawAuthData, requireUserVerification)
+	if err != nil {
+		return nil, err
+	}
+	if authData.Flags&FlagAttestedData == 0 {
+		return nil, ErrCredentialMissing
+	}
+	if !bytes.Equal(authData.CredentialID, resp.RawID) {
+		return nil, ErrCredentialID
+	}
+	key, err := ParsePublicKey(authData.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := obj.verify(key, clientDataHash); err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:                authData.CredentialID,
+		PublicKey:         authData.PublicKey,
+		Algorithm:         key.Algorithm,
+		SignCount:         authData.SignCount,
+		AAGUID:            authData.AAGUID,
+		Transports:        resp.Response.Transports,
+		AttestationFormat: obj.format,
+		UserVerified:      authData.UserVerified(),
+		BackupEligible:    authData.BackupEligible(),
+	}, nil
+}
+
+// VerifyAssertion checks the response to RequestOptions with the given
+// challenge against a stored credential public key and signature counter
+func (rp *RelyingParty) VerifyAssertion(challenge []byte, resp *AssertionResponse, publicKey []byte, signCount uint32, requireUserVerification bool) (*Assertion, error) {
+	if resp.Type != credentialType {
+		return nil, ErrCredentialType
+	}
+	clientDataHash, err := rp.verifyClientData(resp.Response.ClientDataJSON, ceremonyGet, challenge)
+	if err != nil {
+		return nil, err
+	}
+	authData, err := rp.verifyAuthenticatorData(resp.Response.AuthenticatorData, requireUserVerification)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	signed := append(append([]byte(nil), resp.Response.AuthenticatorData...), clientDataHash...)
+	if err := key.Verify(signed, resp.Response.Signature); err != nil {
+		return nil, err
+	}
+
+	// Authenticators without a counter always report zero
+	if (authData.SignCount != 0 || signCount != 0) && authData.SignCount <= signCount {
+		return nil, ErrSignCount
+	}
+	return &Assertion{
+		SignCount:    authData.SignCount,
+		UserVerified: authData.UserVerified(),
+	}, nil
+}
+
+// verifyClientData checks the client data of a ceremony and returns its hash
+func (rp *RelyingParty) verifyClientData(raw []byte, ceremony string, challenge []byte) ([]byte, error) {
+	var clientData ClientData
+	if err := json.Unmarshal(raw, &clientData); err != nil {
+		return nil, ErrInvalidClientData
+	}
+	if clientData.Type != ceremony {
+		return nil, ErrCeremonyType
+	}
+	got, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(clientData.Challenge, "="))
+	if err != nil || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return nil, ErrChallengeMismatch
+	}
+	if !rp.allowedOrigin(clientData.Origin) || clientData.CrossOrigin {
+		return nil, ErrOriginMismatch
+	}
+	hash := sha256.Sum256(raw)
+	return hash[:], nil
+}
+
+// verifyAuthenticatorData checks the RP ID hash and user flags
+func (rp *RelyingParty) verifyAuthenticatorData(raw []byte, requireUserVerification bool) (*AuthenticatorData, error) {
+	authData, err := ParseAuthenticatorData(raw)
+	if err != nil {
+		return nil, err
+	}
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(authData.RPIDHash[:], rpIDHash[:]) != 1 {
+		return nil, ErrRPIDMismatch
+	}
+	if !authData.UserPresent() {
+		return nil, ErrUserNotPresent
+	}
+	if requireUserVerification && !authData.UserVerified() {
+		return nil, ErrUserNotVerified
+	}
+	return authData, nil
+}
+
+func (rp *RelyingParty) allowedOrigin(origin string) bool {
+	for _, allowed := range rp.Origins {
+		if origin == allowed {
+			return true
+		}
+	}
+	return false
+}
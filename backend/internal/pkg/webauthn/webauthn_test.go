@@ -0,0 +1,349 @@
+package webauthn_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/askuy/passwordx/backend/internal/pkg/webauthn"
+	"github.com/askuy/passwordx/backend/internal/pkg/webauthn/webauthntest"
+)
+
+const origin = "https://vault.example.com"
+
+var (
+	rp    = &webauthn.RelyingParty{ID: "example.com", Name: "Example", Origins: []string{origin}}
+	other = &webauthn.RelyingParty{ID: "evil.example", Name: "Evil", Origins: []string{origin}}
+	user  = webauthn.UserEntity{ID: []byte("user-1"), Name: "alice@example.com", DisplayName: "Alice"}
+)
+
+// clientData encodes client data for a ceremony as a browser would
+func clientData(t *testing.T, ceremony string, challenge []byte, crossOrigin bool) []byte {
+	t.Helper()
+	data, err := json.Marshal(webauthn.ClientData{
+		Type:        ceremony,
+		Challenge:   base64.RawURLEncoding.EncodeToString(challenge),
+		Origin:      origin,
+		CrossOrigin: crossOrigin,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// register creates a credential for rp on a new authenticator
+func register(t *testing.T, discoverable bool) (*webauthntest.Authenticator, *webauthn.Credential) {
+	t.Helper()
+	auth := webauthntest.New()
+	opts, err := rp.CreationOptions(user, nil, discoverable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := auth.Create(opts, origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cred, err := rp.VerifyRegistration(opts.Challenge, resp, discoverable)
+	if err != nil {
+		t.Fatalf("VerifyRegistration: %v", err)
+	}
+	return auth, cred
+}
+
+func TestRegistration(t *testing.T) {
+	_, cred := register(t, true)
+	if cred.Algorithm != webauthn.AlgES256 {
+		t.Errorf("Algorithm = %d, want %d", cred.Algorithm, webauthn.AlgES256)
+	}
+	if cred.AttestationFormat != webauthn.AttestationNone {
+		t.Errorf("AttestationFormat = %q, want %q", cred.AttestationFormat, webauthn.AttestationNone)
+	}
+	if cred.SignCount != 1 || !cred.UserVerified || len(cred.ID) != 32 {
+		t.Errorf("credential = %+v", cred)
+	}
+	if _, err := webauthn.ParsePublicKey(cred.PublicKey); err != nil {
+		t.Errorf("ParsePublicKey: %v", err)
+	}
+}
+
+func TestRegistrationRejected(t *testing.T) {
+	tests := []struct {
+		name         string
+		rp           *webauthn.RelyingParty // creates the options, rp if nil
+		origin       string                 // origin if empty
+		notVerified  bool                   // authenticator without user verification
+		discoverable bool
+		modify       func(t *testing.T, opts *webauthn.CreationOptions, resp *webauthn.AttestationResponse)
+		challenge    []byte // the challenge of the options if nil
+		want         error
+	}{
+		{
+			name:   "wrong origin",
+			origin: "https://evil.example",
+			want:   webauthn.ErrOriginMismatch,
+		},
+		{
+			name: "cross origin",
+			modify: func(t *testing.T, opts *webauthn.CreationOptions, resp *webauthn.AttestationResponse) {
+				resp.Response.ClientDataJSON = clientData(t, "webauthn.create", opts.Challenge, true)
+			},
+			want: webauthn.ErrOriginMismatch,
+		},
+		{
+			name:      "wrong challenge",
+			challenge: bytes.Repeat([]byte{1}, webauthn.ChallengeSize),
+			want:      webauthn.ErrChallengeMismatch,
+		},
+		{
+			name: "rpIdHash mismatch",
+			rp:   other,
+			want: webauthn.ErrRPIDMismatch,
+		},
+		{
+			name:         "missing user verification for passwordless",
+			notVerified:  true,
+			discoverable: true,
+			want:         webauthn.ErrUserNotVerified,
+		},
+		{
+			name: "wrong ceremony type",
+			modify: func(t *testing.T, opts *webauthn.CreationOptions, resp *webauthn.AttestationResponse) {
+				resp.Response.ClientDataJSON = clientData(t, "webauthn.get", opts.Challenge, false)
+			},
+			want: webauthn.ErrCeremonyType,
+		},
+		{
+			name: "wrong credential type",
+			modify: func(t *testing.T, opts *webauthn.CreationOptions, resp *webauthn.AttestationResponse) {
+				resp.Type = "password"
+			},
+			want: webauthn.ErrCredentialType,
+		},
+		{
+			name: "credential ID mismatch",
+			modify: func(t *testing.T, opts *webauthn.CreationOptions, resp *webauthn.AttestationResponse) {
+				resp.RawID = bytes.Repeat([]byte{2}, 32)
+			},
+			want: webauthn.ErrCredentialID,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			optsRP := tt.rp
+			if optsRP == nil {
+				optsRP = rp
+			}
+			opts, err := optsRP.CreationOptions(user, nil, tt.discoverable)
+			if err != nil {
+				t.Fatal(err)
+			}
+			from := tt.origin
+			if from == "" {
+				from = origin
+			}
+			auth := webauthntest.New()
+			auth.UserVerified = !tt.notVerified
+			resp, err := auth.Create(opts, from)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.modify != nil {
+				tt.modify(t, opts, resp)
+			}
+			challenge := tt.challenge
+			if challenge == nil {
+				challenge = opts.Challenge
+			}
+
+			if _, err := rp.VerifyRegistration(challenge, resp, tt.discoverable); !errors.Is(err, tt.want) {
+				t.Errorf("VerifyRegistration = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAssertion(t *testing.T) {
+	auth, cred := register(t, false)
+	signCount := cred.SignCount
+	for i := 0; i < 3; i++ {
+		opts, err := rp.RequestOptions([]webauthn.CredentialDescriptor{{Type: "public-key", ID: cred.ID}}, webauthn.UserVerificationPreferred)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := auth.Get(opts, origin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertion, err := rp.VerifyAssertion(opts.Challenge, resp, cred.PublicKey, signCount, false)
+		if err != nil {
+			t.Fatalf("VerifyAssertion: %v", err)
+		}
+		if assertion.SignCount != signCount+1 || !assertion.UserVerified {
+			t.Fatalf("assertion = %+v, previous sign count %d", assertion, signCount)
+		}
+		signCount = assertion.SignCount
+	}
+}
+
+func TestAssertionWithoutCounter(t *testing.T) {
+	auth := webauthntest.New()
+	auth.Counter = false
+	opts, err := rp.CreationOptions(user, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, err := auth.Create(opts, origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cred, err := rp.VerifyRegistration(opts.Challenge, created, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Discoverable login: no allow list, the user handle identifies the account
+	for i := 0; i < 2; i++ {
+		req, err := rp.RequestOptions(nil, webauthn.UserVerificationRequired)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := auth.Get(req, origin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(resp.Response.UserHandle, user.ID) {
+			t.Errorf("UserHandle = %q, want %q", resp.Response.UserHandle, user.ID)
+		}
+		if _, err := rp.VerifyAssertion(req.Challenge, resp, cred.PublicKey, 0, true); err != nil {
+			t.Fatalf("VerifyAssertion: %v", err)
+		}
+	}
+}
+
+func TestAssertionRejected(t *testing.T) {
+	tests := []struct {
+		name        string
+		origin      string // origin if empty
+		otherRP     bool   // the credential was created for another relying party
+		notVerified bool   // authenticator without user verification
+		requireUV   bool   // passwordless login
+		signCount   uint32 // stored sign count, the registration's if zero
+		modify      func(t *testing.T, opts *webauthn.RequestOptions, resp *webauthn.AssertionResponse)
+		challenge   []byte // the challenge of the options if nil
+		want        error
+	}{
+		{
+			name:   "wrong origin",
+			origin: "https://evil.example",
+			want:   webauthn.ErrOriginMismatch,
+		},
+		{
+			name:      "wrong challenge",
+			challenge: bytes.Repeat([]byte{1}, webauthn.ChallengeSize),
+			want:      webauthn.ErrChallengeMismatch,
+		},
+		{
+			name:    "rpIdHash mismatch",
+			otherRP: true,
+			want:    webauthn.ErrRPIDMismatch,
+		},
+		{
+			name:      "sign count regression",
+			signCount: 10,
+			want:      webauthn.ErrSignCount,
+		},
+		{
+			name:        "missing user verification for passwordless",
+			notVerified: true,
+			requireUV:   true,
+			want:        webauthn.ErrUserNotVerified,
+		},
+		{
+			name: "wrong ceremony type",
+			modify: func(t *testing.T, opts *webauthn.RequestOptions, resp *webauthn.AssertionResponse) {
+				resp.Response.ClientDataJSON = clientData(t, "webauthn.create", opts.Challenge, false)
+			},
+			want: webauthn.ErrCeremonyType,
+		},
+		{
+			name: "wrong credential type",
+			modify: func(t *testing.T, opts *webauthn.RequestOptions, resp *webauthn.AssertionResponse) {
+				resp.Type = "password"
+			},
+			want: webauthn.ErrCredentialType,
+		},
+		{
+			name: "tampered signature",
+			modify: func(t *testing.T, opts *webauthn.RequestOptions, resp *webauthn.AssertionResponse) {
+				resp.Response.Signature[len(resp.Response.Signature)-1] ^= 1
+			},
+			want: webauthn.ErrInvalidSignature,
+		},
+		{
+			name: "tampered client data",
+			modify: func(t *testing.T, opts *webauthn.RequestOptions, resp *webauthn.AssertionResponse) {
+				var data webauthn.ClientData
+				if err := json.Unmarshal(resp.Response.ClientDataJSON, &data); err != nil {
+					t.Fatal(err)
+				}
+				resp.Response.ClientDataJSON = append(clientData(t, data.Type, opts.Challenge, false), ' ')
+			},
+			want: webauthn.ErrInvalidSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			credRP := rp
+			if tt.otherRP {
+				credRP = other
+			}
+			auth := webauthntest.New()
+			auth.UserVerified = !tt.notVerified
+			created, err := credRP.CreationOptions(user, nil, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			attestation, err := auth.Create(created, origin)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cred, err := credRP.VerifyRegistration(created.Challenge, attestation, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			opts, err := credRP.RequestOptions([]webauthn.CredentialDescriptor{{Type: "public-key", ID: cred.ID}}, webauthn.UserVerificationPreferred)
+			if err != nil {
+				t.Fatal(err)
+			}
+			from := tt.origin
+			if from == "" {
+				from = origin
+			}
+			resp, err := auth.Get(opts, from)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.modify != nil {
+				tt.modify(t, opts, resp)
+			}
+			challenge := tt.challenge
+			if challenge == nil {
+				challenge = opts.Challenge
+			}
+			signCount := tt.signCount
+			if signCount == 0 {
+				signCount = cred.SignCount
+			}
+
+			if _, err := rp.VerifyAssertion(challenge, resp, cred.PublicKey, signCount, tt.requireUV); !errors.Is(err, tt.want) {
+				t.Errorf("VerifyAssertion = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
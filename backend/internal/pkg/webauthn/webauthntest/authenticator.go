@@ -0,0 +1,238 @@
+// Package webauthntest provides a software authenticator that answers
+// webauthn ceremonies, for testing relying party code without a security key.
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sort"
+
+	"github.com/askuy/passwordx/backend/internal/pkg/webauthn"
+)
+
+var ErrNoCredential = errors.New("authenticator has no credential for this request")
+
+// Authenticator is an ES256 authenticator with "none" attestation. Its flags
+// can be changed to simulate authenticators without user verification or
+// with a broken signature counter.
+type Authenticator struct {
+	AAGUID       [16]byte
+	UserVerified bool // report user verification
+	Counter      bool // increment the signature counter, as most keys do
+
+	credentials []*credential
+}
+
+type credential struct {
+	id         []byte
+	rpID       string
+	userHandle []byte
+	key        *ecdsa.PrivateKey
+	signCount  uint32
+}
+
+// New returns an authenticator that verifies users and counts signatures
+func New() *Authenticator {
+	return &Authenticator{UserVerified: true, Counter: true}
+}
+
+// Create answers navigator.credentials.create as called from origin
+func (a *Authenticator) Create(opts *webauthn.CreationOptions, origin string) (*webauthn.AttestationResponse, error) {
+	for _, excluded := range opts.ExcludeCredentials {
+		if a.find(opts.RP.ID, excluded.ID) != nil {
+			return nil, errors.New("authenticator already holds an excluded credential")
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	cred := &credential{id: id, rpID: opts.RP.ID, userHandle: opts.User.ID, key: key}
+	a.credentials = append(a.credentials, cred)
+
+	clientData, err := clientDataJSON("webauthn.create", opts.Challenge, origin)
+	if err != nil {
+		return nil, err
+	}
+
+	// Attested credential data: AAGUID, credential ID length and ID, COSE key
+	attested := append([]byte(nil), a.AAGUID[:]...)
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(id)))
+	attested = append(attested, id...)
+	attested = append(attested, encodeCOSEKey(&key.PublicKey)...)
+	authData := a.authData(cred, webauthn.FlagAttestedData, attested)
+
+	attestationObject := cborMap(
+		cborText("fmt"), cborText(webauthn.AttestationNone),
+		cborText("attStmt"), cborMap(),
+		cborText("authData"), cborBytes(authData),
+	)
+
+	resp := &webauthn.AttestationResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(id),
+		RawID: id,
+		Type:  "public-key",
+	}
+	resp.Response.ClientDataJSON = clientData
+	resp.Response.AttestationObject = attestationObject
+	resp.Response.Transports = []string{"internal"}
+	return resp, nil
+}
+
+// Get answers navigator.credentials.get as called from origin, using the
+// first allowed credential, or any credential for the site if none are listed
+func (a *Authenticator) Get(opts *webauthn.RequestOptions, origin string) (*webauthn.AssertionResponse, error) {
+	var cred *credential
+	if len(opts.AllowCredentials) == 0 {
+		cred = a.find(opts.RPID, nil)
+	}
+	for _, allowed := range opts.AllowCredentials {
+		if cred = a.find(opts.RPID, allowed.ID); cred != nil {
+			break
+		}
+	}
+	if cred == nil {
+		return nil, ErrNoCredential
+	}
+
+	clientData, err := clientDataJSON("webauthn.get", opts.Challenge, origin)
+	if err != nil {
+		return nil, err
+	}
+	authData := a.authData(cred, 0, nil)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), sha256Sum(clientData)...))
+	sig, err := ecdsa.SignASN1(rand.Reader, cred.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &webauthn.AssertionResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(cred.id),
+		RawID: cred.id,
+		Type:  "public-key",
+	}
+	resp.Response.ClientDataJSON = clientData
+	resp.Response.AuthenticatorData = authData
+	resp.Response.Signature = sig
+	resp.Response.UserHandle = cred.userHandle
+	return resp, nil
+}
+
+// find returns the credential with an ID for a site, or the first
+// credential for the site if id is nil
+func (a *Authenticator) find(rpID string, id []byte) *credential {
+	for _, cred := range a.credentials {
+		if cred.rpID == rpID && (id == nil || string(cred.id) == string(id)) {
+			return cred
+		}
+	}
+	return nil
+}
+
+func (a *Authenticator) authData(cred *credential, flags byte, attested []byte) []byte {
+	flags |= webauthn.FlagUserPresent
+	if a.UserVerified {
+		flags |= webauthn.FlagUserVerified
+	}
+	if a.Counter {
+		cred.signCount++
+	}
+	rpIDHash := sha256.Sum256([]byte(cred.rpID))
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, cred.signCount)
+	return append(data, attested...)
+}
+
+func clientDataJSON(ceremony string, challenge []byte, origin string) ([]byte, error) {
+	return json.Marshal(webauthn.ClientData{
+		Type:      ceremony,
+		Challenge: base64.RawURLEncoding.EncodeToString(challenge),
+		Origin:    origin,
+	})
+}
+
+func sha256Sum(b []byte) []byte {
+	sum := sha256.Sum256(b)
+	return sum[:]
+}
+
+// encodeCOSEKey encodes a P-256 public key as an ES256 COSE_Key
+func encodeCOSEKey(pub *ecdsa.PublicKey) []byte {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	pub.X.FillBytes(x)
+	pub.Y.FillBytes(y)
+	return cborMap(
+		cborInt(1), cborInt(2), // kty: EC2
+		cborInt(3), cborInt(webauthn.AlgES256), // alg
+		cborInt(-1), cborInt(1), // crv: P-256
+		cborInt(-2), cborBytes(x),
+		cborInt(-3), cborBytes(y),
+	)
+}
+
+// Minimal canonical CBOR encoding
+
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n <= 0xff:
+		return []byte{major<<5 | 24, byte(n)}
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	case n <= 0xffffffff:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+	}
+	return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, n)
+}
+
+func cborInt(v int64) []byte {
+	if v < 0 {
+		return cborHead(1, uint64(-1-v))
+	}
+	return cborHead(0, uint64(v))
+}
+
+func cborBytes(b []byte) []byte {
+	return append(cborHead(2, uint64(len(b))), b...)
+}
+
+func cborText(s string) []byte {
+	return append(cborHead(3, uint64(len(s))), s...)
+}
+
+// cborMap encodes alternating keys and values, sorting the pairs by encoded
+// key as canonical CBOR requires
+func cborMap(pairs ...[]byte) []byte {
+	type pair struct{ key, value []byte }
+	sorted := make([]pair, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		sorted = append(sorted, pair{pairs[i], pairs[i+1]})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i].key, sorted[j].key
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return string(a) < string(b)
+	})
+
+	out := cborHead(5, uint64(len(sorted)))
+	for _, p := range sorted {
+		out = append(out, p.key...)
+		out = append(out, p.value...)
+	}
+	return out
+}
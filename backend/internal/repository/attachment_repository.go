@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/askuy/passwordx/backend/internal/model"
+)
+
+type AttachmentRepository struct {
+	db *gorm.DB
+}
+
+func NewAttachmentRepository(db *gorm.DB) *AttachmentRepository {
+	return &AttachmentRepository{db: db}
+}
+
+func (r *AttachmentRepository) Create(ctx context.Context, attachment *model.Attachment) error {
+	return r.db.WithContext(ctx).Create(attachment).Error
+}
+
+func (r *AttachmentRepository) GetByID(ctx context.Context, id int64) (*model.Attachment, error) {
+	var attachment model.Attachment
+	err := r.db.WithContext(ctx).First(&attachment, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+func (r *AttachmentRepository) ExistsByAttachmentID(ctx context.Context, attachmentID string) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&model.Attachment{}).Where("attachment_id = ?", attachmentID).Count(&count).Error
+	return count > 0, err
+}
+
+// UpdateKeys stores a re-encrypted file name and rewrapped file key
+func (r *AttachmentRepository) UpdateKeys(ctx context.Context, attachment *model.Attachment) error {
+	return r.db.WithContext(ctx).Model(&model.Attachment{}).Where("id = ?", attachment.ID).Updates(map[string]interface{}{
+		"file_name_encrypted": attachment.FileNameEncrypted,
+		"key_encrypted":       attachment.KeyEncrypted,
+		"key_generation":      attachment.KeyGeneration,
+	}).Error
+}
+
+func (r *AttachmentRepository) Delete(ctx context.Context, id int64) error {
+	return r.db.WithContext(ctx).Delete(&model.Attachment{}, id).Error
+}
+
+func (r *AttachmentRepository) ListByCredentialID(ctx context.Context, credentialID int64) ([]model.Attachment, error) {
+	var attachments []model.Attachment
+	err := r.db.WithContext(ctx).Where("credential_id = ?", credentialID).Order("id").Find(&attachments).Error
+	return attachments, err
+}
+
+func (r *AttachmentRepository) ListByVaultID(ctx context.Context, vaultID int64) ([]model.Attachment, error) {
+	var attachments []model.Attachment
+	err := r.db.WithContext(ctx).Where("vault_id = ?", vaultID).Find(&attachments).Error
+	return attachments, err
+}
+
+func (r *AttachmentRepository) DeleteByCredentialID(ctx context.Context, credentialID int64) error {
+	return r.db.WithContext(ctx).Where("credential_id = ?", credentialID).Delete(&model.Attachment{}).Error
+}
+
+func (r *AttachmentRepository) DeleteByVaultID(ctx context.Context, vaultID int64) error {
+	return r.db.WithContext(ctx).Where("vault_id = ?", vaultID).Delete(&model.Attachment{}).Error
+}
+
+// SumSizeByTenantID returns the bytes of attachments a tenant stores
+func (r *AttachmentRepository) SumSizeByTenantID(ctx context.Context, tenantID int64) (int64, error) {
+	var total int64
+	err := r.db.WithContext(ctx).Model(&model.Attachment{}).
+		Where("tenant_id = ?", tenantID).
+		Select("COALESCE(SUM(size), 0)").
+		Scan(&total).Error
+	return total, err
+}
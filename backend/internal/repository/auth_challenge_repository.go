@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/askuy/passwordx/backend/internal/model"
+)
+
+type AuthChallengeRepository struct {
+	db *gorm.DB
+}
+
+func NewAuthChallengeRepository(db *gorm.DB) *AuthChallengeRepository {
+	return &AuthChallengeRepository{db: db}
+}
+
+func (r *AuthChallengeRepository) Create(ctx context.Context, challenge *model.AuthChallenge) error {
+	return r.db.WithContext(ctx).Create(challenge).Error
+}
+
+// Consume loads an unexpired challenge and deletes it, so each challenge can
+// be answered at most once even under concurrent requests
+func (r *AuthChallengeRepository) Consume(ctx context.Context, id, purpose string) (*model.AuthChallenge, error) {
+	var challenge model.AuthChallenge
+	err := r.db.WithContext(ctx).
+		Where("id = ? AND purpose = ? AND expires_at > ?", id, purpose, time.Now()).
+		First(&challenge).Error
+	if err != nil {
+		return nil, err
+	}
+
+	result := r.db.WithContext(ctx).Where("id = ?", id).Delete(&model.AuthChallenge{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &challenge, nil
+}
+
+// Get loads an unexpired challenge without consuming it, for flows that
+// allow a few wrong answers
+func (r *AuthChallengeRepository) Get(ctx context.Context, id, purpose string) (*model.AuthChallenge, error) {
+	var challenge model.AuthChallenge
+	err := r.db.WithContext(ctx).
+		Where("id = ? AND purpose = ? AND expires_at > ?", id, purpose, time.Now()).
+		First(&challenge).Error
+	if err != nil {
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+// RecordFailure counts a wrong answer and deletes the challenge once it has
+// been answered wrongly maxAttempts times
+func (r *AuthChallengeRepository) RecordFailure(ctx context.Context, id string, maxAttempts int) error {
+	err := r.db.WithContext(ctx).Model(&model.AuthChallenge{}).
+		Where("id = ?", id).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1")).Error
+	if err != nil {
+		return err
+	}
+	return r.db.WithContext(ctx).Where("id = ? AND attempts >= ?", id, maxAttempts).Delete(&model.AuthChallenge{}).Error
+}
+
+// DeleteByUserID removes the user's unanswered challenges, such as pending
+// two-factor logins and reset tokens
+func (r *AuthChallengeRepository) DeleteByUserID(ctx context.Context, userID int64) error {
+	return r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&model.AuthChallenge{}).Error
+}
+
+// DeleteExpired removes challenges that can no longer be answered
+func (r *AuthChallengeRepository) DeleteExpired(ctx context.Context) error {
+	return r.db.WithContext(ctx).Where("expires_at <= ?", time.Now()).Delete(&model.AuthChallenge{}).Error
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/askuy/passwordx/backend/internal/model"
+)
+
+type CredentialMetadataRepository struct {
+	db *gorm.DB
+}
+
+func NewCredentialMetadataRepository(db *gorm.DB) *CredentialMetadataRepository {
+	return &CredentialMetadataRepository{db: db}
+}
+
+// upsert inserts the user's metadata for a credential or, if there is some
+// already, applies updates to it
+func (r *CredentialMetadataRepository) upsert(ctx context.Context, metadata *model.CredentialMetadata, updates map[string]interface{}) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "credential_id"}},
+		DoUpdates: clause.Assignments(updates),
+	}).Create(metadata).Error
+}
+
+func (r *CredentialMetadataRepository) Get(ctx context.Context, userID, credentialID int64) (*model.CredentialMetadata, error) {
+	var metadata model.CredentialMetadata
+	err := r.db.WithContext(ctx).Where("user_id = ? AND credential_id = ?", userID, credentialID).First(&metadata).Error
+	if err != nil {
+		return nil, err
+	}
+	return &metadata, nil
+}
+
+func (r *CredentialMetadataRepository) SetFavorite(ctx context.Context, userID, credentialID int64, favorite bool) error {
+	return r.upsert(ctx,
+		&model.CredentialMetadata{UserID: userID, CredentialID: credentialID, Favorite: favorite},
+		map[string]interface{}{"favorite": favorite, "updated_at": time.Now()})
+}
+
+// RecordUse counts a use of the credential at the given time, and a fill too
+// if filled is set
+func (r *CredentialMetadataRepository) RecordUse(ctx context.Context, userID, credentialID int64, filled bool, at time.Time) error {
+	metadata := &model.CredentialMetadata{UserID: userID, CredentialID: credentialID, UseCount: 1, LastUsedAt: &at}
+	updates := map[string]interface{}{
+		"use_count":    gorm.Expr("use_count + 1"),
+		"last_used_at": at,
+		"updated_at":   time.Now(),
+	}
+	if filled {
+		metadata.FillCount = 1
+		metadata.LastFilledAt = &at
+		updates["fill_count"] = gorm.Expr("fill_count + 1")
+		updates["last_filled_at"] = at
+	}
+	return r.upsert(ctx, metadata, updates)
+}
+
+// ListByCredentialIDs returns the user's metadata for the given credentials
+func (r *CredentialMetadataRepository) ListByCredentialIDs(ctx context.Context, userID int64, credentialIDs []int64) ([]model.CredentialMetadata, error) {
+	var metadata []model.CredentialMetadata
+	err := r.db.WithContext(ctx).Where("user_id = ? AND credential_id IN ?", userID, credentialIDs).Find(&metadata).Error
+	return metadata, err
+}
+
+// DeleteByCredentialID deletes every user's metadata for a credential
+func (r *CredentialMetadataRepository) DeleteByCredentialID(ctx context.Context, credentialID int64) error {
+	return r.db.WithContext(ctx).Where("credential_id = ?", credentialID).Delete(&model.CredentialMetadata{}).Error
+}
+
+// DeleteByVaultID deletes every user's metadata for the credentials of a vault
+func (r *CredentialMetadataRepository) DeleteByVaultID(ctx context.Context, vaultID int64) error {
+	return r.db.WithContext(ctx).
+		Where("credential_id IN (?)", r.db.Unscoped().Model(&model.Credential{}).Select("id").Where("vault_id = ?", vaultID)).
+		Delete(&model.CredentialMetadata{}).Error
+}
@@ -2,8 +2,11 @@ package repository
 
 import (
 	"context"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/askuy/passwordx/backend/internal/model"
 )
@@ -16,52 +19,339 @@ func NewCredentialRepository(db *gorm.DB) *CredentialRepository {
 	return &CredentialRepository{db: db}
 }
 
+// withCustomFields preloads the custom fields of credentials in display
+// order and their attachments
+func withCustomFields(db *gorm.DB) *gorm.DB {
+	return db.Preload("CustomFields", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position")
+	}).Preload("Attachments", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	})
+}
+
 func (r *CredentialRepository) Create(ctx context.Context, credential *model.Credential) error {
 	return r.db.WithContext(ctx).Create(credential).Error
 }
 
 func (r *CredentialRepository) GetByID(ctx context.Context, id int64) (*model.Credential, error) {
 	var credential model.Credential
-	err := r.db.WithContext(ctx).First(&credential, id).Error
+	err := withCustomFields(r.db.WithContext(ctx)).First(&credential, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
+
+// GetForUpdate loads a credential and locks its row until the transaction ends
+func (r *CredentialRepository) GetForUpdate(ctx context.Context, id int64) (*model.Credential, error) {
+	var credential model.Credential
+	err := r.db.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&credential, id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &credential, nil
 }
 
+// Update saves the credential and replaces its custom fields with
+// credential.CustomFields, positioned in slice order, and its search tokens
+// with credential.SearchTokens unless that is nil. Attachments are left
+// alone, see AttachmentRepository.UpdateKeys.
 func (r *CredentialRepository) Update(ctx context.Context, credential *model.Credential) error {
-	return r.db.WithContext(ctx).Save(credential).Error
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("CustomFields", "Attachments", "SearchTokens").Save(credential).Error; err != nil {
+			return err
+		}
+		if credential.SearchTokens != nil {
+			if err := replaceSearchTokens(tx, credential.ID, credential.SearchTokens); err != nil {
+				return err
+			}
+		}
+
+		keep := make([]int64, 0, len(credential.CustomFields))
+		for i := range credential.CustomFields {
+			credential.CustomFields[i].CredentialID = credential.ID
+			credential.CustomFields[i].Position = i
+			if credential.CustomFields[i].ID != 0 {
+				keep = append(keep, credential.CustomFields[i].ID)
+			}
+		}
+		stale := tx.Where("credential_id = ?", credential.ID)
+		if len(keep) > 0 {
+			stale = stale.Where("id NOT IN ?", keep)
+		}
+		if err := stale.Delete(&model.CredentialField{}).Error; err != nil {
+			return err
+		}
+		if len(credential.CustomFields) == 0 {
+			return nil
+		}
+		return tx.Save(&credential.CustomFields).Error
+	})
 }
 
+// replaceSearchTokens replaces the search tokens of a credential
+func replaceSearchTokens(tx *gorm.DB, credentialID int64, tokens []model.CredentialSearchToken) error {
+	if err := tx.Where("credential_id = ?", credentialID).Delete(&model.CredentialSearchToken{}).Error; err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return nil
+	}
+	for i := range tokens {
+		tokens[i].ID = 0
+		tokens[i].CredentialID = credentialID
+	}
+	return tx.Create(&tokens).Error
+}
+
+// Delete moves a credential to the trash. Its custom fields, search tokens,
+// revisions and attachments stay until it is deleted permanently.
 func (r *CredentialRepository) Delete(ctx context.Context, id int64) error {
 	return r.db.WithContext(ctx).Delete(&model.Credential{}, id).Error
 }
 
+// DeletePermanently deletes a credential in the trash, its custom fields and
+// its search tokens.
+// It returns false if the credential is not in the trash, for instance
+// because it was restored in the meantime.
+func (r *CredentialRepository) DeletePermanently(ctx context.Context, id int64) (bool, error) {
+	deleted := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Where("deleted_at IS NOT NULL").Delete(&model.Credential{}, id)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		deleted = true
+		if err := tx.Where("credential_id = ?", id).Delete(&model.CredentialSearchToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("credential_id = ?", id).Delete(&model.CredentialField{}).Error
+	})
+	return deleted, err
+}
+
+// DeleteByVaultID permanently deletes the credentials of a vault, including
+// those in the trash, and their custom fields and search tokens
+func (r *CredentialRepository) DeleteByVaultID(ctx context.Context, vaultID int64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		ids := tx.Unscoped().Model(&model.Credential{}).Select("id").Where("vault_id = ?", vaultID)
+		if err := tx.Where("credential_id IN (?)", ids).Delete(&model.CredentialSearchToken{}).Error; err != nil {
+			return err
+		}
+		err := tx.Where("credential_id IN (?)", ids).Delete(&model.CredentialField{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("vault_id = ?", vaultID).Delete(&model.Credential{}).Error
+	})
+}
+
+// GetTrashedByID returns a credential that is in the trash
+func (r *CredentialRepository) GetTrashedByID(ctx context.Context, id int64) (*model.Credential, error) {
+	var credential model.Credential
+	err := withCustomFields(r.db.WithContext(ctx).Unscoped()).
+		Where("deleted_at IS NOT NULL").
+		First(&credential, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
+
+// Restore takes a credential out of the trash
+func (r *CredentialRepository) Restore(ctx context.Context, id int64) error {
+	return r.db.WithContext(ctx).Unscoped().Model(&model.Credential{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Update("deleted_at", nil).Error
+}
+
+// ListTrashedByVaultID returns the credentials of a vault that are in the
+// trash, most recently deleted first
+func (r *CredentialRepository) ListTrashedByVaultID(ctx context.Context, vaultID int64) ([]model.Credential, error) {
+	var credentials []model.Credential
+	err := withCustomFields(r.db.WithContext(ctx).Unscoped()).
+		Where("vault_id = ? AND deleted_at IS NOT NULL", vaultID).
+		Order("deleted_at DESC").
+		Find(&credentials).Error
+	return credentials, err
+}
+
+// ListTrashedBefore returns the IDs of credentials moved to the trash before cutoff
+func (r *CredentialRepository) ListTrashedBefore(ctx context.Context, cutoff time.Time) ([]int64, error) {
+	var ids []int64
+	err := r.db.WithContext(ctx).Unscoped().Model(&model.Credential{}).
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
 func (r *CredentialRepository) ListByVaultID(ctx context.Context, vaultID int64) ([]model.Credential, error) {
 	var credentials []model.Credential
-	err := r.db.WithContext(ctx).Where("vault_id = ?", vaultID).Find(&credentials).Error
+	err := withCustomFields(r.db.WithContext(ctx)).Where("vault_id = ?", vaultID).Find(&credentials).Error
 	return credentials, err
 }
 
-func (r *CredentialRepository) ListByTenantID(ctx context.Context, tenantID int64) ([]model.Credential, error) {
+// ListByVaultIDWithTrash returns the credentials of a vault including those
+// in the trash, which must follow the vault through key rotations
+func (r *CredentialRepository) ListByVaultIDWithTrash(ctx context.Context, vaultID int64) ([]model.Credential, error) {
 	var credentials []model.Credential
-	err := r.db.WithContext(ctx).Where("tenant_id = ?", tenantID).Find(&credentials).Error
+	err := withCustomFields(r.db.WithContext(ctx).Unscoped()).Where("vault_id = ?", vaultID).Find(&credentials).Error
 	return credentials, err
 }
 
-// SearchByURL is deprecated - searching encrypted data doesn't work
-// This method now returns all credentials and filtering should be done client-side after decryption
-func (r *CredentialRepository) SearchByURL(ctx context.Context, tenantID int64, userID int64, urlPattern string) ([]model.Credential, error) {
-	// Since URL is encrypted, we cannot search on it server-side
-	// Return all credentials and let the client filter after decryption
-	return r.ListByUserVaults(ctx, tenantID, userID)
+func (r *CredentialRepository) CountByVaultID(ctx context.Context, vaultID int64) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&model.Credential{}).Where("vault_id = ?", vaultID).Count(&count).Error
+	return count, err
 }
 
-func (r *CredentialRepository) ListByUserVaults(ctx context.Context, tenantID int64, userID int64) ([]model.Credential, error) {
+func (r *CredentialRepository) ListByTenantID(ctx context.Context, tenantID int64) ([]model.Credential, error) {
 	var credentials []model.Credential
-	err := r.db.WithContext(ctx).
-		Joins("JOIN vault_members ON vault_members.vault_id = credentials.vault_id").
-		Where("credentials.tenant_id = ? AND vault_members.user_id = ?", tenantID, userID).
-		Find(&credentials).Error
+	err := withCustomFields(r.db.WithContext(ctx)).Where("tenant_id = ?", tenantID).Find(&credentials).Error
 	return credentials, err
 }
+
+// Orders a credential listing can be sorted in besides the default, by ID.
+// The metadata orders follow the requesting user's CredentialMetadata. A
+// leading "-" reverses any of them; ties go by ID.
+const (
+	CredentialSortCreated   = "created_at"
+	CredentialSortUpdated   = "updated_at"
+	CredentialSortMostUsed  = "most_used" // highest use count first
+	CredentialSortRecent    = "recent"    // most recently used first, never used last
+	CredentialSortFavorites = "favorites" // favorites first
+)
+
+// credentialSorting lists the sort keys of credential listings. The metadata
+// keys need credential_metadata joined and Credential.Metadata loaded.
+var credentialSorting = &sorting[model.Credential]{
+	id:   "credentials.id",
+	idOf: func(c *model.Credential) int64 { return c.ID },
+	keys: map[string]sortKey[model.Credential]{
+		"id": {},
+		CredentialSortCreated: {expr: "credentials.created_at", kind: keyTime, value: func(c *model.Credential) interface{} {
+			return c.CreatedAt
+		}},
+		CredentialSortUpdated: {expr: "credentials.updated_at", kind: keyTime, value: func(c *model.Credential) interface{} {
+			return c.UpdatedAt
+		}},
+		CredentialSortMostUsed: {expr: "COALESCE(credential_metadata.use_count, 0)", kind: keyInt, desc: true, value: func(c *model.Credential) interface{} {
+			return c.Metadata.UseCount
+		}},
+		// Microseconds since the epoch of the stored wall clock time, -1 if
+		// never used, which sorts the same as the time without depending on
+		// the connection's time zone
+		CredentialSortRecent: {expr: "COALESCE(TIMESTAMPDIFF(MICROSECOND, '1970-01-01', credential_metadata.last_used_at), -1)", kind: keyInt, desc: true, value: func(c *model.Credential) interface{} {
+			if c.Metadata.LastUsedAt == nil {
+				return int64(-1)
+			}
+			t := *c.Metadata.LastUsedAt
+			wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+			return wall.UnixMicro()
+		}},
+		CredentialSortFavorites: {expr: "COALESCE(credential_metadata.favorite, FALSE)", kind: keyInt, desc: true, value: func(c *model.Credential) interface{} {
+			return c.Metadata.Favorite
+		}},
+	},
+}
+
+// metadataSort reports whether a sort follows the user's CredentialMetadata
+func metadataSort(sort string) bool {
+	switch strings.TrimPrefix(sort, "-") {
+	case CredentialSortMostUsed, CredentialSortRecent, CredentialSortFavorites:
+		return true
+	}
+	return false
+}
+
+// CredentialFilter narrows a listing by vault, category, update time and the
+// user's own folders and tags, and orders it. Zero fields do not filter.
+type CredentialFilter struct {
+	VaultID      int64
+	Category     string
+	UpdatedSince time.Time  // updated at or after
+	FolderIDs    []int64    // filed in any of these folders
+	Unfiled      bool       // filed in none of the user's folders
+	TagIDs       []int64    // carrying every one of these tags
+	Terms        [][]string // carrying, for every term, one of its search tokens
+	Autofill     bool       // leaving out credentials that are never filled automatically
+	Sort         string     // one of the CredentialSort orders, empty for by ID
+}
+
+// apply adds the filter's conditions for the given user to a credential query
+func (f *CredentialFilter) apply(db *gorm.DB, userID int64) *gorm.DB {
+	if f == nil {
+		return db
+	}
+	if f.VaultID != 0 {
+		db = db.Where("credentials.vault_id = ?", f.VaultID)
+	}
+	if f.Category != "" {
+		db = db.Where("credentials.category = ?", f.Category)
+	}
+	if !f.UpdatedSince.IsZero() {
+		db = db.Where("credentials.updated_at >= ?", f.UpdatedSince)
+	}
+	if len(f.FolderIDs) > 0 {
+		db = db.Where("credentials.id IN (?)", db.Session(&gorm.Session{NewDB: true}).Model(&model.CredentialFolder{}).
+			Select("credential_id").Where("user_id = ? AND folder_id IN ?", userID, f.FolderIDs))
+	}
+	if f.Unfiled {
+		db = db.Where("credentials.id NOT IN (?)", db.Session(&gorm.Session{NewDB: true}).Model(&model.CredentialFolder{}).
+			Select("credential_id").Where("user_id = ?", userID))
+	}
+	if len(f.TagIDs) > 0 {
+		db = db.Where("credentials.id IN (?)", db.Session(&gorm.Session{NewDB: true}).Model(&model.CredentialTag{}).
+			Select("credential_id").Where("user_id = ? AND tag_id IN ?", userID, f.TagIDs).
+			Group("credential_id").Having("COUNT(*) = ?", len(f.TagIDs)))
+	}
+	if f.Autofill {
+		db = db.Where("credentials.match_mode <> ?", "never")
+	}
+	for _, tokens := range f.Terms {
+		db = db.Where("credentials.id IN (?)", db.Session(&gorm.Session{NewDB: true}).Model(&model.CredentialSearchToken{}).
+			Select("credential_id").Where("token IN ?", tokens))
+	}
+	return db
+}
+
+// ListByUserVaults returns a page of the credentials in the vaults the user
+// is a member of that match filter, which may be nil, in the order it asks
+// for, and the cursor of the next page
+func (r *CredentialRepository) ListByUserVaults(ctx context.Context, tenantID int64, userID int64, filter *CredentialFilter, page Page) ([]model.Credential, string, error) {
+	sort := ""
+	if filter != nil {
+		sort = filter.Sort
+	}
+	key, err := credentialSorting.key(sort)
+	if err != nil {
+		return nil, "", err
+	}
+
+	db := withCustomFields(r.db.WithContext(ctx)).
+		Joins("JOIN vault_members ON vault_members.vault_id = credentials.vault_id").
+		Joins("JOIN vaults ON vaults.id = credentials.vault_id AND vaults.deleted_at IS NULL").
+		Where("credentials.tenant_id = ? AND vault_members.user_id = ?", tenantID, userID)
+	if metadataSort(sort) {
+		db = db.Joins("LEFT JOIN credential_metadata ON credential_metadata.credential_id = credentials.id AND credential_metadata.user_id = ?", userID)
+	}
+	credentials, more, err := paginate(filter.apply(db, userID), key, page)
+	if err != nil || !more {
+		return credentials, "", err
+	}
+
+	last := &credentials[len(credentials)-1]
+	if metadataSort(sort) {
+		var metadata model.CredentialMetadata
+		err := r.db.WithContext(ctx).
+			Where("user_id = ? AND credential_id = ?", userID, last.ID).
+			Limit(1).Find(&metadata).Error
+		if err != nil {
+			return nil, "", err
+		}
+		last.Metadata = &metadata
+	}
+	return credentials, key.cursor(last), nil
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/askuy/passwordx/backend/internal/model"
+)
+
+type CredentialRevisionRepository struct {
+	db *gorm.DB
+}
+
+func NewCredentialRevisionRepository(db *gorm.DB) *CredentialRevisionRepository {
+	return &CredentialRevisionRepository{db: db}
+}
+
+// Create stores a revision numbered after the credential's latest one
+func (r *CredentialRevisionRepository) Create(ctx context.Context, revision *model.CredentialRevision) error {
+	var latest int
+	err := r.db.WithContext(ctx).Model(&model.CredentialRevision{}).
+		Where("credential_id = ?", revision.CredentialID).
+		Select("COALESCE(MAX(revision), 0)").
+		Scan(&latest).Error
+	if err != nil {
+		return err
+	}
+	revision.Revision = latest + 1
+	return r.db.WithContext(ctx).Create(revision).Error
+}
+
+func (r *CredentialRevisionRepository) Get(ctx context.Context, credentialID int64, revision int) (*model.CredentialRevision, error) {
+	var rev model.CredentialRevision
+	err := r.db.WithContext(ctx).Where("credential_id = ? AND revision = ?", credentialID, revision).First(&rev).Error
+	if err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
+
+// ListByCredentialID returns the revisions of a credential, newest first
+func (r *CredentialRevisionRepository) ListByCredentialID(ctx context.Context, credentialID int64) ([]model.CredentialRevision, error) {
+	var revisions []model.CredentialRevision
+	err := r.db.WithContext(ctx).Where("credential_id = ?", credentialID).Order("revision DESC").Find(&revisions).Error
+	return revisions, err
+}
+
+func (r *CredentialRevisionRepository) Update(ctx context.Context, revision *model.CredentialRevision) error {
+	return r.db.WithContext(ctx).Save(revision).Error
+}
+
+// Prune deletes all but the newest keep revisions of a credential
+func (r *CredentialRevisionRepository) Prune(ctx context.Context, credentialID int64, keep int) error {
+	var oldest []int
+	err := r.db.WithContext(ctx).Model(&model.CredentialRevision{}).
+		Where("credential_id = ?", credentialID).
+		Order("revision DESC").
+		Offset(keep-1).
+		Limit(1).
+		Pluck("revision", &oldest).Error
+	if err != nil || len(oldest) == 0 {
+		return err
+	}
+	return r.db.WithContext(ctx).
+		Where("credential_id = ? AND revision < ?", credentialID, oldest[0]).
+		Delete(&model.CredentialRevision{}).Error
+}
+
+func (r *CredentialRevisionRepository) DeleteByCredentialID(ctx context.Context, credentialID int64) error {
+	return r.db.WithContext(ctx).Where("credential_id = ?", credentialID).Delete(&model.CredentialRevision{}).Error
+}
+
+func (r *CredentialRevisionRepository) DeleteByVaultID(ctx context.Context, vaultID int64) error {
+	return r.db.WithContext(ctx).Where("vault_id = ?", vaultID).Delete(&model.CredentialRevision{}).Error
+}
@@ -39,6 +39,26 @@ func InitDB() *gorm.DB {
 		&model.Vault{},
 		&model.VaultMember{},
 		&model.Credential{},
+		&model.CredentialField{},
+		&model.CredentialSearchToken{},
+		&model.CredentialRevision{},
+		&model.Attachment{},
+		&model.Folder{},
+		&model.Tag{},
+		&model.CredentialFolder{},
+		&model.CredentialTag{},
+		&model.CredentialMetadata{},
+		&model.EquivalentDomainGroup{},
+		&model.AuthChallenge{},
+		&model.RecoveryKey{},
+		&model.TwoFactorRecoveryCode{},
+		&model.WebAuthnCredential{},
+		&model.EscrowShare{},
+		&model.UserEscrow{},
+		&model.EscrowRequest{},
+		&model.EscrowApproval{},
+		&model.EscrowChange{},
+		&model.EscrowChangeApproval{},
 	); err != nil {
 		elog.Panic("failed to migrate database", elog.FieldErr(err))
 	}
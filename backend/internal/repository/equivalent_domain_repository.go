@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/askuy/passwordx/backend/internal/model"
+)
+
+type EquivalentDomainRepository struct {
+	db *gorm.DB
+}
+
+func NewEquivalentDomainRepository(db *gorm.DB) *EquivalentDomainRepository {
+	return &EquivalentDomainRepository{db: db}
+}
+
+func (r *EquivalentDomainRepository) Create(ctx context.Context, group *model.EquivalentDomainGroup) error {
+	return r.db.WithContext(ctx).Create(group).Error
+}
+
+func (r *EquivalentDomainRepository) GetByID(ctx context.Context, id int64) (*model.EquivalentDomainGroup, error) {
+	var group model.EquivalentDomainGroup
+	err := r.db.WithContext(ctx).First(&group, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+func (r *EquivalentDomainRepository) Update(ctx context.Context, group *model.EquivalentDomainGroup) error {
+	return r.db.WithContext(ctx).Save(group).Error
+}
+
+func (r *EquivalentDomainRepository) Delete(ctx context.Context, id int64) error {
+	return r.db.WithContext(ctx).Delete(&model.EquivalentDomainGroup{}, id).Error
+}
+
+// ListByOwner returns the groups of a user, or those of the tenant if userID is 0
+func (r *EquivalentDomainRepository) ListByOwner(ctx context.Context, tenantID, userID int64) ([]model.EquivalentDomainGroup, error) {
+	var groups []model.EquivalentDomainGroup
+	err := r.db.WithContext(ctx).Where("tenant_id = ? AND user_id = ?", tenantID, userID).Order("id").Find(&groups).Error
+	return groups, err
+}
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/askuy/passwordx/backend/internal/model"
+)
+
+// EscrowRepository stores the tenant escrow shares and the members' escrowed keys
+type EscrowRepository struct {
+	db *gorm.DB
+}
+
+func NewEscrowRepository(db *gorm.DB) *EscrowRepository {
+	return &EscrowRepository{db: db}
+}
+
+// ReplaceShares deletes the tenant's shares and escrowed keys and stores the
+// new shares. Escrowed keys are wrapped to the previous escrow key, so members
+// have to enroll again.
+func (r *EscrowRepository) ReplaceShares(ctx context.Context, tenantID int64, shares []model.EscrowShare) error {
+	if err := r.DeleteByTenantID(ctx, tenantID); err != nil {
+		return err
+	}
+	if len(shares) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Create(&shares).Error
+}
+
+// DeleteByTenantID removes all escrow material of a tenant
+func (r *EscrowRepository) DeleteByTenantID(ctx context.Context, tenantID int64) error {
+	if err := r.db.WithContext(ctx).Where("tenant_id = ?", tenantID).Delete(&model.EscrowShare{}).Error; err != nil {
+		return err
+	}
+	return r.db.WithContext(ctx).Where("tenant_id = ?", tenantID).Delete(&model.UserEscrow{}).Error
+}
+
+func (r *EscrowRepository) ListShares(ctx context.Context, tenantID int64) ([]model.EscrowShare, error) {
+	var shares []model.EscrowShare
+	err := r.db.WithContext(ctx).Where("tenant_id = ?", tenantID).Find(&shares).Error
+	return shares, err
+}
+
+func (r *EscrowRepository) GetShare(ctx context.Context, tenantID, userID int64) (*model.EscrowShare, error) {
+	var share model.EscrowShare
+	err := r.db.WithContext(ctx).
+		Where("tenant_id = ? AND user_id = ?", tenantID, userID).
+		First(&share).Error
+	if err != nil {
+		return nil, err
+	}
+	return &share, nil
+}
+
+func (r *EscrowRepository) GetUserEscrow(ctx context.Context, userID int64) (*model.UserEscrow, error) {
+	var escrow model.UserEscrow
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&escrow).Error
+	if err != nil {
+		return nil, err
+	}
+	return &escrow, nil
+}
+
+// SaveUserEscrow creates or replaces a member's escrowed key
+func (r *EscrowRepository) SaveUserEscrow(ctx context.Context, escrow *model.UserEscrow) error {
+	existing, err := r.GetUserEscrow(ctx, escrow.UserID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if existing != nil {
+		escrow.ID = existing.ID
+		escrow.CreatedAt = existing.CreatedAt
+	}
+	return r.db.WithContext(ctx).Save(escrow).Error
+}
+
+func (r *EscrowRepository) DeleteUserEscrow(ctx context.Context, userID int64) error {
+	return r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&model.UserEscrow{}).Error
+}
+
+func (r *EscrowRepository) CreateChange(ctx context.Context, change *model.EscrowChange) error {
+	return r.db.WithContext(ctx).Create(change).Error
+}
+
+// GetChangeForUpdate loads a change and locks its row until the transaction ends
+func (r *EscrowRepository) GetChangeForUpdate(ctx context.Context, id int64) (*model.EscrowChange, error) {
+	var change model.EscrowChange
+	err := r.db.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Preload("Approvals").
+		First(&change, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &change, nil
+}
+
+// GetPendingChange returns the tenant's pending change
+func (r *EscrowRepository) GetPendingChange(ctx context.Context, tenantID int64) (*model.EscrowChange, error) {
+	var change model.EscrowChange
+	err := r.db.WithContext(ctx).
+		Preload("Approvals").
+		Where("tenant_id = ? AND status = ?", tenantID, model.EscrowChangePending).
+		First(&change).Error
+	if err != nil {
+		return nil, err
+	}
+	return &change, nil
+}
+
+func (r *EscrowRepository) UpdateChange(ctx context.Context, change *model.EscrowChange) error {
+	return r.db.WithContext(ctx).Omit("Approvals").Save(change).Error
+}
+
+func (r *EscrowRepository) CreateChangeApproval(ctx context.Context, approval *model.EscrowChangeApproval) error {
+	return r.db.WithContext(ctx).Create(approval).Error
+}
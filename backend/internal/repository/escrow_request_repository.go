@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/askuy/passwordx/backend/internal/model"
+)
+
+type EscrowRequestRepository struct {
+	db *gorm.DB
+}
+
+func NewEscrowRequestRepository(db *gorm.DB) *EscrowRequestRepository {
+	return &EscrowRequestRepository{db: db}
+}
+
+func (r *EscrowRequestRepository) Create(ctx context.Context, request *model.EscrowRequest) error {
+	return r.db.WithContext(ctx).Create(request).Error
+}
+
+func (r *EscrowRequestRepository) GetByID(ctx context.Context, id int64) (*model.EscrowRequest, error) {
+	var request model.EscrowRequest
+	err := r.db.WithContext(ctx).Preload("Approvals").First(&request, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// GetForUpdate loads a request and locks its row until the transaction ends
+func (r *EscrowRequestRepository) GetForUpdate(ctx context.Context, id int64) (*model.EscrowRequest, error) {
+	var request model.EscrowRequest
+	err := r.db.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Preload("Approvals").
+		First(&request, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+func (r *EscrowRequestRepository) Update(ctx context.Context, request *model.EscrowRequest) error {
+	return r.db.WithContext(ctx).Omit("Approvals").Save(request).Error
+}
+
+func (r *EscrowRequestRepository) ListByTenantID(ctx context.Context, tenantID int64) ([]model.EscrowRequest, error) {
+	var requests []model.EscrowRequest
+	err := r.db.WithContext(ctx).
+		Where("tenant_id = ?", tenantID).
+		Order("created_at DESC").
+		Find(&requests).Error
+	return requests, err
+}
+
+// HasOpen reports whether a pending or approved request exists for the user
+func (r *EscrowRequestRepository) HasOpen(ctx context.Context, userID int64) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Model(&model.EscrowRequest{}).
+		Where("user_id = ? AND status IN ?", userID, []string{model.EscrowRequestPending, model.EscrowRequestApproved}).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// CancelOpenByTenantID cancels every open request of a tenant, e.g. when the
+// escrow key is replaced and the released shares become useless
+func (r *EscrowRequestRepository) CancelOpenByTenantID(ctx context.Context, tenantID int64) error {
+	return r.db.WithContext(ctx).
+		Model(&model.EscrowRequest{}).
+		Where("tenant_id = ? AND status IN ?", tenantID, []string{model.EscrowRequestPending, model.EscrowRequestApproved}).
+		Update("status", model.EscrowRequestCancelled).Error
+}
+
+func (r *EscrowRequestRepository) CreateApproval(ctx context.Context, approval *model.EscrowApproval) error {
+	return r.db.WithContext(ctx).Create(approval).Error
+}
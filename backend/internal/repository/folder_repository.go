@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/askuy/passwordx/backend/internal/model"
+)
+
+type FolderRepository struct {
+	db *gorm.DB
+}
+
+func NewFolderRepository(db *gorm.DB) *FolderRepository {
+	return &FolderRepository{db: db}
+}
+
+func (r *FolderRepository) Create(ctx context.Context, folder *model.Folder) error {
+	return r.db.WithContext(ctx).Create(folder).Error
+}
+
+func (r *FolderRepository) GetByID(ctx context.Context, id int64) (*model.Folder, error) {
+	var folder model.Folder
+	err := r.db.WithContext(ctx).First(&folder, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+func (r *FolderRepository) ExistsByFolderID(ctx context.Context, folderID string) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&model.Folder{}).Where("folder_id = ?", folderID).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *FolderRepository) Update(ctx context.Context, folder *model.Folder) error {
+	return r.db.WithContext(ctx).Save(folder).Error
+}
+
+func (r *FolderRepository) ListByUserID(ctx context.Context, userID int64) ([]model.Folder, error) {
+	var folders []model.Folder
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("id").Find(&folders).Error
+	return folders, err
+}
+
+// Delete deletes folders and takes the credentials filed in them out
+func (r *FolderRepository) Delete(ctx context.Context, ids []int64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("folder_id IN ?", ids).Delete(&model.CredentialFolder{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id IN ?", ids).Delete(&model.Folder{}).Error
+	})
+}
+
+// SetCredentialFolder files a credential in a folder of the user, replacing
+// the folder it was in
+func (r *FolderRepository) SetCredentialFolder(ctx context.Context, userID, credentialID, folderID int64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND credential_id = ?", userID, credentialID).Delete(&model.CredentialFolder{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.CredentialFolder{UserID: userID, CredentialID: credentialID, FolderID: folderID}).Error
+	})
+}
+
+// ClearCredentialFolder takes a credential out of the user's folders
+func (r *FolderRepository) ClearCredentialFolder(ctx context.Context, userID, credentialID int64) error {
+	return r.db.WithContext(ctx).Where("user_id = ? AND credential_id = ?", userID, credentialID).Delete(&model.CredentialFolder{}).Error
+}
+
+// ListCredentialFolders returns where the user filed the given credentials
+func (r *FolderRepository) ListCredentialFolders(ctx context.Context, userID int64, credentialIDs []int64) ([]model.CredentialFolder, error) {
+	var assignments []model.CredentialFolder
+	err := r.db.WithContext(ctx).Where("user_id = ? AND credential_id IN ?", userID, credentialIDs).Find(&assignments).Error
+	return assignments, err
+}
+
+// DeleteByCredentialID takes a credential out of every user's folders
+func (r *FolderRepository) DeleteByCredentialID(ctx context.Context, credentialID int64) error {
+	return r.db.WithContext(ctx).Where("credential_id = ?", credentialID).Delete(&model.CredentialFolder{}).Error
+}
+
+// DeleteByVaultID takes the credentials of a vault out of every user's folders
+func (r *FolderRepository) DeleteByVaultID(ctx context.Context, vaultID int64) error {
+	return r.db.WithContext(ctx).
+		Where("credential_id IN (?)", r.db.Unscoped().Model(&model.Credential{}).Select("id").Where("vault_id = ?", vaultID)).
+		Delete(&model.CredentialFolder{}).Error
+}
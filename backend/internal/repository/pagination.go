@@ -0,0 +1,179 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Page sizes of the paginated listings
+const (
+	DefaultPageLimit = 100
+	MaxPageLimit     = 500
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidSort   = errors.New("invalid sort")
+)
+
+// Page asks for one page of a listing: up to Limit rows after the row Cursor
+// points at. Listings are keyset paginated on their sort key and then on the
+// row ID, so pages neither skip nor repeat rows added or removed in between.
+type Page struct {
+	Limit  int    // DefaultPageLimit if zero, at most MaxPageLimit
+	Cursor string // the next cursor of the previous page, empty for the first
+}
+
+func (p Page) limit() int {
+	switch {
+	case p.Limit <= 0:
+		return DefaultPageLimit
+	case p.Limit > MaxPageLimit:
+		return MaxPageLimit
+	}
+	return p.Limit
+}
+
+// keyKind is the type of a sort key's values
+type keyKind int
+
+const (
+	keyInt keyKind = iota
+	keyString
+	keyTime
+)
+
+// sortKey orders a listing by an expression and then by ID, both in the same
+// direction, so the order is total
+type sortKey[T any] struct {
+	name  string               // the sort as asked for, recorded in cursors
+	expr  string               // SQL expression, empty to order by ID alone
+	kind  keyKind              // type of expr
+	desc  bool                 // descending
+	value func(*T) interface{} // value of expr for a row
+	id    string               // ID column
+	idOf  func(*T) int64       // ID of a row
+}
+
+// sorting lists the sorts a listing accepts by name
+type sorting[T any] struct {
+	id   string
+	idOf func(*T) int64
+	keys map[string]sortKey[T]
+}
+
+// key returns the sort key of a sort name. An empty name sorts by ID; a
+// leading "-" reverses the order.
+func (s *sorting[T]) key(name string) (sortKey[T], error) {
+	if name == "" {
+		name = "id"
+	}
+	desc := strings.HasPrefix(name, "-")
+	key, ok := s.keys[strings.TrimPrefix(name, "-")]
+	if !ok {
+		return key, ErrInvalidSort
+	}
+	if desc {
+		key.desc = !key.desc
+	}
+	key.name, key.id, key.idOf = name, s.id, s.idOf
+	return key, nil
+}
+
+// cursor points at the last row of a page
+type cursor struct {
+	Sort string `json:"s"`
+	Key  string `json:"k,omitempty"`
+	ID   int64  `json:"i"`
+}
+
+// cursor returns the cursor pointing at row
+func (k sortKey[T]) cursor(row *T) string {
+	c := cursor{Sort: k.name, ID: k.idOf(row)}
+	if k.expr != "" {
+		switch v := k.value(row).(type) {
+		case int64:
+			c.Key = strconv.FormatInt(v, 10)
+		case bool:
+			if v {
+				c.Key = "1"
+			} else {
+				c.Key = "0"
+			}
+		case time.Time:
+			c.Key = v.UTC().Format(time.RFC3339Nano)
+		case string:
+			c.Key = v
+		}
+	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// after narrows db to the rows following the one encoded points at
+func (k sortKey[T]) after(db *gorm.DB, encoded string) (*gorm.DB, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Sort != k.name {
+		return nil, ErrInvalidCursor
+	}
+
+	op := ">"
+	if k.desc {
+		op = "<"
+	}
+	if k.expr == "" {
+		return db.Where(k.id+" "+op+" ?", c.ID), nil
+	}
+
+	var value interface{}
+	switch k.kind {
+	case keyInt:
+		value, err = strconv.ParseInt(c.Key, 10, 64)
+	case keyTime:
+		value, err = time.Parse(time.RFC3339Nano, c.Key)
+	default:
+		value = c.Key
+	}
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return db.Where("("+k.expr+" "+op+" ? OR ("+k.expr+" = ? AND "+k.id+" "+op+" ?))", value, value, c.ID), nil
+}
+
+// paginate finds the page of the rows db selects in the order of key. It
+// reports whether more rows follow.
+func paginate[T any](db *gorm.DB, key sortKey[T], page Page) ([]T, bool, error) {
+	if page.Cursor != "" {
+		var err error
+		if db, err = key.after(db, page.Cursor); err != nil {
+			return nil, false, err
+		}
+	}
+	direction := ""
+	if key.desc {
+		direction = " DESC"
+	}
+	if key.expr != "" {
+		db = db.Order(key.expr + direction)
+	}
+
+	limit := page.limit()
+	rows := make([]T, 0)
+	if err := db.Order(key.id + direction).Limit(limit + 1).Find(&rows).Error; err != nil {
+		return nil, false, err
+	}
+	if len(rows) > limit {
+		return rows[:limit], true, nil
+	}
+	return rows, false, nil
+}
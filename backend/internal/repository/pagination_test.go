@@ -0,0 +1,276 @@
+package repository
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+
+	"github.com/askuy/passwordx/backend/internal/model"
+)
+
+// dryRun returns a database that renders statements without a server, and
+// a function returning the last query it rendered
+func dryRun(t *testing.T) (*gorm.DB, func() *gorm.Statement) {
+	t.Helper()
+	db, err := gorm.Open(mysql.New(mysql.Config{SkipInitializeWithVersion: true}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last *gorm.Statement
+	err = db.Callback().Query().After("gorm:query").Register("test:capture", func(tx *gorm.DB) {
+		last = tx.Statement
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, func() *gorm.Statement { return last }
+}
+
+// sortCase is a sort and the key value its cursor continues after, nil for
+// the sort by ID
+type sortCase struct {
+	sort string
+	want interface{}
+}
+
+// testCursors checks that the cursor of row, in both directions of every
+// sort, selects the rows after row in the order of the sort
+func testCursors[T any](t *testing.T, s *sorting[T], row *T, tests []sortCase) {
+	t.Helper()
+	for _, tt := range tests {
+		for _, name := range []string{tt.sort, "-" + tt.sort} {
+			t.Run(name, func(t *testing.T) {
+				key, err := s.key(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				db, last := dryRun(t)
+				if _, _, err := paginate(db.Model(new(T)), key, Page{Limit: 2, Cursor: key.cursor(row)}); err != nil {
+					t.Fatal(err)
+				}
+				stmt := last()
+
+				want := []interface{}{s.idOf(row)}
+				if tt.want != nil {
+					want = []interface{}{tt.want, tt.want, s.idOf(row)}
+				}
+				if !equalVars(stmt.Vars, want) {
+					t.Errorf("Vars = %v, want %v", stmt.Vars, want)
+				}
+
+				op, direction := ">", ""
+				if key.desc {
+					op, direction = "<", " DESC"
+				}
+				sql := stmt.SQL.String()
+				order := "ORDER BY " + s.id + direction + " LIMIT 3"
+				if key.expr != "" {
+					order = "ORDER BY " + key.expr + direction + "," + s.id + direction + " LIMIT 3"
+				}
+				if !strings.Contains(sql, s.id+" "+op+" ?") || !strings.HasSuffix(sql, order) {
+					t.Errorf("SQL = %s, want rows %s the cursor, %s", sql, op, order)
+				}
+			})
+		}
+	}
+}
+
+// testAllSorts fails if a sort of s has no case in tests
+func testAllSorts[T any](t *testing.T, s *sorting[T], tests []sortCase) {
+	t.Helper()
+	covered := make(map[string]bool)
+	for _, tt := range tests {
+		covered[tt.sort] = true
+	}
+	for name := range s.keys {
+		if !covered[name] {
+			t.Errorf("sort %q is not tested", name)
+		}
+	}
+}
+
+func equalVars(got, want []interface{}) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if g, ok := got[i].(time.Time); ok {
+			if w, ok := want[i].(time.Time); !ok || !g.Equal(w) {
+				return false
+			}
+			continue
+		}
+		if !reflect.DeepEqual(got[i], want[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// at is a time with sub-millisecond digits outside UTC, which cursors keep
+var at = time.Date(2024, 3, 5, 10, 20, 30, 123456789, time.FixedZone("CET", 3600))
+
+func TestVaultCursors(t *testing.T) {
+	row := &model.Vault{ID: 7, Name: `Team "ops" ✓`, CreatedAt: at, UpdatedAt: at.Add(time.Hour)}
+	tests := []sortCase{
+		{"id", nil},
+		{"name", row.Name},
+		{"created_at", at},
+		{"updated_at", at.Add(time.Hour)},
+	}
+	testAllSorts(t, vaultSorting, tests)
+	testCursors(t, vaultSorting, row, tests)
+}
+
+func TestTenantCursors(t *testing.T) {
+	row := &model.Tenant{ID: 7, Name: "Acme, Inc.", CreatedAt: at}
+	tests := []sortCase{
+		{"id", nil},
+		{"name", row.Name},
+		{"created_at", at},
+	}
+	testAllSorts(t, tenantSorting, tests)
+	testCursors(t, tenantSorting, row, tests)
+}
+
+func TestUserCursors(t *testing.T) {
+	row := &model.User{ID: 7, Email: "alice+vault@example.com", Name: "Alice", CreatedAt: at}
+	tests := []sortCase{
+		{"id", nil},
+		{"email", row.Email},
+		{"name", row.Name},
+		{"created_at", at},
+	}
+	testAllSorts(t, userSorting, tests)
+	testCursors(t, userSorting, row, tests)
+}
+
+func TestCredentialCursors(t *testing.T) {
+	lastUsed := at
+	row := &model.Credential{
+		ID:        7,
+		CreatedAt: at,
+		UpdatedAt: at.Add(time.Hour),
+		Metadata:  &model.CredentialMetadata{Favorite: true, UseCount: 42, LastUsedAt: &lastUsed},
+	}
+	// The stored wall clock time, read as UTC
+	wall := time.Date(2024, 3, 5, 10, 20, 30, 123456000, time.UTC).UnixMicro()
+	tests := []sortCase{
+		{"id", nil},
+		{CredentialSortCreated, at},
+		{CredentialSortUpdated, at.Add(time.Hour)},
+		{CredentialSortMostUsed, int64(42)},
+		{CredentialSortRecent, wall},
+		{CredentialSortFavorites, int64(1)},
+	}
+	testAllSorts(t, credentialSorting, tests)
+	testCursors(t, credentialSorting, row, tests)
+
+	// Credentials the user never touched sort like their COALESCE defaults
+	unused := &model.Credential{ID: 8, Metadata: &model.CredentialMetadata{}}
+	testCursors(t, credentialSorting, unused, []sortCase{
+		{CredentialSortMostUsed, int64(0)},
+		{CredentialSortRecent, int64(-1)},
+		{CredentialSortFavorites, int64(0)},
+	})
+}
+
+func TestInvalidCursor(t *testing.T) {
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	row := &model.Credential{ID: 7, CreatedAt: at, Metadata: &model.CredentialMetadata{}}
+	created, err := credentialSorting.key(CredentialSortCreated)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		sort   string
+		cursor string
+	}{
+		{"not base64", CredentialSortCreated, "!!!"},
+		{"padded base64", CredentialSortCreated, base64.URLEncoding.EncodeToString([]byte(`{"s":"created_at","i":7}`))},
+		{"not JSON", CredentialSortCreated, encode("created_at:7")},
+		{"other sort", CredentialSortMostUsed, created.cursor(row)},
+		{"reversed sort", "-" + CredentialSortCreated, created.cursor(row)},
+		{"no sort", "id", encode(`{"i":7}`)},
+		{"bad integer key", CredentialSortMostUsed, encode(`{"s":"most_used","k":"many","i":7}`)},
+		{"bad time key", CredentialSortCreated, encode(`{"s":"created_at","k":"yesterday","i":7}`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := credentialSorting.key(tt.sort)
+			if err != nil {
+				t.Fatal(err)
+			}
+			db, _ := dryRun(t)
+			if _, _, err := paginate(db.Model(&model.Credential{}), key, Page{Cursor: tt.cursor}); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("paginate error = %v, want %v", err, ErrInvalidCursor)
+			}
+		})
+	}
+}
+
+func TestSortingKey(t *testing.T) {
+	tests := []struct {
+		sort     string
+		wantExpr string
+		wantDesc bool
+		wantErr  error
+	}{
+		{"", "", false, nil},
+		{"id", "", false, nil},
+		{"-id", "", true, nil},
+		{"name", "vaults.name", false, nil},
+		{"-name", "vaults.name", true, nil},
+		{"title", "", false, ErrInvalidSort},
+		{"--name", "", false, ErrInvalidSort},
+		{"Name", "", false, ErrInvalidSort},
+		{CredentialSortMostUsed, "", false, ErrInvalidSort},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Quote(tt.sort), func(t *testing.T) {
+			key, err := vaultSorting.key(tt.sort)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("key error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (key.expr != tt.wantExpr || key.desc != tt.wantDesc) {
+				t.Errorf("key = %q desc %v, want %q desc %v", key.expr, key.desc, tt.wantExpr, tt.wantDesc)
+			}
+		})
+	}
+
+	// Sorts that are descending by default reverse to ascending
+	key, err := credentialSorting.key("-" + CredentialSortMostUsed)
+	if err != nil || key.desc {
+		t.Errorf("-%s: desc %v, error %v, want ascending", CredentialSortMostUsed, key.desc, err)
+	}
+}
+
+func TestPageLimit(t *testing.T) {
+	tests := []struct {
+		limit int
+		want  int
+	}{
+		{0, DefaultPageLimit},
+		{-1, DefaultPageLimit},
+		{1, 1},
+		{MaxPageLimit, MaxPageLimit},
+		{MaxPageLimit + 1, MaxPageLimit},
+	}
+	for _, tt := range tests {
+		if got := (Page{Limit: tt.limit}).limit(); got != tt.want {
+			t.Errorf("Page{Limit: %d}.limit() = %d, want %d", tt.limit, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+
+	"github.com/askuy/passwordx/backend/internal/model"
+)
+
+type RecoveryKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewRecoveryKeyRepository(db *gorm.DB) *RecoveryKeyRepository {
+	return &RecoveryKeyRepository{db: db}
+}
+
+func (r *RecoveryKeyRepository) GetByUserID(ctx context.Context, userID int64) (*model.RecoveryKey, error) {
+	var key model.RecoveryKey
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&key).Error
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// Save creates or replaces the user's recovery key
+func (r *RecoveryKeyRepository) Save(ctx context.Context, key *model.RecoveryKey) error {
+	existing, err := r.GetByUserID(ctx, key.UserID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if existing != nil {
+		key.ID = existing.ID
+		key.CreatedAt = existing.CreatedAt
+	}
+	return r.db.WithContext(ctx).Save(key).Error
+}
+
+func (r *RecoveryKeyRepository) DeleteByUserID(ctx context.Context, userID int64) error {
+	return r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&model.RecoveryKey{}).Error
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/askuy/passwordx/backend/internal/model"
+)
+
+type TagRepository struct {
+	db *gorm.DB
+}
+
+func NewTagRepository(db *gorm.DB) *TagRepository {
+	return &TagRepository{db: db}
+}
+
+func (r *TagRepository) Create(ctx context.Context, tag *model.Tag) error {
+	return r.db.WithContext(ctx).Create(tag).Error
+}
+
+func (r *TagRepository) GetByID(ctx context.Context, id int64) (*model.Tag, error) {
+	var tag model.Tag
+	err := r.db.WithContext(ctx).First(&tag, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+func (r *TagRepository) ExistsByTagID(ctx context.Context, tagID string) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&model.Tag{}).Where("tag_id = ?", tagID).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *TagRepository) Update(ctx context.Context, tag *model.Tag) error {
+	return r.db.WithContext(ctx).Save(tag).Error
+}
+
+func (r *TagRepository) ListByUserID(ctx context.Context, userID int64) ([]model.Tag, error) {
+	var tags []model.Tag
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("id").Find(&tags).Error
+	return tags, err
+}
+
+// Delete deletes a tag and removes it from every credential
+func (r *TagRepository) Delete(ctx context.Context, id int64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("tag_id = ?", id).Delete(&model.CredentialTag{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.Tag{}, id).Error
+	})
+}
+
+// SetCredentialTags replaces the user's tags on a credential
+func (r *TagRepository) SetCredentialTags(ctx context.Context, userID, credentialID int64, tagIDs []int64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND credential_id = ?", userID, credentialID).Delete(&model.CredentialTag{}).Error; err != nil {
+			return err
+		}
+		if len(tagIDs) == 0 {
+			return nil
+		}
+		assignments := make([]model.CredentialTag, len(tagIDs))
+		for i, tagID := range tagIDs {
+			assignments[i] = model.CredentialTag{UserID: userID, CredentialID: credentialID, TagID: tagID}
+		}
+		return tx.Create(&assignments).Error
+	})
+}
+
+// ListCredentialTags returns the user's tags on the given credentials
+func (r *TagRepository) ListCredentialTags(ctx context.Context, userID int64, credentialIDs []int64) ([]model.CredentialTag, error) {
+	var assignments []model.CredentialTag
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND credential_id IN ?", userID, credentialIDs).
+		Order("tag_id").
+		Find(&assignments).Error
+	return assignments, err
+}
+
+// DeleteByCredentialID removes every user's tags from a credential
+func (r *TagRepository) DeleteByCredentialID(ctx context.Context, credentialID int64) error {
+	return r.db.WithContext(ctx).Where("credential_id = ?", credentialID).Delete(&model.CredentialTag{}).Error
+}
+
+// DeleteByVaultID removes every user's tags from the credentials of a vault
+func (r *TagRepository) DeleteByVaultID(ctx context.Context, vaultID int64) error {
+	return r.db.WithContext(ctx).
+		Where("credential_id IN (?)", r.db.Unscoped().Model(&model.Credential{}).Select("id").Where("vault_id = ?", vaultID)).
+		Delete(&model.CredentialTag{}).Error
+}
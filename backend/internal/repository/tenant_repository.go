@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/askuy/passwordx/backend/internal/model"
 )
@@ -29,6 +30,18 @@ func (r *TenantRepository) GetByID(ctx context.Context, id int64) (*model.Tenant
 	return &tenant, nil
 }
 
+// GetForUpdate loads a tenant and locks its row until the transaction ends
+func (r *TenantRepository) GetForUpdate(ctx context.Context, id int64) (*model.Tenant, error) {
+	var tenant model.Tenant
+	err := r.db.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&tenant, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &tenant, nil
+}
+
 func (r *TenantRepository) GetBySlug(ctx context.Context, slug string) (*model.Tenant, error) {
 	var tenant model.Tenant
 	err := r.db.WithContext(ctx).Where("slug = ?", slug).First(&tenant).Error
@@ -46,11 +59,32 @@ func (r *TenantRepository) Delete(ctx context.Context, id int64) error {
 	return r.db.WithContext(ctx).Delete(&model.Tenant{}, id).Error
 }
 
-func (r *TenantRepository) ListByUserID(ctx context.Context, userID int64) ([]model.Tenant, error) {
-	var tenants []model.Tenant
-	err := r.db.WithContext(ctx).
+// tenantSorting lists the sort keys of tenant listings
+var tenantSorting = &sorting[model.Tenant]{
+	id:   "tenants.id",
+	idOf: func(t *model.Tenant) int64 { return t.ID },
+	keys: map[string]sortKey[model.Tenant]{
+		"id":         {},
+		"name":       {expr: "tenants.name", kind: keyString, value: func(t *model.Tenant) interface{} { return t.Name }},
+		"created_at": {expr: "tenants.created_at", kind: keyTime, value: func(t *model.Tenant) interface{} { return t.CreatedAt }},
+	},
+}
+
+// ListByUserID returns a page of the user's tenants in the order sort asks
+// for, id, name or created_at, "-" first to reverse, and the cursor of the
+// next page
+func (r *TenantRepository) ListByUserID(ctx context.Context, userID int64, sort string, page Page) ([]model.Tenant, string, error) {
+	key, err := tenantSorting.key(sort)
+	if err != nil {
+		return nil, "", err
+	}
+
+	db := r.db.WithContext(ctx).
 		Joins("JOIN users ON users.tenant_id = tenants.id").
-		Where("users.id = ?", userID).
-		Find(&tenants).Error
-	return tenants, err
+		Where("users.id = ?", userID)
+	tenants, more, err := paginate(db, key, page)
+	if err != nil || !more {
+		return tenants, "", err
+	}
+	return tenants, key.cursor(&tenants[len(tenants)-1]), nil
 }
@@ -53,14 +53,14 @@ func (r *UserRepository) Update(ctx context.Context, user *model.User) error {
 	return r.db.WithContext(ctx).Save(user).Error
 }
 
-func (r *UserRepository) Delete(ctx context.Context, id int64) error {
-	return r.db.WithContext(ctx).Delete(&model.User{}, id).Error
+// Transaction runs fn inside a database transaction. Repositories that take part
+// in the transaction must be constructed from the tx handle passed to fn.
+func (r *UserRepository) Transaction(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	return r.db.WithContext(ctx).Transaction(fn)
 }
 
-func (r *UserRepository) ListByTenantID(ctx context.Context, tenantID int64) ([]model.User, error) {
-	var users []model.User
-	err := r.db.WithContext(ctx).Where("tenant_id = ?", tenantID).Find(&users).Error
-	return users, err
+func (r *UserRepository) Delete(ctx context.Context, id int64) error {
+	return r.db.WithContext(ctx).Delete(&model.User{}, id).Error
 }
 
 func (r *UserRepository) ExistsByEmail(ctx context.Context, email string) (bool, error) {
@@ -76,14 +76,74 @@ func (r *UserRepository) ListByRole(ctx context.Context, role string) ([]model.U
 	return users, err
 }
 
-// ListAll returns all users (for super admin)
-func (r *UserRepository) ListAll(ctx context.Context) ([]model.User, error) {
-	var users []model.User
-	err := r.db.WithContext(ctx).Find(&users).Error
-	return users, err
+// userSorting lists the sort keys of user listings
+var userSorting = &sorting[model.User]{
+	id:   "id",
+	idOf: func(u *model.User) int64 { return u.ID },
+	keys: map[string]sortKey[model.User]{
+		"id":         {},
+		"email":      {expr: "email", kind: keyString, value: func(u *model.User) interface{} { return u.Email }},
+		"name":       {expr: "name", kind: keyString, value: func(u *model.User) interface{} { return u.Name }},
+		"created_at": {expr: "created_at", kind: keyTime, value: func(u *model.User) interface{} { return u.CreatedAt }},
+	},
+}
+
+// UserFilter narrows a user listing and orders it. Zero fields do not filter.
+type UserFilter struct {
+	TenantID int64
+	Status   string
+	Role     string
+	Sort     string // id, email, name or created_at, "-" first to reverse
+}
+
+// List returns a page of the users matching filter, which may be nil, and
+// the cursor of the next page
+func (r *UserRepository) List(ctx context.Context, filter *UserFilter, page Page) ([]model.User, string, error) {
+	if filter == nil {
+		filter = &UserFilter{}
+	}
+	key, err := userSorting.key(filter.Sort)
+	if err != nil {
+		return nil, "", err
+	}
+
+	db := r.db.WithContext(ctx)
+	if filter.TenantID != 0 {
+		db = db.Where("tenant_id = ?", filter.TenantID)
+	}
+	if filter.Status != "" {
+		db = db.Where("status = ?", filter.Status)
+	}
+	if filter.Role != "" {
+		db = db.Where("role = ?", filter.Role)
+	}
+	users, more, err := paginate(db, key, page)
+	if err != nil || !more {
+		return users, "", err
+	}
+	return users, key.cursor(&users[len(users)-1]), nil
 }
 
 // UpdateStatus updates a user's status
 func (r *UserRepository) UpdateStatus(ctx context.Context, id int64, status string) error {
 	return r.db.WithContext(ctx).Model(&model.User{}).Where("id = ?", id).Update("status", status).Error
 }
+
+// AdvanceTwoFactorStep records step as the user's last accepted TOTP time
+// step. It reports false if that step or a later one was already used.
+func (r *UserRepository) AdvanceTwoFactorStep(ctx context.Context, id, step int64) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&model.User{}).
+		Where("id = ? AND two_factor_last_step < ?", id, step).
+		Update("two_factor_last_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// UpdateTwoFactor sets the user's two-factor state without touching the last
+// accepted time step
+func (r *UserRepository) UpdateTwoFactor(ctx context.Context, id int64, enabled bool, sealedSecret string) error {
+	return r.db.WithContext(ctx).Model(&model.User{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"two_factor_enabled": enabled, "two_factor_secret": sealedSecret}).Error
+}
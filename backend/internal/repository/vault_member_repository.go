@@ -20,9 +20,16 @@ func (r *VaultMemberRepository) Create(ctx context.Context, member *model.VaultM
 	return r.db.WithContext(ctx).Create(member).Error
 }
 
+// inLiveVaults limits a query to memberships of vaults that are not in the
+// trash, so access checks fail for everything inside a trashed vault
+func inLiveVaults(db *gorm.DB) *gorm.DB {
+	return db.Where("vault_id IN (?)", db.Session(&gorm.Session{NewDB: true}).Model(&model.Vault{}).Select("id"))
+}
+
 func (r *VaultMemberRepository) GetByVaultAndUser(ctx context.Context, vaultID, userID int64) (*model.VaultMember, error) {
 	var member model.VaultMember
 	err := r.db.WithContext(ctx).
+		Scopes(inLiveVaults).
 		Where("vault_id = ? AND user_id = ?", vaultID, userID).
 		First(&member).Error
 	if err != nil {
@@ -41,6 +48,11 @@ func (r *VaultMemberRepository) Delete(ctx context.Context, vaultID, userID int6
 		Delete(&model.VaultMember{}).Error
 }
 
+// DeleteByVaultID removes every member of a vault
+func (r *VaultMemberRepository) DeleteByVaultID(ctx context.Context, vaultID int64) error {
+	return r.db.WithContext(ctx).Where("vault_id = ?", vaultID).Delete(&model.VaultMember{}).Error
+}
+
 func (r *VaultMemberRepository) ListByVaultID(ctx context.Context, vaultID int64) ([]model.VaultMember, error) {
 	var members []model.VaultMember
 	err := r.db.WithContext(ctx).
@@ -54,6 +66,7 @@ func (r *VaultMemberRepository) HasAccess(ctx context.Context, vaultID, userID i
 	var count int64
 	err := r.db.WithContext(ctx).
 		Model(&model.VaultMember{}).
+		Scopes(inLiveVaults).
 		Where("vault_id = ? AND user_id = ?", vaultID, userID).
 		Count(&count).Error
 	return count > 0, err
@@ -63,7 +76,41 @@ func (r *VaultMemberRepository) HasRole(ctx context.Context, vaultID, userID int
 	var count int64
 	err := r.db.WithContext(ctx).
 		Model(&model.VaultMember{}).
+		Scopes(inLiveVaults).
 		Where("vault_id = ? AND user_id = ? AND role IN ?", vaultID, userID, roles).
 		Count(&count).Error
 	return count > 0, err
 }
+
+// CountLegacyByUserID counts memberships without a wrapped vault key. Credentials in
+// such vaults are still encrypted directly with the user's master key.
+func (r *VaultMemberRepository) CountLegacyByUserID(ctx context.Context, userID int64) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Model(&model.VaultMember{}).
+		Where("user_id = ? AND (encrypted_vault_key IS NULL OR encrypted_vault_key = '') AND key_revoked = ?", userID, false).
+		Count(&count).Error
+	return count, err
+}
+
+// ListLegacyByUserID returns memberships without a wrapped vault key
+func (r *VaultMemberRepository) ListLegacyByUserID(ctx context.Context, userID int64) ([]model.VaultMember, error) {
+	var members []model.VaultMember
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND (encrypted_vault_key IS NULL OR encrypted_vault_key = '') AND key_revoked = ?", userID, false).
+		Find(&members).Error
+	return members, err
+}
+
+// RevokeKeysByUserID drops the user's wrapped vault keys, which their lost
+// keypair can no longer unwrap, and marks the memberships so vault admins
+// share the keys again
+func (r *VaultMemberRepository) RevokeKeysByUserID(ctx context.Context, userID int64) error {
+	return r.db.WithContext(ctx).
+		Model(&model.VaultMember{}).
+		Where("user_id = ?", userID).
+		Updates(map[string]interface{}{
+			"encrypted_vault_key": "",
+			"key_revoked":         true,
+		}).Error
+}
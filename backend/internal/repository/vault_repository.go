@@ -2,8 +2,10 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/askuy/passwordx/backend/internal/model"
 )
@@ -29,6 +31,20 @@ func (r *VaultRepository) GetByID(ctx context.Context, id int64) (*model.Vault,
 	return &vault, nil
 }
 
+// GetForUpdate loads a vault and locks its row until the transaction ends.
+// Writes encrypted under the vault key lock it to check the key generation,
+// so they serialize with key rotations.
+func (r *VaultRepository) GetForUpdate(ctx context.Context, id int64) (*model.Vault, error) {
+	var vault model.Vault
+	err := r.db.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&vault, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &vault, nil
+}
+
 func (r *VaultRepository) GetByIDWithMembers(ctx context.Context, id int64) (*model.Vault, error) {
 	var vault model.Vault
 	err := r.db.WithContext(ctx).
@@ -45,21 +61,138 @@ func (r *VaultRepository) Update(ctx context.Context, vault *model.Vault) error
 	return r.db.WithContext(ctx).Save(vault).Error
 }
 
+// Delete moves a vault to the trash. Its members and credentials stay until
+// it is deleted permanently, but are out of reach while it is trashed.
 func (r *VaultRepository) Delete(ctx context.Context, id int64) error {
 	return r.db.WithContext(ctx).Delete(&model.Vault{}, id).Error
 }
 
+// DeletePermanently deletes the row of a vault in the trash. It returns false
+// if the vault is not in the trash, for instance because it was restored in
+// the meantime.
+func (r *VaultRepository) DeletePermanently(ctx context.Context, id int64) (bool, error) {
+	result := r.db.WithContext(ctx).Unscoped().Where("deleted_at IS NOT NULL").Delete(&model.Vault{}, id)
+	return result.RowsAffected == 1, result.Error
+}
+
+// GetTrashedByOwner returns a vault in the trash that the user owns
+func (r *VaultRepository) GetTrashedByOwner(ctx context.Context, id, userID int64) (*model.Vault, error) {
+	var vault model.Vault
+	err := r.db.WithContext(ctx).Unscoped().
+		Joins("JOIN vault_members ON vault_members.vault_id = vaults.id").
+		Where("vaults.deleted_at IS NOT NULL AND vault_members.user_id = ? AND vault_members.role = ?", userID, model.VaultRoleOwner).
+		First(&vault, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &vault, nil
+}
+
+// ListTrashedByOwner returns the vaults in the trash that the user owns,
+// most recently deleted first
+func (r *VaultRepository) ListTrashedByOwner(ctx context.Context, userID, tenantID int64) ([]model.Vault, error) {
+	var vaults []model.Vault
+	err := r.db.WithContext(ctx).Unscoped().
+		Joins("JOIN vault_members ON vault_members.vault_id = vaults.id").
+		Where("vaults.deleted_at IS NOT NULL AND vault_members.user_id = ? AND vault_members.role = ? AND vaults.tenant_id = ?", userID, model.VaultRoleOwner, tenantID).
+		Order("vaults.deleted_at DESC").
+		Find(&vaults).Error
+	return vaults, err
+}
+
+// Restore takes a vault out of the trash
+func (r *VaultRepository) Restore(ctx context.Context, id int64) error {
+	return r.db.WithContext(ctx).Unscoped().Model(&model.Vault{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Update("deleted_at", nil).Error
+}
+
+// ListTrashedBefore returns the IDs of vaults moved to the trash before cutoff
+func (r *VaultRepository) ListTrashedBefore(ctx context.Context, cutoff time.Time) ([]int64, error) {
+	var ids []int64
+	err := r.db.WithContext(ctx).Unscoped().Model(&model.Vault{}).
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+// Transaction runs fn inside a database transaction. Repositories that take part
+// in the transaction must be constructed from the tx handle passed to fn.
+func (r *VaultRepository) Transaction(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	return r.db.WithContext(ctx).Transaction(fn)
+}
+
+// SetRotationPending flags a vault whose key must be rotated
+func (r *VaultRepository) SetRotationPending(ctx context.Context, id int64) error {
+	return r.db.WithContext(ctx).Model(&model.Vault{}).Where("id = ?", id).Update("rotation_pending", true).Error
+}
+
+// SetRotationPendingByMember flags every vault the user is a member of,
+// including vaults in the trash
+func (r *VaultRepository) SetRotationPendingByMember(ctx context.Context, userID int64) error {
+	members := r.db.Model(&model.VaultMember{}).Select("vault_id").Where("user_id = ?", userID)
+	return r.db.WithContext(ctx).Unscoped().Model(&model.Vault{}).
+		Where("id IN (?)", members).
+		Update("rotation_pending", true).Error
+}
+
+// AdvanceKeyGeneration moves a vault from fromGeneration to the next generation and
+// clears the pending flag. It returns false if another rotation got there first.
+func (r *VaultRepository) AdvanceKeyGeneration(ctx context.Context, id int64, fromGeneration int) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&model.Vault{}).
+		Where("id = ? AND key_generation = ?", id, fromGeneration).
+		Updates(map[string]interface{}{
+			"key_generation":   fromGeneration + 1,
+			"rotation_pending": false,
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
 func (r *VaultRepository) ListByTenantID(ctx context.Context, tenantID int64) ([]model.Vault, error) {
 	var vaults []model.Vault
 	err := r.db.WithContext(ctx).Where("tenant_id = ?", tenantID).Find(&vaults).Error
 	return vaults, err
 }
 
-func (r *VaultRepository) ListByUserID(ctx context.Context, userID int64, tenantID int64) ([]model.Vault, error) {
-	var vaults []model.Vault
-	err := r.db.WithContext(ctx).
+// vaultSorting lists the sort keys of vault listings
+var vaultSorting = &sorting[model.Vault]{
+	id:   "vaults.id",
+	idOf: func(v *model.Vault) int64 { return v.ID },
+	keys: map[string]sortKey[model.Vault]{
+		"id":         {},
+		"name":       {expr: "vaults.name", kind: keyString, value: func(v *model.Vault) interface{} { return v.Name }},
+		"created_at": {expr: "vaults.created_at", kind: keyTime, value: func(v *model.Vault) interface{} { return v.CreatedAt }},
+		"updated_at": {expr: "vaults.updated_at", kind: keyTime, value: func(v *model.Vault) interface{} { return v.UpdatedAt }},
+	},
+}
+
+// VaultFilter narrows a listing of a user's vaults and orders it. Zero fields
+// do not filter.
+type VaultFilter struct {
+	Role string // the user's role in the vault
+	Sort string // id, name, created_at or updated_at, "-" first to reverse
+}
+
+// ListByUserID returns a page of the vaults in a tenant the user is a member
+// of that match filter, which may be nil, and the cursor of the next page
+func (r *VaultRepository) ListByUserID(ctx context.Context, userID int64, tenantID int64, filter *VaultFilter, page Page) ([]model.Vault, string, error) {
+	if filter == nil {
+		filter = &VaultFilter{}
+	}
+	key, err := vaultSorting.key(filter.Sort)
+	if err != nil {
+		return nil, "", err
+	}
+
+	db := r.db.WithContext(ctx).
 		Joins("JOIN vault_members ON vault_members.vault_id = vaults.id").
-		Where("vault_members.user_id = ? AND vaults.tenant_id = ?", userID, tenantID).
-		Find(&vaults).Error
-	return vaults, err
+		Where("vault_members.user_id = ? AND vaults.tenant_id = ?", userID, tenantID)
+	if filter.Role != "" {
+		db = db.Where("vault_members.role = ?", filter.Role)
+	}
+	vaults, more, err := paginate(db, key, page)
+	if err != nil || !more {
+		return vaults, "", err
+	}
+	return vaults, key.cursor(&vaults[len(vaults)-1]), nil
 }
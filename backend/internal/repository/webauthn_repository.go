@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/askuy/passwordx/backend/internal/model"
+)
+
+type WebAuthnRepository struct {
+	db *gorm.DB
+}
+
+func NewWebAuthnRepository(db *gorm.DB) *WebAuthnRepository {
+	return &WebAuthnRepository{db: db}
+}
+
+func (r *WebAuthnRepository) Create(ctx context.Context, credential *model.WebAuthnCredential) error {
+	return r.db.WithContext(ctx).Create(credential).Error
+}
+
+func (r *WebAuthnRepository) GetByID(ctx context.Context, id int64) (*model.WebAuthnCredential, error) {
+	var credential model.WebAuthnCredential
+	err := r.db.WithContext(ctx).First(&credential, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
+
+// GetByCredentialIDHash finds a credential by the hash of its raw ID
+func (r *WebAuthnRepository) GetByCredentialIDHash(ctx context.Context, hash string) (*model.WebAuthnCredential, error) {
+	var credential model.WebAuthnCredential
+	err := r.db.WithContext(ctx).Where("credential_id_hash = ?", hash).First(&credential).Error
+	if err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
+
+func (r *WebAuthnRepository) ListByUser(ctx context.Context, userID int64) ([]model.WebAuthnCredential, error) {
+	var credentials []model.WebAuthnCredential
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("id ASC").Find(&credentials).Error
+	return credentials, err
+}
+
+func (r *WebAuthnRepository) CountByUser(ctx context.Context, userID int64) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&model.WebAuthnCredential{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+// UpdateSignCount records a login, provided the counter is still at the value
+// the assertion was checked against. It reports false if a concurrent login
+// with the same credential got there first.
+func (r *WebAuthnRepository) UpdateSignCount(ctx context.Context, id int64, oldCount, newCount uint32) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&model.WebAuthnCredential{}).
+		Where("id = ? AND sign_count = ?", id, oldCount).
+		Updates(map[string]interface{}{
+			"sign_count":   newCount,
+			"last_used_at": time.Now(),
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *WebAuthnRepository) Delete(ctx context.Context, id int64) error {
+	return r.db.WithContext(ctx).Delete(&model.WebAuthnCredential{}, id).Error
+}
+
+func (r *WebAuthnRepository) DeleteByUser(ctx context.Context, userID int64) error {
+	return r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&model.WebAuthnCredential{}).Error
+}
@@ -0,0 +1,341 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/gotomicro/ego/core/econf"
+	"gorm.io/gorm"
+
+	"github.com/askuy/passwordx/backend/internal/pkg/crypto"
+	"github.com/askuy/passwordx/backend/internal/repository"
+)
+
+var (
+	ErrKeysAlreadySet     = errors.New("encryption keypair already set")
+	ErrKeysRequired       = errors.New("encryption keypair must be set up first")
+	ErrLegacyVaults       = errors.New("vaults encrypted directly with the master key must be migrated to vault keys first")
+	ErrKDFDowngrade       = errors.New("new KDF parameters are weaker than the current ones")
+	ErrInvalidKDFSettings = errors.New("invalid KDF parameters")
+	ErrInvalidSalt        = errors.New("invalid master key salt")
+	ErrIncompleteBatch    = errors.New("re-encryption batch must cover every credential encrypted with the master key")
+)
+
+// AccountService handles self-service operations on the current user's account
+type AccountService struct {
+	userRepo        *repository.UserRepository
+	vaultMemberRepo *repository.VaultMemberRepository
+	srp             *srpAuthenticator
+	jwtSecret       string
+	jwtExpire       int
+}
+
+func NewAccountService(userRepo *repository.UserRepository, vaultMemberRepo *repository.VaultMemberRepository, challengeRepo *repository.AuthChallengeRepository) *AccountService {
+	return &AccountService{
+		userRepo:        userRepo,
+		vaultMemberRepo: vaultMemberRepo,
+		srp:             &srpAuthenticator{challengeRepo: challengeRepo},
+		jwtSecret:       econf.GetString("jwt.secret"),
+		jwtExpire:       econf.GetInt("jwt.expireHours"),
+	}
+}
+
+// SetKeysRequest is the request body for uploading the user's keypair
+type SetKeysRequest struct {
+	PublicKey           string `json:"public_key" binding:"required"`
+	EncryptedPrivateKey string `json:"encrypted_private_key" binding:"required"`
+}
+
+// KeysResponse holds the current user's key material
+type KeysResponse struct {
+	crypto.KDFParams
+	PublicKey           string `json:"public_key"`
+	EncryptedPrivateKey string `json:"encrypted_private_key"`
+	MasterKeySalt       string `json:"master_key_salt"`
+}
+
+// UpgradeKDFRequest switches the user to stronger KDF parameters. The client
+// proves it knows the current password like for ChangePasswordRequest,
+// derives the new master key and re-encrypts the private key with it. SRP
+// accounts also send a verifier computed from the new master key.
+type UpgradeKDFRequest struct {
+	crypto.KDFParams
+	SRPCredentials
+	SRPProof
+	CurrentPassword     string `json:"current_password"`
+	EncryptedPrivateKey string `json:"encrypted_private_key" binding:"required"`
+}
+
+// ChangePasswordRequest replaces the master password. The client proves it
+// knows the current password with an answered SRP challenge (or, for legacy
+// accounts, CurrentPassword), derives the new master key from the new
+// password, MasterKeySalt and the KDF parameters, and submits a new SRP
+// verifier together with everything that was encrypted with the old master
+// key: the private key, and every credential (trashed ones included) in vaults
+// that have no wrapped vault key yet. Vault keys themselves are wrapped with
+// the public key and do not change. KDF parameters default to the current ones
+// when omitted.
+type ChangePasswordRequest struct {
+	crypto.KDFParams
+	SRPCredentials
+	SRPProof
+	CurrentPassword     string                  `json:"current_password"`
+	MasterKeySalt       string                  `json:"master_key_salt" binding:"required"`
+	EncryptedPrivateKey string                  `json:"encrypted_private_key"`
+	Credentials         []ReencryptedCredential `json:"credentials" binding:"dive"`
+}
+
+// PublicKeyResponse holds another user's public key
+type PublicKeyResponse struct {
+	UserID    int64  `json:"user_id"`
+	PublicKey string `json:"public_key"`
+}
+
+// GetKeys returns the current user's key material
+func (s *AccountService) GetKeys(ctx context.Context, userID int64) (*KeysResponse, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	return &KeysResponse{
+		KDFParams:           userKDFParams(user),
+		PublicKey:           user.PublicKey,
+		EncryptedPrivateKey: user.EncryptedPrivateKey,
+		MasterKeySalt:       user.MasterKeySalt,
+	}, nil
+}
+
+// SetKeys stores the user's keypair. The keypair can only be set once, because
+// replacing it would make every vault key wrapped for the user unreadable.
+func (s *AccountService) SetKeys(ctx context.Context, userID int64, req *SetKeysRequest) error {
+	if err := crypto.ValidatePublicKey(req.PublicKey); err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	if user.PublicKey != "" {
+		return ErrKeysAlreadySet
+	}
+
+	user.PublicKey = req.PublicKey
+	user.EncryptedPrivateKey = req.EncryptedPrivateKey
+	return s.userRepo.Update(ctx, user)
+}
+
+// GetPublicKey returns the public key of a user in the same tenant, so that
+// vault owners can wrap the vault key for a new member
+func (s *AccountService) GetPublicKey(ctx context.Context, tenantID, userID int64) (*PublicKeyResponse, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	if user.TenantID != tenantID {
+		return nil, ErrUserNotFound
+	}
+	if user.PublicKey == "" {
+		return nil, ErrMemberKeyMissing
+	}
+
+	return &PublicKeyResponse{
+		UserID:    user.ID,
+		PublicKey: user.PublicKey,
+	}, nil
+}
+
+// UpgradeKDF replaces the user's KDF parameters together with the private key
+// re-encrypted under the newly derived master key
+func (s *AccountService) UpgradeKDF(ctx context.Context, userID int64, req *UpgradeKDFRequest) error {
+	if err := req.KDFParams.Validate(); err != nil {
+		return ErrInvalidKDFSettings
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	if err := s.srp.reauthenticate(ctx, s.userRepo, user, req.CurrentPassword, &req.SRPProof); err != nil {
+		return err
+	}
+
+	if user.PublicKey == "" {
+		return ErrKeysRequired
+	}
+	if req.KDFParams.WeakerThan(userKDFParams(user)) {
+		return ErrKDFDowngrade
+	}
+
+	// Credentials in legacy vaults would become unreadable with a new master key
+	legacy, err := s.vaultMemberRepo.CountLegacyByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if legacy > 0 {
+		return ErrLegacyVaults
+	}
+
+	if req.SRPCredentials.provided() {
+		if err := req.SRPCredentials.applyTo(user); err != nil {
+			return err
+		}
+	} else if user.SRPVerifier != "" {
+		return ErrInvalidVerifier
+	}
+
+	setUserKDFParams(user, req.KDFParams)
+	user.EncryptedPrivateKey = req.EncryptedPrivateKey
+	return s.userRepo.Update(ctx, user)
+}
+
+// ChangePasswordResponse holds a new token for the caller's session, because
+// changing the password signs out every other session
+type ChangePasswordResponse struct {
+	Token    string    `json:"token"`
+	ExpireAt time.Time `json:"expire_at"`
+}
+
+// ChangePassword verifies the current password and atomically replaces the
+// SRP verifier, master key salt, KDF parameters and every ciphertext that
+// depends on the master key. Partial batches are rejected so the account can
+// never end up with data encrypted under two different master keys.
+func (s *AccountService) ChangePassword(ctx context.Context, userID int64, req *ChangePasswordRequest) (*ChangePasswordResponse, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	if err := s.srp.reauthenticate(ctx, s.userRepo, user, req.CurrentPassword, &req.SRPProof); err != nil {
+		return nil, err
+	}
+	if err := req.SRPCredentials.validate(); err != nil {
+		return nil, err
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(req.MasterKeySalt)
+	if err != nil || len(salt) < crypto.SaltSize {
+		return nil, ErrInvalidSalt
+	}
+
+	params := req.KDFParams
+	if params.Algorithm == "" {
+		params = userKDFParams(user)
+	}
+	if err := params.Validate(); err != nil {
+		return nil, ErrInvalidKDFSettings
+	}
+	if params.WeakerThan(userKDFParams(user)) {
+		return nil, ErrKDFDowngrade
+	}
+
+	if user.PublicKey != "" && req.EncryptedPrivateKey == "" {
+		return nil, ErrIncompleteBatch
+	}
+	if user.PublicKey == "" && req.EncryptedPrivateKey != "" {
+		return nil, ErrKeysRequired
+	}
+
+	reencrypted := make(map[int64]*ReencryptedCredential, len(req.Credentials))
+	for i := range req.Credentials {
+		rc := &req.Credentials[i]
+		if _, dup := reencrypted[rc.ID]; dup {
+			return nil, ErrIncompleteBatch
+		}
+		reencrypted[rc.ID] = rc
+	}
+
+	err = s.userRepo.Transaction(ctx, func(tx *gorm.DB) error {
+		userRepo := repository.NewUserRepository(tx)
+		memberRepo := repository.NewVaultMemberRepository(tx)
+		credentialRepo := repository.NewCredentialRepository(tx)
+		attachmentRepo := repository.NewAttachmentRepository(tx)
+		revisionRepo := repository.NewCredentialRevisionRepository(tx)
+
+		legacy, err := memberRepo.ListLegacyByUserID(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		covered := 0
+		for _, member := range legacy {
+			credentials, err := credentialRepo.ListByVaultIDWithTrash(ctx, member.VaultID)
+			if err != nil {
+				return err
+			}
+			for i := range credentials {
+				rc, ok := reencrypted[credentials[i].ID]
+				if !ok {
+					return ErrIncompleteBatch
+				}
+				if err := validateCiphertexts(rc.ciphertexts(), credentials[i].KeyGeneration); err != nil {
+					return err
+				}
+				if err := rc.applyTo(&credentials[i], credentials[i].KeyGeneration); err != nil {
+					return err
+				}
+				if err := credentialRepo.Update(ctx, &credentials[i]); err != nil {
+					return err
+				}
+				for j := range credentials[i].Attachments {
+					if err := attachmentRepo.UpdateKeys(ctx, &credentials[i].Attachments[j]); err != nil {
+						return err
+					}
+				}
+				if err := reencryptRevisions(ctx, revisionRepo, credentials[i].ID, rc.Revisions, credentials[i].KeyGeneration); err != nil {
+					return err
+				}
+				covered++
+			}
+		}
+		// Anything left over is not the user's to re-encrypt
+		if covered != len(reencrypted) {
+			return ErrIncompleteBatch
+		}
+
+		if err := req.SRPCredentials.applyTo(user); err != nil {
+			return err
+		}
+		user.MasterKeySalt = req.MasterKeySalt
+		setUserKDFParams(user, params)
+		if req.EncryptedPrivateKey != "" {
+			user.EncryptedPrivateKey = req.EncryptedPrivateKey
+		}
+		user.TokenVersion++
+		if err := userRepo.Update(ctx, user); err != nil {
+			return err
+		}
+		// Pending two-factor logins were started with the old password
+		return repository.NewAuthChallengeRepository(tx).DeleteByUserID(ctx, user.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	token, expireAt, err := signToken(user, s.jwtSecret, s.jwtExpire)
+	if err != nil {
+		return nil, err
+	}
+	return &ChangePasswordResponse{Token: token, ExpireAt: expireAt}, nil
+}
@@ -0,0 +1,429 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/gotomicro/ego/core/econf"
+	"github.com/gotomicro/ego/core/elog"
+	"gorm.io/gorm"
+
+	"github.com/askuy/passwordx/backend/internal/model"
+	"github.com/askuy/passwordx/backend/internal/pkg/blobstore"
+	"github.com/askuy/passwordx/backend/internal/repository"
+)
+
+const (
+	defaultMaxAttachmentSize = 25 << 20 // 25 MiB
+	defaultAttachmentQuota   = 1 << 30  // 1 GiB per tenant
+)
+
+var (
+	ErrAttachmentNotFound      = errors.New("attachment not found")
+	ErrAttachmentExists        = errors.New("attachment already exists")
+	ErrAttachmentTooLarge      = errors.New("attachment exceeds the maximum file size")
+	ErrAttachmentQuotaExceeded = errors.New("attachment storage quota exceeded")
+	ErrInvalidAttachments      = errors.New("invalid attachments")
+)
+
+// UploadAttachmentRequest describes an uploaded file. The client encrypts the
+// file with a random file key, wraps the key with the vault key and encrypts
+// the file name with the vault key; both ciphertexts are sealed with
+// crypto.CredentialAAD(vaultID, itemID, name) of the credential, where name
+// is "attachments.<attachment_id>.file_name" or "attachments.<attachment_id>.key".
+type UploadAttachmentRequest struct {
+	AttachmentID      string `form:"attachment_id" binding:"required,uuid"`
+	FileNameEncrypted string `form:"file_name_encrypted" binding:"required,max=1000"`
+	KeyEncrypted      string `form:"key_encrypted" binding:"required,max=500"`
+	KeyGeneration     int    `form:"key_generation" binding:"required"`
+}
+
+// ciphertexts returns the encrypted fields of the request keyed by name
+func (r *UploadAttachmentRequest) ciphertexts() map[string]string {
+	ciphertexts := make(map[string]string, 2)
+	attachmentCiphertexts(ciphertexts, r.AttachmentID, r.FileNameEncrypted, r.KeyEncrypted)
+	return ciphertexts
+}
+
+// ReencryptedAttachment carries an attachment's file name and file key
+// re-encrypted under a new vault key; the blob itself is unchanged
+type ReencryptedAttachment struct {
+	AttachmentID      string `json:"attachment_id" binding:"required"`
+	FileNameEncrypted string `json:"file_name_encrypted" binding:"required"`
+	KeyEncrypted      string `json:"key_encrypted" binding:"required"`
+}
+
+// attachmentCiphertexts adds the file name and key of an attachment to
+// ciphertexts, named as their associated data names them
+func attachmentCiphertexts(ciphertexts map[string]string, id, fileName, key string) {
+	ciphertexts["attachments."+id+".file_name"] = fileName
+	ciphertexts["attachments."+id+".key"] = key
+}
+
+// reencryptAttachments replaces the ciphertexts of every attachment of the
+// credential; an attachment left out would keep a key wrapped with the old
+// vault key
+func reencryptAttachments(credential *model.Credential, attachments []ReencryptedAttachment, keyGeneration int) error {
+	if len(attachments) != len(credential.Attachments) {
+		return fmt.Errorf("%w: every attachment must be re-encrypted", ErrInvalidAttachments)
+	}
+	byID := make(map[string]*ReencryptedAttachment, len(attachments))
+	for i := range attachments {
+		byID[attachments[i].AttachmentID] = &attachments[i]
+	}
+	for i := range credential.Attachments {
+		a, ok := byID[credential.Attachments[i].AttachmentID]
+		if !ok {
+			return fmt.Errorf("%w: attachment %s is not re-encrypted", ErrInvalidAttachments, credential.Attachments[i].AttachmentID)
+		}
+		credential.Attachments[i].FileNameEncrypted = a.FileNameEncrypted
+		credential.Attachments[i].KeyEncrypted = a.KeyEncrypted
+		credential.Attachments[i].KeyGeneration = keyGeneration
+	}
+	return nil
+}
+
+// AttachmentQuota is a tenant's attachment storage quota and usage in bytes
+type AttachmentQuota struct {
+	Quota       int64 `json:"quota"`
+	Used        int64 `json:"used"`
+	MaxFileSize int64 `json:"max_file_size"`
+	Default     bool  `json:"default"` // the configured default applies
+}
+
+// SetAttachmentQuotaRequest sets a tenant's attachment storage quota
+type SetAttachmentQuotaRequest struct {
+	Quota int64 `json:"quota" binding:"required,min=1"`
+}
+
+// AttachmentService stores encrypted file attachments of credentials
+type AttachmentService struct {
+	store           blobstore.Store
+	attachmentRepo  *repository.AttachmentRepository
+	credentialRepo  *repository.CredentialRepository
+	vaultRepo       *repository.VaultRepository
+	vaultMemberRepo *repository.VaultMemberRepository
+	tenantRepo      *repository.TenantRepository
+	maxFileSize     int64
+	defaultQuota    int64
+}
+
+// NewAttachmentService opens the blob store configured in the [attachments]
+// config section
+func NewAttachmentService(attachmentRepo *repository.AttachmentRepository, credentialRepo *repository.CredentialRepository, vaultRepo *repository.VaultRepository, vaultMemberRepo *repository.VaultMemberRepository, tenantRepo *repository.TenantRepository) (*AttachmentService, error) {
+	store, err := blobstore.Open(blobstore.Config{
+		Driver:    econf.GetString("attachments.driver"),
+		Dir:       econf.GetString("attachments.dir"),
+		Endpoint:  econf.GetString("attachments.s3.endpoint"),
+		Region:    econf.GetString("attachments.s3.region"),
+		Bucket:    econf.GetString("attachments.s3.bucket"),
+		AccessKey: econf.GetString("attachments.s3.accessKey"),
+		SecretKey: econf.GetString("attachments.s3.secretKey"),
+		PathStyle: econf.GetBool("attachments.s3.pathStyle"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	maxFileSize := econf.GetInt64("attachments.maxFileSize")
+	if maxFileSize <= 0 {
+		maxFileSize = defaultMaxAttachmentSize
+	}
+	defaultQuota := econf.GetInt64("attachments.tenantQuota")
+	if defaultQuota <= 0 {
+		defaultQuota = defaultAttachmentQuota
+	}
+
+	return &AttachmentService{
+		store:           store,
+		attachmentRepo:  attachmentRepo,
+		credentialRepo:  credentialRepo,
+		vaultRepo:       vaultRepo,
+		vaultMemberRepo: vaultMemberRepo,
+		tenantRepo:      tenantRepo,
+		maxFileSize:     maxFileSize,
+		defaultQuota:    defaultQuota,
+	}, nil
+}
+
+// MaxFileSize returns the largest blob an upload may carry
+func (s *AttachmentService) MaxFileSize() int64 {
+	return s.maxFileSize
+}
+
+// quota returns the tenant's attachment storage quota
+func (s *AttachmentService) quota(tenant *model.Tenant) int64 {
+	if tenant.AttachmentQuota > 0 {
+		return tenant.AttachmentQuota
+	}
+	return s.defaultQuota
+}
+
+// credential loads a credential of a vault and checks the user's role
+func (s *AttachmentService) credential(ctx context.Context, vaultID, credentialID, userID int64, allowed func(role string) bool) (*model.Credential, error) {
+	member, err := s.vaultMemberRepo.GetByVaultAndUser(ctx, vaultID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCredentialAccessDenied
+		}
+		return nil, err
+	}
+	if !allowed(member.Role) {
+		return nil, ErrCredentialAccessDenied
+	}
+
+	credential, err := s.credentialRepo.GetByID(ctx, credentialID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCredentialNotFound
+		}
+		return nil, err
+	}
+	if credential.VaultID != vaultID {
+		return nil, ErrCredentialNotFound
+	}
+	return credential, nil
+}
+
+// Upload stores an encrypted file and attaches it to a credential. The blob
+// is written first; if recording it fails, it is removed again.
+func (s *AttachmentService) Upload(ctx context.Context, vaultID, credentialID, userID int64, req *UploadAttachmentRequest, file io.Reader, size int64) (*model.Attachment, error) {
+	credential, err := s.credential(ctx, vaultID, credentialID, userID, model.CanEditCredentials)
+	if err != nil {
+		return nil, err
+	}
+	if credential.ItemID == "" {
+		return nil, ErrItemIDRequired
+	}
+	if size <= 0 || size > s.maxFileSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrAttachmentTooLarge, s.maxFileSize)
+	}
+
+	vault, err := s.vaultRepo.GetByID(ctx, vaultID)
+	if err != nil {
+		return nil, err
+	}
+	if req.KeyGeneration != vault.KeyGeneration {
+		return nil, ErrStaleKeyGeneration
+	}
+	if err := validateCiphertexts(req.ciphertexts(), req.KeyGeneration); err != nil {
+		return nil, err
+	}
+
+	// Fail fast before storing anything; the check is repeated under lock
+	tenant, err := s.tenantRepo.GetByID(ctx, credential.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	used, err := s.attachmentRepo.SumSizeByTenantID(ctx, tenant.ID)
+	if err != nil {
+		return nil, err
+	}
+	if used+size > s.quota(tenant) {
+		return nil, ErrAttachmentQuotaExceeded
+	}
+	exists, err := s.attachmentRepo.ExistsByAttachmentID(ctx, req.AttachmentID)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrAttachmentExists
+	}
+
+	storageKey, err := newStorageKey(tenant.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.Put(ctx, storageKey, file, size); err != nil {
+		return nil, err
+	}
+
+	attachment := &model.Attachment{
+		TenantID:          tenant.ID,
+		VaultID:           vaultID,
+		CredentialID:      credentialID,
+		AttachmentID:      req.AttachmentID,
+		FileNameEncrypted: req.FileNameEncrypted,
+		KeyEncrypted:      req.KeyEncrypted,
+		KeyGeneration:     req.KeyGeneration,
+		Size:              size,
+		StorageKey:        storageKey,
+		CreatedBy:         userID,
+	}
+	err = s.vaultRepo.Transaction(ctx, func(tx *gorm.DB) error {
+		tenantRepo := repository.NewTenantRepository(tx)
+		credentialRepo := repository.NewCredentialRepository(tx)
+		attachmentRepo := repository.NewAttachmentRepository(tx)
+
+		// Locking the tenant serializes quota checks, locking the vault keeps
+		// its key from being rotated and locking the credential keeps it from
+		// being deleted before the attachment is recorded
+		tenant, err := tenantRepo.GetForUpdate(ctx, tenant.ID)
+		if err != nil {
+			return err
+		}
+		if err := checkKeyGeneration(ctx, repository.NewVaultRepository(tx), vaultID, req.KeyGeneration); err != nil {
+			return err
+		}
+		if _, err := credentialRepo.GetForUpdate(ctx, credentialID); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrCredentialNotFound
+			}
+			return err
+		}
+		used, err := attachmentRepo.SumSizeByTenantID(ctx, tenant.ID)
+		if err != nil {
+			return err
+		}
+		if used+size > s.quota(tenant) {
+			return ErrAttachmentQuotaExceeded
+		}
+		exists, err := attachmentRepo.ExistsByAttachmentID(ctx, req.AttachmentID)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrAttachmentExists
+		}
+		return attachmentRepo.Create(ctx, attachment)
+	})
+	if err != nil {
+		s.deleteBlobs(ctx, []model.Attachment{*attachment})
+		return nil, err
+	}
+
+	return attachment, nil
+}
+
+// List returns the attachments of a credential
+func (s *AttachmentService) List(ctx context.Context, vaultID, credentialID, userID int64) ([]model.Attachment, error) {
+	credential, err := s.credential(ctx, vaultID, credentialID, userID, model.CanViewCredentials)
+	if err != nil {
+		return nil, err
+	}
+	return credential.Attachments, nil
+}
+
+// attachment loads an attachment of a credential
+func (s *AttachmentService) attachment(ctx context.Context, credential *model.Credential, attachmentID int64) (*model.Attachment, error) {
+	attachment, err := s.attachmentRepo.GetByID(ctx, attachmentID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAttachmentNotFound
+		}
+		return nil, err
+	}
+	if attachment.CredentialID != credential.ID {
+		return nil, ErrAttachmentNotFound
+	}
+	return attachment, nil
+}
+
+// Download opens the encrypted blob of an attachment. The caller closes it.
+func (s *AttachmentService) Download(ctx context.Context, vaultID, credentialID, attachmentID, userID int64) (*model.Attachment, io.ReadCloser, error) {
+	credential, err := s.credential(ctx, vaultID, credentialID, userID, model.CanViewCredentials)
+	if err != nil {
+		return nil, nil, err
+	}
+	attachment, err := s.attachment(ctx, credential, attachmentID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	blob, err := s.store.Get(ctx, attachment.StorageKey)
+	if err != nil {
+		if errors.Is(err, blobstore.ErrNotFound) {
+			return nil, nil, ErrAttachmentNotFound
+		}
+		return nil, nil, err
+	}
+	return attachment, blob, nil
+}
+
+// Delete removes an attachment and its blob
+func (s *AttachmentService) Delete(ctx context.Context, vaultID, credentialID, attachmentID, userID int64) error {
+	credential, err := s.credential(ctx, vaultID, credentialID, userID, model.CanEditCredentials)
+	if err != nil {
+		return err
+	}
+	attachment, err := s.attachment(ctx, credential, attachmentID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.attachmentRepo.Delete(ctx, attachment.ID); err != nil {
+		return err
+	}
+	s.deleteBlobs(ctx, []model.Attachment{*attachment})
+	return nil
+}
+
+// deleteBlobs removes the blobs of attachments whose records are gone. A
+// blob that cannot be removed is only orphaned, so failures are logged
+// rather than returned.
+func (s *AttachmentService) deleteBlobs(ctx context.Context, attachments []model.Attachment) {
+	for _, a := range attachments {
+		if err := s.store.Delete(ctx, a.StorageKey); err != nil {
+			elog.Warn("failed to delete attachment blob", elog.String("key", a.StorageKey), elog.FieldErr(err))
+		}
+	}
+}
+
+// GetQuota returns the attachment storage quota and usage of the admin's tenant
+func (s *AttachmentService) GetQuota(ctx context.Context, admin *model.User) (*AttachmentQuota, error) {
+	tenant, err := s.tenantRepo.GetByID(ctx, admin.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	used, err := s.attachmentRepo.SumSizeByTenantID(ctx, tenant.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &AttachmentQuota{
+		Quota:       s.quota(tenant),
+		Used:        used,
+		MaxFileSize: s.maxFileSize,
+		Default:     tenant.AttachmentQuota == 0,
+	}, nil
+}
+
+// SetQuota sets the attachment storage quota of the admin's tenant. Lowering
+// it below the current usage only blocks new uploads.
+func (s *AttachmentService) SetQuota(ctx context.Context, admin *model.User, req *SetAttachmentQuotaRequest) (*AttachmentQuota, error) {
+	tenant, err := s.tenantRepo.GetByID(ctx, admin.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	tenant.AttachmentQuota = req.Quota
+	if err := s.tenantRepo.Update(ctx, tenant); err != nil {
+		return nil, err
+	}
+	return s.GetQuota(ctx, admin)
+}
+
+// ResetQuota makes the admin's tenant use the default quota again
+func (s *AttachmentService) ResetQuota(ctx context.Context, admin *model.User) (*AttachmentQuota, error) {
+	tenant, err := s.tenantRepo.GetByID(ctx, admin.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	tenant.AttachmentQuota = 0
+	if err := s.tenantRepo.Update(ctx, tenant); err != nil {
+		return nil, err
+	}
+	return s.GetQuota(ctx, admin)
+}
+
+// newStorageKey returns a random blob key under the tenant's prefix. Keys
+// are never derived from client input, so one upload cannot overwrite another.
+func newStorageKey(tenantID int64) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d/%s", tenantID, hex.EncodeToString(b)), nil
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"strings"
 	"time"
@@ -25,27 +26,47 @@ var (
 )
 
 type AuthService struct {
-	userRepo   *repository.UserRepository
-	tenantRepo *repository.TenantRepository
-	jwtSecret  string
-	jwtExpire  int
+	userRepo         *repository.UserRepository
+	tenantRepo       *repository.TenantRepository
+	challengeRepo    *repository.AuthChallengeRepository
+	breachService    *BreachService
+	twoFactorService *TwoFactorService
+	srp              *srpAuthenticator
+	jwtSecret        string
+	jwtExpire        int
 }
 
-func NewAuthService(userRepo *repository.UserRepository, tenantRepo *repository.TenantRepository) *AuthService {
+func NewAuthService(userRepo *repository.UserRepository, tenantRepo *repository.TenantRepository, challengeRepo *repository.AuthChallengeRepository, breachService *BreachService, twoFactorService *TwoFactorService) *AuthService {
+	jwtSecret := econf.GetString("jwt.secret")
 	return &AuthService{
-		userRepo:   userRepo,
-		tenantRepo: tenantRepo,
-		jwtSecret:  econf.GetString("jwt.secret"),
-		jwtExpire:  econf.GetInt("jwt.expireHours"),
+		userRepo:         userRepo,
+		tenantRepo:       tenantRepo,
+		challengeRepo:    challengeRepo,
+		breachService:    breachService,
+		twoFactorService: twoFactorService,
+		srp: &srpAuthenticator{
+			challengeRepo: challengeRepo,
+			decoyKey:      []byte(jwtSecret),
+		},
+		jwtSecret: jwtSecret,
+		jwtExpire: econf.GetInt("jwt.expireHours"),
 	}
 }
 
+// RegisterRequest is the request body for registration. Clients should send
+// MasterKeySalt and SRP credentials computed locally so the password never
+// leaves the device, together with the KDF parameters they derived the master
+// key with (the legacy parameters if omitted); Password is accepted from older
+// clients and converted to an SRP verifier on the server.
 type RegisterRequest struct {
-	Email      string `json:"email" binding:"required,email"`
-	Password   string `json:"password" binding:"required,min=8"`
-	Name       string `json:"name" binding:"required"`
-	TenantName string `json:"tenant_name" binding:"required"`
-	TenantSlug string `json:"tenant_slug" binding:"required"`
+	SRPCredentials
+	crypto.KDFParams
+	Email         string `json:"email" binding:"required,email"`
+	Password      string `json:"password" binding:"omitempty,min=8"`
+	MasterKeySalt string `json:"master_key_salt"`
+	Name          string `json:"name" binding:"required"`
+	TenantName    string `json:"tenant_name" binding:"required"`
+	TenantSlug    string `json:"tenant_slug" binding:"required"`
 }
 
 type LoginRequest struct {
@@ -54,16 +75,42 @@ type LoginRequest struct {
 }
 
 type AuthResponse struct {
-	Token    string        `json:"token"`
-	User     *model.User   `json:"user"`
-	Tenant   *model.Tenant `json:"tenant"`
+	Token    string        `json:"token,omitempty"`
+	User     *model.User   `json:"user,omitempty"`
+	Tenant   *model.Tenant `json:"tenant,omitempty"`
 	ExpireAt time.Time     `json:"expire_at"`
+	// MFAToken is set instead of Token when the first factor passed and a
+	// second one is needed; MFA says whether to verify a code or enroll first
+	// and MFAMethods which second factors the user can verify with.
+	// ExpireAt is then the expiry of the MFA token.
+	MFAToken   string   `json:"mfa_token,omitempty"`
+	MFA        string   `json:"mfa,omitempty"`         // verify, enroll
+	MFAMethods []string `json:"mfa_methods,omitempty"` // totp, webauthn
+	// RecoveryCodes are returned once when enrollment completes the login
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+	// KDFUpgrade is set when the user's KDF parameters are below the current
+	// policy; the client should re-derive and upgrade on this unlock
+	KDFUpgrade *crypto.KDFParams `json:"kdf_upgrade,omitempty"`
+	// ServerProof is the SRP server proof M2, set on SRP logins so the client
+	// can verify it talked to a server that knows its verifier
+	ServerProof string `json:"m2,omitempty"`
+}
+
+type PreloginRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// PreloginResponse tells the client how to derive the master key before login
+type PreloginResponse struct {
+	crypto.KDFParams
+	MasterKeySalt string `json:"master_key_salt"`
 }
 
 type Claims struct {
-	UserID   int64  `json:"user_id"`
-	TenantID int64  `json:"tenant_id"`
-	Email    string `json:"email"`
+	UserID       int64  `json:"user_id"`
+	TenantID     int64  `json:"tenant_id"`
+	Email        string `json:"email"`
+	TokenVersion int    `json:"token_version"`
 	jwt.RegisteredClaims
 }
 
@@ -74,6 +121,21 @@ func (s *AuthService) Register(ctx context.Context, req *RegisterRequest) (*Auth
 		return nil, ErrRegistrationDisabled
 	}
 
+	if req.SRPCredentials.provided() == (req.Password != "") {
+		return nil, ErrInvalidVerifier
+	}
+
+	// The new tenant starts with the default policy. SRP clients never send
+	// the password, so they check it locally before deriving the verifier.
+	if req.Password != "" {
+		if err := configuredPasswordPolicy().check(req.Password, req.Email, req.Name); err != nil {
+			return nil, err
+		}
+		if err := s.breachService.check(req.Password); err != nil {
+			return nil, err
+		}
+	}
+
 	// Check if user already exists
 	exists, err := s.userRepo.ExistsByEmail(ctx, req.Email)
 	if err != nil {
@@ -92,6 +154,32 @@ func (s *AuthService) Register(ctx context.Context, req *RegisterRequest) (*Auth
 		return nil, err
 	}
 
+	// Prepare user with default role and status. Clients registering with SRP
+	// state the KDF parameters they derived their verifier with; prelogin
+	// hands out the legacy ones for unknown emails.
+	user := &model.User{
+		Email:         req.Email,
+		Name:          req.Name,
+		MasterKeySalt: req.MasterKeySalt,
+		Role:          model.UserRoleUser,
+		AccountType:   model.AccountTypeTeam,
+		Status:        model.UserStatusActive,
+	}
+	switch {
+	case req.Password != "":
+		setUserKDFParams(user, serverDerivedKDFParams())
+	case req.KDFParams.Algorithm == "":
+		setUserKDFParams(user, crypto.LegacyKDFParams())
+	default:
+		if err := req.KDFParams.Validate(); err != nil {
+			return nil, ErrInvalidKDFSettings
+		}
+		setUserKDFParams(user, req.KDFParams)
+	}
+	if err := s.setRegistrationSecrets(ctx, user, req); err != nil {
+		return nil, err
+	}
+
 	// Create tenant
 	tenant := &model.Tenant{
 		Name: req.TenantName,
@@ -101,29 +189,7 @@ func (s *AuthService) Register(ctx context.Context, req *RegisterRequest) (*Auth
 		return nil, err
 	}
 
-	// Hash password
-	passwordHash, err := crypto.HashPasswordBcrypt(req.Password)
-	if err != nil {
-		return nil, err
-	}
-
-	// Generate salt for master key derivation
-	salt, err := crypto.GenerateSalt()
-	if err != nil {
-		return nil, err
-	}
-
-	// Create user with default role and status
-	user := &model.User{
-		TenantID:      tenant.ID,
-		Email:         req.Email,
-		Name:          req.Name,
-		PasswordHash:  passwordHash,
-		MasterKeySalt: salt,
-		Role:          model.UserRoleUser,
-		AccountType:   model.AccountTypeTeam,
-		Status:        model.UserStatusActive,
-	}
+	user.TenantID = tenant.ID
 	if err := s.userRepo.Create(ctx, user); err != nil {
 		return nil, err
 	}
@@ -142,8 +208,32 @@ func (s *AuthService) Register(ctx context.Context, req *RegisterRequest) (*Auth
 	}, nil
 }
 
-// Login authenticates a user and returns a JWT token
+// setRegistrationSecrets stores the SRP verifier for a new user, either as
+// computed by the client or derived here from a password sent by an older client
+func (s *AuthService) setRegistrationSecrets(ctx context.Context, user *model.User, req *RegisterRequest) error {
+	if req.SRPCredentials.provided() {
+		salt, err := base64.StdEncoding.DecodeString(req.MasterKeySalt)
+		if err != nil || len(salt) < crypto.SaltSize {
+			return ErrInvalidSalt
+		}
+		return req.SRPCredentials.applyTo(user)
+	}
+
+	salt, err := crypto.GenerateSalt()
+	if err != nil {
+		return err
+	}
+	user.MasterKeySalt = salt
+	return setSRPVerifierFromPassword(ctx, user, req.Password)
+}
+
+// Login authenticates a legacy account with its password, upgrades it to SRP
+// and returns a JWT token. It is disabled unless app.enablePasswordLogin is set.
 func (s *AuthService) Login(ctx context.Context, req *LoginRequest) (*AuthResponse, error) {
+	if !passwordLogin() {
+		return nil, ErrSRPRequired
+	}
+
 	user, err := s.userRepo.GetByEmail(ctx, req.Email)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -160,17 +250,89 @@ func (s *AuthService) Login(ctx context.Context, req *LoginRequest) (*AuthRespon
 		return nil, ErrUserNotInvited
 	}
 
-	// Verify password
-	if !crypto.VerifyPasswordBcrypt(req.Password, user.PasswordHash) {
+	// Accounts with an SRP verifier never accept the password itself. They
+	// fail like a wrong password so this does not reveal which accounts are
+	// enrolled.
+	if user.SRPVerifier != "" || user.PasswordHash == "" || !crypto.VerifyPasswordBcrypt(req.Password, user.PasswordHash) {
 		return nil, ErrInvalidCredentials
 	}
 
+	// Upgrade the legacy account to SRP; this is the last time the server sees the password
+	if user.MasterKeySalt != "" {
+		if err := setSRPVerifierFromPassword(ctx, user, req.Password); err != nil {
+			return nil, err
+		}
+		if err := s.userRepo.Update(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.completeLogin(ctx, user)
+}
+
+// SRPInit starts an SRP login. Unknown emails and accounts not upgraded to SRP
+// yet get a decoy challenge so the endpoint cannot be used to discover which
+// accounts exist.
+func (s *AuthService) SRPInit(ctx context.Context, req *SRPInitRequest) (*SRPInitResponse, error) {
+	user, err := s.userRepo.GetByEmail(ctx, req.Email)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		user = nil
+	}
+
+	return s.srp.challenge(ctx, user, req.Email, req.ClientPublic)
+}
+
+// SRPVerify completes an SRP login and returns a JWT token together with the
+// server proof
+func (s *AuthService) SRPVerify(ctx context.Context, req *SRPVerifyRequest) (*AuthResponse, error) {
+	user, serverProof, err := s.srp.verify(ctx, s.userRepo, req.ChallengeID, req.ClientProof)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check user status
+	if user.Status == model.UserStatusInactive {
+		return nil, ErrUserInactive
+	}
+	if user.Status == model.UserStatusInvited {
+		return nil, ErrUserNotInvited
+	}
+
+	resp, err := s.completeLogin(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	resp.ServerProof = base64.StdEncoding.EncodeToString(serverProof)
+	return resp, nil
+}
+
+// completeLogin issues a token for a user who passed the first factor, or an
+// MFA token if they have to pass a second one
+func (s *AuthService) completeLogin(ctx context.Context, user *model.User) (*AuthResponse, error) {
 	// Get tenant
 	tenant, err := s.tenantRepo.GetByID(ctx, user.TenantID)
 	if err != nil {
 		return nil, err
 	}
 
+	methods, err := s.twoFactorService.methods(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if len(methods) > 0 {
+		return s.requireSecondFactor(ctx, user, mfaStepVerify, methods)
+	}
+	if tenant.RequireTwoFactor {
+		return s.requireSecondFactor(ctx, user, mfaStepEnroll, nil)
+	}
+	return s.issueSession(user, tenant)
+}
+
+// issueSession issues a JWT token once every required factor has passed
+func (s *AuthService) issueSession(user *model.User, tenant *model.Tenant) (*AuthResponse, error) {
 	// Generate JWT token
 	token, expireAt, err := s.generateToken(user)
 	if err != nil {
@@ -178,10 +340,11 @@ func (s *AuthService) Login(ctx context.Context, req *LoginRequest) (*AuthRespon
 	}
 
 	return &AuthResponse{
-		Token:    token,
-		User:     user,
-		Tenant:   tenant,
-		ExpireAt: expireAt,
+		Token:      token,
+		User:       user,
+		Tenant:     tenant,
+		ExpireAt:   expireAt,
+		KDFUpgrade: kdfUpgradeFor(user),
 	}, nil
 }
 
@@ -195,8 +358,6 @@ func (s *AuthService) OAuthLogin(ctx context.Context, provider, oauthID, email,
 		return nil, err
 	}
 
-	var tenant *model.Tenant
-
 	if user == nil {
 		// Check if user exists by email (must be pre-created/invited by admin)
 		user, err = s.userRepo.GetByEmail(ctx, email)
@@ -226,33 +387,34 @@ func (s *AuthService) OAuthLogin(ctx context.Context, provider, oauthID, email,
 		if err := s.userRepo.Update(ctx, user); err != nil {
 			return nil, err
 		}
-		tenant, err = s.tenantRepo.GetByID(ctx, user.TenantID)
-		if err != nil {
-			return nil, err
-		}
 	} else {
 		// Check user status
 		if user.Status == model.UserStatusInactive {
 			return nil, ErrUserInactive
 		}
-
-		tenant, err = s.tenantRepo.GetByID(ctx, user.TenantID)
-		if err != nil {
-			return nil, err
-		}
 	}
 
-	// Generate JWT token
-	token, expireAt, err := s.generateToken(user)
+	return s.completeLogin(ctx, user)
+}
+
+// Prelogin returns the salt and KDF parameters needed to derive the master key.
+// Unknown emails get stable fake values so the endpoint cannot be used to
+// discover which accounts exist.
+func (s *AuthService) Prelogin(ctx context.Context, req *PreloginRequest) (*PreloginResponse, error) {
+	user, err := s.userRepo.GetByEmail(ctx, req.Email)
 	if err != nil {
-		return nil, err
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		return &PreloginResponse{
+			KDFParams:     crypto.LegacyKDFParams(),
+			MasterKeySalt: base64.StdEncoding.EncodeToString(s.srp.decoy("prelogin", req.Email)),
+		}, nil
 	}
 
-	return &AuthResponse{
-		Token:    token,
-		User:     user,
-		Tenant:   tenant,
-		ExpireAt: expireAt,
+	return &PreloginResponse{
+		KDFParams:     userKDFParams(user),
+		MasterKeySalt: user.MasterKeySalt,
 	}, nil
 }
 
@@ -266,12 +428,18 @@ func (s *AuthService) GetUserSalt(ctx context.Context, userID int64) (string, er
 }
 
 func (s *AuthService) generateToken(user *model.User) (string, time.Time, error) {
-	expireAt := time.Now().Add(time.Duration(s.jwtExpire) * time.Hour)
+	return signToken(user, s.jwtSecret, s.jwtExpire)
+}
+
+// signToken issues a session token for the user's current token version
+func signToken(user *model.User, jwtSecret string, jwtExpire int) (string, time.Time, error) {
+	expireAt := time.Now().Add(time.Duration(jwtExpire) * time.Hour)
 
 	claims := &Claims{
-		UserID:   user.ID,
-		TenantID: user.TenantID,
-		Email:    user.Email,
+		UserID:       user.ID,
+		TenantID:     user.TenantID,
+		Email:        user.Email,
+		TokenVersion: user.TokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expireAt),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -280,7 +448,7 @@ func (s *AuthService) generateToken(user *model.User) (string, time.Time, error)
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(s.jwtSecret))
+	tokenString, err := token.SignedString([]byte(jwtSecret))
 	if err != nil {
 		return "", time.Time{}, err
 	}
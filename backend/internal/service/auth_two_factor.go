@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/askuy/passwordx/backend/internal/model"
+)
+
+const (
+	// mfaTokenTTL is how long a user has to pass the second factor
+	mfaTokenTTL = 5 * time.Minute
+	// maxMFAAttempts is how many wrong codes an MFA token survives
+	maxMFAAttempts = 5
+)
+
+// Second factor steps of a pending login
+const (
+	mfaStepVerify = "verify" // enter a TOTP or recovery code, or use a security key
+	mfaStepEnroll = "enroll" // the tenant requires 2FA and the user has to set it up first
+)
+
+var (
+	ErrInvalidMFAToken = errors.New("invalid or expired MFA token")
+	ErrMFAStep         = errors.New("MFA token is not valid for this step")
+)
+
+// MFATokenRequest identifies a pending login
+type MFATokenRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+}
+
+// MFACodeRequest completes a pending login with a code
+type MFACodeRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required,max=32"`
+}
+
+// mfaPendingState is the state of an mfa_pending challenge
+type mfaPendingState struct {
+	Step string `json:"step"`
+}
+
+// requireSecondFactor starts an mfa_pending challenge instead of a session
+func (s *AuthService) requireSecondFactor(ctx context.Context, user *model.User, step string, methods []string) (*AuthResponse, error) {
+	token, err := newChallengeID()
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(mfaPendingState{Step: step})
+	if err != nil {
+		return nil, err
+	}
+	expireAt := time.Now().Add(mfaTokenTTL)
+	if err := s.challengeRepo.Create(ctx, &model.AuthChallenge{
+		ID:        token,
+		UserID:    user.ID,
+		Purpose:   model.ChallengePurposeMFAPending,
+		Data:      string(data),
+		ExpiresAt: expireAt,
+	}); err != nil {
+		return nil, err
+	}
+
+	return &AuthResponse{
+		MFAToken:   token,
+		MFA:        step,
+		MFAMethods: methods,
+		ExpireAt:   expireAt,
+	}, nil
+}
+
+// VerifyTwoFactor completes a login with a TOTP or recovery code
+func (s *AuthService) VerifyTwoFactor(ctx context.Context, req *MFACodeRequest) (*AuthResponse, error) {
+	challenge, user, err := s.pendingLogin(ctx, req.MFAToken, mfaStepVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.twoFactorService.verify(ctx, user, req.Code); err != nil {
+		return nil, s.mfaFailure(ctx, challenge, err)
+	}
+	return s.finishPendingLogin(ctx, challenge, user, nil)
+}
+
+// BeginTwoFactorEnrollment returns a new TOTP seed for a user whose tenant
+// requires two-factor authentication before they can log in
+func (s *AuthService) BeginTwoFactorEnrollment(ctx context.Context, req *MFATokenRequest) (*TwoFactorEnrollment, error) {
+	_, user, err := s.pendingLogin(ctx, req.MFAToken, mfaStepEnroll)
+	if err != nil {
+		return nil, err
+	}
+	return s.twoFactorService.beginEnrollment(ctx, user)
+}
+
+// ConfirmTwoFactorEnrollment enables two-factor authentication and completes
+// the login, returning the user's first recovery codes
+func (s *AuthService) ConfirmTwoFactorEnrollment(ctx context.Context, req *MFACodeRequest) (*AuthResponse, error) {
+	challenge, user, err := s.pendingLogin(ctx, req.MFAToken, mfaStepEnroll)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := s.twoFactorService.confirmEnrollment(ctx, user, req.Code)
+	if err != nil {
+		return nil, s.mfaFailure(ctx, challenge, err)
+	}
+	return s.finishPendingLogin(ctx, challenge, user, codes)
+}
+
+// pendingLogin loads the challenge and user of an MFA token for a step
+func (s *AuthService) pendingLogin(ctx context.Context, token, step string) (*model.AuthChallenge, *model.User, error) {
+	challenge, err := s.challengeRepo.Get(ctx, token, model.ChallengePurposeMFAPending)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidMFAToken
+		}
+		return nil, nil, err
+	}
+	var state mfaPendingState
+	if err := json.Unmarshal([]byte(challenge.Data), &state); err != nil {
+		return nil, nil, err
+	}
+	if state.Step != step {
+		return nil, nil, ErrMFAStep
+	}
+
+	user, err := s.userRepo.GetByID(ctx, challenge.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidMFAToken
+		}
+		return nil, nil, err
+	}
+	if user.Status != model.UserStatusActive {
+		return nil, nil, ErrUserInactive
+	}
+	return challenge, user, nil
+}
+
+// mfaFailure counts a wrong code or failed security key against the MFA token
+func (s *AuthService) mfaFailure(ctx context.Context, challenge *model.AuthChallenge, err error) error {
+	if !errors.Is(err, ErrInvalidTwoFactorCode) && !errors.Is(err, ErrInvalidSecurityKey) {
+		return err
+	}
+	if recordErr := s.challengeRepo.RecordFailure(ctx, challenge.ID, maxMFAAttempts); recordErr != nil {
+		return recordErr
+	}
+	return err
+}
+
+// finishPendingLogin consumes the MFA token and issues the session. Consuming
+// it last means a token can complete at most one login.
+func (s *AuthService) finishPendingLogin(ctx context.Context, challenge *model.AuthChallenge, user *model.User, recoveryCodes []string) (*AuthResponse, error) {
+	if _, err := s.challengeRepo.Consume(ctx, challenge.ID, model.ChallengePurposeMFAPending); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidMFAToken
+		}
+		return nil, err
+	}
+
+	tenant, err := s.tenantRepo.GetByID(ctx, user.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.issueSession(user, tenant)
+	if err != nil {
+		return nil, err
+	}
+	resp.RecoveryCodes = recoveryCodes
+	return resp, nil
+}
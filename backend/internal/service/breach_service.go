@@ -0,0 +1,94 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/gotomicro/ego/core/econf"
+
+	"github.com/askuy/passwordx/backend/internal/pkg/breach"
+)
+
+// Range padding bounds, as in the Pwned Passwords API
+const (
+	minPaddedRange = 800
+	maxPaddedRange = 1000
+)
+
+var (
+	ErrBreachedPassword = errors.New("password appears in a known data breach")
+	ErrBreachDisabled   = errors.New("breached password checking is not configured")
+)
+
+// BreachService checks passwords against the local breach index configured
+// in [breach]. Without an index every check passes.
+type BreachService struct {
+	index    *breach.Index
+	minCount uint32
+}
+
+// NewBreachService opens the configured breach index, if any
+func NewBreachService() (*BreachService, error) {
+	s := &BreachService{minCount: uint32(max(econf.GetInt("breach.minCount"), 1))}
+
+	path := econf.GetString("breach.indexPath")
+	if path == "" {
+		return s, nil
+	}
+	index, err := breach.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open breach index: %w", err)
+	}
+	s.index = index
+	return s, nil
+}
+
+// Range returns the breached hashes starting with a five hex digit prefix.
+// With pad set, decoy entries with a count of 0 are mixed in so the response
+// size doesn't reveal the prefix.
+func (s *BreachService) Range(prefix string, pad bool) ([]breach.Entry, error) {
+	if s.index == nil {
+		return nil, ErrBreachDisabled
+	}
+	entries, err := s.index.Range(prefix)
+	if err != nil {
+		return nil, err
+	}
+	if !pad {
+		return entries, nil
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(maxPaddedRange-minPaddedRange+1))
+	if err != nil {
+		return nil, err
+	}
+	suffix := make([]byte, 18)
+	for target := minPaddedRange + int(n.Int64()); len(entries) < target; {
+		if _, err := rand.Read(suffix); err != nil {
+			return nil, err
+		}
+		entries = append(entries, breach.Entry{Suffix: strings.ToUpper(hex.EncodeToString(suffix)[:35])})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Suffix < entries[j].Suffix })
+	return entries, nil
+}
+
+// check rejects passwords seen in at least minCount breaches
+func (s *BreachService) check(password string) error {
+	if s == nil || s.index == nil {
+		return nil
+	}
+	count, err := s.index.LookupPassword(password)
+	if err != nil {
+		return err
+	}
+	if count >= s.minCount {
+		return fmt.Errorf("%w (seen %d times)", ErrBreachedPassword, count)
+	}
+	return nil
+}
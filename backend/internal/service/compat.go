@@ -0,0 +1,30 @@
+package service
+
+import (
+	"github.com/gotomicro/ego/core/econf"
+
+	"github.com/askuy/passwordx/backend/internal/model"
+)
+
+// legacyClients reports whether requests from clients that predate per-vault
+// keys and ciphertext envelopes are still accepted. The bundled web app and
+// browser extension are such clients, so this stays on until
+// app.disableLegacyClients is set.
+func legacyClients() bool {
+	return !econf.GetBool("app.disableLegacyClients")
+}
+
+// passwordLogin reports whether /api/auth/login accepts the master password.
+// It only exists so accounts that predate SRP can log in once and be
+// upgraded, and is off unless app.enablePasswordLogin is set.
+func passwordLogin() bool {
+	return econf.GetBool("app.enablePasswordLogin")
+}
+
+// legacyMember reports whether a vault member may write credentials the way
+// clients that predate vault keys do. Only members without a wrapped vault key
+// qualify: they encrypt with their master key, so vaults with a vault key keep
+// every check. Neither do members whose key was revoked by a password reset.
+func legacyMember(member *model.VaultMember) bool {
+	return legacyClients() && member.EncryptedVaultKey == "" && !member.KeyRevoked
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/askuy/passwordx/backend/internal/model"
+)
+
+// maxCustomFields limits the custom fields of one credential
+const maxCustomFields = 100
+
+var ErrInvalidCustomFields = errors.New("invalid custom fields")
+
+// CustomFieldInput adds a custom field, or changes the field with the same ID.
+// Label and value are sealed with crypto.CredentialAAD(vaultID, ItemID, name),
+// where name is "custom_fields.<id>.label" or "custom_fields.<id>.value".
+// New fields need a label and default to type text.
+type CustomFieldInput struct {
+	ID             string `json:"id" binding:"required,uuid"`
+	Type           string `json:"type" binding:"omitempty,oneof=text concealed url email date totp"`
+	LabelEncrypted string `json:"label_encrypted"`
+	ValueEncrypted string `json:"value_encrypted"`
+}
+
+// ReencryptedCustomField carries a custom field's label and value
+// re-encrypted under a new key
+type ReencryptedCustomField struct {
+	ID             string `json:"id" binding:"required"`
+	LabelEncrypted string `json:"label_encrypted" binding:"required"`
+	ValueEncrypted string `json:"value_encrypted"`
+}
+
+// customFieldCiphertexts adds the label and value of custom fields to
+// ciphertexts, named as their associated data names them
+func customFieldCiphertexts(ciphertexts map[string]string, id, label, value string) {
+	ciphertexts["custom_fields."+id+".label"] = label
+	ciphertexts["custom_fields."+id+".value"] = value
+}
+
+// applyCustomFields changes, adds, removes and then reorders the credential's
+// custom fields. New fields are appended; order, when given, must name every
+// remaining field exactly once.
+func applyCustomFields(credential *model.Credential, inputs []CustomFieldInput, remove, order []string) error {
+	fields := credential.CustomFields
+	index := make(map[string]int, len(fields))
+	for i := range fields {
+		index[fields[i].FieldID] = i
+	}
+
+	removed := make(map[string]bool, len(remove))
+	for _, id := range remove {
+		if _, ok := index[id]; !ok {
+			return fmt.Errorf("%w: no field %s to remove", ErrInvalidCustomFields, id)
+		}
+		removed[id] = true
+	}
+
+	seen := make(map[string]bool, len(inputs))
+	for _, in := range inputs {
+		if seen[in.ID] || removed[in.ID] {
+			return fmt.Errorf("%w: field %s is changed twice", ErrInvalidCustomFields, in.ID)
+		}
+		seen[in.ID] = true
+
+		if i, ok := index[in.ID]; ok {
+			if in.Type != "" {
+				fields[i].Type = in.Type
+			}
+			if in.LabelEncrypted != "" {
+				fields[i].LabelEncrypted = in.LabelEncrypted
+			}
+			if in.ValueEncrypted != "" {
+				fields[i].ValueEncrypted = in.ValueEncrypted
+			}
+			continue
+		}
+
+		if in.LabelEncrypted == "" {
+			return fmt.Errorf("%w: new field %s needs a label", ErrInvalidCustomFields, in.ID)
+		}
+		fieldType := in.Type
+		if fieldType == "" {
+			fieldType = model.CustomFieldText
+		}
+		index[in.ID] = len(fields)
+		fields = append(fields, model.CredentialField{
+			FieldID:        in.ID,
+			Type:           fieldType,
+			LabelEncrypted: in.LabelEncrypted,
+			ValueEncrypted: in.ValueEncrypted,
+		})
+	}
+
+	kept := make([]model.CredentialField, 0, len(fields))
+	for _, f := range fields {
+		if !removed[f.FieldID] {
+			kept = append(kept, f)
+		}
+	}
+	if len(kept) > maxCustomFields {
+		return fmt.Errorf("%w: at most %d fields", ErrInvalidCustomFields, maxCustomFields)
+	}
+
+	if len(order) > 0 {
+		if len(order) != len(kept) {
+			return fmt.Errorf("%w: order must list every field", ErrInvalidCustomFields)
+		}
+		byID := make(map[string]model.CredentialField, len(kept))
+		for _, f := range kept {
+			byID[f.FieldID] = f
+		}
+		kept = kept[:0]
+		for _, id := range order {
+			f, ok := byID[id]
+			if !ok {
+				return fmt.Errorf("%w: order lists unknown or repeated field %s", ErrInvalidCustomFields, id)
+			}
+			delete(byID, id)
+			kept = append(kept, f)
+		}
+	}
+
+	for i := range kept {
+		kept[i].Position = i
+	}
+	credential.CustomFields = kept
+	return nil
+}
+
+// reencryptCustomFields replaces the ciphertexts of every custom field of a
+// credential or revision; a field left out would stay encrypted under the
+// old key
+func reencryptCustomFields(fields []model.CredentialField, reencrypted []ReencryptedCustomField) error {
+	if len(reencrypted) != len(fields) {
+		return fmt.Errorf("%w: every field must be re-encrypted", ErrInvalidCustomFields)
+	}
+	byID := make(map[string]*ReencryptedCustomField, len(reencrypted))
+	for i := range reencrypted {
+		byID[reencrypted[i].ID] = &reencrypted[i]
+	}
+	for i := range fields {
+		f, ok := byID[fields[i].FieldID]
+		if !ok {
+			return fmt.Errorf("%w: field %s is not re-encrypted", ErrInvalidCustomFields, fields[i].FieldID)
+		}
+		fields[i].LabelEncrypted = f.LabelEncrypted
+		fields[i].ValueEncrypted = f.ValueEncrypted
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/askuy/passwordx/backend/internal/model"
+	"github.com/askuy/passwordx/backend/internal/repository"
+)
+
+// Usage events the clients report
+const (
+	UsageEventUse  = "use"  // copied, opened or revealed
+	UsageEventFill = "fill" // filled into a form, also counted as a use
+)
+
+type SetFavoriteRequest struct {
+	Favorite *bool `json:"favorite" binding:"required"`
+}
+
+type ReportUsageRequest struct {
+	Event string `json:"event" binding:"required,oneof=use fill"`
+}
+
+// SetFavorite marks a credential as one of the user's favorites or unmarks it
+func (s *CredentialService) SetFavorite(ctx context.Context, vaultID, credentialID, userID int64, req *SetFavoriteRequest) (*model.CredentialMetadata, error) {
+	if err := s.folderService.checkCredential(ctx, vaultID, credentialID, userID); err != nil {
+		return nil, err
+	}
+	if err := s.metadataRepo.SetFavorite(ctx, userID, credentialID, *req.Favorite); err != nil {
+		return nil, err
+	}
+	return s.metadataRepo.Get(ctx, userID, credentialID)
+}
+
+// ReportUsage records that the user used a credential now. The time is the
+// server's, so clients report as the use happens.
+func (s *CredentialService) ReportUsage(ctx context.Context, vaultID, credentialID, userID int64, req *ReportUsageRequest) (*model.CredentialMetadata, error) {
+	if err := s.folderService.checkCredential(ctx, vaultID, credentialID, userID); err != nil {
+		return nil, err
+	}
+	if err := s.metadataRepo.RecordUse(ctx, userID, credentialID, req.Event == UsageEventFill, time.Now()); err != nil {
+		return nil, err
+	}
+	return s.metadataRepo.Get(ctx, userID, credentialID)
+}
+
+// resolveFilter checks a filter and resolves it for the repository
+func (s *CredentialService) resolveFilter(ctx context.Context, userID int64, filter *CredentialFilter) (*repository.CredentialFilter, error) {
+	if err := validateTerms(filter.Terms); err != nil {
+		return nil, err
+	}
+	resolved, err := s.folderService.resolveFilter(ctx, userID, filter)
+	if err != nil {
+		return nil, err
+	}
+	resolved.Category = filter.Category
+	resolved.UpdatedSince = filter.UpdatedSince
+	resolved.Terms = filter.Terms
+	resolved.Autofill = filter.Autofill
+	resolved.Sort = filter.Sort
+	return resolved, nil
+}
+
+// annotate fills in the user's own view of each credential: where they
+// filed it and their metadata, zero if they have none yet
+func (s *CredentialService) annotate(ctx context.Context, userID int64, credentials []model.Credential) error {
+	if len(credentials) == 0 {
+		return nil
+	}
+	if err := s.folderService.organize(ctx, userID, credentials); err != nil {
+		return err
+	}
+
+	ids := make([]int64, len(credentials))
+	for i := range credentials {
+		ids[i] = credentials[i].ID
+	}
+	metadata, err := s.metadataRepo.ListByCredentialIDs(ctx, userID, ids)
+	if err != nil {
+		return err
+	}
+	byID := make(map[int64]*model.CredentialMetadata, len(metadata))
+	for i := range metadata {
+		byID[metadata[i].CredentialID] = &metadata[i]
+	}
+	for i := range credentials {
+		if m, ok := byID[credentials[i].ID]; ok {
+			credentials[i].Metadata = m
+		} else {
+			credentials[i].Metadata = &model.CredentialMetadata{}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,338 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gotomicro/ego/core/econf"
+	"gorm.io/gorm"
+
+	"github.com/askuy/passwordx/backend/internal/model"
+	"github.com/askuy/passwordx/backend/internal/repository"
+)
+
+// defaultMaxRevisions is how many revisions of a credential are kept unless
+// configured otherwise
+const defaultMaxRevisions = 20
+
+var (
+	ErrRevisionNotFound = errors.New("revision not found")
+	ErrInvalidRevisions = errors.New("invalid revisions")
+)
+
+// RevisionPolicy is how many previous versions of each credential a tenant keeps
+type RevisionPolicy struct {
+	MaxRevisions int `json:"max_revisions" binding:"required,min=1,max=1000"`
+}
+
+// ReencryptedRevision carries every ciphertext of a revision re-encrypted
+// under a new key, sealed with the same associated data as the credential's
+// current fields
+type ReencryptedRevision struct {
+	Revision          int                      `json:"revision" binding:"required"`
+	TitleEncrypted    string                   `json:"title_encrypted" binding:"required"`
+	URLEncrypted      string                   `json:"url_encrypted"`
+	UsernameEncrypted string                   `json:"username_encrypted"`
+	PasswordEncrypted string                   `json:"password_encrypted"`
+	NotesEncrypted    string                   `json:"notes_encrypted"`
+	TOTPEncrypted     string                   `json:"totp_encrypted"`
+	FieldsEncrypted   map[string]string        `json:"fields_encrypted"`
+	CustomFields      []ReencryptedCustomField `json:"custom_fields" binding:"omitempty,dive"`
+}
+
+// addCiphertexts adds the encrypted fields of the revision to ciphertexts,
+// prefixed with the revision so they do not collide with the credential's
+func (r *ReencryptedRevision) addCiphertexts(ciphertexts map[string]string) {
+	prefix := "revisions." + strconv.Itoa(r.Revision) + "."
+	revision := withFieldCiphertexts(map[string]string{
+		"title_encrypted":    r.TitleEncrypted,
+		"url_encrypted":      r.URLEncrypted,
+		"username_encrypted": r.UsernameEncrypted,
+		"password_encrypted": r.PasswordEncrypted,
+		"notes_encrypted":    r.NotesEncrypted,
+		"totp_encrypted":     r.TOTPEncrypted,
+	}, r.FieldsEncrypted)
+	for _, f := range r.CustomFields {
+		customFieldCiphertexts(revision, f.ID, f.LabelEncrypted, f.ValueEncrypted)
+	}
+	for name, value := range revision {
+		ciphertexts[prefix+name] = value
+	}
+}
+
+// configuredMaxRevisions returns the default from the [revisions] config section
+func configuredMaxRevisions() int {
+	if n := econf.GetInt("revisions.maxPerCredential"); n > 0 {
+		return n
+	}
+	return defaultMaxRevisions
+}
+
+// tenantRevisionPolicy returns the tenant's policy, or the default if it has none
+func tenantRevisionPolicy(tenant *model.Tenant) RevisionPolicy {
+	if tenant == nil || tenant.MaxRevisions == 0 {
+		return RevisionPolicy{MaxRevisions: configuredMaxRevisions()}
+	}
+	return RevisionPolicy{MaxRevisions: tenant.MaxRevisions}
+}
+
+// snapshotRevision copies the encrypted content of a credential into a
+// revision archived by the given user
+func snapshotRevision(credential *model.Credential, replacedBy int64) *model.CredentialRevision {
+	var fields map[string]string
+	if credential.FieldsEncrypted != nil {
+		fields = make(map[string]string, len(credential.FieldsEncrypted))
+		for name, value := range credential.FieldsEncrypted {
+			fields[name] = value
+		}
+	}
+	customFields := make([]model.CredentialField, len(credential.CustomFields))
+	copy(customFields, credential.CustomFields)
+
+	return &model.CredentialRevision{
+		CredentialID:      credential.ID,
+		VaultID:           credential.VaultID,
+		ItemType:          credential.ItemType,
+		TitleEncrypted:    credential.TitleEncrypted,
+		URLEncrypted:      credential.URLEncrypted,
+		UsernameEncrypted: credential.UsernameEncrypted,
+		PasswordEncrypted: credential.PasswordEncrypted,
+		NotesEncrypted:    credential.NotesEncrypted,
+		TOTPEncrypted:     credential.TOTPEncrypted,
+		FieldsEncrypted:   fields,
+		CustomFields:      customFields,
+		KeyGeneration:     credential.KeyGeneration,
+		UpdatedBy:         credential.UpdatedBy,
+		UpdatedAt:         credential.UpdatedAt,
+		ReplacedBy:        replacedBy,
+	}
+}
+
+// sameContent reports whether a revision holds the credential's current
+// encrypted content, in which case there is nothing to archive
+func sameContent(revision *model.CredentialRevision, credential *model.Credential) bool {
+	if revision.ItemType != credential.ItemType ||
+		revision.TitleEncrypted != credential.TitleEncrypted ||
+		revision.URLEncrypted != credential.URLEncrypted ||
+		revision.UsernameEncrypted != credential.UsernameEncrypted ||
+		revision.PasswordEncrypted != credential.PasswordEncrypted ||
+		revision.NotesEncrypted != credential.NotesEncrypted ||
+		revision.TOTPEncrypted != credential.TOTPEncrypted ||
+		len(revision.FieldsEncrypted) != len(credential.FieldsEncrypted) ||
+		len(revision.CustomFields) != len(credential.CustomFields) {
+		return false
+	}
+	for name, value := range revision.FieldsEncrypted {
+		if credential.FieldsEncrypted[name] != value {
+			return false
+		}
+	}
+	for i, f := range revision.CustomFields {
+		c := credential.CustomFields[i]
+		if f.FieldID != c.FieldID || f.Type != c.Type || f.LabelEncrypted != c.LabelEncrypted || f.ValueEncrypted != c.ValueEncrypted {
+			return false
+		}
+	}
+	return true
+}
+
+// restoreRevision copies a revision's encrypted content back onto the credential
+func restoreRevision(credential *model.Credential, revision *model.CredentialRevision) {
+	credential.ItemType = revision.ItemType
+	credential.TitleEncrypted = revision.TitleEncrypted
+	credential.URLEncrypted = revision.URLEncrypted
+	credential.UsernameEncrypted = revision.UsernameEncrypted
+	credential.PasswordEncrypted = revision.PasswordEncrypted
+	credential.NotesEncrypted = revision.NotesEncrypted
+	credential.TOTPEncrypted = revision.TOTPEncrypted
+	credential.FieldsEncrypted = compactFields(revision.FieldsEncrypted)
+	credential.KeyGeneration = revision.KeyGeneration
+
+	// The restored fields replace the current rows
+	credential.CustomFields = make([]model.CredentialField, len(revision.CustomFields))
+	for i, f := range revision.CustomFields {
+		f.ID = 0
+		f.CredentialID = credential.ID
+		f.Position = i
+		credential.CustomFields[i] = f
+	}
+}
+
+// reencryptRevisions replaces the ciphertexts of every revision of a
+// credential; a revision left out would stay encrypted under the old key
+func reencryptRevisions(ctx context.Context, revisionRepo *repository.CredentialRevisionRepository, credentialID int64, reencrypted []ReencryptedRevision, keyGeneration int) error {
+	revisions, err := revisionRepo.ListByCredentialID(ctx, credentialID)
+	if err != nil {
+		return err
+	}
+	if len(reencrypted) != len(revisions) {
+		return fmt.Errorf("%w: every revision must be re-encrypted", ErrInvalidRevisions)
+	}
+	byRevision := make(map[int]*ReencryptedRevision, len(reencrypted))
+	for i := range reencrypted {
+		byRevision[reencrypted[i].Revision] = &reencrypted[i]
+	}
+
+	for i := range revisions {
+		rr, ok := byRevision[revisions[i].Revision]
+		if !ok {
+			return fmt.Errorf("%w: revision %d is not re-encrypted", ErrInvalidRevisions, revisions[i].Revision)
+		}
+		revisions[i].TitleEncrypted = rr.TitleEncrypted
+		revisions[i].URLEncrypted = rr.URLEncrypted
+		revisions[i].UsernameEncrypted = rr.UsernameEncrypted
+		revisions[i].PasswordEncrypted = rr.PasswordEncrypted
+		revisions[i].NotesEncrypted = rr.NotesEncrypted
+		revisions[i].TOTPEncrypted = rr.TOTPEncrypted
+		revisions[i].FieldsEncrypted = compactFields(rr.FieldsEncrypted)
+		if err := reencryptCustomFields(revisions[i].CustomFields, rr.CustomFields); err != nil {
+			return err
+		}
+		revisions[i].KeyGeneration = keyGeneration
+		if err := revisionRepo.Update(ctx, &revisions[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// save stores an updated credential. If previous is set, it is archived as
+// the credential's newest revision and revisions beyond the tenant's policy
+// are pruned. If keyGeneration is set, the credential's ciphertexts changed
+// and it is checked against the vault with checkKeyGeneration. All of this
+// happens in one transaction.
+func (s *CredentialService) save(ctx context.Context, credential *model.Credential, previous *model.CredentialRevision, keyGeneration int) error {
+	var policy RevisionPolicy
+	if previous != nil {
+		tenant, err := s.tenantRepo.GetByID(ctx, credential.TenantID)
+		if err != nil {
+			return err
+		}
+		policy = tenantRevisionPolicy(tenant)
+	}
+
+	return s.vaultRepo.Transaction(ctx, func(tx *gorm.DB) error {
+		if keyGeneration != 0 {
+			if err := checkKeyGeneration(ctx, repository.NewVaultRepository(tx), credential.VaultID, keyGeneration); err != nil {
+				return err
+			}
+		}
+		if previous != nil {
+			revisionRepo := repository.NewCredentialRevisionRepository(tx)
+			if err := revisionRepo.Create(ctx, previous); err != nil {
+				return err
+			}
+			if err := revisionRepo.Prune(ctx, credential.ID, policy.MaxRevisions); err != nil {
+				return err
+			}
+		}
+		return repository.NewCredentialRepository(tx).Update(ctx, credential)
+	})
+}
+
+// ListRevisions returns the previous versions of a credential, newest first
+func (s *CredentialService) ListRevisions(ctx context.Context, credentialID, userID int64) ([]model.CredentialRevision, error) {
+	if _, err := s.Get(ctx, credentialID, userID); err != nil {
+		return nil, err
+	}
+	return s.revisionRepo.ListByCredentialID(ctx, credentialID)
+}
+
+// GetRevision returns one previous version of a credential
+func (s *CredentialService) GetRevision(ctx context.Context, credentialID, userID int64, revision int) (*model.CredentialRevision, error) {
+	if _, err := s.Get(ctx, credentialID, userID); err != nil {
+		return nil, err
+	}
+	rev, err := s.revisionRepo.Get(ctx, credentialID, revision)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRevisionNotFound
+		}
+		return nil, err
+	}
+	return rev, nil
+}
+
+// RestoreRevision makes a previous version the credential's current content.
+// The content it replaces becomes a revision itself, so a restore can be
+// undone like any other change.
+func (s *CredentialService) RestoreRevision(ctx context.Context, credentialID, userID int64, revision int) (*model.Credential, error) {
+	credential, err := s.credentialRepo.GetByID(ctx, credentialID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCredentialNotFound
+		}
+		return nil, err
+	}
+
+	member, err := s.vaultMemberRepo.GetByVaultAndUser(ctx, credential.VaultID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCredentialAccessDenied
+		}
+		return nil, err
+	}
+	if !model.CanEditCredentials(member.Role) {
+		return nil, ErrCredentialAccessDenied
+	}
+
+	rev, err := s.revisionRepo.Get(ctx, credentialID, revision)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRevisionNotFound
+		}
+		return nil, err
+	}
+
+	previous := snapshotRevision(credential, userID)
+	restoreRevision(credential, rev)
+	if sameContent(previous, credential) {
+		return credential, nil
+	}
+	credential.UpdatedBy = userID
+	if err := validateItem(credential); err != nil {
+		return nil, err
+	}
+
+	if err := s.save(ctx, credential, previous, rev.KeyGeneration); err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
+
+// GetRevisionPolicy returns the revision policy of the admin's tenant
+func (s *CredentialService) GetRevisionPolicy(ctx context.Context, admin *model.User) (*RevisionPolicy, error) {
+	tenant, err := s.tenantRepo.GetByID(ctx, admin.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	policy := tenantRevisionPolicy(tenant)
+	return &policy, nil
+}
+
+// SetRevisionPolicy sets the revision policy of the admin's tenant. Credentials
+// are pruned to the new limit on their next change.
+func (s *CredentialService) SetRevisionPolicy(ctx context.Context, admin *model.User, policy *RevisionPolicy) error {
+	tenant, err := s.tenantRepo.GetByID(ctx, admin.TenantID)
+	if err != nil {
+		return err
+	}
+	tenant.MaxRevisions = policy.MaxRevisions
+	return s.tenantRepo.Update(ctx, tenant)
+}
+
+// ResetRevisionPolicy makes the admin's tenant use the default policy again
+func (s *CredentialService) ResetRevisionPolicy(ctx context.Context, admin *model.User) (*RevisionPolicy, error) {
+	tenant, err := s.tenantRepo.GetByID(ctx, admin.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	tenant.MaxRevisions = 0
+	if err := s.tenantRepo.Update(ctx, tenant); err != nil {
+		return nil, err
+	}
+	policy := tenantRevisionPolicy(tenant)
+	return &policy, nil
+}
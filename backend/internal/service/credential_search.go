@@ -0,0 +1,61 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/askuy/passwordx/backend/internal/model"
+	"github.com/askuy/passwordx/backend/internal/pkg/crypto"
+)
+
+const (
+	// maxSearchTokens bounds the search tokens of one credential
+	maxSearchTokens = 200
+	// maxSearchTerms bounds the terms of one search, and maxTermTokens the
+	// tokens of a term, one per vault searched
+	maxSearchTerms = 10
+	maxTermTokens  = 500
+)
+
+var (
+	ErrInvalidSearchToken = errors.New("search token is not a valid blind index token")
+	ErrInvalidSearchTerms = errors.New("invalid search terms")
+)
+
+// searchTokens validates the search tokens of a credential and drops
+// duplicates. It never returns nil, so the result replaces any stored tokens.
+func searchTokens(tokens []string) ([]model.CredentialSearchToken, error) {
+	if len(tokens) > maxSearchTokens {
+		return nil, fmt.Errorf("%w: at most %d per credential", ErrInvalidSearchToken, maxSearchTokens)
+	}
+	result := make([]model.CredentialSearchToken, 0, len(tokens))
+	seen := make(map[string]bool, len(tokens))
+	for _, token := range tokens {
+		if !crypto.ValidSearchToken(token) {
+			return nil, ErrInvalidSearchToken
+		}
+		if !seen[token] {
+			seen[token] = true
+			result = append(result, model.CredentialSearchToken{Token: token})
+		}
+	}
+	return result, nil
+}
+
+// validateTerms checks the terms of a search
+func validateTerms(terms [][]string) error {
+	if len(terms) > maxSearchTerms {
+		return fmt.Errorf("%w: at most %d terms", ErrInvalidSearchTerms, maxSearchTerms)
+	}
+	for _, tokens := range terms {
+		if len(tokens) == 0 || len(tokens) > maxTermTokens {
+			return fmt.Errorf("%w: a term has 1 to %d tokens", ErrInvalidSearchTerms, maxTermTokens)
+		}
+		for _, token := range tokens {
+			if !crypto.ValidSearchToken(token) {
+				return fmt.Errorf("%w: %w", ErrInvalidSearchTerms, ErrInvalidSearchToken)
+			}
+		}
+	}
+	return nil
+}
@@ -3,48 +3,386 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 
 	"gorm.io/gorm"
 
 	"github.com/askuy/passwordx/backend/internal/model"
+	"github.com/askuy/passwordx/backend/internal/pkg/crypto"
+	"github.com/askuy/passwordx/backend/internal/pkg/domain"
+	"github.com/askuy/passwordx/backend/internal/pkg/itemtype"
 	"github.com/askuy/passwordx/backend/internal/repository"
 )
 
 var (
 	ErrCredentialNotFound     = errors.New("credential not found")
 	ErrCredentialAccessDenied = errors.New("credential access denied")
+	ErrInvalidCiphertext      = errors.New("encrypted field is not a valid ciphertext envelope")
+	ErrItemIDRequired         = errors.New("item_id is required to bind ciphertexts to the credential")
+	ErrItemIDImmutable        = errors.New("item_id cannot be changed once set")
+	ErrInvalidItem            = errors.New("item does not match its type")
+	ErrInvalidMatchMode       = errors.New("match_mode must be one of base_domain, host, exact, starts_with, regex or never")
 )
 
 type CredentialService struct {
 	credentialRepo  *repository.CredentialRepository
+	vaultRepo       *repository.VaultRepository
 	vaultMemberRepo *repository.VaultMemberRepository
+	tenantRepo      *repository.TenantRepository
+	revisionRepo    *repository.CredentialRevisionRepository
+	metadataRepo    *repository.CredentialMetadataRepository
+	folderService   *FolderService
 }
 
-func NewCredentialService(credentialRepo *repository.CredentialRepository, vaultMemberRepo *repository.VaultMemberRepository) *CredentialService {
+func NewCredentialService(credentialRepo *repository.CredentialRepository, vaultRepo *repository.VaultRepository, vaultMemberRepo *repository.VaultMemberRepository, tenantRepo *repository.TenantRepository, revisionRepo *repository.CredentialRevisionRepository, metadataRepo *repository.CredentialMetadataRepository, folderService *FolderService) *CredentialService {
 	return &CredentialService{
 		credentialRepo:  credentialRepo,
+		vaultRepo:       vaultRepo,
 		vaultMemberRepo: vaultMemberRepo,
+		tenantRepo:      tenantRepo,
+		revisionRepo:    revisionRepo,
+		metadataRepo:    metadataRepo,
+		folderService:   folderService,
 	}
 }
 
+// CreateCredentialRequest is the request body for creating a credential. Every
+// encrypted field must be sealed with crypto.CredentialAAD(vaultID, ItemID, field),
+// where field is the JSON name, or "fields_encrypted.<name>" for the field map.
+// Only clients that predate envelopes, writing to legacy vaults, omit ItemID.
+// Which fields are required depends on the item type, login by default.
+// CustomFields are stored in the order given.
 type CreateCredentialRequest struct {
-	TitleEncrypted    string `json:"title_encrypted" binding:"required"`
-	URLEncrypted      string `json:"url_encrypted"`
-	UsernameEncrypted string `json:"username_encrypted"`
-	PasswordEncrypted string `json:"password_encrypted" binding:"required"`
-	NotesEncrypted    string `json:"notes_encrypted"`
-	Category          string `json:"category"`
-	Favicon           string `json:"favicon"`
+	ItemID         string `json:"item_id" binding:"omitempty,uuid"`
+	ItemType       string `json:"item_type"`
+	TitleEncrypted string `json:"title_encrypted" binding:"required"`
+	CredentialCiphertexts
+	CustomFields  []CustomFieldInput `json:"custom_fields" binding:"omitempty,max=100,dive"`
+	Category      string             `json:"category"`
+	Favicon       string             `json:"favicon"`
+	MatchMode     string             `json:"match_mode"` // base_domain by default
+	SearchTokens  []string           `json:"search_tokens"`
+	KeyGeneration int                `json:"key_generation"` // vault key generation used to encrypt the fields, see writeKeyGeneration
 }
 
+// UpdateCredentialRequest is the request body for updating a credential.
+// ItemID may only be supplied to bind a legacy credential that has none yet.
+// Entries of FieldsEncrypted replace those of the same name; Clear removes
+// fields, which changing ItemType may need. CustomFields change the custom
+// fields with the same ID and append new ones, RemoveCustomFields drops
+// fields by ID and CustomFieldOrder, when given, lists every remaining
+// field ID in its new order.
 type UpdateCredentialRequest struct {
-	TitleEncrypted    string `json:"title_encrypted"`
-	URLEncrypted      string `json:"url_encrypted"`
-	UsernameEncrypted string `json:"username_encrypted"`
-	PasswordEncrypted string `json:"password_encrypted"`
-	NotesEncrypted    string `json:"notes_encrypted"`
-	Category          string `json:"category"`
-	Favicon           string `json:"favicon"`
+	ItemID         string `json:"item_id" binding:"omitempty,uuid"`
+	ItemType       string `json:"item_type"`
+	TitleEncrypted string `json:"title_encrypted"`
+	CredentialCiphertexts
+	CustomFields       []CustomFieldInput `json:"custom_fields" binding:"omitempty,max=100,dive"`
+	RemoveCustomFields []string           `json:"remove_custom_fields"`
+	CustomFieldOrder   []string           `json:"custom_field_order"`
+	RemoveTOTP         bool               `json:"remove_totp"` // clears the one-time password seed
+	Clear              []string           `json:"clear"`       // names of fields to remove
+	Category           string             `json:"category"`
+	Favicon            string             `json:"favicon"`
+	MatchMode          string             `json:"match_mode"`
+	SearchTokens       []string           `json:"search_tokens"`  // replaces all search tokens when present, [] removes them
+	KeyGeneration      int                `json:"key_generation"` // required when any encrypted field or the search tokens change
+}
+
+// CredentialCiphertexts are the encrypted fields every credential write
+// carries besides the title, whose binding differs between writes
+type CredentialCiphertexts struct {
+	URLEncrypted      string            `json:"url_encrypted"`
+	UsernameEncrypted string            `json:"username_encrypted"`
+	PasswordEncrypted string            `json:"password_encrypted"`
+	NotesEncrypted    string            `json:"notes_encrypted"`
+	TOTPEncrypted     string            `json:"totp_encrypted"`
+	FieldsEncrypted   map[string]string `json:"fields_encrypted"`
+}
+
+// ciphertexts returns the fields and the title keyed by JSON name
+func (c *CredentialCiphertexts) ciphertexts(title string) map[string]string {
+	return withFieldCiphertexts(map[string]string{
+		"title_encrypted":    title,
+		"url_encrypted":      c.URLEncrypted,
+		"username_encrypted": c.UsernameEncrypted,
+		"password_encrypted": c.PasswordEncrypted,
+		"notes_encrypted":    c.NotesEncrypted,
+		"totp_encrypted":     c.TOTPEncrypted,
+	}, c.FieldsEncrypted)
+}
+
+// ciphertexts returns the encrypted fields of the request keyed by JSON name
+func (r *CreateCredentialRequest) ciphertexts() map[string]string {
+	ciphertexts := r.CredentialCiphertexts.ciphertexts(r.TitleEncrypted)
+	for _, f := range r.CustomFields {
+		customFieldCiphertexts(ciphertexts, f.ID, f.LabelEncrypted, f.ValueEncrypted)
+	}
+	return ciphertexts
+}
+
+// ciphertexts returns the encrypted fields of the request keyed by JSON name
+func (r *UpdateCredentialRequest) ciphertexts() map[string]string {
+	ciphertexts := r.CredentialCiphertexts.ciphertexts(r.TitleEncrypted)
+	for _, f := range r.CustomFields {
+		customFieldCiphertexts(ciphertexts, f.ID, f.LabelEncrypted, f.ValueEncrypted)
+	}
+	return ciphertexts
+}
+
+// hasEncryptedFields reports whether the update replaces any ciphertext
+func (r *UpdateCredentialRequest) hasEncryptedFields() bool {
+	for _, v := range r.ciphertexts() {
+		if v != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// ReencryptedCredential carries every ciphertext of a credential re-encrypted
+// under a new key. Fields left empty are cleared on the stored credential;
+// CustomFields, Attachments and Revisions must cover every custom field,
+// attachment and revision of the credential.
+type ReencryptedCredential struct {
+	ID             int64  `json:"id" binding:"required"`
+	ItemID         string `json:"item_id" binding:"omitempty,uuid"` // required for legacy credentials without one
+	TitleEncrypted string `json:"title_encrypted" binding:"required"`
+	CredentialCiphertexts
+	CustomFields []ReencryptedCustomField `json:"custom_fields" binding:"omitempty,dive"`
+	Attachments  []ReencryptedAttachment  `json:"attachments" binding:"omitempty,dive"`
+	Revisions    []ReencryptedRevision    `json:"revisions" binding:"omitempty,dive"`
+	SearchTokens []string                 `json:"search_tokens"` // computed with the new index key
+}
+
+// ciphertexts returns the encrypted fields of the request keyed by JSON name
+func (r *ReencryptedCredential) ciphertexts() map[string]string {
+	ciphertexts := r.CredentialCiphertexts.ciphertexts(r.TitleEncrypted)
+	for _, f := range r.CustomFields {
+		customFieldCiphertexts(ciphertexts, f.ID, f.LabelEncrypted, f.ValueEncrypted)
+	}
+	for _, a := range r.Attachments {
+		attachmentCiphertexts(ciphertexts, a.AttachmentID, a.FileNameEncrypted, a.KeyEncrypted)
+	}
+	for i := range r.Revisions {
+		r.Revisions[i].addCiphertexts(ciphertexts)
+	}
+	return ciphertexts
+}
+
+// withFieldCiphertexts adds the entries of a field map to ciphertexts, named
+// as their associated data names them
+func withFieldCiphertexts(ciphertexts, fields map[string]string) map[string]string {
+	for name, value := range fields {
+		ciphertexts["fields_encrypted."+name] = value
+	}
+	return ciphertexts
+}
+
+// applyTo replaces the credential's ciphertexts and records the key generation
+func (r *ReencryptedCredential) applyTo(credential *model.Credential, keyGeneration int) error {
+	itemID, err := resolveItemID(credential, r.ItemID)
+	if err != nil {
+		return err
+	}
+	credential.ItemID = itemID
+	credential.TitleEncrypted = r.TitleEncrypted
+	credential.URLEncrypted = r.URLEncrypted
+	credential.UsernameEncrypted = r.UsernameEncrypted
+	credential.PasswordEncrypted = r.PasswordEncrypted
+	credential.NotesEncrypted = r.NotesEncrypted
+	credential.TOTPEncrypted = r.TOTPEncrypted
+	credential.FieldsEncrypted = compactFields(r.FieldsEncrypted)
+	if err := reencryptCustomFields(credential.CustomFields, r.CustomFields); err != nil {
+		return err
+	}
+	if err := reencryptAttachments(credential, r.Attachments, keyGeneration); err != nil {
+		return err
+	}
+	if credential.SearchTokens, err = searchTokens(r.SearchTokens); err != nil {
+		return err
+	}
+	credential.KeyGeneration = keyGeneration
+	return validateItem(credential)
+}
+
+// resolveItemID returns the item ID new ciphertexts of the credential are bound
+// to. Legacy credentials get the requested ID; existing IDs never change,
+// because that would orphan every ciphertext already bound to them.
+func resolveItemID(credential *model.Credential, requested string) (string, error) {
+	if credential.ItemID == "" {
+		if requested == "" {
+			return "", ErrItemIDRequired
+		}
+		return requested, nil
+	}
+	if requested != "" && requested != credential.ItemID {
+		return "", ErrItemIDImmutable
+	}
+	return credential.ItemID, nil
+}
+
+// isUnbound reports whether the credential still has ciphertexts that are not
+// bound to their item and field and therefore need to be migrated
+func isUnbound(credential *model.Credential) bool {
+	if credential.ItemID == "" {
+		return true
+	}
+	for _, value := range []string{
+		credential.TitleEncrypted,
+		credential.URLEncrypted,
+		credential.UsernameEncrypted,
+		credential.PasswordEncrypted,
+		credential.NotesEncrypted,
+		credential.TOTPEncrypted,
+	} {
+		if value != "" && !crypto.IsBound(value) {
+			return true
+		}
+	}
+	for _, value := range credential.FieldsEncrypted {
+		if !crypto.IsBound(value) {
+			return true
+		}
+	}
+	for _, f := range credential.CustomFields {
+		if !crypto.IsBound(f.LabelEncrypted) || (f.ValueEncrypted != "" && !crypto.IsBound(f.ValueEncrypted)) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateItem checks the credential's fields against the schema of its type
+func validateItem(credential *model.Credential) error {
+	t, err := itemtype.Lookup(credential.ItemType)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidItem, err)
+	}
+
+	present := make([]string, 0, 5+len(credential.FieldsEncrypted))
+	for name, value := range map[string]string{
+		itemtype.FieldURL:      credential.URLEncrypted,
+		itemtype.FieldUsername: credential.UsernameEncrypted,
+		itemtype.FieldPassword: credential.PasswordEncrypted,
+		itemtype.FieldNotes:    credential.NotesEncrypted,
+		itemtype.FieldTOTP:     credential.TOTPEncrypted,
+	} {
+		if value != "" {
+			present = append(present, name)
+		}
+	}
+	for name := range credential.FieldsEncrypted {
+		if itemtype.IsStandardField(name) {
+			return fmt.Errorf("%w: %s belongs in %s_encrypted", ErrInvalidItem, name, name)
+		}
+		present = append(present, name)
+	}
+
+	if err := t.Validate(present); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidItem, err)
+	}
+	return nil
+}
+
+// compactFields drops empty entries from a field map
+func compactFields(fields map[string]string) map[string]string {
+	compact := make(map[string]string, len(fields))
+	for name, value := range fields {
+		if value != "" {
+			compact[name] = value
+		}
+	}
+	if len(compact) == 0 {
+		return nil
+	}
+	return compact
+}
+
+// clearField removes a field's value from the credential
+func clearField(credential *model.Credential, name string) {
+	switch name {
+	case itemtype.FieldURL:
+		credential.URLEncrypted = ""
+	case itemtype.FieldUsername:
+		credential.UsernameEncrypted = ""
+	case itemtype.FieldPassword:
+		credential.PasswordEncrypted = ""
+	case itemtype.FieldNotes:
+		credential.NotesEncrypted = ""
+	case itemtype.FieldTOTP:
+		credential.TOTPEncrypted = ""
+	default:
+		delete(credential.FieldsEncrypted, name)
+	}
+}
+
+// validateCiphertexts checks that every non-empty field is a well-formed,
+// AAD-bound envelope encrypted under the given key generation, so plaintext
+// and unbound ciphertexts can never be stored
+func validateCiphertexts(fields map[string]string, keyGeneration int) error {
+	for name, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := crypto.ValidateEnvelope(value, keyGeneration); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidCiphertext, name)
+		}
+	}
+	return nil
+}
+
+// validateMemberCiphertexts validates the ciphertexts a vault member writes.
+// Legacy members may also write the bare ciphertexts of clients that predate
+// envelopes; those stay unbound and are listed by ListUnbound until migrated.
+func validateMemberCiphertexts(member *model.VaultMember, fields map[string]string, keyGeneration int) error {
+	if !legacyMember(member) {
+		return validateCiphertexts(fields, keyGeneration)
+	}
+	for name, value := range fields {
+		if value == "" {
+			continue
+		}
+		if crypto.ValidateLegacy(value) != nil && crypto.ValidateEnvelope(value, keyGeneration) != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidCiphertext, name)
+		}
+	}
+	return nil
+}
+
+// checkKeyGeneration rejects writes encrypted under anything but the vault's
+// current key. It locks the vault row, so it must run in the transaction that
+// stores the write: a concurrent key rotation then either commits first and the
+// write is stale, or waits until the write is stored and has to include it.
+func checkKeyGeneration(ctx context.Context, vaultRepo *repository.VaultRepository, vaultID int64, keyGeneration int) error {
+	vault, err := vaultRepo.GetForUpdate(ctx, vaultID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrVaultNotFound
+		}
+		return err
+	}
+	if keyGeneration != vault.KeyGeneration {
+		return ErrStaleKeyGeneration
+	}
+	return nil
+}
+
+// writeKeyGeneration returns the key generation a write's ciphertexts are
+// encrypted under. Clients that predate vault keys omit it; their writes to
+// legacy vaults count as the vault's current generation.
+func (s *CredentialService) writeKeyGeneration(ctx context.Context, member *model.VaultMember, keyGeneration int) (int, error) {
+	if keyGeneration != 0 || !legacyMember(member) {
+		return keyGeneration, nil
+	}
+	vault, err := s.vaultRepo.GetByID(ctx, member.VaultID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, ErrVaultNotFound
+		}
+		return 0, err
+	}
+	return vault.KeyGeneration, nil
 }
 
 // Create creates a new credential in a vault
@@ -62,19 +400,63 @@ func (s *CredentialService) Create(ctx context.Context, vaultID, tenantID, userI
 		return nil, ErrCredentialAccessDenied
 	}
 
+	if req.ItemID == "" && !legacyMember(member) {
+		return nil, ErrItemIDRequired
+	}
+	keyGeneration, err := s.writeKeyGeneration(ctx, member, req.KeyGeneration)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateMemberCiphertexts(member, req.ciphertexts(), keyGeneration); err != nil {
+		return nil, err
+	}
+
+	itemType := req.ItemType
+	if itemType == "" {
+		itemType = itemtype.Login
+	}
+	matchMode := req.MatchMode
+	if matchMode == "" {
+		matchMode = string(domain.MatchBaseDomain)
+	}
+	if !domain.ValidMatchMode(matchMode) {
+		return nil, ErrInvalidMatchMode
+	}
 	credential := &model.Credential{
 		VaultID:           vaultID,
 		TenantID:          tenantID,
+		ItemID:            req.ItemID,
+		ItemType:          itemType,
 		TitleEncrypted:    req.TitleEncrypted,
 		URLEncrypted:      req.URLEncrypted,
 		UsernameEncrypted: req.UsernameEncrypted,
 		PasswordEncrypted: req.PasswordEncrypted,
 		NotesEncrypted:    req.NotesEncrypted,
+		TOTPEncrypted:     req.TOTPEncrypted,
+		FieldsEncrypted:   compactFields(req.FieldsEncrypted),
 		Category:          req.Category,
 		Favicon:           req.Favicon,
+		MatchMode:         matchMode,
+		KeyGeneration:     keyGeneration,
+		UpdatedBy:         userID,
+	}
+	if err := applyCustomFields(credential, req.CustomFields, nil, nil); err != nil {
+		return nil, err
+	}
+	if err := validateItem(credential); err != nil {
+		return nil, err
+	}
+	if credential.SearchTokens, err = searchTokens(req.SearchTokens); err != nil {
+		return nil, err
 	}
 
-	if err := s.credentialRepo.Create(ctx, credential); err != nil {
+	err = s.vaultRepo.Transaction(ctx, func(tx *gorm.DB) error {
+		if err := checkKeyGeneration(ctx, repository.NewVaultRepository(tx), vaultID, keyGeneration); err != nil {
+			return err
+		}
+		return repository.NewCredentialRepository(tx).Create(ctx, credential)
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -104,25 +486,70 @@ func (s *CredentialService) Get(ctx context.Context, credentialID, userID int64)
 		return nil, ErrCredentialAccessDenied
 	}
 
-	return credential, nil
+	credentials := []model.Credential{*credential}
+	if err := s.annotate(ctx, userID, credentials); err != nil {
+		return nil, err
+	}
+	return &credentials[0], nil
 }
 
-// List returns all credentials in a vault
-func (s *CredentialService) List(ctx context.Context, vaultID, userID int64) ([]model.Credential, error) {
+// List returns a page of the credentials in a vault, narrowed and sorted as
+// filter asks if it is not nil, and the cursor of the next page
+func (s *CredentialService) List(ctx context.Context, vaultID, userID int64, filter *CredentialFilter, page repository.Page) ([]model.Credential, string, error) {
 	// Check if user has view permission
 	member, err := s.vaultMemberRepo.GetByVaultAndUser(ctx, vaultID, userID)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, ErrCredentialAccessDenied
+			return nil, "", ErrCredentialAccessDenied
 		}
-		return nil, err
+		return nil, "", err
 	}
 
 	if !model.CanViewCredentials(member.Role) {
-		return nil, ErrCredentialAccessDenied
+		return nil, "", ErrCredentialAccessDenied
+	}
+
+	if filter == nil {
+		filter = &CredentialFilter{}
+	}
+	resolved, err := s.resolveFilter(ctx, userID, filter)
+	if err != nil {
+		return nil, "", err
+	}
+	resolved.VaultID = vaultID
+	vault, err := s.vaultRepo.GetByID(ctx, vaultID)
+	if err != nil {
+		return nil, "", err
+	}
+	credentials, next, err := s.credentialRepo.ListByUserVaults(ctx, vault.TenantID, userID, resolved, page)
+	if err != nil {
+		return nil, "", err
 	}
 
-	return s.credentialRepo.ListByVaultID(ctx, vaultID)
+	if err := s.annotate(ctx, userID, credentials); err != nil {
+		return nil, "", err
+	}
+	return credentials, next, nil
+}
+
+// ListUnbound returns the credentials in a page of a vault's credentials that
+// still hold ciphertexts without associated data, and the cursor of the next
+// page. Pages may hold none while more follow. Clients migrate them by
+// decrypting each field with crypto.DecryptUnbound and writing it back bound
+// to a new item ID.
+func (s *CredentialService) ListUnbound(ctx context.Context, vaultID, userID int64, page repository.Page) ([]model.Credential, string, error) {
+	credentials, next, err := s.List(ctx, vaultID, userID, nil, page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	unbound := make([]model.Credential, 0)
+	for i := range credentials {
+		if isUnbound(&credentials[i]) {
+			unbound = append(unbound, credentials[i])
+		}
+	}
+	return unbound, next, nil
 }
 
 // Update updates a credential
@@ -148,6 +575,46 @@ func (s *CredentialService) Update(ctx context.Context, credentialID, userID int
 		return nil, ErrCredentialAccessDenied
 	}
 
+	// The content about to be replaced, archived if the update changes it
+	previous := snapshotRevision(credential, userID)
+
+	// Legacy members may keep writing unbound ciphertexts to a credential
+	// without an item ID
+	unbound := credential.ItemID == "" && req.ItemID == "" && legacyMember(member)
+	if req.ItemID != "" || (req.hasEncryptedFields() && !unbound) {
+		itemID, err := resolveItemID(credential, req.ItemID)
+		if err != nil {
+			return nil, err
+		}
+		credential.ItemID = itemID
+	}
+
+	// Checked against the vault when the update is saved; zero skips the check
+	keyGeneration := 0
+	if req.hasEncryptedFields() || req.SearchTokens != nil {
+		if keyGeneration, err = s.writeKeyGeneration(ctx, member, req.KeyGeneration); err != nil {
+			return nil, err
+		}
+		// Generations start at 1
+		if keyGeneration == 0 {
+			return nil, ErrStaleKeyGeneration
+		}
+	}
+	if req.SearchTokens != nil {
+		if credential.SearchTokens, err = searchTokens(req.SearchTokens); err != nil {
+			return nil, err
+		}
+	}
+	if req.hasEncryptedFields() {
+		if err := validateMemberCiphertexts(member, req.ciphertexts(), keyGeneration); err != nil {
+			return nil, err
+		}
+		credential.KeyGeneration = keyGeneration
+	}
+
+	if req.ItemType != "" {
+		credential.ItemType = req.ItemType
+	}
 	if req.TitleEncrypted != "" {
 		credential.TitleEncrypted = req.TitleEncrypted
 	}
@@ -163,21 +630,53 @@ func (s *CredentialService) Update(ctx context.Context, credentialID, userID int
 	if req.NotesEncrypted != "" {
 		credential.NotesEncrypted = req.NotesEncrypted
 	}
+	if req.TOTPEncrypted != "" {
+		credential.TOTPEncrypted = req.TOTPEncrypted
+	} else if req.RemoveTOTP {
+		credential.TOTPEncrypted = ""
+	}
+	for name, value := range compactFields(req.FieldsEncrypted) {
+		if credential.FieldsEncrypted == nil {
+			credential.FieldsEncrypted = make(map[string]string)
+		}
+		credential.FieldsEncrypted[name] = value
+	}
+	for _, name := range req.Clear {
+		clearField(credential, name)
+	}
+	credential.FieldsEncrypted = compactFields(credential.FieldsEncrypted)
+	if err := applyCustomFields(credential, req.CustomFields, req.RemoveCustomFields, req.CustomFieldOrder); err != nil {
+		return nil, err
+	}
 	if req.Category != "" {
 		credential.Category = req.Category
 	}
 	if req.Favicon != "" {
 		credential.Favicon = req.Favicon
 	}
+	if req.MatchMode != "" {
+		if !domain.ValidMatchMode(req.MatchMode) {
+			return nil, ErrInvalidMatchMode
+		}
+		credential.MatchMode = req.MatchMode
+	}
+	if err := validateItem(credential); err != nil {
+		return nil, err
+	}
 
-	if err := s.credentialRepo.Update(ctx, credential); err != nil {
+	if sameContent(previous, credential) {
+		previous = nil
+	} else {
+		credential.UpdatedBy = userID
+	}
+	if err := s.save(ctx, credential, previous, keyGeneration); err != nil {
 		return nil, err
 	}
 
 	return credential, nil
 }
 
-// Delete deletes a credential
+// Delete moves a credential to the trash, see TrashService
 func (s *CredentialService) Delete(ctx context.Context, credentialID, userID int64) error {
 	credential, err := s.credentialRepo.GetByID(ctx, credentialID)
 	if err != nil {
@@ -203,10 +702,24 @@ func (s *CredentialService) Delete(ctx context.Context, credentialID, userID int
 	return s.credentialRepo.Delete(ctx, credentialID)
 }
 
-// Search searches credentials across user's vaults
-func (s *CredentialService) Search(ctx context.Context, tenantID, userID int64, query string) ([]model.Credential, error) {
-	if query == "" {
-		return s.credentialRepo.ListByUserVaults(ctx, tenantID, userID)
+// Search returns a page of the credentials across user's vaults, narrowed and
+// sorted as filter asks if it is not nil, and the cursor of the next page
+func (s *CredentialService) Search(ctx context.Context, tenantID, userID int64, filter *CredentialFilter, page repository.Page) ([]model.Credential, string, error) {
+	var resolved *repository.CredentialFilter
+	if filter != nil {
+		var err error
+		if resolved, err = s.resolveFilter(ctx, userID, filter); err != nil {
+			return nil, "", err
+		}
+	}
+
+	credentials, next, err := s.credentialRepo.ListByUserVaults(ctx, tenantID, userID, resolved, page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := s.annotate(ctx, userID, credentials); err != nil {
+		return nil, "", err
 	}
-	return s.credentialRepo.SearchByURL(ctx, tenantID, userID, query)
+	return credentials, next, nil
 }
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/askuy/passwordx/backend/internal/model"
+	"github.com/askuy/passwordx/backend/internal/pkg/domain"
+	"github.com/askuy/passwordx/backend/internal/repository"
+)
+
+// maxDomainGroups bounds the equivalent domain groups of a tenant or a user
+const maxDomainGroups = 200
+
+var (
+	ErrDomainGroupNotFound = errors.New("equivalent domain group not found")
+	ErrInvalidDomain       = errors.New("not a registrable domain")
+	ErrDomainGrouped       = errors.New("domain is already in another equivalent domain group")
+	ErrTooManyDomainGroups = errors.New("too many equivalent domain groups")
+)
+
+// DomainService manages equivalent domain groups. Clients fetch them with
+// List to expand the domain of the page they autofill before they compute
+// its search tokens, see pkg/domain.
+type DomainService struct {
+	groupRepo *repository.EquivalentDomainRepository
+}
+
+func NewDomainService(groupRepo *repository.EquivalentDomainRepository) *DomainService {
+	return &DomainService{
+		groupRepo: groupRepo,
+	}
+}
+
+// EquivalentDomainsRequest sets the domains of a group. Each is reduced to
+// its registrable domain, so "www.example.co.uk" is stored as "example.co.uk".
+type EquivalentDomainsRequest struct {
+	Domains []string `json:"domains" binding:"required,min=2,max=50"`
+}
+
+// EquivalentDomains are the groups that apply to a user
+type EquivalentDomains struct {
+	Tenant []model.EquivalentDomainGroup `json:"tenant"` // managed by tenant admins
+	User   []model.EquivalentDomainGroup `json:"user"`   // the user's own
+}
+
+// normalizeDomains reduces the requested domains to distinct registrable
+// domains, of which a group needs two
+func normalizeDomains(requested []string) ([]string, error) {
+	domains := make([]string, 0, len(requested))
+	seen := make(map[string]bool, len(requested))
+	for _, d := range requested {
+		registrable, err := domain.Registrable(d)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidDomain, d)
+		}
+		if !seen[registrable] {
+			seen[registrable] = true
+			domains = append(domains, registrable)
+		}
+	}
+	if len(domains) < 2 {
+		return nil, fmt.Errorf("%w: a group needs at least two different domains", ErrInvalidDomain)
+	}
+	return domains, nil
+}
+
+// List returns the tenant's groups and the user's own
+func (s *DomainService) List(ctx context.Context, tenantID, userID int64) (*EquivalentDomains, error) {
+	tenant, err := s.groupRepo.ListByOwner(ctx, tenantID, 0)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.groupRepo.ListByOwner(ctx, tenantID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &EquivalentDomains{Tenant: tenant, User: user}, nil
+}
+
+// ListTenantGroups returns the groups of the admin's tenant
+func (s *DomainService) ListTenantGroups(ctx context.Context, admin *model.User) ([]model.EquivalentDomainGroup, error) {
+	return s.groupRepo.ListByOwner(ctx, admin.TenantID, 0)
+}
+
+// CreateGroup creates a group of the user's own
+func (s *DomainService) CreateGroup(ctx context.Context, tenantID, userID int64, req *EquivalentDomainsRequest) (*model.EquivalentDomainGroup, error) {
+	return s.create(ctx, tenantID, userID, req)
+}
+
+// CreateTenantGroup creates a group for the admin's tenant
+func (s *DomainService) CreateTenantGroup(ctx context.Context, admin *model.User, req *EquivalentDomainsRequest) (*model.EquivalentDomainGroup, error) {
+	return s.create(ctx, admin.TenantID, 0, req)
+}
+
+// UpdateGroup replaces the domains of a group of the user's own
+func (s *DomainService) UpdateGroup(ctx context.Context, tenantID, userID, groupID int64, req *EquivalentDomainsRequest) (*model.EquivalentDomainGroup, error) {
+	return s.update(ctx, tenantID, userID, groupID, req)
+}
+
+// UpdateTenantGroup replaces the domains of a group of the admin's tenant
+func (s *DomainService) UpdateTenantGroup(ctx context.Context, admin *model.User, groupID int64, req *EquivalentDomainsRequest) (*model.EquivalentDomainGroup, error) {
+	return s.update(ctx, admin.TenantID, 0, groupID, req)
+}
+
+// DeleteGroup deletes a group of the user's own
+func (s *DomainService) DeleteGroup(ctx context.Context, tenantID, userID, groupID int64) error {
+	return s.delete(ctx, tenantID, userID, groupID)
+}
+
+// DeleteTenantGroup deletes a group of the admin's tenant
+func (s *DomainService) DeleteTenantGroup(ctx context.Context, admin *model.User, groupID int64) error {
+	return s.delete(ctx, admin.TenantID, 0, groupID)
+}
+
+// checkOverlap makes sure no other group of the same owner has one of the
+// domains, so every domain belongs to at most one group per owner
+func (s *DomainService) checkOverlap(ctx context.Context, tenantID, userID, groupID int64, domains []string) (int, error) {
+	groups, err := s.groupRepo.ListByOwner(ctx, tenantID, userID)
+	if err != nil {
+		return 0, err
+	}
+	for _, g := range groups {
+		if g.ID == groupID {
+			continue
+		}
+		for _, d := range domains {
+			for _, existing := range g.Domains {
+				if d == existing {
+					return 0, fmt.Errorf("%w: %s", ErrDomainGrouped, d)
+				}
+			}
+		}
+	}
+	return len(groups), nil
+}
+
+func (s *DomainService) create(ctx context.Context, tenantID, userID int64, req *EquivalentDomainsRequest) (*model.EquivalentDomainGroup, error) {
+	domains, err := normalizeDomains(req.Domains)
+	if err != nil {
+		return nil, err
+	}
+	count, err := s.checkOverlap(ctx, tenantID, userID, 0, domains)
+	if err != nil {
+		return nil, err
+	}
+	if count >= maxDomainGroups {
+		return nil, ErrTooManyDomainGroups
+	}
+
+	group := &model.EquivalentDomainGroup{
+		TenantID: tenantID,
+		UserID:   userID,
+		Domains:  domains,
+	}
+	if err := s.groupRepo.Create(ctx, group); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// getGroup returns a group of the given owner
+func (s *DomainService) getGroup(ctx context.Context, tenantID, userID, groupID int64) (*model.EquivalentDomainGroup, error) {
+	group, err := s.groupRepo.GetByID(ctx, groupID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDomainGroupNotFound
+		}
+		return nil, err
+	}
+	if group.TenantID != tenantID || group.UserID != userID {
+		return nil, ErrDomainGroupNotFound
+	}
+	return group, nil
+}
+
+func (s *DomainService) update(ctx context.Context, tenantID, userID, groupID int64, req *EquivalentDomainsRequest) (*model.EquivalentDomainGroup, error) {
+	group, err := s.getGroup(ctx, tenantID, userID, groupID)
+	if err != nil {
+		return nil, err
+	}
+	domains, err := normalizeDomains(req.Domains)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.checkOverlap(ctx, tenantID, userID, groupID, domains); err != nil {
+		return nil, err
+	}
+
+	group.Domains = domains
+	if err := s.groupRepo.Update(ctx, group); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+func (s *DomainService) delete(ctx context.Context, tenantID, userID, groupID int64) error {
+	if _, err := s.getGroup(ctx, tenantID, userID, groupID); err != nil {
+		return err
+	}
+	return s.groupRepo.Delete(ctx, groupID)
+}
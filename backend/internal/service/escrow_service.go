@@ -0,0 +1,809 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/askuy/passwordx/backend/internal/model"
+	"github.com/askuy/passwordx/backend/internal/pkg/crypto"
+	"github.com/askuy/passwordx/backend/internal/pkg/shamir"
+	"github.com/askuy/passwordx/backend/internal/repository"
+)
+
+var (
+	ErrEscrowDisabled        = errors.New("organization escrow is not enabled")
+	ErrEscrowKeyChanged      = errors.New("escrow key has changed, fetch the escrow policy and enroll again")
+	ErrInvalidEscrowPolicy   = errors.New("threshold must be between 1 and the number of shares")
+	ErrInvalidShareHolder    = errors.New("share holders must be distinct active admins of the tenant with a keypair")
+	ErrInvalidEscrowShare    = errors.New("invalid encrypted escrow share")
+	ErrEscrowNotEnrolled     = errors.New("user has not escrowed their keys")
+	ErrEscrowRequestNotFound = errors.New("escrow request not found")
+	ErrEscrowRequestOpen     = errors.New("an escrow request for this user is already open")
+	ErrEscrowRequestState    = errors.New("escrow request does not allow this action in its current status")
+	ErrNotShareHolder        = errors.New("you do not hold an escrow share")
+	ErrEscrowAlreadyApproved = errors.New("you already approved this escrow request")
+	ErrEscrowSelfApproval    = errors.New("the user being recovered cannot approve their own escrow request")
+	ErrEscrowOwnRequest      = errors.New("the requester cannot approve their own escrow request")
+	ErrEscrowSoleHolder      = errors.New("the configuring admin cannot be the only share holder")
+	ErrEscrowChangePending   = errors.New("an escrow change is already waiting for approval")
+	ErrEscrowChangeNotFound  = errors.New("escrow change not found")
+	ErrEscrowChangeState     = errors.New("escrow change is no longer pending")
+	ErrEscrowOwnChange       = errors.New("the proposer cannot approve their own escrow change")
+	ErrEscrowNoQuorum        = errors.New("no share holder other than the proposer can approve the change")
+)
+
+// EscrowService implements organization escrow recovery.
+//
+// An admin generates an escrow keypair client-side, encrypts its private key
+// with a random escrow secret and splits the secret with Shamir's scheme
+// (shamir.Split) into one share per share holder, each wrapped to that admin's
+// public key. Members escrow a copy of their private key to the escrow public
+// key (crypto.SealForEscrow). To re-key a member, an admin opens a request;
+// share holders release their shares re-wrapped to the requester's public key,
+// and once the threshold is reached the requester rebuilds the escrow private
+// key, opens the member's escrow and sets a new master password for them. The
+// server only ever stores wrapped material.
+type EscrowService struct {
+	userRepo    *repository.UserRepository
+	tenantRepo  *repository.TenantRepository
+	escrowRepo  *repository.EscrowRepository
+	requestRepo *repository.EscrowRequestRepository
+}
+
+func NewEscrowService(userRepo *repository.UserRepository, tenantRepo *repository.TenantRepository, escrowRepo *repository.EscrowRepository, requestRepo *repository.EscrowRequestRepository) *EscrowService {
+	return &EscrowService{
+		userRepo:    userRepo,
+		tenantRepo:  tenantRepo,
+		escrowRepo:  escrowRepo,
+		requestRepo: requestRepo,
+	}
+}
+
+// EscrowShareInput is one share holder's wrapped share
+type EscrowShareInput struct {
+	UserID         int64  `json:"user_id" binding:"required"`
+	EncryptedShare string `json:"encrypted_share" binding:"required"` // base64, RSA-OAEP wrapped to the holder's public key
+}
+
+// ConfigureEscrowRequest enables escrow or proposes to replace the escrow key.
+// Replacing it discards every member's escrow and cancels open requests.
+type ConfigureEscrowRequest struct {
+	PublicKey           string             `json:"public_key" binding:"required"`
+	EncryptedPrivateKey string             `json:"encrypted_private_key" binding:"required"` // encrypted with the escrow secret
+	Threshold           int                `json:"threshold" binding:"required,min=1"`
+	Shares              []EscrowShareInput `json:"shares" binding:"required,min=1,dive"`
+}
+
+// EscrowConfig describes a tenant's escrow policy to admins
+type EscrowConfig struct {
+	Enabled      bool    `json:"enabled"`
+	KeyID        string  `json:"key_id,omitempty"`
+	PublicKey    string  `json:"public_key,omitempty"`
+	Threshold    int     `json:"threshold,omitempty"`
+	ShareHolders []int64 `json:"share_holders,omitempty"`
+
+	// PendingChange waits for share holders to approve it
+	PendingChange *model.EscrowChange `json:"pending_change,omitempty"`
+}
+
+// EscrowPolicy describes a tenant's escrow policy to a member
+type EscrowPolicy struct {
+	Enabled   bool   `json:"enabled"`
+	KeyID     string `json:"key_id,omitempty"`
+	PublicKey string `json:"public_key,omitempty"`
+	Enrolled  bool   `json:"enrolled"`
+}
+
+// EnrollEscrowRequest escrows the member's private key, see crypto.SealForEscrow
+type EnrollEscrowRequest struct {
+	EscrowKeyID         string `json:"escrow_key_id" binding:"required"`
+	WrappedKey          string `json:"wrapped_key" binding:"required"`
+	EncryptedPrivateKey string `json:"encrypted_private_key" binding:"required"`
+}
+
+// CreateEscrowRequestRequest opens an escrow request for a member
+type CreateEscrowRequestRequest struct {
+	UserID int64  `json:"user_id" binding:"required"`
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+// ApproveEscrowRequest releases the approver's share to the requester
+type ApproveEscrowRequest struct {
+	EncryptedShare string `json:"encrypted_share" binding:"required"` // re-wrapped to the requester's public key
+}
+
+// CompleteEscrowRequest re-keys the member. The requester derives a new master
+// key from a temporary password, re-encrypts the member's private key with it
+// and computes a new SRP verifier, exactly like a password change.
+type CompleteEscrowRequest struct {
+	crypto.KDFParams
+	SRPCredentials
+	MasterKeySalt       string `json:"master_key_salt" binding:"required"`
+	EncryptedPrivateKey string `json:"encrypted_private_key" binding:"required"`
+}
+
+// EscrowRequestDetail is an escrow request as seen by an admin. The released
+// shares, the escrow private key and the member's escrow are only included
+// for the requester once the request is approved.
+type EscrowRequestDetail struct {
+	model.EscrowRequest
+	EscrowKeyID               string            `json:"escrow_key_id,omitempty"`
+	EscrowEncryptedPrivateKey string            `json:"escrow_encrypted_private_key,omitempty"`
+	UserEscrow                *model.UserEscrow `json:"user_escrow,omitempty"`
+}
+
+// GetConfig returns the escrow policy of the admin's tenant
+func (s *EscrowService) GetConfig(ctx context.Context, admin *model.User) (*EscrowConfig, error) {
+	tenant, err := s.tenantRepo.GetByID(ctx, admin.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	if !tenant.EscrowEnabled {
+		return &EscrowConfig{}, nil
+	}
+
+	shares, err := s.escrowRepo.ListShares(ctx, tenant.ID)
+	if err != nil {
+		return nil, err
+	}
+	holders := make([]int64, 0, len(shares))
+	for _, share := range shares {
+		holders = append(holders, share.UserID)
+	}
+
+	config := &EscrowConfig{
+		Enabled:      true,
+		KeyID:        tenant.EscrowKeyID,
+		PublicKey:    tenant.EscrowPublicKey,
+		Threshold:    tenant.EscrowThreshold,
+		ShareHolders: holders,
+	}
+	change, err := s.escrowRepo.GetPendingChange(ctx, tenant.ID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if err == nil {
+		config.PendingChange = change
+	}
+	return config, nil
+}
+
+// Configure enables escrow for the admin's tenant with a new escrow key. Only
+// super admins configure escrow, and once it is enabled replacing the key is
+// only proposed: it takes effect when current share holders approve it, see
+// ApproveChange.
+func (s *EscrowService) Configure(ctx context.Context, admin *model.User, req *ConfigureEscrowRequest) (*EscrowConfig, error) {
+	if !admin.IsSuperAdmin() {
+		return nil, ErrUserNotAllowed
+	}
+	if err := crypto.ValidatePublicKey(req.PublicKey); err != nil {
+		return nil, err
+	}
+	if req.Threshold > len(req.Shares) || len(req.Shares) > shamir.MaxShares {
+		return nil, ErrInvalidEscrowPolicy
+	}
+
+	holders := make(map[int64]bool, len(req.Shares))
+	holderIDs := make([]int64, 0, len(req.Shares))
+	shares := make([]model.EscrowShare, 0, len(req.Shares))
+	for _, input := range req.Shares {
+		if holders[input.UserID] {
+			return nil, ErrInvalidShareHolder
+		}
+		holders[input.UserID] = true
+
+		holder, err := s.userRepo.GetByID(ctx, input.UserID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrInvalidShareHolder
+			}
+			return nil, err
+		}
+		if holder.TenantID != admin.TenantID || !holder.IsAdmin() || !holder.IsActive() || holder.PublicKey == "" {
+			return nil, ErrInvalidShareHolder
+		}
+		if !validWrappedKey(input.EncryptedShare) {
+			return nil, ErrInvalidEscrowShare
+		}
+		holderIDs = append(holderIDs, input.UserID)
+		shares = append(shares, model.EscrowShare{
+			TenantID:       admin.TenantID,
+			UserID:         input.UserID,
+			EncryptedShare: input.EncryptedShare,
+		})
+	}
+	// The configuring admin would hold the whole escrow secret
+	if len(shares) == 1 && shares[0].UserID == admin.ID {
+		return nil, ErrEscrowSoleHolder
+	}
+
+	return s.propose(ctx, admin, &model.EscrowChange{
+		TenantID:            admin.TenantID,
+		ProposedBy:          admin.ID,
+		PublicKey:           req.PublicKey,
+		EncryptedPrivateKey: req.EncryptedPrivateKey,
+		Threshold:           req.Threshold,
+		Shares:              shares,
+		ShareHolders:        holderIDs,
+	})
+}
+
+// Disable proposes to turn escrow off and delete all escrow material of the
+// tenant. Like replacing the key, it needs the approval of share holders, or
+// an admin could disable escrow and enable it again with holders of their
+// choosing.
+func (s *EscrowService) Disable(ctx context.Context, admin *model.User) (*EscrowConfig, error) {
+	if !admin.IsSuperAdmin() {
+		return nil, ErrUserNotAllowed
+	}
+	return s.propose(ctx, admin, &model.EscrowChange{
+		TenantID:   admin.TenantID,
+		ProposedBy: admin.ID,
+		Disable:    true,
+	})
+}
+
+// propose applies change right away while escrow is disabled and otherwise
+// stores it for share holders to approve
+func (s *EscrowService) propose(ctx context.Context, admin *model.User, change *model.EscrowChange) (*EscrowConfig, error) {
+	err := s.userRepo.Transaction(ctx, func(tx *gorm.DB) error {
+		escrowRepo := repository.NewEscrowRepository(tx)
+		tenant, err := repository.NewTenantRepository(tx).GetForUpdate(ctx, admin.TenantID)
+		if err != nil {
+			return err
+		}
+		if !tenant.EscrowEnabled {
+			if change.Disable {
+				return ErrEscrowDisabled
+			}
+			return applyEscrowChange(ctx, tx, tenant, change)
+		}
+
+		if _, err := escrowRepo.GetPendingChange(ctx, tenant.ID); err == nil {
+			return ErrEscrowChangePending
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		required, err := requiredChangeApprovals(ctx, escrowRepo, tenant, change.ProposedBy)
+		if err != nil {
+			return err
+		}
+		if required == 0 {
+			return ErrEscrowNoQuorum
+		}
+
+		change.EscrowKeyID = tenant.EscrowKeyID
+		change.Status = model.EscrowChangePending
+		return escrowRepo.CreateChange(ctx, change)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetConfig(ctx, admin)
+}
+
+// ApproveChange records a share holder's approval of the pending change. The
+// change is applied once the tenant's threshold of current share holders
+// other than the proposer have approved it, or all of them if fewer remain.
+func (s *EscrowService) ApproveChange(ctx context.Context, admin *model.User, changeID int64) (*EscrowConfig, error) {
+	err := s.userRepo.Transaction(ctx, func(tx *gorm.DB) error {
+		escrowRepo := repository.NewEscrowRepository(tx)
+		tenant, err := repository.NewTenantRepository(tx).GetForUpdate(ctx, admin.TenantID)
+		if err != nil {
+			return err
+		}
+		change, err := getEscrowChange(ctx, escrowRepo, admin, changeID)
+		if err != nil {
+			return err
+		}
+		if change.Status != model.EscrowChangePending {
+			return ErrEscrowChangeState
+		}
+		if !tenant.EscrowEnabled || change.EscrowKeyID != tenant.EscrowKeyID {
+			return ErrEscrowKeyChanged
+		}
+		if change.ProposedBy == admin.ID {
+			return ErrEscrowOwnChange
+		}
+		if _, err := escrowRepo.GetShare(ctx, tenant.ID, admin.ID); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNotShareHolder
+			}
+			return err
+		}
+		for _, approval := range change.Approvals {
+			if approval.AdminID == admin.ID {
+				return ErrEscrowAlreadyApproved
+			}
+		}
+
+		approval := model.EscrowChangeApproval{ChangeID: change.ID, AdminID: admin.ID}
+		if err := escrowRepo.CreateChangeApproval(ctx, &approval); err != nil {
+			return err
+		}
+		change.Approvals = append(change.Approvals, approval)
+
+		required, err := requiredChangeApprovals(ctx, escrowRepo, tenant, change.ProposedBy)
+		if err != nil {
+			return err
+		}
+		if len(change.Approvals) < required {
+			return nil
+		}
+
+		if err := applyEscrowChange(ctx, tx, tenant, change); err != nil {
+			return err
+		}
+		now := time.Now()
+		change.Status = model.EscrowChangeApplied
+		change.AppliedAt = &now
+		clearEscrowChange(change)
+		return escrowRepo.UpdateChange(ctx, change)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetConfig(ctx, admin)
+}
+
+// CancelChange withdraws the pending change. The proposer or any super admin
+// can cancel it.
+func (s *EscrowService) CancelChange(ctx context.Context, admin *model.User, changeID int64) error {
+	return s.userRepo.Transaction(ctx, func(tx *gorm.DB) error {
+		escrowRepo := repository.NewEscrowRepository(tx)
+		change, err := getEscrowChange(ctx, escrowRepo, admin, changeID)
+		if err != nil {
+			return err
+		}
+		if change.ProposedBy != admin.ID && !admin.IsSuperAdmin() {
+			return ErrUserNotAllowed
+		}
+		if change.Status != model.EscrowChangePending {
+			return ErrEscrowChangeState
+		}
+		change.Status = model.EscrowChangeCancelled
+		clearEscrowChange(change)
+		return escrowRepo.UpdateChange(ctx, change)
+	})
+}
+
+// applyEscrowChange puts change into effect for tenant: it cancels open
+// escrow requests and installs the new escrow key and shares, or deletes all
+// escrow material
+func applyEscrowChange(ctx context.Context, tx *gorm.DB, tenant *model.Tenant, change *model.EscrowChange) error {
+	if err := repository.NewEscrowRequestRepository(tx).CancelOpenByTenantID(ctx, tenant.ID); err != nil {
+		return err
+	}
+
+	escrowRepo := repository.NewEscrowRepository(tx)
+	if change.Disable {
+		if err := escrowRepo.DeleteByTenantID(ctx, tenant.ID); err != nil {
+			return err
+		}
+		tenant.EscrowEnabled = false
+		tenant.EscrowKeyID = ""
+		tenant.EscrowPublicKey = ""
+		tenant.EscrowEncryptedPrivateKey = ""
+		tenant.EscrowThreshold = 0
+	} else {
+		keyID, err := newEscrowKeyID()
+		if err != nil {
+			return err
+		}
+		if err := escrowRepo.ReplaceShares(ctx, tenant.ID, change.Shares); err != nil {
+			return err
+		}
+		tenant.EscrowEnabled = true
+		tenant.EscrowKeyID = keyID
+		tenant.EscrowPublicKey = change.PublicKey
+		tenant.EscrowEncryptedPrivateKey = change.EncryptedPrivateKey
+		tenant.EscrowThreshold = change.Threshold
+	}
+	return repository.NewTenantRepository(tx).Update(ctx, tenant)
+}
+
+// requiredChangeApprovals returns how many share holders other than the
+// proposer must approve a change: the tenant's threshold, or all of them if
+// fewer remain
+func requiredChangeApprovals(ctx context.Context, escrowRepo *repository.EscrowRepository, tenant *model.Tenant, proposedBy int64) (int, error) {
+	shares, err := escrowRepo.ListShares(ctx, tenant.ID)
+	if err != nil {
+		return 0, err
+	}
+	approvers := 0
+	for _, share := range shares {
+		if share.UserID != proposedBy {
+			approvers++
+		}
+	}
+	if approvers > tenant.EscrowThreshold {
+		return tenant.EscrowThreshold, nil
+	}
+	return approvers, nil
+}
+
+// getEscrowChange loads and locks a change of the admin's tenant
+func getEscrowChange(ctx context.Context, escrowRepo *repository.EscrowRepository, admin *model.User, changeID int64) (*model.EscrowChange, error) {
+	change, err := escrowRepo.GetChangeForUpdate(ctx, changeID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrEscrowChangeNotFound
+		}
+		return nil, err
+	}
+	if change.TenantID != admin.TenantID {
+		return nil, ErrEscrowChangeNotFound
+	}
+	return change, nil
+}
+
+// clearEscrowChange drops the key material of a change that is no longer
+// pending, so disabling escrow leaves no copy of it behind
+func clearEscrowChange(change *model.EscrowChange) {
+	change.EncryptedPrivateKey = ""
+	change.Shares = nil
+}
+
+// GetShare returns the admin's own wrapped share
+func (s *EscrowService) GetShare(ctx context.Context, admin *model.User) (*model.EscrowShare, error) {
+	share, err := s.escrowRepo.GetShare(ctx, admin.TenantID, admin.ID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotShareHolder
+		}
+		return nil, err
+	}
+	return share, nil
+}
+
+// GetPolicy returns the escrow policy of the member's tenant, which clients
+// check after unlocking to enroll when required
+func (s *EscrowService) GetPolicy(ctx context.Context, userID int64) (*EscrowPolicy, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	tenant, err := s.tenantRepo.GetByID(ctx, user.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	if !tenant.EscrowEnabled {
+		return &EscrowPolicy{}, nil
+	}
+
+	escrow, err := s.escrowRepo.GetUserEscrow(ctx, userID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	return &EscrowPolicy{
+		Enabled:   true,
+		KeyID:     tenant.EscrowKeyID,
+		PublicKey: tenant.EscrowPublicKey,
+		Enrolled:  escrow != nil && escrow.EscrowKeyID == tenant.EscrowKeyID,
+	}, nil
+}
+
+// Enroll stores the member's escrowed private key
+func (s *EscrowService) Enroll(ctx context.Context, userID int64, req *EnrollEscrowRequest) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	if user.PublicKey == "" {
+		return ErrKeysRequired
+	}
+	tenant, err := s.tenantRepo.GetByID(ctx, user.TenantID)
+	if err != nil {
+		return err
+	}
+	if !tenant.EscrowEnabled {
+		return ErrEscrowDisabled
+	}
+	if req.EscrowKeyID != tenant.EscrowKeyID {
+		return ErrEscrowKeyChanged
+	}
+	if err := crypto.ValidateEscrowCiphertext(req.WrappedKey, req.EncryptedPrivateKey, tenant.EscrowKeyID); err != nil {
+		return err
+	}
+
+	return s.escrowRepo.SaveUserEscrow(ctx, &model.UserEscrow{
+		UserID:              userID,
+		TenantID:            tenant.ID,
+		EscrowKeyID:         tenant.EscrowKeyID,
+		WrappedKey:          req.WrappedKey,
+		EncryptedPrivateKey: req.EncryptedPrivateKey,
+	})
+}
+
+// ListRequests lists the escrow requests of the admin's tenant
+func (s *EscrowService) ListRequests(ctx context.Context, admin *model.User) ([]model.EscrowRequest, error) {
+	return s.requestRepo.ListByTenantID(ctx, admin.TenantID)
+}
+
+// CreateRequest opens an escrow request to re-key a member
+func (s *EscrowService) CreateRequest(ctx context.Context, admin *model.User, req *CreateEscrowRequestRequest) (*model.EscrowRequest, error) {
+	tenant, err := s.tenantRepo.GetByID(ctx, admin.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	if !tenant.EscrowEnabled {
+		return nil, ErrEscrowDisabled
+	}
+	if admin.PublicKey == "" {
+		// Released shares are wrapped to the requester's public key
+		return nil, ErrKeysRequired
+	}
+
+	user, err := s.userRepo.GetByID(ctx, req.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	if user.TenantID != admin.TenantID {
+		return nil, ErrUserNotFound
+	}
+	if user.ID == admin.ID {
+		return nil, ErrCannotModifySelf
+	}
+
+	escrow, err := s.escrowRepo.GetUserEscrow(ctx, user.ID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrEscrowNotEnrolled
+		}
+		return nil, err
+	}
+	if escrow.EscrowKeyID != tenant.EscrowKeyID {
+		return nil, ErrEscrowNotEnrolled
+	}
+
+	open, err := s.requestRepo.HasOpen(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if open {
+		return nil, ErrEscrowRequestOpen
+	}
+
+	request := &model.EscrowRequest{
+		TenantID:    admin.TenantID,
+		UserID:      user.ID,
+		RequestedBy: admin.ID,
+		Reason:      req.Reason,
+		Status:      model.EscrowRequestPending,
+	}
+	if err := s.requestRepo.Create(ctx, request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// GetRequest returns an escrow request of the admin's tenant
+func (s *EscrowService) GetRequest(ctx context.Context, admin *model.User, requestID int64) (*EscrowRequestDetail, error) {
+	request, err := s.getRequest(ctx, s.requestRepo, admin, requestID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	detail := &EscrowRequestDetail{EscrowRequest: *request}
+	if request.RequestedBy != admin.ID || request.Status != model.EscrowRequestApproved {
+		for i := range detail.Approvals {
+			detail.Approvals[i].EncryptedShare = ""
+		}
+		return detail, nil
+	}
+
+	tenant, err := s.tenantRepo.GetByID(ctx, admin.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	escrow, err := s.escrowRepo.GetUserEscrow(ctx, request.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrEscrowNotEnrolled
+		}
+		return nil, err
+	}
+	detail.EscrowKeyID = tenant.EscrowKeyID
+	detail.EscrowEncryptedPrivateKey = tenant.EscrowEncryptedPrivateKey
+	detail.UserEscrow = escrow
+	return detail, nil
+}
+
+// Approve releases the admin's share for a pending request. The request is
+// approved once the tenant's threshold of shares has been released by share
+// holders other than the requester.
+func (s *EscrowService) Approve(ctx context.Context, admin *model.User, requestID int64, req *ApproveEscrowRequest) (*model.EscrowRequest, error) {
+	if !validWrappedKey(req.EncryptedShare) {
+		return nil, ErrInvalidEscrowShare
+	}
+	if _, err := s.GetShare(ctx, admin); err != nil {
+		return nil, err
+	}
+
+	var result *model.EscrowRequest
+	err := s.userRepo.Transaction(ctx, func(tx *gorm.DB) error {
+		requestRepo := repository.NewEscrowRequestRepository(tx)
+		request, err := s.getRequest(ctx, requestRepo, admin, requestID, true)
+		if err != nil {
+			return err
+		}
+		if request.Status != model.EscrowRequestPending {
+			return ErrEscrowRequestState
+		}
+		if request.UserID == admin.ID {
+			return ErrEscrowSelfApproval
+		}
+		// Otherwise one share holder could request and approve alone
+		if request.RequestedBy == admin.ID {
+			return ErrEscrowOwnRequest
+		}
+		for _, approval := range request.Approvals {
+			if approval.AdminID == admin.ID {
+				return ErrEscrowAlreadyApproved
+			}
+		}
+
+		approval := model.EscrowApproval{
+			RequestID:      request.ID,
+			AdminID:        admin.ID,
+			EncryptedShare: req.EncryptedShare,
+		}
+		if err := requestRepo.CreateApproval(ctx, &approval); err != nil {
+			return err
+		}
+		request.Approvals = append(request.Approvals, approval)
+
+		tenant, err := repository.NewTenantRepository(tx).GetByID(ctx, admin.TenantID)
+		if err != nil {
+			return err
+		}
+		if len(request.Approvals) >= tenant.EscrowThreshold {
+			request.Status = model.EscrowRequestApproved
+			if err := requestRepo.Update(ctx, request); err != nil {
+				return err
+			}
+		}
+		result = request
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range result.Approvals {
+		result.Approvals[i].EncryptedShare = ""
+	}
+	return result, nil
+}
+
+// Complete re-keys the member of an approved request. Only the requester can
+// complete it, since the released shares are wrapped to their public key.
+func (s *EscrowService) Complete(ctx context.Context, admin *model.User, requestID int64, req *CompleteEscrowRequest) error {
+	if err := req.KDFParams.Validate(); err != nil {
+		return ErrInvalidKDFSettings
+	}
+	if err := req.SRPCredentials.validate(); err != nil {
+		return err
+	}
+	salt, err := base64.StdEncoding.DecodeString(req.MasterKeySalt)
+	if err != nil || len(salt) < crypto.SaltSize {
+		return ErrInvalidSalt
+	}
+
+	return s.userRepo.Transaction(ctx, func(tx *gorm.DB) error {
+		requestRepo := repository.NewEscrowRequestRepository(tx)
+		userRepo := repository.NewUserRepository(tx)
+
+		request, err := s.getRequest(ctx, requestRepo, admin, requestID, true)
+		if err != nil {
+			return err
+		}
+		if request.RequestedBy != admin.ID {
+			return ErrUserNotAllowed
+		}
+		if request.Status != model.EscrowRequestApproved {
+			return ErrEscrowRequestState
+		}
+
+		user, err := userRepo.GetByID(ctx, request.UserID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrUserNotFound
+			}
+			return err
+		}
+		// Credentials encrypted directly with the old master key cannot be recovered
+		if err := checkNoLegacyVaults(ctx, repository.NewVaultMemberRepository(tx), user.ID); err != nil {
+			return err
+		}
+
+		if err := req.SRPCredentials.applyTo(user); err != nil {
+			return err
+		}
+		user.MasterKeySalt = req.MasterKeySalt
+		user.EncryptedPrivateKey = req.EncryptedPrivateKey
+		setUserKDFParams(user, req.KDFParams)
+		// Sessions and pending logins of the old password end with it
+		user.TokenVersion++
+		if err := userRepo.Update(ctx, user); err != nil {
+			return err
+		}
+		if err := repository.NewAuthChallengeRepository(tx).DeleteByUserID(ctx, user.ID); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		request.Status = model.EscrowRequestCompleted
+		request.CompletedAt = &now
+		return requestRepo.Update(ctx, request)
+	})
+}
+
+// Cancel withdraws an open request
+func (s *EscrowService) Cancel(ctx context.Context, admin *model.User, requestID int64) error {
+	return s.userRepo.Transaction(ctx, func(tx *gorm.DB) error {
+		requestRepo := repository.NewEscrowRequestRepository(tx)
+		request, err := s.getRequest(ctx, requestRepo, admin, requestID, true)
+		if err != nil {
+			return err
+		}
+		if request.Status != model.EscrowRequestPending && request.Status != model.EscrowRequestApproved {
+			return ErrEscrowRequestState
+		}
+		request.Status = model.EscrowRequestCancelled
+		return requestRepo.Update(ctx, request)
+	})
+}
+
+// getRequest loads a request of the admin's tenant. Inside a transaction,
+// forUpdate locks the request until the transaction ends.
+func (s *EscrowService) getRequest(ctx context.Context, requestRepo *repository.EscrowRequestRepository, admin *model.User, requestID int64, forUpdate bool) (*model.EscrowRequest, error) {
+	load := requestRepo.GetByID
+	if forUpdate {
+		load = requestRepo.GetForUpdate
+	}
+	request, err := load(ctx, requestID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrEscrowRequestNotFound
+		}
+		return nil, err
+	}
+	if request.TenantID != admin.TenantID {
+		return nil, ErrEscrowRequestNotFound
+	}
+	return request, nil
+}
+
+// validWrappedKey checks that s is base64 of at least one RSA block
+func validWrappedKey(s string) bool {
+	wrapped, err := base64.StdEncoding.DecodeString(s)
+	return err == nil && len(wrapped) >= crypto.RSAKeySize/8
+}
+
+func newEscrowKeyID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+		return "", err
+	}
+	return "escrow-" + hex.EncodeToString(buf), nil
+}
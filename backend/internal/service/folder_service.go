@@ -0,0 +1,444 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/askuy/passwordx/backend/internal/model"
+	"github.com/askuy/passwordx/backend/internal/pkg/crypto"
+	"github.com/askuy/passwordx/backend/internal/repository"
+)
+
+// maxFolderDepth bounds how deep folders nest, counting top-level folders as 1
+const maxFolderDepth = 10
+
+var (
+	ErrFolderNotFound      = errors.New("folder not found")
+	ErrFolderExists        = errors.New("folder_id is already in use")
+	ErrInvalidFolderParent = errors.New("invalid parent folder")
+	ErrTagNotFound         = errors.New("tag not found")
+	ErrTagExists           = errors.New("tag_id is already in use")
+)
+
+// FolderService manages each user's own folders and tags and where they file
+// credentials. Names are sealed with the user's organizer key under
+// crypto.OrganizerAAD(userID, "folder" or "tag", folder_id or tag_id).
+type FolderService struct {
+	folderRepo      *repository.FolderRepository
+	tagRepo         *repository.TagRepository
+	credentialRepo  *repository.CredentialRepository
+	vaultMemberRepo *repository.VaultMemberRepository
+}
+
+func NewFolderService(folderRepo *repository.FolderRepository, tagRepo *repository.TagRepository, credentialRepo *repository.CredentialRepository, vaultMemberRepo *repository.VaultMemberRepository) *FolderService {
+	return &FolderService{
+		folderRepo:      folderRepo,
+		tagRepo:         tagRepo,
+		credentialRepo:  credentialRepo,
+		vaultMemberRepo: vaultMemberRepo,
+	}
+}
+
+type CreateFolderRequest struct {
+	FolderID      string `json:"folder_id" binding:"required,uuid"`
+	NameEncrypted string `json:"name_encrypted" binding:"required"`
+	ParentID      *int64 `json:"parent_id"`
+}
+
+// UpdateFolderRequest renames and moves a folder; a nil ParentID moves it to the top level
+type UpdateFolderRequest struct {
+	NameEncrypted string `json:"name_encrypted" binding:"required"`
+	ParentID      *int64 `json:"parent_id"`
+}
+
+type CreateTagRequest struct {
+	TagID         string `json:"tag_id" binding:"required,uuid"`
+	NameEncrypted string `json:"name_encrypted" binding:"required"`
+}
+
+type UpdateTagRequest struct {
+	NameEncrypted string `json:"name_encrypted" binding:"required"`
+}
+
+// SetCredentialFolderRequest files a credential in a folder, or takes it out
+// of the user's folders if FolderID is nil
+type SetCredentialFolderRequest struct {
+	FolderID *int64 `json:"folder_id"`
+}
+
+// SetCredentialTagsRequest replaces the user's tags on a credential
+type SetCredentialTagsRequest struct {
+	TagIDs []int64 `json:"tag_ids" binding:"max=100"`
+}
+
+// CredentialFilter selects credentials by category, update time, the
+// requesting user's folders and tags and search terms, and orders them. Zero
+// fields do not filter.
+type CredentialFilter struct {
+	Category     string
+	UpdatedSince time.Time  // updated at or after
+	FolderID     int64      // filed in this folder or one nested in it
+	Unfiled      bool       // filed in none of the user's folders
+	TagIDs       []int64    // carrying every one of these tags
+	Terms        [][]string // carrying, for every term, one of its search tokens, one per vault
+	Autofill     bool       // leaving out credentials whose match mode is never
+	Sort         string     // see repository.CredentialSortMostUsed and the other orders
+}
+
+// validateName rejects names that are not sealed with the organizer key
+func validateName(name string) error {
+	if err := crypto.ValidateEnvelope(name, crypto.OrganizerKeyGeneration); err != nil {
+		return fmt.Errorf("%w: name_encrypted", ErrInvalidCiphertext)
+	}
+	return nil
+}
+
+// folderTree indexes a user's folders by ID
+type folderTree map[int64]*model.Folder
+
+func (s *FolderService) loadTree(ctx context.Context, userID int64) (folderTree, error) {
+	folders, err := s.folderRepo.ListByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	tree := make(folderTree, len(folders))
+	for i := range folders {
+		tree[folders[i].ID] = &folders[i]
+	}
+	return tree, nil
+}
+
+// depth returns how deep a folder is nested, top-level folders being 1
+func (t folderTree) depth(id int64) int {
+	depth := 0
+	for f, ok := t[id]; ok && depth <= len(t); f, ok = t[derefID(f.ParentID)] {
+		depth++
+	}
+	return depth
+}
+
+// height returns how many levels a folder and its deepest subfolder span
+func (t folderTree) height(id int64) int {
+	height := 1
+	for _, f := range t {
+		if f.ParentID != nil && *f.ParentID == id {
+			height = max(height, t.height(f.ID)+1)
+		}
+	}
+	return height
+}
+
+// subtree returns the IDs of a folder and all folders nested in it
+func (t folderTree) subtree(id int64) []int64 {
+	ids := []int64{id}
+	for i := 0; i < len(ids); i++ {
+		for _, f := range t {
+			if f.ParentID != nil && *f.ParentID == ids[i] {
+				ids = append(ids, f.ID)
+			}
+		}
+	}
+	return ids
+}
+
+func derefID(id *int64) int64 {
+	if id == nil {
+		return 0
+	}
+	return *id
+}
+
+// checkParent verifies that a folder of the given height can be placed
+// under parentID without leaving the user's folders, forming a cycle or
+// nesting too deep
+func (t folderTree) checkParent(parentID *int64, folderID int64, height int) error {
+	if parentID == nil {
+		return nil
+	}
+	if _, ok := t[*parentID]; !ok {
+		return ErrInvalidFolderParent
+	}
+	if folderID != 0 {
+		for _, id := range t.subtree(folderID) {
+			if id == *parentID {
+				return fmt.Errorf("%w: a folder cannot be moved into itself", ErrInvalidFolderParent)
+			}
+		}
+	}
+	if t.depth(*parentID)+height > maxFolderDepth {
+		return fmt.Errorf("%w: folders nest at most %d levels deep", ErrInvalidFolderParent, maxFolderDepth)
+	}
+	return nil
+}
+
+// ListFolders returns the user's folders; clients build the tree from parent_id
+func (s *FolderService) ListFolders(ctx context.Context, userID int64) ([]model.Folder, error) {
+	return s.folderRepo.ListByUserID(ctx, userID)
+}
+
+// CreateFolder creates a folder for the user
+func (s *FolderService) CreateFolder(ctx context.Context, userID int64, req *CreateFolderRequest) (*model.Folder, error) {
+	if err := validateName(req.NameEncrypted); err != nil {
+		return nil, err
+	}
+	tree, err := s.loadTree(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tree.checkParent(req.ParentID, 0, 1); err != nil {
+		return nil, err
+	}
+	exists, err := s.folderRepo.ExistsByFolderID(ctx, req.FolderID)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrFolderExists
+	}
+
+	folder := &model.Folder{
+		UserID:        userID,
+		FolderID:      req.FolderID,
+		ParentID:      req.ParentID,
+		NameEncrypted: req.NameEncrypted,
+	}
+	if err := s.folderRepo.Create(ctx, folder); err != nil {
+		return nil, err
+	}
+	return folder, nil
+}
+
+// UpdateFolder renames a folder and moves it with everything nested in it
+func (s *FolderService) UpdateFolder(ctx context.Context, userID, folderID int64, req *UpdateFolderRequest) (*model.Folder, error) {
+	if err := validateName(req.NameEncrypted); err != nil {
+		return nil, err
+	}
+	tree, err := s.loadTree(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	folder, ok := tree[folderID]
+	if !ok {
+		return nil, ErrFolderNotFound
+	}
+	if err := tree.checkParent(req.ParentID, folderID, tree.height(folderID)); err != nil {
+		return nil, err
+	}
+
+	folder.NameEncrypted = req.NameEncrypted
+	folder.ParentID = req.ParentID
+	if err := s.folderRepo.Update(ctx, folder); err != nil {
+		return nil, err
+	}
+	return folder, nil
+}
+
+// DeleteFolder deletes a folder and the folders nested in it. The
+// credentials filed in them are not deleted, only unfiled.
+func (s *FolderService) DeleteFolder(ctx context.Context, userID, folderID int64) error {
+	tree, err := s.loadTree(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if _, ok := tree[folderID]; !ok {
+		return ErrFolderNotFound
+	}
+	return s.folderRepo.Delete(ctx, tree.subtree(folderID))
+}
+
+// ListTags returns the user's tags
+func (s *FolderService) ListTags(ctx context.Context, userID int64) ([]model.Tag, error) {
+	return s.tagRepo.ListByUserID(ctx, userID)
+}
+
+// CreateTag creates a tag for the user
+func (s *FolderService) CreateTag(ctx context.Context, userID int64, req *CreateTagRequest) (*model.Tag, error) {
+	if err := validateName(req.NameEncrypted); err != nil {
+		return nil, err
+	}
+	exists, err := s.tagRepo.ExistsByTagID(ctx, req.TagID)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrTagExists
+	}
+
+	tag := &model.Tag{
+		UserID:        userID,
+		TagID:         req.TagID,
+		NameEncrypted: req.NameEncrypted,
+	}
+	if err := s.tagRepo.Create(ctx, tag); err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// getTag returns a tag of the user
+func (s *FolderService) getTag(ctx context.Context, userID, tagID int64) (*model.Tag, error) {
+	tag, err := s.tagRepo.GetByID(ctx, tagID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTagNotFound
+		}
+		return nil, err
+	}
+	if tag.UserID != userID {
+		return nil, ErrTagNotFound
+	}
+	return tag, nil
+}
+
+// UpdateTag renames a tag
+func (s *FolderService) UpdateTag(ctx context.Context, userID, tagID int64, req *UpdateTagRequest) (*model.Tag, error) {
+	if err := validateName(req.NameEncrypted); err != nil {
+		return nil, err
+	}
+	tag, err := s.getTag(ctx, userID, tagID)
+	if err != nil {
+		return nil, err
+	}
+
+	tag.NameEncrypted = req.NameEncrypted
+	if err := s.tagRepo.Update(ctx, tag); err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// DeleteTag deletes a tag and removes it from the credentials carrying it
+func (s *FolderService) DeleteTag(ctx context.Context, userID, tagID int64) error {
+	if _, err := s.getTag(ctx, userID, tagID); err != nil {
+		return err
+	}
+	return s.tagRepo.Delete(ctx, tagID)
+}
+
+// checkCredential verifies that the user can see a credential of the vault.
+// Filing is personal, so viewers may organize shared credentials too.
+func (s *FolderService) checkCredential(ctx context.Context, vaultID, credentialID, userID int64) error {
+	credential, err := s.credentialRepo.GetByID(ctx, credentialID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrCredentialNotFound
+		}
+		return err
+	}
+	if credential.VaultID != vaultID {
+		return ErrCredentialNotFound
+	}
+
+	member, err := s.vaultMemberRepo.GetByVaultAndUser(ctx, vaultID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrCredentialAccessDenied
+		}
+		return err
+	}
+	if !model.CanViewCredentials(member.Role) {
+		return ErrCredentialAccessDenied
+	}
+	return nil
+}
+
+// SetCredentialFolder files a credential in one of the user's folders
+func (s *FolderService) SetCredentialFolder(ctx context.Context, vaultID, credentialID, userID int64, req *SetCredentialFolderRequest) error {
+	if err := s.checkCredential(ctx, vaultID, credentialID, userID); err != nil {
+		return err
+	}
+	if req.FolderID == nil {
+		return s.folderRepo.ClearCredentialFolder(ctx, userID, credentialID)
+	}
+
+	folder, err := s.folderRepo.GetByID(ctx, *req.FolderID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrFolderNotFound
+		}
+		return err
+	}
+	if folder.UserID != userID {
+		return ErrFolderNotFound
+	}
+	return s.folderRepo.SetCredentialFolder(ctx, userID, credentialID, folder.ID)
+}
+
+// SetCredentialTags replaces the user's tags on a credential
+func (s *FolderService) SetCredentialTags(ctx context.Context, vaultID, credentialID, userID int64, req *SetCredentialTagsRequest) error {
+	if err := s.checkCredential(ctx, vaultID, credentialID, userID); err != nil {
+		return err
+	}
+
+	tagIDs := make([]int64, 0, len(req.TagIDs))
+	seen := make(map[int64]bool, len(req.TagIDs))
+	for _, id := range req.TagIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if _, err := s.getTag(ctx, userID, id); err != nil {
+			return err
+		}
+		tagIDs = append(tagIDs, id)
+	}
+	return s.tagRepo.SetCredentialTags(ctx, userID, credentialID, tagIDs)
+}
+
+// resolveFilter checks that a filter only names the user's own folders and
+// tags and expands the folder to its subtree
+func (s *FolderService) resolveFilter(ctx context.Context, userID int64, filter *CredentialFilter) (*repository.CredentialFilter, error) {
+	resolved := &repository.CredentialFilter{Unfiled: filter.Unfiled}
+	if filter.FolderID != 0 {
+		tree, err := s.loadTree(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := tree[filter.FolderID]; !ok {
+			return nil, ErrFolderNotFound
+		}
+		resolved.FolderIDs = tree.subtree(filter.FolderID)
+	}
+	for _, id := range filter.TagIDs {
+		if _, err := s.getTag(ctx, userID, id); err != nil {
+			return nil, err
+		}
+	}
+	resolved.TagIDs = filter.TagIDs
+	return resolved, nil
+}
+
+// organize fills in where the user filed each credential
+func (s *FolderService) organize(ctx context.Context, userID int64, credentials []model.Credential) error {
+	if len(credentials) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(credentials))
+	byID := make(map[int64]*model.Credential, len(credentials))
+	for i := range credentials {
+		ids[i] = credentials[i].ID
+		byID[credentials[i].ID] = &credentials[i]
+	}
+
+	folders, err := s.folderRepo.ListCredentialFolders(ctx, userID, ids)
+	if err != nil {
+		return err
+	}
+	for _, a := range folders {
+		folderID := a.FolderID
+		byID[a.CredentialID].FolderID = &folderID
+	}
+	tags, err := s.tagRepo.ListCredentialTags(ctx, userID, ids)
+	if err != nil {
+		return err
+	}
+	for _, a := range tags {
+		c := byID[a.CredentialID]
+		c.TagIDs = append(c.TagIDs, a.TagID)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gotomicro/ego/core/econf"
+
+	"github.com/askuy/passwordx/backend/internal/model"
+	"github.com/askuy/passwordx/backend/internal/pkg/crypto"
+)
+
+// ErrServerBusy is returned when a password sent by an older client cannot be
+// processed because too many key derivations are already running
+var ErrServerBusy = errors.New("server is busy, please try again")
+
+const (
+	// defaultKDFConcurrency bounds server-side key derivations if
+	// kdf.serverConcurrency is not set
+	defaultKDFConcurrency = 2
+	// kdfWait is how long a request waits for a free derivation slot
+	kdfWait = 5 * time.Second
+)
+
+// kdfSlots bounds the master key derivations the server runs for clients that
+// send the password. Each Argon2id derivation allocates kdf.memory and these
+// run on unauthenticated paths, so a burst of requests must queue instead of
+// exhausting memory.
+var (
+	kdfSlotsOnce sync.Once
+	kdfSlots     chan struct{}
+)
+
+// deriveMasterKey derives a user's master key from their password on the
+// server, waiting for a free derivation slot
+func deriveMasterKey(ctx context.Context, user *model.User, password string) ([]byte, error) {
+	kdfSlotsOnce.Do(func() {
+		n := econf.GetInt("kdf.serverConcurrency")
+		if n <= 0 {
+			n = defaultKDFConcurrency
+		}
+		kdfSlots = make(chan struct{}, n)
+	})
+
+	timer := time.NewTimer(kdfWait)
+	defer timer.Stop()
+	select {
+	case kdfSlots <- struct{}{}:
+	case <-timer.C:
+		return nil, ErrServerBusy
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-kdfSlots }()
+
+	return crypto.DeriveKeyWithParams(password, user.MasterKeySalt, userKDFParams(user))
+}
+
+// configuredKDFParams returns the KDF parameters for new accounts and upgrades.
+// Falls back to the built-in defaults if the [kdf] config section is missing or invalid.
+func configuredKDFParams() crypto.KDFParams {
+	params := crypto.KDFParams{
+		Algorithm:   econf.GetString("kdf.algorithm"),
+		Iterations:  econf.GetInt("kdf.iterations"),
+		Memory:      econf.GetInt("kdf.memory"),
+		Parallelism: econf.GetInt("kdf.parallelism"),
+	}
+	if params.Validate() != nil {
+		return crypto.DefaultKDFParams()
+	}
+	return params
+}
+
+// serverDerivedKDFParams returns the KDF parameters for an account whose
+// master key the server derives from a password, on registration by an older
+// client or when an admin sets the password. The bundled clients derive the
+// master key with the legacy parameters, so these stay legacy while legacy
+// clients are accepted; kdfUpgradeFor offers such accounts an upgrade.
+func serverDerivedKDFParams() crypto.KDFParams {
+	if legacyClients() {
+		return crypto.LegacyKDFParams()
+	}
+	return configuredKDFParams()
+}
+
+// userKDFParams returns the KDF parameters stored for a user
+func userKDFParams(user *model.User) crypto.KDFParams {
+	if user.KDFAlgorithm == "" {
+		return crypto.LegacyKDFParams()
+	}
+	return crypto.KDFParams{
+		Algorithm:   user.KDFAlgorithm,
+		Iterations:  user.KDFIterations,
+		Memory:      user.KDFMemory,
+		Parallelism: user.KDFParallelism,
+	}
+}
+
+// setUserKDFParams stores KDF parameters on a user
+func setUserKDFParams(user *model.User, params crypto.KDFParams) {
+	user.KDFAlgorithm = params.Algorithm
+	user.KDFIterations = params.Iterations
+	user.KDFMemory = params.Memory
+	user.KDFParallelism = params.Parallelism
+}
+
+// kdfUpgradeFor returns the parameters a user should upgrade to on their next
+// unlock, or nil if their current parameters are strong enough
+func kdfUpgradeFor(user *model.User) *crypto.KDFParams {
+	target := configuredKDFParams()
+	if !userKDFParams(user).WeakerThan(target) {
+		return nil
+	}
+	return &target
+}
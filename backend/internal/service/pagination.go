@@ -0,0 +1,11 @@
+package service
+
+import (
+	"github.com/askuy/passwordx/backend/internal/repository"
+)
+
+// Errors of the paginated listings, see repository.Page
+var (
+	ErrInvalidCursor = repository.ErrInvalidCursor
+	ErrInvalidSort   = repository.ErrInvalidSort
+)
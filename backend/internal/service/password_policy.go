@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/gotomicro/ego/core/econf"
+	"gorm.io/gorm"
+
+	"github.com/askuy/passwordx/backend/internal/model"
+	"github.com/askuy/passwordx/backend/internal/pkg/strength"
+	"github.com/askuy/passwordx/backend/internal/repository"
+)
+
+// minPasswordLength is the floor for every password policy
+const minPasswordLength = 8
+
+var ErrWeakPassword = errors.New("password does not meet the password policy")
+
+// PasswordPolicy is a master password policy. The server can only enforce it
+// where it sees the password (legacy registration, admin-set passwords);
+// SRP clients evaluate it locally with the same estimator.
+type PasswordPolicy struct {
+	MinLength int `json:"min_length" binding:"min=8,max=128"`
+	MinScore  int `json:"min_score" binding:"min=0,max=4"`
+}
+
+// EvaluatePasswordRequest asks for a strength estimate
+type EvaluatePasswordRequest struct {
+	Password   string   `json:"password" binding:"required,max=1024"`
+	UserInputs []string `json:"user_inputs" binding:"max=20"`
+}
+
+// PasswordEvaluation is a strength estimate checked against the caller's policy
+type PasswordEvaluation struct {
+	*strength.Result
+	Policy      PasswordPolicy `json:"policy"`
+	MeetsPolicy bool           `json:"meets_policy"`
+}
+
+// configuredPasswordPolicy returns the default policy from the
+// [passwordPolicy] config section
+func configuredPasswordPolicy() PasswordPolicy {
+	policy := PasswordPolicy{
+		MinLength: econf.GetInt("passwordPolicy.minLength"),
+		MinScore:  econf.GetInt("passwordPolicy.minScore"),
+	}
+	if policy.MinLength < minPasswordLength {
+		policy.MinLength = minPasswordLength
+	}
+	if policy.MinScore < 0 || policy.MinScore > 4 {
+		policy.MinScore = 0
+	}
+	return policy
+}
+
+// tenantPasswordPolicy returns the tenant's policy, or the default if it has none
+func tenantPasswordPolicy(tenant *model.Tenant) PasswordPolicy {
+	if tenant == nil || tenant.PasswordMinLength == 0 {
+		return configuredPasswordPolicy()
+	}
+	return PasswordPolicy{MinLength: tenant.PasswordMinLength, MinScore: tenant.PasswordMinScore}
+}
+
+// check rejects passwords that are too short or too guessable. userInputs are
+// details about the user, such as their email and name, that count as guessable.
+func (p PasswordPolicy) check(password string, userInputs ...string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return fmt.Errorf("%w: use at least %d characters", ErrWeakPassword, p.MinLength)
+	}
+	result := strength.Estimate(password, userInputs...)
+	if result.Score < p.MinScore {
+		reason := result.Feedback.Warning
+		if reason == "" && len(result.Feedback.Suggestions) > 0 {
+			reason = result.Feedback.Suggestions[0]
+		}
+		return fmt.Errorf("%w: strength %d of required %d. %s", ErrWeakPassword, result.Score, p.MinScore, reason)
+	}
+	return nil
+}
+
+// PasswordPolicyService evaluates passwords and manages tenant password policies
+type PasswordPolicyService struct {
+	userRepo   *repository.UserRepository
+	tenantRepo *repository.TenantRepository
+}
+
+func NewPasswordPolicyService(userRepo *repository.UserRepository, tenantRepo *repository.TenantRepository) *PasswordPolicyService {
+	return &PasswordPolicyService{
+		userRepo:   userRepo,
+		tenantRepo: tenantRepo,
+	}
+}
+
+// DefaultPolicy returns the policy that applies to new registrations
+func (s *PasswordPolicyService) DefaultPolicy() PasswordPolicy {
+	return configuredPasswordPolicy()
+}
+
+// GetPolicy returns the policy of the user's tenant
+func (s *PasswordPolicyService) GetPolicy(ctx context.Context, userID int64) (*PasswordPolicy, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	tenant, err := s.tenantRepo.GetByID(ctx, user.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	policy := tenantPasswordPolicy(tenant)
+	return &policy, nil
+}
+
+// Evaluate estimates a password's strength and checks it against the
+// caller's tenant policy. The user's email and name always count as guessable.
+func (s *PasswordPolicyService) Evaluate(ctx context.Context, userID int64, req *EvaluatePasswordRequest) (*PasswordEvaluation, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	tenant, err := s.tenantRepo.GetByID(ctx, user.TenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	inputs := append([]string{user.Email, user.Name}, req.UserInputs...)
+	policy := tenantPasswordPolicy(tenant)
+	result := strength.Estimate(req.Password, inputs...)
+	return &PasswordEvaluation{
+		Result:      result,
+		Policy:      policy,
+		MeetsPolicy: utf8.RuneCountInString(req.Password) >= policy.MinLength && result.Score >= policy.MinScore,
+	}, nil
+}
+
+// SetPolicy sets the policy of the admin's tenant
+func (s *PasswordPolicyService) SetPolicy(ctx context.Context, admin *model.User, policy *PasswordPolicy) error {
+	tenant, err := s.tenantRepo.GetByID(ctx, admin.TenantID)
+	if err != nil {
+		return err
+	}
+	tenant.PasswordMinLength = policy.MinLength
+	tenant.PasswordMinScore = policy.MinScore
+	return s.tenantRepo.Update(ctx, tenant)
+}
+
+// ResetPolicy makes the admin's tenant use the default policy again
+func (s *PasswordPolicyService) ResetPolicy(ctx context.Context, admin *model.User) error {
+	tenant, err := s.tenantRepo.GetByID(ctx, admin.TenantID)
+	if err != nil {
+		return err
+	}
+	tenant.PasswordMinLength = 0
+	tenant.PasswordMinScore = 0
+	return s.tenantRepo.Update(ctx, tenant)
+}
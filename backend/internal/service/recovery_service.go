@@ -0,0 +1,399 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gotomicro/ego/core/econf"
+	"gorm.io/gorm"
+
+	"github.com/askuy/passwordx/backend/internal/model"
+	"github.com/askuy/passwordx/backend/internal/pkg/crypto"
+	"github.com/askuy/passwordx/backend/internal/repository"
+)
+
+// recoveryResetTTL is how long a verified recovery may take to submit the reset
+const recoveryResetTTL = 15 * time.Minute
+
+var ErrRecoveryKeyExists = errors.New("recovery key already set, re-authenticate to replace it")
+
+// RecoveryService manages recovery keys and recovers accounts with them.
+//
+// The client generates a recovery key at signup, encrypts a copy of its
+// private key with crypto.RecoveryWrapKey and registers an SRP verifier
+// computed from crypto.RecoveryAuthSecret. Recovery is an SRP handshake
+// against that verifier, after which the client receives the encrypted
+// private key, picks a new master password and re-keys the account.
+type RecoveryService struct {
+	userRepo        *repository.UserRepository
+	tenantRepo      *repository.TenantRepository
+	vaultMemberRepo *repository.VaultMemberRepository
+	recoveryRepo    *repository.RecoveryKeyRepository
+	challengeRepo   *repository.AuthChallengeRepository
+	srp             *srpAuthenticator
+}
+
+func NewRecoveryService(userRepo *repository.UserRepository, tenantRepo *repository.TenantRepository, vaultMemberRepo *repository.VaultMemberRepository, recoveryRepo *repository.RecoveryKeyRepository, challengeRepo *repository.AuthChallengeRepository) *RecoveryService {
+	return &RecoveryService{
+		userRepo:        userRepo,
+		tenantRepo:      tenantRepo,
+		vaultMemberRepo: vaultMemberRepo,
+		recoveryRepo:    recoveryRepo,
+		challengeRepo:   challengeRepo,
+		srp: &srpAuthenticator{
+			challengeRepo: challengeRepo,
+			decoyKey:      []byte(econf.GetString("jwt.secret")),
+		},
+	}
+}
+
+// RecoveryKeyMaterial is what the server stores for a recovery key: an SRP
+// verifier derived from it and the private key encrypted with it
+type RecoveryKeyMaterial struct {
+	SRPCredentials
+	EncryptedPrivateKey string `json:"encrypted_private_key" binding:"required"`
+}
+
+// SetRecoveryKeyRequest registers or replaces the user's recovery key.
+// Replacing an existing key requires proof of the current password.
+type SetRecoveryKeyRequest struct {
+	RecoveryKeyMaterial
+	SRPProof
+	CurrentPassword string `json:"current_password"`
+}
+
+// RecoveryStatus describes whether the user can recover their account
+type RecoveryStatus struct {
+	Enabled   bool       `json:"enabled"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// RecoveryInitResponse carries the SRP challenge for the recovery key
+type RecoveryInitResponse struct {
+	ChallengeID  string `json:"challenge_id"`
+	SRPSalt      string `json:"srp_salt"`
+	ServerPublic string `json:"b"` // base64
+}
+
+// RecoveryVerifyResponse is returned once the recovery key has been proven
+type RecoveryVerifyResponse struct {
+	crypto.KDFParams           // parameters to derive the new master key with
+	ServerProof         string `json:"m2"`
+	ResetToken          string `json:"reset_token"`
+	EncryptedPrivateKey string `json:"encrypted_private_key"` // encrypted with the recovery wrap key
+}
+
+// RecoveryResetRequest re-keys the account after a successful recovery. The
+// used recovery key is retired, so a new one must be registered at the same time.
+type RecoveryResetRequest struct {
+	crypto.KDFParams
+	SRPCredentials
+	ResetToken          string              `json:"reset_token" binding:"required"`
+	MasterKeySalt       string              `json:"master_key_salt" binding:"required"`
+	EncryptedPrivateKey string              `json:"encrypted_private_key" binding:"required"`
+	Recovery            RecoveryKeyMaterial `json:"recovery"`
+}
+
+// recoveryResetState is stored with a reset token
+type recoveryResetState struct {
+	Verifier string `json:"verifier"`
+}
+
+// GetStatus reports whether the user has a recovery key
+func (s *RecoveryService) GetStatus(ctx context.Context, userID int64) (*RecoveryStatus, error) {
+	key, err := s.recoveryRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &RecoveryStatus{}, nil
+		}
+		return nil, err
+	}
+	return &RecoveryStatus{Enabled: true, CreatedAt: &key.CreatedAt}, nil
+}
+
+// SetRecoveryKey registers the user's recovery key. It can be set freely the
+// first time, which clients do right after uploading their keypair at signup.
+func (s *RecoveryService) SetRecoveryKey(ctx context.Context, userID int64, req *SetRecoveryKeyRequest) error {
+	if err := req.RecoveryKeyMaterial.validate(); err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	if user.PublicKey == "" {
+		return ErrKeysRequired
+	}
+
+	_, err = s.recoveryRepo.GetByUserID(ctx, userID)
+	if err == nil {
+		// Replacing the recovery key would let a stolen session take over the account
+		if req.SRPChallengeID == "" && req.CurrentPassword == "" {
+			return ErrRecoveryKeyExists
+		}
+		if err := s.srp.reauthenticate(ctx, s.userRepo, user, req.CurrentPassword, &req.SRPProof); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	return s.recoveryRepo.Save(ctx, &model.RecoveryKey{
+		UserID:              userID,
+		SRPSalt:             req.SRPSalt,
+		SRPVerifier:         req.SRPVerifier,
+		EncryptedPrivateKey: req.EncryptedPrivateKey,
+	})
+}
+
+// Init starts a recovery handshake. Accounts without a recovery key, and
+// unknown emails, get decoy challenges.
+func (s *RecoveryService) Init(ctx context.Context, req *SRPInitRequest) (*RecoveryInitResponse, error) {
+	var (
+		userID   int64
+		salt     []byte
+		verifier []byte
+	)
+
+	user, err := s.userRepo.GetByEmail(ctx, req.Email)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if user != nil {
+		key, err := s.recoveryRepo.GetByUserID(ctx, user.ID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if key != nil {
+			userID = user.ID
+			if salt, err = base64.StdEncoding.DecodeString(key.SRPSalt); err != nil {
+				return nil, err
+			}
+			if verifier, err = base64.StdEncoding.DecodeString(key.SRPVerifier); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	id, salt, serverPublic, err := s.srp.issue(ctx, model.ChallengePurposeRecovery, userID, req.Email, salt, verifier, req.ClientPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RecoveryInitResponse{
+		ChallengeID:  id,
+		SRPSalt:      base64.StdEncoding.EncodeToString(salt),
+		ServerPublic: base64.StdEncoding.EncodeToString(serverPublic),
+	}, nil
+}
+
+// Verify checks the recovery key proof and hands out the recovery copy of the
+// private key together with a single-use reset token
+func (s *RecoveryService) Verify(ctx context.Context, req *SRPVerifyRequest) (*RecoveryVerifyResponse, error) {
+	userID, verifier, serverProof, err := s.srp.consume(ctx, model.ChallengePurposeRecovery, req.ChallengeID, req.ClientProof)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := s.recoveryRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+	if key.SRPVerifier != verifier {
+		return nil, ErrInvalidCredentials
+	}
+	if err := checkNoLegacyVaults(ctx, s.vaultMemberRepo, userID); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(recoveryResetState{Verifier: verifier})
+	if err != nil {
+		return nil, err
+	}
+	token, err := newChallengeID()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.challengeRepo.Create(ctx, &model.AuthChallenge{
+		ID:        token,
+		UserID:    userID,
+		Purpose:   model.ChallengePurposeRecoveryReset,
+		Data:      string(data),
+		ExpiresAt: time.Now().Add(recoveryResetTTL),
+	}); err != nil {
+		return nil, err
+	}
+
+	return &RecoveryVerifyResponse{
+		ServerProof:         base64.StdEncoding.EncodeToString(serverProof),
+		ResetToken:          token,
+		EncryptedPrivateKey: key.EncryptedPrivateKey,
+		KDFParams:           configuredKDFParams(),
+	}, nil
+}
+
+// Reset replaces the master password of a recovered account: new master key
+// salt, KDF parameters, SRP verifier and private key encryption, plus a fresh
+// recovery key. Vault keys are wrapped with the unchanged public key, so all
+// vault data stays readable. Every session of the account is revoked, since
+// whoever lost control of the account may still be signed in.
+func (s *RecoveryService) Reset(ctx context.Context, req *RecoveryResetRequest) error {
+	if err := req.SRPCredentials.validate(); err != nil {
+		return err
+	}
+	if err := req.Recovery.validate(); err != nil {
+		return err
+	}
+	if err := req.KDFParams.Validate(); err != nil {
+		return ErrInvalidKDFSettings
+	}
+	salt, err := base64.StdEncoding.DecodeString(req.MasterKeySalt)
+	if err != nil || len(salt) < crypto.SaltSize {
+		return ErrInvalidSalt
+	}
+
+	challenge, err := s.challengeRepo.Consume(ctx, req.ResetToken, model.ChallengePurposeRecoveryReset)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidCredentials
+		}
+		return err
+	}
+	var state recoveryResetState
+	if err := json.Unmarshal([]byte(challenge.Data), &state); err != nil {
+		return err
+	}
+
+	return s.userRepo.Transaction(ctx, func(tx *gorm.DB) error {
+		userRepo := repository.NewUserRepository(tx)
+		recoveryRepo := repository.NewRecoveryKeyRepository(tx)
+
+		user, err := userRepo.GetByID(ctx, challenge.UserID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidCredentials
+			}
+			return err
+		}
+		key, err := recoveryRepo.GetByUserID(ctx, user.ID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidCredentials
+			}
+			return err
+		}
+		// The recovery key was replaced after it was verified
+		if key.SRPVerifier != state.Verifier {
+			return ErrInvalidCredentials
+		}
+		if err := checkNoLegacyVaults(ctx, repository.NewVaultMemberRepository(tx), user.ID); err != nil {
+			return err
+		}
+
+		if err := req.SRPCredentials.applyTo(user); err != nil {
+			return err
+		}
+		user.MasterKeySalt = req.MasterKeySalt
+		user.EncryptedPrivateKey = req.EncryptedPrivateKey
+		setUserKDFParams(user, req.KDFParams)
+		user.TokenVersion++
+		if err := userRepo.Update(ctx, user); err != nil {
+			return err
+		}
+		// Pending two-factor logins were started with the old password
+		if err := repository.NewAuthChallengeRepository(tx).DeleteByUserID(ctx, user.ID); err != nil {
+			return err
+		}
+
+		return recoveryRepo.Save(ctx, &model.RecoveryKey{
+			UserID:              user.ID,
+			SRPSalt:             req.Recovery.SRPSalt,
+			SRPVerifier:         req.Recovery.SRPVerifier,
+			EncryptedPrivateKey: req.Recovery.EncryptedPrivateKey,
+		})
+	})
+}
+
+// checkNoLegacyVaults rejects recovery for users whose credentials are still
+// encrypted directly with the master key, which the recovery key cannot unlock
+func checkNoLegacyVaults(ctx context.Context, memberRepo *repository.VaultMemberRepository, userID int64) error {
+	legacy, err := memberRepo.CountLegacyByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if legacy > 0 {
+		return ErrLegacyVaults
+	}
+	return nil
+}
+
+// EmergencyKit renders a printable emergency kit. It only contains non-secret
+// account metadata and blanks for the user to write the secrets on.
+func (s *RecoveryService) EmergencyKit(ctx context.Context, userID int64) (string, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrUserNotFound
+		}
+		return "", err
+	}
+	tenant, err := s.tenantRepo.GetByID(ctx, user.TenantID)
+	if err != nil {
+		return "", err
+	}
+	status, err := s.GetStatus(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	params := userKDFParams(user)
+	kdf := fmt.Sprintf("%s, %d iterations", params.Algorithm, params.Iterations)
+	if params.Algorithm == crypto.KDFArgon2id {
+		kdf = fmt.Sprintf("%s, t=%d, m=%d KiB, p=%d", params.Algorithm, params.Iterations, params.Memory, params.Parallelism)
+	}
+	recovery := "NOT SET - set up a recovery key in your account settings"
+	if status.Enabled {
+		recovery = "set up on " + status.CreatedAt.UTC().Format("2006-01-02")
+	}
+
+	var b strings.Builder
+	line := func(format string, args ...interface{}) {
+		fmt.Fprintf(&b, format+"\n", args...)
+	}
+	line("PASSWORDX EMERGENCY KIT")
+	line("=======================")
+	line("")
+	line("Keep this document somewhere safe, such as a locked drawer or a safe.")
+	line("Anyone holding it together with the secrets written on it can open your vaults.")
+	line("")
+	line("Sign-in address:   %s", econf.GetString("app.frontendUrl"))
+	line("Email:             %s", user.Email)
+	line("Name:              %s", user.Name)
+	line("Organization:      %s", tenant.Name)
+	line("Account created:   %s", user.CreatedAt.UTC().Format("2006-01-02"))
+	line("Key derivation:    %s", kdf)
+	line("Recovery key:      %s", recovery)
+	line("Kit generated:     %s", time.Now().UTC().Format("2006-01-02 15:04 MST"))
+	line("")
+	line("Master password:   ________________________________________")
+	line("")
+	line("Recovery key:      ____-____-____-____-____-____-____-____")
+	line("")
+	line("If you forget your master password, choose \"Recover account\" on the")
+	line("sign-in page and enter your recovery key. Your administrator cannot")
+	line("recover your data for you.")
+
+	return b.String(), nil
+}
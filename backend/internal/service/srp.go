@@ -0,0 +1,302 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/askuy/passwordx/backend/internal/model"
+	"github.com/askuy/passwordx/backend/internal/pkg/crypto"
+	"github.com/askuy/passwordx/backend/internal/pkg/srp"
+	"github.com/askuy/passwordx/backend/internal/repository"
+)
+
+// srpChallengeTTL is how long a client has to answer an SRP challenge
+const srpChallengeTTL = 5 * time.Minute
+
+var (
+	ErrInvalidVerifier = errors.New("invalid SRP salt or verifier")
+	ErrSRPRequired     = errors.New("password login is disabled, use /api/auth/srp")
+)
+
+// SRPCredentials carries a client computed SRP salt and verifier. The
+// verifier is derived from srp.AuthSecret(masterKey), so it has to be replaced
+// whenever the master key changes.
+type SRPCredentials struct {
+	SRPSalt     string `json:"srp_salt"`
+	SRPVerifier string `json:"srp_verifier"`
+}
+
+// provided reports whether the client sent SRP credentials
+func (c *SRPCredentials) provided() bool {
+	return c.SRPSalt != "" || c.SRPVerifier != ""
+}
+
+// validate checks that the salt and verifier are well formed
+func (c *SRPCredentials) validate() error {
+	salt, err := base64.StdEncoding.DecodeString(c.SRPSalt)
+	if err != nil || len(salt) < srp.SaltSize {
+		return ErrInvalidVerifier
+	}
+	verifier, err := base64.StdEncoding.DecodeString(c.SRPVerifier)
+	if err != nil || srp.ValidateVerifier(verifier) != nil {
+		return ErrInvalidVerifier
+	}
+	return nil
+}
+
+// applyTo validates the credentials and stores them on the user, dropping any
+// legacy password hash
+func (c *SRPCredentials) applyTo(user *model.User) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+	user.SRPSalt = c.SRPSalt
+	user.SRPVerifier = c.SRPVerifier
+	user.PasswordHash = ""
+	return nil
+}
+
+// setSRPVerifierFromPassword enrolls a user in SRP from a plaintext password
+// the server already has, e.g. on a legacy login or an admin-set password. The
+// verifier is computed exactly as a client would: from the master key derived
+// with the user's KDF parameters and master key salt.
+func setSRPVerifierFromPassword(ctx context.Context, user *model.User, password string) error {
+	masterKey, err := deriveMasterKey(ctx, user, password)
+	if err != nil {
+		return err
+	}
+	salt, err := srp.GenerateSalt()
+	if err != nil {
+		return err
+	}
+
+	verifier := srp.ComputeVerifier(salt, srp.NormalizeIdentity(user.Email), srp.AuthSecret(masterKey))
+	user.SRPSalt = base64.StdEncoding.EncodeToString(salt)
+	user.SRPVerifier = base64.StdEncoding.EncodeToString(verifier)
+	user.PasswordHash = ""
+	return nil
+}
+
+// SRPInitRequest starts an SRP handshake with the client's public value A
+type SRPInitRequest struct {
+	Email        string `json:"email" binding:"required,email"`
+	ClientPublic string `json:"a" binding:"required"` // base64
+}
+
+// SRPInitResponse carries everything the client needs to compute its proof
+type SRPInitResponse struct {
+	crypto.KDFParams
+	ChallengeID   string `json:"challenge_id"`
+	MasterKeySalt string `json:"master_key_salt"`
+	SRPSalt       string `json:"srp_salt"`
+	ServerPublic  string `json:"b"` // base64
+}
+
+// SRPVerifyRequest completes an SRP handshake with the client proof M1
+type SRPVerifyRequest struct {
+	ChallengeID string `json:"challenge_id" binding:"required"`
+	ClientProof string `json:"m1" binding:"required"` // base64
+}
+
+// SRPProof is an answered SRP challenge, used to re-authenticate sensitive
+// account operations without sending the password
+type SRPProof struct {
+	SRPChallengeID string `json:"srp_challenge_id"`
+	SRPClientProof string `json:"srp_m1"`
+}
+
+// srpAuthenticator issues and checks SRP challenges. It is shared by the
+// login flow and by account operations that require re-authentication.
+type srpAuthenticator struct {
+	challengeRepo *repository.AuthChallengeRepository
+	decoyKey      []byte
+}
+
+// issue creates an SRP challenge for the given purpose. A nil verifier issues a
+// decoy challenge with a stable fake salt that can never be answered, so
+// unknown accounts are indistinguishable from real ones. It returns the
+// challenge ID, the salt and the server public value B.
+func (a *srpAuthenticator) issue(ctx context.Context, purpose string, userID int64, email string, salt, verifier []byte, clientPublic string) (string, []byte, []byte, error) {
+	A, err := base64.StdEncoding.DecodeString(clientPublic)
+	if err != nil {
+		return "", nil, nil, srp.ErrInvalidPublicValue
+	}
+
+	identity := srp.NormalizeIdentity(email)
+	if verifier == nil {
+		userID = 0
+		salt = a.decoy(purpose, email)
+		verifier = srp.ComputeVerifier(salt, identity, a.decoy(purpose+"-secret", email))
+	}
+
+	session, err := srp.NewServerSession(identity, salt, verifier, A)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	id, err := newChallengeID()
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	// Expired challenges are swept opportunistically; a failure here is harmless
+	_ = a.challengeRepo.DeleteExpired(ctx)
+	if err := a.challengeRepo.Create(ctx, &model.AuthChallenge{
+		ID:        id,
+		UserID:    userID,
+		Purpose:   purpose,
+		Data:      string(data),
+		ExpiresAt: time.Now().Add(srpChallengeTTL),
+	}); err != nil {
+		return "", nil, nil, err
+	}
+
+	return id, salt, session.B, nil
+}
+
+// consume answers a challenge of the given purpose. It returns the user the
+// challenge was issued for, the base64 verifier it was checked against and
+// the server proof M2.
+func (a *srpAuthenticator) consume(ctx context.Context, purpose, challengeID, clientProof string) (int64, string, []byte, error) {
+	challenge, err := a.challengeRepo.Consume(ctx, challengeID, purpose)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, "", nil, ErrInvalidCredentials
+		}
+		return 0, "", nil, err
+	}
+	if challenge.UserID == 0 {
+		return 0, "", nil, ErrInvalidCredentials
+	}
+
+	var session srp.ServerSession
+	if err := json.Unmarshal([]byte(challenge.Data), &session); err != nil {
+		return 0, "", nil, err
+	}
+	proof, err := base64.StdEncoding.DecodeString(clientProof)
+	if err != nil {
+		return 0, "", nil, ErrInvalidCredentials
+	}
+	serverProof, err := session.Verify(proof)
+	if err != nil {
+		return 0, "", nil, ErrInvalidCredentials
+	}
+
+	return challenge.UserID, base64.StdEncoding.EncodeToString(session.Verifier), serverProof, nil
+}
+
+// challenge creates a login challenge against the user's SRP verifier, or a
+// decoy challenge if user is nil or has no verifier. Users without a verifier
+// still get their real KDF parameters and master key salt, which prelogin
+// hands out as well.
+func (a *srpAuthenticator) challenge(ctx context.Context, user *model.User, email, clientPublic string) (*SRPInitResponse, error) {
+	var (
+		userID        int64
+		salt          []byte
+		verifier      []byte
+		params        = crypto.LegacyKDFParams()
+		masterKeySalt = base64.StdEncoding.EncodeToString(a.decoy("prelogin", email))
+		err           error
+	)
+	if user != nil {
+		params = userKDFParams(user)
+		masterKeySalt = user.MasterKeySalt
+	}
+	if user != nil && user.SRPVerifier != "" {
+		userID = user.ID
+		if salt, err = base64.StdEncoding.DecodeString(user.SRPSalt); err != nil {
+			return nil, err
+		}
+		if verifier, err = base64.StdEncoding.DecodeString(user.SRPVerifier); err != nil {
+			return nil, err
+		}
+	}
+
+	id, salt, serverPublic, err := a.issue(ctx, model.ChallengePurposeSRP, userID, email, salt, verifier, clientPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SRPInitResponse{
+		KDFParams:     params,
+		ChallengeID:   id,
+		MasterKeySalt: masterKeySalt,
+		SRPSalt:       base64.StdEncoding.EncodeToString(salt),
+		ServerPublic:  base64.StdEncoding.EncodeToString(serverPublic),
+	}, nil
+}
+
+// verify answers a login challenge. It returns the authenticated user and the
+// server proof M2.
+func (a *srpAuthenticator) verify(ctx context.Context, userRepo *repository.UserRepository, challengeID, clientProof string) (*model.User, []byte, error) {
+	userID, verifier, serverProof, err := a.consume(ctx, model.ChallengePurposeSRP, challengeID, clientProof)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidCredentials
+		}
+		return nil, nil, err
+	}
+	// The verifier may have been replaced while the challenge was outstanding
+	if subtle.ConstantTimeCompare([]byte(user.SRPVerifier), []byte(verifier)) != 1 {
+		return nil, nil, ErrInvalidCredentials
+	}
+
+	return user, serverProof, nil
+}
+
+// reauthenticate checks that the caller knows the user's current password
+// without the server ever receiving it, except for legacy accounts that still
+// have a bcrypt hash
+func (a *srpAuthenticator) reauthenticate(ctx context.Context, userRepo *repository.UserRepository, user *model.User, currentPassword string, proof *SRPProof) error {
+	if user.SRPVerifier == "" {
+		if user.PasswordHash == "" || !crypto.VerifyPasswordBcrypt(currentPassword, user.PasswordHash) {
+			return ErrInvalidCredentials
+		}
+		return nil
+	}
+	if proof.SRPChallengeID == "" || proof.SRPClientProof == "" {
+		return ErrInvalidCredentials
+	}
+	verified, _, err := a.verify(ctx, userRepo, proof.SRPChallengeID, proof.SRPClientProof)
+	if err != nil {
+		return err
+	}
+	if verified.ID != user.ID {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+// decoy derives stable fake values for unknown emails
+func (a *srpAuthenticator) decoy(purpose, email string) []byte {
+	mac := hmac.New(sha256.New, a.decoyKey)
+	mac.Write([]byte(purpose + ":" + srp.NormalizeIdentity(email)))
+	return mac.Sum(nil)
+}
+
+func newChallengeID() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -85,9 +85,10 @@ func (s *TenantService) Get(ctx context.Context, id int64) (*model.Tenant, error
 	return tenant, nil
 }
 
-// List returns all tenants for a user
-func (s *TenantService) List(ctx context.Context, userID int64) ([]model.Tenant, error) {
-	return s.tenantRepo.ListByUserID(ctx, userID)
+// List returns a page of a user's tenants in the order sort asks for and the
+// cursor of the next page
+func (s *TenantService) List(ctx context.Context, userID int64, sort string, page repository.Page) ([]model.Tenant, string, error) {
+	return s.tenantRepo.ListByUserID(ctx, userID, sort, page)
 }
 
 // Update updates a tenant
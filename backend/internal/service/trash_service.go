@@ -0,0 +1,294 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gotomicro/ego/core/econf"
+	"github.com/gotomicro/ego/core/elog"
+	"gorm.io/gorm"
+
+	"github.com/askuy/passwordx/backend/internal/model"
+	"github.com/askuy/passwordx/backend/internal/repository"
+)
+
+// defaultTrashRetentionDays is how long deleted credentials and vaults stay
+// in the trash unless configured otherwise
+const defaultTrashRetentionDays = 30
+
+var ErrNotInTrash = errors.New("item is not in the trash")
+
+// TrashService manages deleted credentials and vaults. Deleting only moves
+// them to the trash; they can be restored until they are deleted permanently,
+// by hand or by Purge once the retention period is over.
+type TrashService struct {
+	credentialRepo    *repository.CredentialRepository
+	vaultRepo         *repository.VaultRepository
+	vaultMemberRepo   *repository.VaultMemberRepository
+	attachmentService *AttachmentService
+	retention         time.Duration
+}
+
+func NewTrashService(credentialRepo *repository.CredentialRepository, vaultRepo *repository.VaultRepository, vaultMemberRepo *repository.VaultMemberRepository, attachmentService *AttachmentService) *TrashService {
+	days := econf.GetInt("trash.retentionDays")
+	if days <= 0 {
+		days = defaultTrashRetentionDays
+	}
+	return &TrashService{
+		credentialRepo:    credentialRepo,
+		vaultRepo:         vaultRepo,
+		vaultMemberRepo:   vaultMemberRepo,
+		attachmentService: attachmentService,
+		retention:         time.Duration(days) * 24 * time.Hour,
+	}
+}
+
+// TrashedCredentials lists the trash of a vault. Items are deleted
+// permanently Retention days after they were deleted.
+type TrashedCredentials struct {
+	Credentials []model.Credential `json:"credentials"`
+	Retention   int                `json:"retention_days"`
+}
+
+// TrashedVaults lists the vaults in the trash the user owns
+type TrashedVaults struct {
+	Vaults    []model.Vault `json:"vaults"`
+	Retention int           `json:"retention_days"`
+}
+
+// checkRole returns ErrCredentialAccessDenied unless the user is a member of
+// the vault whose role passes allowed
+func (s *TrashService) checkRole(ctx context.Context, vaultID, userID int64, allowed func(role string) bool) error {
+	member, err := s.vaultMemberRepo.GetByVaultAndUser(ctx, vaultID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrCredentialAccessDenied
+		}
+		return err
+	}
+	if !allowed(member.Role) {
+		return ErrCredentialAccessDenied
+	}
+	return nil
+}
+
+// getTrashedCredential returns a credential of the vault that is in the trash
+func (s *TrashService) getTrashedCredential(ctx context.Context, vaultID, credentialID int64) (*model.Credential, error) {
+	credential, err := s.credentialRepo.GetTrashedByID(ctx, credentialID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotInTrash
+		}
+		return nil, err
+	}
+	if credential.VaultID != vaultID {
+		return nil, ErrNotInTrash
+	}
+	return credential, nil
+}
+
+// ListCredentials returns the credentials in the trash of a vault
+func (s *TrashService) ListCredentials(ctx context.Context, vaultID, userID int64) (*TrashedCredentials, error) {
+	if err := s.checkRole(ctx, vaultID, userID, model.CanViewCredentials); err != nil {
+		return nil, err
+	}
+	credentials, err := s.credentialRepo.ListTrashedByVaultID(ctx, vaultID)
+	if err != nil {
+		return nil, err
+	}
+	return &TrashedCredentials{Credentials: credentials, Retention: s.retentionDays()}, nil
+}
+
+// RestoreCredential takes a credential out of the trash
+func (s *TrashService) RestoreCredential(ctx context.Context, vaultID, credentialID, userID int64) (*model.Credential, error) {
+	if err := s.checkRole(ctx, vaultID, userID, model.CanDeleteCredentials); err != nil {
+		return nil, err
+	}
+	if _, err := s.getTrashedCredential(ctx, vaultID, credentialID); err != nil {
+		return nil, err
+	}
+	if err := s.credentialRepo.Restore(ctx, credentialID); err != nil {
+		return nil, err
+	}
+	return s.credentialRepo.GetByID(ctx, credentialID)
+}
+
+// DeleteCredential permanently deletes a credential in the trash
+func (s *TrashService) DeleteCredential(ctx context.Context, vaultID, credentialID, userID int64) error {
+	if err := s.checkRole(ctx, vaultID, userID, model.CanDeleteCredentials); err != nil {
+		return err
+	}
+	if _, err := s.getTrashedCredential(ctx, vaultID, credentialID); err != nil {
+		return err
+	}
+	return s.purgeCredential(ctx, credentialID)
+}
+
+// ListVaults returns the vaults in the trash the user owns
+func (s *TrashService) ListVaults(ctx context.Context, tenantID, userID int64) (*TrashedVaults, error) {
+	vaults, err := s.vaultRepo.ListTrashedByOwner(ctx, userID, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return &TrashedVaults{Vaults: vaults, Retention: s.retentionDays()}, nil
+}
+
+// getTrashedVault returns a vault in the trash the user owns
+func (s *TrashService) getTrashedVault(ctx context.Context, vaultID, userID int64) (*model.Vault, error) {
+	vault, err := s.vaultRepo.GetTrashedByOwner(ctx, vaultID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotInTrash
+		}
+		return nil, err
+	}
+	return vault, nil
+}
+
+// RestoreVault takes a vault out of the trash, with its members and
+// credentials as they were when it was deleted
+func (s *TrashService) RestoreVault(ctx context.Context, vaultID, userID int64) (*model.Vault, error) {
+	if _, err := s.getTrashedVault(ctx, vaultID, userID); err != nil {
+		return nil, err
+	}
+	if err := s.vaultRepo.Restore(ctx, vaultID); err != nil {
+		return nil, err
+	}
+	return s.vaultRepo.GetByID(ctx, vaultID)
+}
+
+// DeleteVault permanently deletes a vault in the trash
+func (s *TrashService) DeleteVault(ctx context.Context, vaultID, userID int64) error {
+	if _, err := s.getTrashedVault(ctx, vaultID, userID); err != nil {
+		return err
+	}
+	return s.purgeVault(ctx, vaultID)
+}
+
+// Purge permanently deletes every credential and vault that has been in the
+// trash for longer than the retention period. It runs as a cron job; one
+// item failing does not stop the others.
+func (s *TrashService) Purge(ctx context.Context) error {
+	cutoff := time.Now().Add(-s.retention)
+	var errs []error
+
+	credentialIDs, err := s.credentialRepo.ListTrashedBefore(ctx, cutoff)
+	if err != nil {
+		return err
+	}
+	for _, id := range credentialIDs {
+		// Items restored since they were listed are not in the trash anymore
+		if err := s.purgeCredential(ctx, id); err != nil && !errors.Is(err, ErrNotInTrash) {
+			elog.Warn("failed to purge trashed credential", elog.Int64("id", id), elog.FieldErr(err))
+			errs = append(errs, err)
+		}
+	}
+
+	vaultIDs, err := s.vaultRepo.ListTrashedBefore(ctx, cutoff)
+	if err != nil {
+		return err
+	}
+	for _, id := range vaultIDs {
+		if err := s.purgeVault(ctx, id); err != nil && !errors.Is(err, ErrNotInTrash) {
+			elog.Warn("failed to purge trashed vault", elog.Int64("id", id), elog.FieldErr(err))
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// purgeCredential deletes a credential in the trash with its custom fields,
+// revisions, attachments and every user's folder and tag assignments and
+// metadata. Attachments are listed after the credential row is locked by its
+// deletion, so no upload can slip in between.
+func (s *TrashService) purgeCredential(ctx context.Context, credentialID int64) error {
+	var attachments []model.Attachment
+	err := s.vaultRepo.Transaction(ctx, func(tx *gorm.DB) error {
+		attachmentRepo := repository.NewAttachmentRepository(tx)
+
+		deleted, err := repository.NewCredentialRepository(tx).DeletePermanently(ctx, credentialID)
+		if err != nil {
+			return err
+		}
+		if !deleted {
+			return ErrNotInTrash
+		}
+		if err := repository.NewCredentialRevisionRepository(tx).DeleteByCredentialID(ctx, credentialID); err != nil {
+			return err
+		}
+		if err := repository.NewFolderRepository(tx).DeleteByCredentialID(ctx, credentialID); err != nil {
+			return err
+		}
+		if err := repository.NewTagRepository(tx).DeleteByCredentialID(ctx, credentialID); err != nil {
+			return err
+		}
+		if err := repository.NewCredentialMetadataRepository(tx).DeleteByCredentialID(ctx, credentialID); err != nil {
+			return err
+		}
+		attachments, err = attachmentRepo.ListByCredentialID(ctx, credentialID)
+		if err != nil {
+			return err
+		}
+		return attachmentRepo.DeleteByCredentialID(ctx, credentialID)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.attachmentService.deleteBlobs(ctx, attachments)
+	return nil
+}
+
+// purgeVault deletes a vault in the trash with everything in it: members,
+// credentials (trashed or not) and their custom fields, revisions,
+// attachments, folder and tag assignments and metadata
+func (s *TrashService) purgeVault(ctx context.Context, vaultID int64) error {
+	var attachments []model.Attachment
+	err := s.vaultRepo.Transaction(ctx, func(tx *gorm.DB) error {
+		attachmentRepo := repository.NewAttachmentRepository(tx)
+
+		deleted, err := repository.NewVaultRepository(tx).DeletePermanently(ctx, vaultID)
+		if err != nil {
+			return err
+		}
+		if !deleted {
+			return ErrNotInTrash
+		}
+		// Assignments and metadata find their credentials through the vault, so
+		// they go first
+		if err := repository.NewFolderRepository(tx).DeleteByVaultID(ctx, vaultID); err != nil {
+			return err
+		}
+		if err := repository.NewTagRepository(tx).DeleteByVaultID(ctx, vaultID); err != nil {
+			return err
+		}
+		if err := repository.NewCredentialMetadataRepository(tx).DeleteByVaultID(ctx, vaultID); err != nil {
+			return err
+		}
+		if err := repository.NewCredentialRepository(tx).DeleteByVaultID(ctx, vaultID); err != nil {
+			return err
+		}
+		if err := repository.NewCredentialRevisionRepository(tx).DeleteByVaultID(ctx, vaultID); err != nil {
+			return err
+		}
+		attachments, err = attachmentRepo.ListByVaultID(ctx, vaultID)
+		if err != nil {
+			return err
+		}
+		if err := attachmentRepo.DeleteByVaultID(ctx, vaultID); err != nil {
+			return err
+		}
+		return repository.NewVaultMemberRepository(tx).DeleteByVaultID(ctx, vaultID)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.attachmentService.deleteBlobs(ctx, attachments)
+	return nil
+}
+
+func (s *TrashService) retentionDays() int {
+	return int(s.retention / (24 * time.Hour))
+}
@@ -0,0 +1,474 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gotomicro/ego/core/econf"
+	"gorm.io/gorm"
+
+	"github.com/askuy/passwordx/backend/internal/model"
+	"github.com/askuy/passwordx/backend/internal/pkg/crypto"
+	"github.com/askuy/passwordx/backend/internal/pkg/totp"
+	"github.com/askuy/passwordx/backend/internal/repository"
+)
+
+const (
+	// twoFactorIssuer is shown next to the account in authenticator apps
+	twoFactorIssuer = "PasswordX"
+	// twoFactorSkew is how many 30 second steps of clock drift are accepted
+	twoFactorSkew = 1
+	// twoFactorSecretSize is the size of generated TOTP seeds (160 bits, as RFC 4226 recommends)
+	twoFactorSecretSize = 20
+	// recoveryCodeCount is how many recovery codes a user gets at a time
+	recoveryCodeCount = 10
+	// recoveryCodeSize is the size of a recovery code in bytes (50 bits after encoding)
+	recoveryCodeSize = 5
+)
+
+var (
+	ErrTwoFactorEnabled       = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled    = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorNotEnrolling  = errors.New("start two-factor enrollment first")
+	ErrTwoFactorRequired      = errors.New("the organization requires two-factor authentication")
+	ErrInvalidTwoFactorCode   = errors.New("invalid two-factor code")
+	ErrInvalidTwoFactorConfig = errors.New("twoFactor.secretKey must be 32 base64 encoded bytes")
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Second factor methods offered at login. Recovery codes are accepted
+// wherever a TOTP code is.
+const (
+	MFAMethodTOTP     = "totp"
+	MFAMethodWebAuthn = "webauthn"
+)
+
+// TwoFactorService manages TOTP two-factor authentication and recovery codes.
+// Unlike vault data, TOTP seeds have to be readable by the server to check
+// codes; they are stored sealed with a server-side key. Security keys are
+// registered by WebAuthnService but count as a second factor here too.
+type TwoFactorService struct {
+	userRepo      *repository.UserRepository
+	tenantRepo    *repository.TenantRepository
+	twoFactorRepo *repository.TwoFactorRepository
+	webauthnRepo  *repository.WebAuthnRepository
+	secretKey     []byte
+}
+
+// NewTwoFactorService seals TOTP seeds with twoFactor.secretKey, or with a key
+// derived from the JWT secret if none is configured
+func NewTwoFactorService(userRepo *repository.UserRepository, tenantRepo *repository.TenantRepository, twoFactorRepo *repository.TwoFactorRepository, webauthnRepo *repository.WebAuthnRepository) (*TwoFactorService, error) {
+	var secretKey []byte
+	if configured := econf.GetString("twoFactor.secretKey"); configured != "" {
+		key, err := base64.StdEncoding.DecodeString(configured)
+		if err != nil || len(key) != crypto.KeySize {
+			return nil, ErrInvalidTwoFactorConfig
+		}
+		secretKey = key
+	} else {
+		mac := hmac.New(sha256.New, []byte(econf.GetString("jwt.secret")))
+		mac.Write([]byte("passwordx-two-factor"))
+		secretKey = mac.Sum(nil)
+	}
+
+	return &TwoFactorService{
+		userRepo:      userRepo,
+		tenantRepo:    tenantRepo,
+		twoFactorRepo: twoFactorRepo,
+		webauthnRepo:  webauthnRepo,
+		secretKey:     secretKey,
+	}, nil
+}
+
+// TwoFactorCodeRequest carries a TOTP code or, where accepted, a recovery code
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required,max=32"`
+}
+
+// SetTwoFactorPolicyRequest is the request body for the tenant two-factor policy
+type SetTwoFactorPolicyRequest struct {
+	Required bool `json:"required"`
+}
+
+// TwoFactorStatus describes a user's two-factor setup
+type TwoFactorStatus struct {
+	Enabled                bool  `json:"enabled"`  // TOTP is set up
+	Required               bool  `json:"required"` // the tenant requires two-factor authentication
+	SecurityKeys           int64 `json:"security_keys"`
+	RecoveryCodesRemaining int64 `json:"recovery_codes_remaining"`
+}
+
+// TwoFactorEnrollment is a new TOTP seed to add to an authenticator app
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"` // base32, for manual entry
+	URI    string `json:"uri"`    // otpauth:// URI, usually shown as a QR code
+}
+
+// RecoveryCodesResponse returns freshly generated recovery codes. They are
+// shown once; only their hashes are stored.
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// GetStatus returns the user's two-factor status
+func (s *TwoFactorService) GetStatus(ctx context.Context, userID int64) (*TwoFactorStatus, error) {
+	user, tenant, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	securityKeys, err := s.webauthnRepo.CountByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	remaining, err := s.twoFactorRepo.CountUnusedRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorStatus{
+		Enabled:                user.TwoFactorEnabled,
+		Required:               tenant.RequireTwoFactor,
+		SecurityKeys:           securityKeys,
+		RecoveryCodesRemaining: remaining,
+	}, nil
+}
+
+// Enroll starts enrollment with a new TOTP seed; it takes effect once confirmed
+func (s *TwoFactorService) Enroll(ctx context.Context, userID int64) (*TwoFactorEnrollment, error) {
+	user, _, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.beginEnrollment(ctx, user)
+}
+
+// Confirm enables two-factor authentication once the user proves their
+// authenticator produces the right codes
+func (s *TwoFactorService) Confirm(ctx context.Context, userID int64, req *TwoFactorCodeRequest) (*RecoveryCodesResponse, error) {
+	user, _, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	codes, err := s.confirmEnrollment(ctx, user, req.Code)
+	if err != nil {
+		return nil, err
+	}
+	return &RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes
+func (s *TwoFactorService) RegenerateRecoveryCodes(ctx context.Context, userID int64, req *TwoFactorCodeRequest) (*RecoveryCodesResponse, error) {
+	user, _, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	methods, err := s.methods(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if len(methods) == 0 {
+		return nil, ErrTwoFactorNotEnabled
+	}
+	if err := s.verify(ctx, user, req.Code); err != nil {
+		return nil, err
+	}
+
+	codes, err := s.newRecoveryCodes(ctx, s.twoFactorRepo, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// Disable turns TOTP off. Unless security keys remain, that turns two-factor
+// authentication off, which tenants that require it don't allow.
+func (s *TwoFactorService) Disable(ctx context.Context, userID int64, req *TwoFactorCodeRequest) error {
+	user, tenant, err := s.getUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !user.TwoFactorEnabled {
+		return ErrTwoFactorNotEnabled
+	}
+	securityKeys, err := s.webauthnRepo.CountByUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if tenant.RequireTwoFactor && securityKeys == 0 {
+		return ErrTwoFactorRequired
+	}
+	if err := s.verify(ctx, user, req.Code); err != nil {
+		return err
+	}
+	return s.clear(ctx, user, false)
+}
+
+// Reset turns a user's two-factor authentication off and removes their
+// security keys, for users who lost both their authenticators and their
+// recovery codes (admin only). Tenants that
+// require two-factor authentication make the user enroll again on next login.
+func (s *TwoFactorService) Reset(ctx context.Context, currentUser *model.User, userID int64) error {
+	if !currentUser.IsAdmin() {
+		return ErrUserNotAllowed
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	// Non-super admins can only reset users in their tenant
+	if !currentUser.IsSuperAdmin() && user.TenantID != currentUser.TenantID {
+		return ErrUserNotAllowed
+	}
+	if user.Role == model.UserRoleSuperAdmin && !currentUser.IsSuperAdmin() {
+		return ErrUserNotAllowed
+	}
+
+	return s.clear(ctx, user, true)
+}
+
+// GetPolicy returns whether the admin's tenant requires two-factor authentication
+func (s *TwoFactorService) GetPolicy(ctx context.Context, admin *model.User) (*SetTwoFactorPolicyRequest, error) {
+	tenant, err := s.tenantRepo.GetByID(ctx, admin.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	return &SetTwoFactorPolicyRequest{Required: tenant.RequireTwoFactor}, nil
+}
+
+// SetPolicy makes two-factor authentication mandatory for the admin's tenant
+func (s *TwoFactorService) SetPolicy(ctx context.Context, admin *model.User, req *SetTwoFactorPolicyRequest) error {
+	tenant, err := s.tenantRepo.GetByID(ctx, admin.TenantID)
+	if err != nil {
+		return err
+	}
+	tenant.RequireTwoFactor = req.Required
+	return s.tenantRepo.Update(ctx, tenant)
+}
+
+func (s *TwoFactorService) getUser(ctx context.Context, userID int64) (*model.User, *model.Tenant, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrUserNotFound
+		}
+		return nil, nil, err
+	}
+	tenant, err := s.tenantRepo.GetByID(ctx, user.TenantID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, tenant, nil
+}
+
+// beginEnrollment stores a new pending TOTP seed, replacing any earlier one
+func (s *TwoFactorService) beginEnrollment(ctx context.Context, user *model.User) (*TwoFactorEnrollment, error) {
+	if user.TwoFactorEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	secret := make([]byte, twoFactorSecretSize)
+	if _, err := io.ReadFull(rand.Reader, secret); err != nil {
+		return nil, err
+	}
+	sealed, err := s.sealSecret(user.ID, secret)
+	if err != nil {
+		return nil, err
+	}
+	user.TwoFactorSecret = sealed
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, err
+	}
+
+	key := totp.NewKey(secret)
+	key.Issuer = twoFactorIssuer
+	key.Account = user.Email
+	return &TwoFactorEnrollment{
+		Secret: totp.EncodeSecret(secret),
+		URI:    key.URI(),
+	}, nil
+}
+
+// confirmEnrollment checks a code from the pending seed, enables two-factor
+// authentication and returns the first set of recovery codes
+func (s *TwoFactorService) confirmEnrollment(ctx context.Context, user *model.User, code string) ([]string, error) {
+	if user.TwoFactorEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	if user.TwoFactorSecret == "" {
+		return nil, ErrTwoFactorNotEnrolling
+	}
+	if err := s.verifyTOTP(ctx, user, code); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err := s.userRepo.Transaction(ctx, func(tx *gorm.DB) error {
+		var err error
+		if codes, err = s.newRecoveryCodes(ctx, repository.NewTwoFactorRepository(tx), user.ID); err != nil {
+			return err
+		}
+		// Save would overwrite the step just recorded by verifyTOTP
+		return repository.NewUserRepository(tx).UpdateTwoFactor(ctx, user.ID, true, user.TwoFactorSecret)
+	})
+	if err != nil {
+		return nil, err
+	}
+	user.TwoFactorEnabled = true
+	return codes, nil
+}
+
+// methods returns the second factors a user has set up
+func (s *TwoFactorService) methods(ctx context.Context, user *model.User) ([]string, error) {
+	var methods []string
+	if user.TwoFactorEnabled {
+		methods = append(methods, MFAMethodTOTP)
+	}
+	securityKeys, err := s.webauthnRepo.CountByUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if securityKeys > 0 {
+		methods = append(methods, MFAMethodWebAuthn)
+	}
+	return methods, nil
+}
+
+// verify accepts a TOTP code of an enrolled user or an unused recovery code.
+// Users with only security keys have recovery codes too.
+func (s *TwoFactorService) verify(ctx context.Context, user *model.User, code string) error {
+	if isTOTPCode(code) {
+		if !user.TwoFactorEnabled {
+			return ErrInvalidTwoFactorCode
+		}
+		return s.verifyTOTP(ctx, user, code)
+	}
+
+	used, err := s.twoFactorRepo.UseRecoveryCode(ctx, user.ID, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// verifyTOTP checks a code against the user's seed. Each time step is
+// accepted once, so an observed code can't be replayed.
+func (s *TwoFactorService) verifyTOTP(ctx context.Context, user *model.User, code string) error {
+	secret, err := s.openSecret(user.ID, user.TwoFactorSecret)
+	if err != nil {
+		return err
+	}
+	step, ok := totp.NewKey(secret).Verify(strings.TrimSpace(code), time.Now(), twoFactorSkew)
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+	advanced, err := s.userRepo.AdvanceTwoFactorStep(ctx, user.ID, int64(step))
+	if err != nil {
+		return err
+	}
+	if !advanced {
+		return ErrInvalidTwoFactorCode
+	}
+	user.TwoFactorLastStep = int64(step)
+	return nil
+}
+
+// clear removes the user's seed, and optionally their security keys. The
+// recovery codes go too unless security keys remain.
+func (s *TwoFactorService) clear(ctx context.Context, user *model.User, securityKeys bool) error {
+	user.TwoFactorEnabled = false
+	user.TwoFactorSecret = ""
+	return s.userRepo.Transaction(ctx, func(tx *gorm.DB) error {
+		webauthnRepo := repository.NewWebAuthnRepository(tx)
+		if securityKeys {
+			if err := webauthnRepo.DeleteByUser(ctx, user.ID); err != nil {
+				return err
+			}
+		}
+		remaining, err := webauthnRepo.CountByUser(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		if remaining == 0 {
+			if err := repository.NewTwoFactorRepository(tx).DeleteRecoveryCodes(ctx, user.ID); err != nil {
+				return err
+			}
+		}
+		return repository.NewUserRepository(tx).UpdateTwoFactor(ctx, user.ID, false, "")
+	})
+}
+
+// newRecoveryCodes generates and stores a fresh set of recovery codes,
+// formatted as two groups of five base32 characters
+func (s *TwoFactorService) newRecoveryCodes(ctx context.Context, repo *repository.TwoFactorRepository, userID int64) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	buf := make([]byte, recoveryCodeSize)
+	for i := range codes {
+		if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+			return nil, err
+		}
+		encoded := strings.ToLower(recoveryCodeEncoding.EncodeToString(buf))
+		codes[i] = encoded[:5] + "-" + encoded[5:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	if err := repo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *TwoFactorService) sealSecret(userID int64, secret []byte) (string, error) {
+	return crypto.Encrypt(totp.EncodeSecret(secret), s.secretKey, crypto.KeyRef{ID: "two-factor", Generation: 1}, twoFactorAAD(userID))
+}
+
+func (s *TwoFactorService) openSecret(userID int64, sealed string) ([]byte, error) {
+	encoded, err := crypto.Decrypt(sealed, s.secretKey, twoFactorAAD(userID))
+	if err != nil {
+		return nil, err
+	}
+	return totp.DecodeSecret(encoded)
+}
+
+// twoFactorAAD binds a sealed seed to its user
+func twoFactorAAD(userID int64) []byte {
+	return []byte("passwordx:two-factor|user=" + strconv.FormatInt(userID, 10))
+}
+
+// isTOTPCode reports whether code looks like a TOTP code rather than a recovery code
+func isTOTPCode(code string) bool {
+	code = strings.TrimSpace(code)
+	if len(code) < totp.MinDigits || len(code) > totp.MaxDigits {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// hashRecoveryCode hashes a recovery code, ignoring case, dashes and spaces
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
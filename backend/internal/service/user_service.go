@@ -16,17 +16,24 @@ var (
 	ErrUserNotAllowed    = errors.New("user not allowed to perform this action")
 	ErrCannotModifySelf  = errors.New("cannot modify your own account")
 	ErrCannotDeleteAdmin = errors.New("cannot delete super admin")
+	ErrInvalidUserStatus = errors.New("status must be one of active, inactive or invited")
+	ErrInvalidUserRole   = errors.New("role must be one of super_admin, admin or user")
+	ErrResetDestroysData = errors.New("resetting the password makes the user's encrypted data unreadable; use escrow recovery, or set acknowledge_data_loss")
 )
 
 type UserService struct {
-	userRepo   *repository.UserRepository
-	tenantRepo *repository.TenantRepository
+	userRepo        *repository.UserRepository
+	tenantRepo      *repository.TenantRepository
+	vaultMemberRepo *repository.VaultMemberRepository
+	breachService   *BreachService
 }
 
-func NewUserService(userRepo *repository.UserRepository, tenantRepo *repository.TenantRepository) *UserService {
+func NewUserService(userRepo *repository.UserRepository, tenantRepo *repository.TenantRepository, vaultMemberRepo *repository.VaultMemberRepository, breachService *BreachService) *UserService {
 	return &UserService{
-		userRepo:   userRepo,
-		tenantRepo: tenantRepo,
+		userRepo:        userRepo,
+		tenantRepo:      tenantRepo,
+		vaultMemberRepo: vaultMemberRepo,
+		breachService:   breachService,
 	}
 }
 
@@ -48,9 +55,12 @@ type UpdateUserRequest struct {
 	AccountType string `json:"account_type"`
 }
 
-// ResetPasswordRequest is the request body for resetting a user's password
+// ResetPasswordRequest is the request body for resetting a user's password.
+// The server never sees the user's master key, so a reset cannot carry their
+// encrypted data over; AcknowledgeDataLoss confirms that it is discarded.
 type ResetPasswordRequest struct {
-	Password string `json:"password" binding:"required,min=8"`
+	Password            string `json:"password" binding:"required,min=8"`
+	AcknowledgeDataLoss bool   `json:"acknowledge_data_loss"`
 }
 
 // CreateUser creates a new user (admin only)
@@ -76,7 +86,27 @@ func (s *UserService) CreateUser(ctx context.Context, currentUser *model.User, r
 			return nil, ErrUserNotAllowed
 		}
 		tenantID = req.TenantID
-	} else {
+	}
+
+	// Passwords set by an admin must meet the tenant's policy, checked before
+	// a personal tenant is created for the user
+	if req.Password != "" {
+		var tenant *model.Tenant
+		if tenantID != 0 {
+			var err error
+			if tenant, err = s.tenantRepo.GetByID(ctx, tenantID); err != nil {
+				return nil, err
+			}
+		}
+		if err := tenantPasswordPolicy(tenant).check(req.Password, req.Email, req.Name); err != nil {
+			return nil, err
+		}
+		if err := s.breachService.check(req.Password); err != nil {
+			return nil, err
+		}
+	}
+
+	if req.AccountType == model.AccountTypePersonal {
 		// Personal accounts: create a personal tenant for them
 		tenant := &model.Tenant{
 			Name: req.Name + "'s Personal Space",
@@ -99,17 +129,9 @@ func (s *UserService) CreateUser(ctx context.Context, currentUser *model.User, r
 
 	// Determine user status
 	status := model.UserStatusInvited
-	var passwordHash string
 
-	// If password is provided, hash it and set status to active
+	// If password is provided, set status to active
 	if req.Password != "" {
-		if len(req.Password) < 8 {
-			return nil, errors.New("password must be at least 8 characters")
-		}
-		passwordHash, err = crypto.HashPasswordBcrypt(req.Password)
-		if err != nil {
-			return nil, err
-		}
 		status = model.UserStatusActive
 	}
 
@@ -135,12 +157,17 @@ func (s *UserService) CreateUser(ctx context.Context, currentUser *model.User, r
 		TenantID:      tenantID,
 		Email:         strings.ToLower(req.Email),
 		Name:          req.Name,
-		PasswordHash:  passwordHash,
 		MasterKeySalt: salt,
 		Role:          role,
 		AccountType:   req.AccountType,
 		Status:        status,
 	}
+	setUserKDFParams(user, serverDerivedKDFParams())
+	if req.Password != "" {
+		if err := setSRPVerifierFromPassword(ctx, user, req.Password); err != nil {
+			return nil, err
+		}
+	}
 
 	if err := s.userRepo.Create(ctx, user); err != nil {
 		return nil, err
@@ -149,22 +176,30 @@ func (s *UserService) CreateUser(ctx context.Context, currentUser *model.User, r
 	return user, nil
 }
 
-// ListUsers lists users based on current user's permissions
-func (s *UserService) ListUsers(ctx context.Context, currentUser *model.User, tenantID int64) ([]model.User, error) {
-	// Super admin can see all users or filter by tenant
-	if currentUser.IsSuperAdmin() {
-		if tenantID > 0 {
-			return s.userRepo.ListByTenantID(ctx, tenantID)
-		}
-		return s.userRepo.ListAll(ctx)
+// ListUsers lists a page of users based on current user's permissions and
+// returns the cursor of the next page. filter.TenantID narrows a super
+// admin's listing to one tenant.
+func (s *UserService) ListUsers(ctx context.Context, currentUser *model.User, filter *repository.UserFilter, page repository.Page) ([]model.User, string, error) {
+	if !currentUser.IsAdmin() {
+		return nil, "", ErrUserNotAllowed
 	}
-
-	// Regular admins can only see users in their tenant
-	if currentUser.IsAdmin() {
-		return s.userRepo.ListByTenantID(ctx, currentUser.TenantID)
+	switch filter.Status {
+	case "", model.UserStatusActive, model.UserStatusInactive, model.UserStatusInvited:
+	default:
+		return nil, "", ErrInvalidUserStatus
+	}
+	switch filter.Role {
+	case "", model.UserRoleSuperAdmin, model.UserRoleAdmin, model.UserRoleUser:
+	default:
+		return nil, "", ErrInvalidUserRole
 	}
 
-	return nil, ErrUserNotAllowed
+	// Super admin can see all users or filter by tenant; regular admins can
+	// only see users in their tenant
+	if !currentUser.IsSuperAdmin() {
+		filter.TenantID = currentUser.TenantID
+	}
+	return s.userRepo.List(ctx, filter, page)
 }
 
 // GetUser gets a user by ID
@@ -304,17 +339,66 @@ func (s *UserService) ResetPassword(ctx context.Context, currentUser *model.User
 		return ErrUserNotAllowed
 	}
 
-	// Hash new password
-	passwordHash, err := crypto.HashPasswordBcrypt(req.Password)
+	// Anything encrypted with the old master key is lost. Refuse unless the
+	// admin explicitly accepts that, since escrow recovery keeps the data.
+	legacy, err := s.vaultMemberRepo.CountLegacyByUserID(ctx, userID)
 	if err != nil {
 		return err
 	}
+	if (user.PublicKey != "" || legacy > 0) && !req.AcknowledgeDataLoss {
+		return ErrResetDestroysData
+	}
 
-	user.PasswordHash = passwordHash
+	tenant, err := s.tenantRepo.GetByID(ctx, user.TenantID)
+	if err != nil {
+		return err
+	}
+	if err := tenantPasswordPolicy(tenant).check(req.Password, user.Email, user.Name); err != nil {
+		return err
+	}
+	if err := s.breachService.check(req.Password); err != nil {
+		return err
+	}
+
+	salt, err := crypto.GenerateSalt()
+	if err != nil {
+		return err
+	}
+	user.MasterKeySalt = salt
+	setUserKDFParams(user, serverDerivedKDFParams())
+	// The new password replaces the SRP verifier
+	if err := setSRPVerifierFromPassword(ctx, user, req.Password); err != nil {
+		return err
+	}
+	// The keypair can no longer be unlocked; the user sets up a new one on
+	// their next login and vault admins share their vaults again. Their
+	// vault keys are revoked below and the vaults flagged for rotation.
+	user.PublicKey = ""
+	user.EncryptedPrivateKey = ""
 	// If user was invited, activate them
 	if user.Status == model.UserStatusInvited {
 		user.Status = model.UserStatusActive
 	}
 
-	return s.userRepo.Update(ctx, user)
+	return s.userRepo.Transaction(ctx, func(tx *gorm.DB) error {
+		if err := repository.NewRecoveryKeyRepository(tx).DeleteByUserID(ctx, userID); err != nil {
+			return err
+		}
+		if err := repository.NewEscrowRepository(tx).DeleteUserEscrow(ctx, userID); err != nil {
+			return err
+		}
+		// Whoever learned the old password may hold the unwrapped vault keys
+		if err := repository.NewVaultRepository(tx).SetRotationPendingByMember(ctx, userID); err != nil {
+			return err
+		}
+		if err := repository.NewVaultMemberRepository(tx).RevokeKeysByUserID(ctx, userID); err != nil {
+			return err
+		}
+		// Sessions and pending logins of the old password end with it
+		user.TokenVersion++
+		if err := repository.NewUserRepository(tx).Update(ctx, user); err != nil {
+			return err
+		}
+		return repository.NewAuthChallengeRepository(tx).DeleteByUserID(ctx, userID)
+	})
 }
@@ -15,17 +15,24 @@ var (
 	ErrVaultAccessDenied      = errors.New("vault access denied")
 	ErrPersonalVaultNoMembers = errors.New("personal vaults cannot have additional members")
 	ErrInvalidVaultRole       = errors.New("invalid vault role")
+	ErrMemberKeyMissing       = errors.New("user has not set up an encryption keypair")
+	ErrVaultKeyRequired       = errors.New("encrypted vault key is required")
+	ErrStaleKeyGeneration     = errors.New("data is encrypted with an outdated vault key generation")
+	ErrRotationIncomplete     = errors.New("rotation batch must cover every credential and member of the vault")
+	ErrRotationConflict       = errors.New("vault was modified during key rotation, please retry")
 )
 
 type VaultService struct {
 	vaultRepo       *repository.VaultRepository
 	vaultMemberRepo *repository.VaultMemberRepository
+	userRepo        *repository.UserRepository
 }
 
-func NewVaultService(vaultRepo *repository.VaultRepository, vaultMemberRepo *repository.VaultMemberRepository) *VaultService {
+func NewVaultService(vaultRepo *repository.VaultRepository, vaultMemberRepo *repository.VaultMemberRepository, userRepo *repository.UserRepository) *VaultService {
 	return &VaultService{
 		vaultRepo:       vaultRepo,
 		vaultMemberRepo: vaultMemberRepo,
+		userRepo:        userRepo,
 	}
 }
 
@@ -34,6 +41,10 @@ type CreateVaultRequest struct {
 	Description string `json:"description"`
 	Icon        string `json:"icon"`
 	IsPersonal  bool   `json:"is_personal"` // true = personal vault (only owner can see)
+	// EncryptedVaultKey is the new vault key wrapped with the creator's public key.
+	// Clients that predate vault keys omit it and get a legacy vault, whose
+	// credentials they encrypt with their master key.
+	EncryptedVaultKey string `json:"encrypted_vault_key"`
 }
 
 type UpdateVaultRequest struct {
@@ -45,16 +56,41 @@ type UpdateVaultRequest struct {
 type AddMemberRequest struct {
 	UserID int64  `json:"user_id" binding:"required"`
 	Role   string `json:"role" binding:"required,oneof=admin editor viewer"`
+	// EncryptedVaultKey is the vault key wrapped with the new member's public key.
+	// It may be omitted when only changing the role of an existing member.
+	EncryptedVaultKey string `json:"encrypted_vault_key"`
+	KeyGeneration     int    `json:"key_generation"` // generation of the wrapped key, required with encrypted_vault_key
+}
+
+// RotateVaultKeyRequest replaces the vault key in one atomic batch: every credential,
+// including those in the trash, re-encrypted under the new key and the new key
+// wrapped for every remaining member
+type RotateVaultKeyRequest struct {
+	KeyGeneration int                     `json:"key_generation" binding:"required"` // must be the current generation + 1
+	MemberKeys    []RotatedMemberKey      `json:"member_keys" binding:"required,dive"`
+	Credentials   []ReencryptedCredential `json:"credentials" binding:"dive"`
+}
+
+// RotatedMemberKey is the new vault key wrapped for one member
+type RotatedMemberKey struct {
+	UserID            int64  `json:"user_id" binding:"required"`
+	EncryptedVaultKey string `json:"encrypted_vault_key" binding:"required"`
 }
 
 // Create creates a new vault and adds the creator as owner
 func (s *VaultService) Create(ctx context.Context, tenantID, userID int64, req *CreateVaultRequest) (*model.Vault, error) {
+	if req.EncryptedVaultKey == "" && !legacyClients() {
+		return nil, ErrVaultKeyRequired
+	}
+
 	vault := &model.Vault{
 		TenantID:    tenantID,
 		Name:        req.Name,
 		Description: req.Description,
 		Icon:        req.Icon,
 		IsPersonal:  req.IsPersonal,
+		// Vault keys start at generation 1 and advance on every rotation
+		KeyGeneration: 1,
 	}
 
 	// For personal vaults, set the owner ID directly
@@ -68,9 +104,11 @@ func (s *VaultService) Create(ctx context.Context, tenantID, userID int64, req *
 
 	// Add creator as owner (for both personal and team vaults)
 	member := &model.VaultMember{
-		VaultID: vault.ID,
-		UserID:  userID,
-		Role:    model.VaultRoleOwner,
+		VaultID:           vault.ID,
+		UserID:            userID,
+		Role:              model.VaultRoleOwner,
+		EncryptedVaultKey: req.EncryptedVaultKey,
+		KeyGeneration:     vault.KeyGeneration,
 	}
 	if err := s.vaultMemberRepo.Create(ctx, member); err != nil {
 		return nil, err
@@ -109,9 +147,13 @@ func (s *VaultService) Get(ctx context.Context, vaultID, userID int64) (*model.V
 	return vault, nil
 }
 
-// List returns all vaults for a user in a tenant
-func (s *VaultService) List(ctx context.Context, tenantID, userID int64) ([]model.Vault, error) {
-	return s.vaultRepo.ListByUserID(ctx, userID, tenantID)
+// List returns a page of the vaults of a user in a tenant matching filter,
+// which may be nil, and the cursor of the next page
+func (s *VaultService) List(ctx context.Context, tenantID, userID int64, filter *repository.VaultFilter, page repository.Page) ([]model.Vault, string, error) {
+	if filter != nil && filter.Role != "" && !model.CanViewCredentials(filter.Role) {
+		return nil, "", ErrInvalidVaultRole
+	}
+	return s.vaultRepo.ListByUserID(ctx, userID, tenantID, filter, page)
 }
 
 // Update updates a vault (only admins and owners)
@@ -150,7 +192,7 @@ func (s *VaultService) Update(ctx context.Context, vaultID, userID int64, req *U
 	return vault, nil
 }
 
-// Delete deletes a vault (only owners)
+// Delete moves a vault to the trash (only owners), see TrashService
 func (s *VaultService) Delete(ctx context.Context, vaultID, userID int64) error {
 	// Check if user is owner
 	hasRole, err := s.vaultMemberRepo.HasRole(ctx, vaultID, userID, []string{model.VaultRoleOwner})
@@ -194,6 +236,11 @@ func (s *VaultService) AddMember(ctx context.Context, vaultID, userID int64, req
 		return nil, ErrVaultAccessDenied
 	}
 
+	// A supplied key must be wrapped from the current vault key
+	if req.EncryptedVaultKey != "" && req.KeyGeneration != vault.KeyGeneration {
+		return nil, ErrStaleKeyGeneration
+	}
+
 	// Check if member already exists
 	existing, err := s.vaultMemberRepo.GetByVaultAndUser(ctx, vaultID, req.UserID)
 	if err == nil && existing != nil {
@@ -201,18 +248,57 @@ func (s *VaultService) AddMember(ctx context.Context, vaultID, userID int64, req
 		if existing.Role == model.VaultRoleOwner {
 			return nil, errors.New("cannot change owner's role")
 		}
-		// Update role
+		// A downgraded member still holds the current key, so it must be rotated
+		downgraded := model.IsVaultRoleDowngrade(existing.Role, req.Role)
+
+		// Update role (and the wrapped key, if a new one was supplied)
 		existing.Role = req.Role
-		if err := s.vaultMemberRepo.Update(ctx, existing); err != nil {
+		if req.EncryptedVaultKey != "" {
+			existing.EncryptedVaultKey = req.EncryptedVaultKey
+			existing.KeyGeneration = req.KeyGeneration
+			existing.KeyRevoked = false
+		}
+		err := s.vaultRepo.Transaction(ctx, func(tx *gorm.DB) error {
+			if err := repository.NewVaultMemberRepository(tx).Update(ctx, existing); err != nil {
+				return err
+			}
+			if downgraded {
+				return repository.NewVaultRepository(tx).SetRotationPending(ctx, vaultID)
+			}
+			return nil
+		})
+		if err != nil {
 			return nil, err
 		}
 		return existing, nil
 	}
 
+	// New members must receive the vault key, otherwise they cannot decrypt anything
+	if req.EncryptedVaultKey == "" {
+		return nil, ErrVaultKeyRequired
+	}
+
+	// The target user must belong to the vault's tenant and have a keypair
+	target, err := s.userRepo.GetByID(ctx, req.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	if target.TenantID != vault.TenantID {
+		return nil, ErrUserNotFound
+	}
+	if target.PublicKey == "" {
+		return nil, ErrMemberKeyMissing
+	}
+
 	member := &model.VaultMember{
-		VaultID: vaultID,
-		UserID:  req.UserID,
-		Role:    req.Role,
+		VaultID:           vaultID,
+		UserID:            req.UserID,
+		Role:              req.Role,
+		EncryptedVaultKey: req.EncryptedVaultKey,
+		KeyGeneration:     req.KeyGeneration,
 	}
 
 	if err := s.vaultMemberRepo.Create(ctx, member); err != nil {
@@ -222,6 +308,18 @@ func (s *VaultService) AddMember(ctx context.Context, vaultID, userID int64, req
 	return member, nil
 }
 
+// GetMemberKey returns the calling user's membership, including their wrapped vault key
+func (s *VaultService) GetMemberKey(ctx context.Context, vaultID, userID int64) (*model.VaultMember, error) {
+	member, err := s.vaultMemberRepo.GetByVaultAndUser(ctx, vaultID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrVaultAccessDenied
+		}
+		return nil, err
+	}
+	return member, nil
+}
+
 // RemoveMember removes a member from a vault
 func (s *VaultService) RemoveMember(ctx context.Context, vaultID, requestingUserID, targetUserID int64) error {
 	// Check if requesting user is admin or owner
@@ -242,5 +340,141 @@ func (s *VaultService) RemoveMember(ctx context.Context, vaultID, requestingUser
 		return errors.New("cannot remove vault owner")
 	}
 
-	return s.vaultMemberRepo.Delete(ctx, vaultID, targetUserID)
+	// The removed member may still hold the vault key
+	return s.vaultRepo.Transaction(ctx, func(tx *gorm.DB) error {
+		if err := repository.NewVaultMemberRepository(tx).Delete(ctx, vaultID, targetUserID); err != nil {
+			return err
+		}
+		return repository.NewVaultRepository(tx).SetRotationPending(ctx, vaultID)
+	})
+}
+
+// RotateKey replaces the vault key (only owners). The client generates a new key,
+// re-encrypts every credential and wraps the key for every remaining member; the
+// server applies the batch in a single transaction or not at all.
+func (s *VaultService) RotateKey(ctx context.Context, vaultID, userID int64, req *RotateVaultKeyRequest) (*model.Vault, error) {
+	hasRole, err := s.vaultMemberRepo.HasRole(ctx, vaultID, userID, []string{model.VaultRoleOwner})
+	if err != nil {
+		return nil, err
+	}
+	if !hasRole {
+		return nil, ErrVaultAccessDenied
+	}
+
+	memberKeys := make(map[int64]string, len(req.MemberKeys))
+	for _, mk := range req.MemberKeys {
+		if _, dup := memberKeys[mk.UserID]; dup {
+			return nil, ErrRotationIncomplete
+		}
+		memberKeys[mk.UserID] = mk.EncryptedVaultKey
+	}
+
+	reencrypted := make(map[int64]*ReencryptedCredential, len(req.Credentials))
+	for i := range req.Credentials {
+		rc := &req.Credentials[i]
+		if _, dup := reencrypted[rc.ID]; dup {
+			return nil, ErrRotationIncomplete
+		}
+		if err := validateCiphertexts(rc.ciphertexts(), req.KeyGeneration); err != nil {
+			return nil, err
+		}
+		reencrypted[rc.ID] = rc
+	}
+
+	var vault *model.Vault
+	err = s.vaultRepo.Transaction(ctx, func(tx *gorm.DB) error {
+		vaultRepo := repository.NewVaultRepository(tx)
+		memberRepo := repository.NewVaultMemberRepository(tx)
+		credentialRepo := repository.NewCredentialRepository(tx)
+		attachmentRepo := repository.NewAttachmentRepository(tx)
+		revisionRepo := repository.NewCredentialRevisionRepository(tx)
+
+		// Locking the vault first waits for credential writes that checked
+		// the old generation, so the credentials listed below include them
+		current, err := vaultRepo.GetForUpdate(ctx, vaultID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrVaultNotFound
+			}
+			return err
+		}
+		if req.KeyGeneration != current.KeyGeneration+1 {
+			return ErrStaleKeyGeneration
+		}
+
+		// Claim the next generation first, so concurrent rotations and writes
+		// made with the old key conflict instead of interleaving
+		ok, err := vaultRepo.AdvanceKeyGeneration(ctx, vaultID, current.KeyGeneration)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrRotationConflict
+		}
+
+		members, err := memberRepo.ListByVaultID(ctx, vaultID)
+		if err != nil {
+			return err
+		}
+		wrapped := 0
+		for i := range members {
+			key, ok := memberKeys[members[i].UserID]
+			if !ok {
+				// Members whose key was revoked may not have a new keypair
+				// yet; their key is shared again with AddMember
+				if members[i].KeyRevoked {
+					continue
+				}
+				return ErrRotationIncomplete
+			}
+			wrapped++
+			members[i].EncryptedVaultKey = key
+			members[i].KeyGeneration = req.KeyGeneration
+			members[i].KeyRevoked = false
+			members[i].User = nil
+			if err := memberRepo.Update(ctx, &members[i]); err != nil {
+				return err
+			}
+		}
+		if wrapped != len(memberKeys) {
+			return ErrRotationIncomplete
+		}
+
+		// Credentials in the trash are re-encrypted too, so they can be restored
+		credentials, err := credentialRepo.ListByVaultIDWithTrash(ctx, vaultID)
+		if err != nil {
+			return err
+		}
+		if len(credentials) != len(reencrypted) {
+			return ErrRotationIncomplete
+		}
+		for i := range credentials {
+			rc, ok := reencrypted[credentials[i].ID]
+			if !ok {
+				return ErrRotationIncomplete
+			}
+			if err := rc.applyTo(&credentials[i], req.KeyGeneration); err != nil {
+				return err
+			}
+			if err := credentialRepo.Update(ctx, &credentials[i]); err != nil {
+				return err
+			}
+			for j := range credentials[i].Attachments {
+				if err := attachmentRepo.UpdateKeys(ctx, &credentials[i].Attachments[j]); err != nil {
+					return err
+				}
+			}
+			if err := reencryptRevisions(ctx, revisionRepo, credentials[i].ID, rc.Revisions, req.KeyGeneration); err != nil {
+				return err
+			}
+		}
+
+		vault, err = vaultRepo.GetByID(ctx, vaultID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return vault, nil
 }
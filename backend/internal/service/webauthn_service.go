@@ -0,0 +1,486 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gotomicro/ego/core/econf"
+	"gorm.io/gorm"
+
+	"github.com/askuy/passwordx/backend/internal/model"
+	"github.com/askuy/passwordx/backend/internal/pkg/webauthn"
+	"github.com/askuy/passwordx/backend/internal/repository"
+)
+
+const (
+	// webauthnChallengeTTL matches the time the browser gives the user
+	webauthnChallengeTTL = webauthn.Timeout * time.Millisecond
+	// defaultSecurityKeyName names keys registered without a name
+	defaultSecurityKeyName = "Security key"
+)
+
+var (
+	ErrInvalidWebAuthnConfig    = errors.New("webauthn.rpId and webauthn.origins must be set, or app.frontendUrl must be a URL")
+	ErrInvalidWebAuthnChallenge = errors.New("invalid or expired security key challenge")
+	ErrInvalidSecurityKey       = errors.New("security key verification failed")
+	ErrSecurityKeyNotFound      = errors.New("security key not found")
+	ErrSecurityKeyRegistered    = errors.New("security key is already registered")
+	ErrNoSecurityKeys           = errors.New("no security keys registered")
+)
+
+// WebAuthnService registers security keys and logs in with them, either as
+// the second factor of a pending login or, for passwordless keys, as both
+// factors at once. A passwordless login only authenticates the session; the
+// master password is still needed to unlock the vaults.
+type WebAuthnService struct {
+	userRepo         *repository.UserRepository
+	tenantRepo       *repository.TenantRepository
+	webauthnRepo     *repository.WebAuthnRepository
+	challengeRepo    *repository.AuthChallengeRepository
+	authService      *AuthService
+	twoFactorService *TwoFactorService
+	rp               *webauthn.RelyingParty
+}
+
+// NewWebAuthnService reads the relying party from the webauthn config,
+// defaulting to the host and origin of app.frontendUrl
+func NewWebAuthnService(userRepo *repository.UserRepository, tenantRepo *repository.TenantRepository, webauthnRepo *repository.WebAuthnRepository, challengeRepo *repository.AuthChallengeRepository, authService *AuthService, twoFactorService *TwoFactorService) (*WebAuthnService, error) {
+	rp, err := configuredRelyingParty()
+	if err != nil {
+		return nil, err
+	}
+	return &WebAuthnService{
+		userRepo:         userRepo,
+		tenantRepo:       tenantRepo,
+		webauthnRepo:     webauthnRepo,
+		challengeRepo:    challengeRepo,
+		authService:      authService,
+		twoFactorService: twoFactorService,
+		rp:               rp,
+	}, nil
+}
+
+func configuredRelyingParty() (*webauthn.RelyingParty, error) {
+	rp := &webauthn.RelyingParty{
+		ID:      econf.GetString("webauthn.rpId"),
+		Name:    econf.GetString("webauthn.rpName"),
+		Origins: econf.GetStringSlice("webauthn.origins"),
+	}
+	if rp.Name == "" {
+		rp.Name = twoFactorIssuer
+	}
+	if rp.ID == "" || len(rp.Origins) == 0 {
+		frontend, err := url.Parse(econf.GetString("app.frontendUrl"))
+		if err != nil || frontend.Hostname() == "" {
+			return nil, ErrInvalidWebAuthnConfig
+		}
+		if rp.ID == "" {
+			rp.ID = frontend.Hostname()
+		}
+		if len(rp.Origins) == 0 {
+			rp.Origins = []string{frontend.Scheme + "://" + frontend.Host}
+		}
+	}
+	return rp, nil
+}
+
+// BeginWebAuthnRegistrationRequest starts registering a security key.
+// Passwordless keys are stored on the authenticator with a PIN or biometric.
+type BeginWebAuthnRegistrationRequest struct {
+	Passwordless bool `json:"passwordless"`
+}
+
+// FinishWebAuthnRegistrationRequest carries the browser's response
+type FinishWebAuthnRegistrationRequest struct {
+	ChallengeID string                       `json:"challenge_id" binding:"required"`
+	Name        string                       `json:"name" binding:"max=100"`
+	Credential  webauthn.AttestationResponse `json:"credential"`
+}
+
+// BeginWebAuthnLoginRequest starts a security key login. With an MFA token it
+// is the second factor of that login, without one a passwordless login.
+type BeginWebAuthnLoginRequest struct {
+	MFAToken string `json:"mfa_token"`
+}
+
+// FinishWebAuthnLoginRequest carries the browser's response
+type FinishWebAuthnLoginRequest struct {
+	ChallengeID string                     `json:"challenge_id" binding:"required"`
+	Credential  webauthn.AssertionResponse `json:"credential"`
+}
+
+// WebAuthnCreationResponse holds the options for navigator.credentials.create
+type WebAuthnCreationResponse struct {
+	ChallengeID string                    `json:"challenge_id"`
+	PublicKey   *webauthn.CreationOptions `json:"public_key"`
+}
+
+// WebAuthnRequestResponse holds the options for navigator.credentials.get
+type WebAuthnRequestResponse struct {
+	ChallengeID string                   `json:"challenge_id"`
+	PublicKey   *webauthn.RequestOptions `json:"public_key"`
+}
+
+// WebAuthnRegistration is a registered security key. The first second factor
+// of a user comes with recovery codes, shown once.
+type WebAuthnRegistration struct {
+	Credential    *model.WebAuthnCredential `json:"credential"`
+	RecoveryCodes []string                  `json:"recovery_codes,omitempty"`
+}
+
+// webauthnChallengeState is the state of a webauthn challenge
+type webauthnChallengeState struct {
+	Challenge    []byte `json:"challenge"`
+	Passwordless bool   `json:"passwordless,omitempty"`
+	MFAToken     string `json:"mfa_token,omitempty"`
+}
+
+// BeginRegistration returns the options to create a credential for the user
+func (s *WebAuthnService) BeginRegistration(ctx context.Context, userID int64, req *BeginWebAuthnRegistrationRequest) (*WebAuthnCreationResponse, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	existing, err := s.webauthnRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	displayName := user.Name
+	if displayName == "" {
+		displayName = user.Email
+	}
+	options, err := s.rp.CreationOptions(webauthn.UserEntity{
+		ID:          userHandle(user.ID),
+		Name:        user.Email,
+		DisplayName: displayName,
+	}, descriptors(existing), req.Passwordless)
+	if err != nil {
+		return nil, err
+	}
+
+	challengeID, err := s.createChallenge(ctx, userID, model.ChallengePurposeWebAuthnRegister, &webauthnChallengeState{
+		Challenge:    options.Challenge,
+		Passwordless: req.Passwordless,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &WebAuthnCreationResponse{ChallengeID: challengeID, PublicKey: options}, nil
+}
+
+// FinishRegistration verifies the new credential and stores it
+func (s *WebAuthnService) FinishRegistration(ctx context.Context, userID int64, req *FinishWebAuthnRegistrationRequest) (*WebAuthnRegistration, error) {
+	challenge, state, err := s.consumeChallenge(ctx, req.ChallengeID, model.ChallengePurposeWebAuthnRegister)
+	if err != nil {
+		return nil, err
+	}
+	if challenge.UserID != userID {
+		return nil, ErrInvalidWebAuthnChallenge
+	}
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	verified, err := s.rp.VerifyRegistration(state.Challenge, &req.Credential, state.Passwordless)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSecurityKey, err)
+	}
+	idHash := credentialIDHash(verified.ID)
+	if _, err := s.webauthnRepo.GetByCredentialIDHash(ctx, idHash); err == nil {
+		return nil, ErrSecurityKeyRegistered
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = defaultSecurityKeyName
+	}
+	credential := &model.WebAuthnCredential{
+		UserID:           userID,
+		CredentialID:     base64.RawURLEncoding.EncodeToString(verified.ID),
+		CredentialIDHash: idHash,
+		PublicKey:        base64.StdEncoding.EncodeToString(verified.PublicKey),
+		Algorithm:        verified.Algorithm,
+		SignCount:        verified.SignCount,
+		AAGUID:           formatAAGUID(verified.AAGUID),
+		Transports:       strings.Join(verified.Transports, ","),
+		Name:             name,
+		Passwordless:     state.Passwordless,
+		BackupEligible:   verified.BackupEligible,
+	}
+
+	// Users without TOTP or recovery codes left get recovery codes, so
+	// losing the key doesn't lock them out
+	var codes []string
+	err = s.userRepo.Transaction(ctx, func(tx *gorm.DB) error {
+		if err := repository.NewWebAuthnRepository(tx).Create(ctx, credential); err != nil {
+			return err
+		}
+		if user.TwoFactorEnabled {
+			return nil
+		}
+		twoFactorRepo := repository.NewTwoFactorRepository(tx)
+		remaining, err := twoFactorRepo.CountUnusedRecoveryCodes(ctx, userID)
+		if err != nil || remaining > 0 {
+			return err
+		}
+		codes, err = s.twoFactorService.newRecoveryCodes(ctx, twoFactorRepo, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &WebAuthnRegistration{Credential: credential, RecoveryCodes: codes}, nil
+}
+
+// ListCredentials returns the user's security keys
+func (s *WebAuthnService) ListCredentials(ctx context.Context, userID int64) ([]model.WebAuthnCredential, error) {
+	return s.webauthnRepo.ListByUser(ctx, userID)
+}
+
+// DeleteCredential removes one of the user's security keys. Removing the last
+// second factor turns two-factor authentication off, which tenants that
+// require it don't allow.
+func (s *WebAuthnService) DeleteCredential(ctx context.Context, userID, id int64) error {
+	credential, err := s.webauthnRepo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSecurityKeyNotFound
+		}
+		return err
+	}
+	if credential.UserID != userID {
+		return ErrSecurityKeyNotFound
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	tenant, err := s.tenantRepo.GetByID(ctx, user.TenantID)
+	if err != nil {
+		return err
+	}
+	remaining, err := s.webauthnRepo.CountByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	lastFactor := remaining == 1 && !user.TwoFactorEnabled
+	if lastFactor && tenant.RequireTwoFactor {
+		return ErrTwoFactorRequired
+	}
+
+	return s.userRepo.Transaction(ctx, func(tx *gorm.DB) error {
+		if err := repository.NewWebAuthnRepository(tx).Delete(ctx, id); err != nil {
+			return err
+		}
+		if lastFactor {
+			return repository.NewTwoFactorRepository(tx).DeleteRecoveryCodes(ctx, userID)
+		}
+		return nil
+	})
+}
+
+// BeginLogin returns the options to sign in with a security key. Second
+// factor logins are limited to the user's keys; passwordless logins let the
+// authenticator offer any passwordless key for the site and require user
+// verification.
+func (s *WebAuthnService) BeginLogin(ctx context.Context, req *BeginWebAuthnLoginRequest) (*WebAuthnRequestResponse, error) {
+	var userID int64
+	allow := []webauthn.CredentialDescriptor{}
+	userVerification := webauthn.UserVerificationRequired
+
+	if req.MFAToken != "" {
+		_, user, err := s.authService.pendingLogin(ctx, req.MFAToken, mfaStepVerify)
+		if err != nil {
+			return nil, err
+		}
+		credentials, err := s.webauthnRepo.ListByUser(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(credentials) == 0 {
+			return nil, ErrNoSecurityKeys
+		}
+		userID = user.ID
+		allow = descriptors(credentials)
+		userVerification = webauthn.UserVerificationDiscouraged
+	}
+
+	options, err := s.rp.RequestOptions(allow, userVerification)
+	if err != nil {
+		return nil, err
+	}
+	challengeID, err := s.createChallenge(ctx, userID, model.ChallengePurposeWebAuthnLogin, &webauthnChallengeState{
+		Challenge:    options.Challenge,
+		Passwordless: req.MFAToken == "",
+		MFAToken:     req.MFAToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &WebAuthnRequestResponse{ChallengeID: challengeID, PublicKey: options}, nil
+}
+
+// FinishLogin verifies the assertion and completes the login
+func (s *WebAuthnService) FinishLogin(ctx context.Context, req *FinishWebAuthnLoginRequest) (*AuthResponse, error) {
+	challenge, state, err := s.consumeChallenge(ctx, req.ChallengeID, model.ChallengePurposeWebAuthnLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := s.webauthnRepo.GetByCredentialIDHash(ctx, credentialIDHash(req.Credential.RawID))
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if !state.Passwordless {
+		pending, user, err := s.authService.pendingLogin(ctx, state.MFAToken, mfaStepVerify)
+		if err != nil {
+			return nil, err
+		}
+		if credential == nil || credential.UserID != challenge.UserID || user.ID != challenge.UserID {
+			return nil, s.authService.mfaFailure(ctx, pending, ErrInvalidSecurityKey)
+		}
+		if err := s.verifyAssertion(ctx, credential, state, &req.Credential, false); err != nil {
+			return nil, s.authService.mfaFailure(ctx, pending, err)
+		}
+		return s.authService.finishPendingLogin(ctx, pending, user, nil)
+	}
+
+	if credential == nil || !credential.Passwordless {
+		return nil, ErrInvalidSecurityKey
+	}
+	// Authenticators return the user handle of discoverable credentials
+	if handle := req.Credential.Response.UserHandle; len(handle) > 0 && string(handle) != string(userHandle(credential.UserID)) {
+		return nil, ErrInvalidSecurityKey
+	}
+	user, err := s.userRepo.GetByID(ctx, credential.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Status != model.UserStatusActive {
+		return nil, ErrUserInactive
+	}
+	if err := s.verifyAssertion(ctx, credential, state, &req.Credential, true); err != nil {
+		return nil, err
+	}
+
+	// A verified passwordless key is two factors by itself, so tenants that
+	// require two-factor authentication are satisfied
+	tenant, err := s.tenantRepo.GetByID(ctx, user.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	return s.authService.issueSession(user, tenant)
+}
+
+// verifyAssertion checks an assertion against a stored credential and
+// advances its signature counter
+func (s *WebAuthnService) verifyAssertion(ctx context.Context, credential *model.WebAuthnCredential, state *webauthnChallengeState, resp *webauthn.AssertionResponse, requireUserVerification bool) error {
+	publicKey, err := base64.StdEncoding.DecodeString(credential.PublicKey)
+	if err != nil {
+		return err
+	}
+	assertion, err := s.rp.VerifyAssertion(state.Challenge, resp, publicKey, credential.SignCount, requireUserVerification)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSecurityKey, err)
+	}
+	updated, err := s.webauthnRepo.UpdateSignCount(ctx, credential.ID, credential.SignCount, assertion.SignCount)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return ErrInvalidSecurityKey
+	}
+	return nil
+}
+
+func (s *WebAuthnService) createChallenge(ctx context.Context, userID int64, purpose string, state *webauthnChallengeState) (string, error) {
+	id, err := newChallengeID()
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+	err = s.challengeRepo.Create(ctx, &model.AuthChallenge{
+		ID:        id,
+		UserID:    userID,
+		Purpose:   purpose,
+		Data:      string(data),
+		ExpiresAt: time.Now().Add(webauthnChallengeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (s *WebAuthnService) consumeChallenge(ctx context.Context, id, purpose string) (*model.AuthChallenge, *webauthnChallengeState, error) {
+	challenge, err := s.challengeRepo.Consume(ctx, id, purpose)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidWebAuthnChallenge
+		}
+		return nil, nil, err
+	}
+	var state webauthnChallengeState
+	if err := json.Unmarshal([]byte(challenge.Data), &state); err != nil {
+		return nil, nil, err
+	}
+	return challenge, &state, nil
+}
+
+// userHandle is the WebAuthn user ID of a user. It is opaque to the
+// authenticator and carries no personal information.
+func userHandle(userID int64) []byte {
+	return []byte(strconv.FormatInt(userID, 10))
+}
+
+// descriptors lists credentials for the browser
+func descriptors(credentials []model.WebAuthnCredential) []webauthn.CredentialDescriptor {
+	list := make([]webauthn.CredentialDescriptor, 0, len(credentials))
+	for _, c := range credentials {
+		id, err := base64.RawURLEncoding.DecodeString(c.CredentialID)
+		if err != nil {
+			continue
+		}
+		descriptor := webauthn.CredentialDescriptor{Type: "public-key", ID: id}
+		if c.Transports != "" {
+			descriptor.Transports = strings.Split(c.Transports, ",")
+		}
+		list = append(list, descriptor)
+	}
+	return list
+}
+
+func credentialIDHash(id []byte) string {
+	sum := sha256.Sum256(id)
+	return hex.EncodeToString(sum[:])
+}
+
+// formatAAGUID formats an AAGUID as a UUID
+func formatAAGUID(aaguid [16]byte) string {
+	h := hex.EncodeToString(aaguid[:])
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"github.com/askuy/passwordx/backend/cmd"
+	_ "github.com/askuy/passwordx/backend/cmd/breach"
 	_ "github.com/askuy/passwordx/backend/cmd/init"
 	_ "github.com/askuy/passwordx/backend/cmd/server"
 	"github.com/gotomicro/ego/core/elog"
@@ -1,6 +1,7 @@
 import { create } from 'zustand'
 import { persist } from 'zustand/middleware'
 import { deriveKey, decrypt, setMasterKey } from '../utils/crypto'
+import { SRPClient, deriveMasterKeyBytes, importMasterKey } from '../utils/srp'
 
 export interface Credential {
   id: number
@@ -45,10 +46,25 @@ export const useAuthStore = create<AuthState>()(
       login: async (email: string, password: string) => {
         try {
           console.log('PasswordX: Attempting login for', email)
-          const res = await fetch(`${API_BASE}/auth/login`, {
+          // SRP login: only a proof derived from the master key is sent
+          const client = new SRPClient()
+          const initRes = await fetch(`${API_BASE}/auth/srp/init`, {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
-            body: JSON.stringify({ email, password }),
+            body: JSON.stringify({ email, a: client.publicValue() }),
+          })
+          if (!initRes.ok) {
+            console.error('PasswordX: Login failed, status:', initRes.status)
+            return false
+          }
+          const challenge = await initRes.json()
+
+          const masterKey = await deriveMasterKeyBytes(password, challenge.master_key_salt, challenge)
+          const m1 = await client.proof(email, masterKey, challenge.srp_salt, challenge.b)
+          const res = await fetch(`${API_BASE}/auth/srp/verify`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ challenge_id: challenge.challenge_id, m1 }),
           })
 
           if (!res.ok) {
@@ -57,25 +73,21 @@ export const useAuthStore = create<AuthState>()(
           }
 
           const data = await res.json()
+          if (!(await client.verifyServer(data.m2))) {
+            console.error('PasswordX: Server proof mismatch')
+            return false
+          }
           console.log('PasswordX: Login successful, user:', data.user?.email)
-          
-          // Store auth but don't unlock yet - need master password
+
           set({
             isAuthenticated: true,
             token: data.token,
             user: data.user,
           })
 
-          // Derive and set master key
-          if (data.user.master_key_salt) {
-            console.log('PasswordX: Deriving master key...')
-            const key = await deriveKey(password, data.user.master_key_salt)
-            setMasterKey(key)
-            set({ isUnlocked: true })
-            console.log('PasswordX: Master key derived and vault unlocked')
-          } else {
-            console.warn('PasswordX: No master_key_salt in user data')
-          }
+          // The master key was derived for the handshake, so the vault is unlocked too
+          setMasterKey(await importMasterKey(masterKey))
+          set({ isUnlocked: true })
 
           return true
         } catch (err) {
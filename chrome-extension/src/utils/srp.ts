@@ -0,0 +1,177 @@
+// SRP-6a client (RFC 5054 2048-bit group, SHA-256), the browser half of
+// backend/internal/pkg/srp. The password input is an auth secret derived from
+// the master key, so the master password never leaves the browser.
+
+import { arrayBufferToBase64, base64ToArrayBuffer } from './crypto'
+
+const N = BigInt(
+  '0x' +
+    'AC6BDB41324A9A9BF166DE5E1389582FAF72B6651987EE07FC3192943DB56050' +
+    'A37329CBB4A099ED8193E0757767A13DD52312AB4B03310DCD7F48A9DA04FD50' +
+    'E8083969EDB767B0CF6095179A163AB3661A05FBD5FAAAE82918A9962F0B93B8' +
+    '55F97993EC975EEAA80D740ADBF4FF747359D041D5C33EA71D281E446B14773B' +
+    'CA97B43A23FB801676BD207A436C6481F1D2B9078717461A5B9D32E688F87748' +
+    '544523B524B0D57D5EA77A2775D2ECFA032CFBDBF52FB3786160279004E57AE6' +
+    'AF874E7303CE53299CCC041C7BC308D82A5698F3A8D0C38271AE35F8E9DBFBB6' +
+    '94B5C803D89F7AE435DE236D525F54759B65E372FCD68EF20FA7111F9E4AFF73'
+)
+const g = 2n
+const N_LENGTH = 256
+
+// KDF parameters as returned by /auth/prelogin and /auth/srp/init
+export interface KDFParams {
+  kdf: string
+  kdf_iterations: number
+  kdf_memory?: number
+  kdf_parallelism?: number
+}
+
+// Derive the raw master key from the master password
+export async function deriveMasterKeyBytes(password: string, saltBase64: string, params: KDFParams): Promise<Uint8Array> {
+  if (params.kdf !== 'pbkdf2-sha256') {
+    throw new Error(`Unsupported key derivation function: ${params.kdf}`)
+  }
+
+  const keyMaterial = await crypto.subtle.importKey(
+    'raw',
+    new TextEncoder().encode(password),
+    'PBKDF2',
+    false,
+    ['deriveBits']
+  )
+  const bits = await crypto.subtle.deriveBits(
+    {
+      name: 'PBKDF2',
+      salt: base64ToArrayBuffer(saltBase64),
+      iterations: params.kdf_iterations,
+      hash: 'SHA-256',
+    },
+    keyMaterial,
+    256
+  )
+  return new Uint8Array(bits)
+}
+
+// Import a raw master key for AES-GCM
+export function importMasterKey(masterKey: Uint8Array): Promise<CryptoKey> {
+  return crypto.subtle.importKey('raw', masterKey, { name: 'AES-GCM' }, false, ['encrypt', 'decrypt'])
+}
+
+// The SRP password input: HMAC-SHA256(masterKey, "passwordx-srp-auth")
+async function authSecret(masterKey: Uint8Array): Promise<Uint8Array> {
+  const key = await crypto.subtle.importKey('raw', masterKey, { name: 'HMAC', hash: 'SHA-256' }, false, ['sign'])
+  const mac = await crypto.subtle.sign('HMAC', key, new TextEncoder().encode('passwordx-srp-auth'))
+  return new Uint8Array(mac)
+}
+
+export function normalizeIdentity(email: string): string {
+  return email.trim().toLowerCase()
+}
+
+// SRPClient runs one login handshake
+export class SRPClient {
+  private readonly a: bigint
+  readonly A: bigint
+  private m1: Uint8Array | null = null
+  private key: Uint8Array | null = null
+
+  constructor() {
+    this.a = toBigInt(crypto.getRandomValues(new Uint8Array(32)))
+    this.A = modPow(g, this.a, N)
+  }
+
+  // The public value A to send to /auth/srp/init
+  publicValue(): string {
+    return arrayBufferToBase64(pad(this.A).buffer)
+  }
+
+  // Compute the client proof M1 from the challenge returned by /auth/srp/init
+  async proof(email: string, masterKey: Uint8Array, srpSaltBase64: string, serverPublicBase64: string): Promise<string> {
+    const identity = new TextEncoder().encode(normalizeIdentity(email))
+    const salt = new Uint8Array(base64ToArrayBuffer(srpSaltBase64))
+    const B = toBigInt(new Uint8Array(base64ToArrayBuffer(serverPublicBase64)))
+    if (B <= 0n || B >= N) {
+      throw new Error('Invalid SRP server value')
+    }
+    const u = toBigInt(await digest(pad(this.A), pad(B)))
+    if (u === 0n) {
+      throw new Error('Invalid SRP server value')
+    }
+
+    const secret = await authSecret(masterKey)
+    const x = toBigInt(await digest(salt, await digest(identity, new TextEncoder().encode(':'), secret)))
+    const k = toBigInt(await digest(pad(N), pad(g)))
+
+    // S = (B - k*g^x) ^ (a + u*x)
+    const base = (((B - k * modPow(g, x, N)) % N) + N) % N
+    const S = modPow(base, this.a + u * x, N)
+    this.key = await digest(pad(S))
+
+    const hn = await digest(pad(N))
+    const hg = await digest(pad(g))
+    for (let i = 0; i < hn.length; i++) {
+      hn[i] ^= hg[i]
+    }
+    this.m1 = await digest(hn, await digest(identity), salt, pad(this.A), pad(B), this.key)
+    return arrayBufferToBase64(this.m1.buffer)
+  }
+
+  // Check the server proof M2 returned by /auth/srp/verify
+  async verifyServer(serverProofBase64: string): Promise<boolean> {
+    if (!this.m1 || !this.key) {
+      return false
+    }
+    const expected = await digest(pad(this.A), this.m1, this.key)
+    const actual = new Uint8Array(base64ToArrayBuffer(serverProofBase64))
+    if (actual.length !== expected.length) {
+      return false
+    }
+    let diff = 0
+    for (let i = 0; i < expected.length; i++) {
+      diff |= expected[i] ^ actual[i]
+    }
+    return diff === 0
+  }
+}
+
+async function digest(...parts: Uint8Array[]): Promise<Uint8Array> {
+  const length = parts.reduce((n, p) => n + p.length, 0)
+  const data = new Uint8Array(length)
+  let offset = 0
+  for (const p of parts) {
+    data.set(p, offset)
+    offset += p.length
+  }
+  return new Uint8Array(await crypto.subtle.digest('SHA-256', data))
+}
+
+function modPow(base: bigint, exp: bigint, mod: bigint): bigint {
+  let result = 1n
+  base %= mod
+  while (exp > 0n) {
+    if (exp & 1n) {
+      result = (result * base) % mod
+    }
+    base = (base * base) % mod
+    exp >>= 1n
+  }
+  return result
+}
+
+function toBigInt(bytes: Uint8Array): bigint {
+  let hex = ''
+  for (const b of bytes) {
+    hex += b.toString(16).padStart(2, '0')
+  }
+  return hex ? BigInt('0x' + hex) : 0n
+}
+
+// Left-pad a group element to the byte length of N
+function pad(v: bigint): Uint8Array {
+  const hex = v.toString(16).padStart(N_LENGTH * 2, '0')
+  const out = new Uint8Array(N_LENGTH)
+  for (let i = 0; i < N_LENGTH; i++) {
+    out[i] = parseInt(hex.slice(i * 2, i * 2 + 2), 16)
+  }
+  return out
+}
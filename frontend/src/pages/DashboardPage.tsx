@@ -53,7 +53,7 @@ export default function DashboardPage() {
   const { data: allCredentials, isLoading: isSearching } = useQuery({
     queryKey: ['credentials-search'],
     queryFn: async () => {
-      const res = await credentialAPI.search('')
+      const res = await credentialAPI.search()
       return res.data.credentials as Credential[]
     },
     enabled: searchQuery.length > 0,
@@ -5,7 +5,8 @@ import { Shield, Mail, Lock, Loader2, Github } from 'lucide-react'
 import { useAuthStore } from '../stores/authStore'
 import { useSettingsStore } from '../stores/settingsStore'
 import { authAPI } from '../services/api'
-import { deriveKey, setMasterKey } from '../utils/crypto'
+import { setMasterKey } from '../utils/crypto'
+import { SRPClient, deriveMasterKeyBytes, importMasterKey } from '../utils/srp'
 
 export default function LoginPage() {
   const navigate = useNavigate()
@@ -16,15 +17,19 @@ export default function LoginPage() {
 
   const loginMutation = useMutation({
     mutationFn: async () => {
-      const res = await authAPI.login({ email, password })
-      return res.data
-    },
-    onSuccess: async (data) => {
-      // Derive master key from password
-      if (data.user.master_key_salt) {
-        const key = await deriveKey(password, data.user.master_key_salt)
-        setMasterKey(key)
+      // SRP login: only a proof derived from the master key is sent
+      const client = new SRPClient()
+      const { data: challenge } = await authAPI.srpInit({ email, a: client.publicValue() })
+      const masterKey = await deriveMasterKeyBytes(password, challenge.master_key_salt, challenge)
+      const m1 = await client.proof(email, masterKey, challenge.srp_salt, challenge.b)
+      const { data } = await authAPI.srpVerify({ challenge_id: challenge.challenge_id, m1 })
+      if (!(await client.verifyServer(data.m2))) {
+        throw new Error('Server could not prove it knows the account verifier')
       }
+      return { data, masterKey }
+    },
+    onSuccess: async ({ data, masterKey }) => {
+      setMasterKey(await importMasterKey(masterKey))
       setAuth(data.token, data.user, data.tenant)
       navigate('/dashboard')
     },
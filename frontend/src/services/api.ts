@@ -1,5 +1,6 @@
 import axios from 'axios'
 import { useAuthStore } from '../stores/authStore'
+import type { KDFParams } from '../utils/srp'
 
 const api = axios.create({
   baseURL: '/api',
@@ -47,8 +48,16 @@ export const authAPI = {
     tenant_slug: string
   }) => api.post('/auth/register', data),
 
-  login: (data: { email: string; password: string }) =>
-    api.post('/auth/login', data),
+  srpInit: (data: { email: string; a: string }) =>
+    api.post<KDFParams & {
+      challenge_id: string
+      master_key_salt: string
+      srp_salt: string
+      b: string
+    }>('/auth/srp/init', data),
+
+  srpVerify: (data: { challenge_id: string; m1: string }) =>
+    api.post('/auth/srp/verify', data),
 
   getOAuthURL: (provider: string) => `/api/auth/oauth/${provider}`,
 }
@@ -93,7 +102,7 @@ export const credentialAPI = {
   }) => api.put(`/vaults/${vaultId}/credentials/${credId}`, data),
   delete: (vaultId: number, credId: number) =>
     api.delete(`/vaults/${vaultId}/credentials/${credId}`),
-  search: (query: string) => api.get(`/credentials/search?q=${encodeURIComponent(query)}`),
+  search: () => api.get('/credentials/search'),
 }
 
 // Tenant API
@@ -122,8 +131,8 @@ export const userAPI = {
   update: (id: number, data: { name?: string; role?: string; status?: string }) =>
     api.put(`/admin/users/${id}`, data),
   delete: (id: number) => api.delete(`/admin/users/${id}`),
-  resetPassword: (id: number, password: string) =>
-    api.post(`/admin/users/${id}/reset-password`, { password }),
+  resetPassword: (id: number, password: string, acknowledgeDataLoss = false) =>
+    api.post(`/admin/users/${id}/reset-password`, { password, acknowledge_data_loss: acknowledgeDataLoss }),
 }
 
 // Current user API